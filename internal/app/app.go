@@ -2,17 +2,25 @@ package app
 
 import (
 	"context"
+	"encoding/hex"
+	"errors"
+	"fmt"
 	_ "github.com/golang-migrate/migrate/v4/database/sqlite"
 	_ "github.com/golang-migrate/migrate/v4/source/file"
 	_ "github.com/mattn/go-sqlite3"
 	"github.com/qPyth/mobydev-internship-auth/internal/config"
+	"github.com/qPyth/mobydev-internship-auth/internal/domain"
+	"github.com/qPyth/mobydev-internship-auth/internal/mailer"
 	"github.com/qPyth/mobydev-internship-auth/internal/server"
 	"github.com/qPyth/mobydev-internship-auth/internal/services"
+	"github.com/qPyth/mobydev-internship-auth/internal/storage/memory"
 	"github.com/qPyth/mobydev-internship-auth/internal/storage/sqlite"
 	"github.com/qPyth/mobydev-internship-auth/internal/transport/http"
 	"github.com/qPyth/mobydev-internship-auth/pkg/auth"
+	"github.com/qPyth/mobydev-internship-auth/pkg/policy"
 	"log/slog"
 	"os"
+	"slices"
 	"time"
 )
 
@@ -21,12 +29,107 @@ func Run(cfg *config.Config) {
 
 	storage := sqlite.New(cfg.StoragePath)
 
-	jwtSecret := os.Getenv("JWT_SECRET")
-	tokenManager := auth.NewManager(jwtSecret, cfg.TokenTTL)
+	keyring, err := loadKeyring(cfg.JWT)
+	if err != nil {
+		logger.Error("failed to load signing keys: ", "error", err.Error())
+		return
+	}
+	tokenManager, err := newTokenManager(cfg, keyring)
+	if err != nil {
+		logger.Error("failed to create token manager: ", "error", err.Error())
+		return
+	}
+
+	userService := services.NewUserService(storage, storage, storage, storage, storage, storage, storage, tokenManager, services.Config{
+		AccessTokenTTL:         cfg.TokenTTL,
+		RefreshTokenTTL:        cfg.RefreshTokenTTL,
+		SessionIdleTimeout:     cfg.Session.IdleTimeout,
+		SessionAbsoluteTimeout: cfg.Session.AbsoluteTimeout,
+		InviteOnly:             cfg.Signup.InviteOnly,
+		GroupsClaim:            cfg.JWT.GroupsClaim,
+		PersonalTokenMaxTTL:    cfg.PersonalTokens.MaxTTL,
+		EmailVerification:      cfg.EmailVerification.Policy,
+		UnverifiedScopes:       cfg.EmailVerification.UnverifiedScopes,
+	})
+
+	bgCtx, stopBackground := context.WithCancel(context.Background())
+	defer stopBackground()
+	go pruneRevokedTokens(bgCtx, logger, userService, cfg.RevocationPruneInterval)
+	if cfg.JWT.RotationPeriod > 0 {
+		logger.Warn("signing keys are rotated in memory, run a single instance", "rotation_period", cfg.JWT.RotationPeriod.String())
+		go rotateSigningKeys(bgCtx, logger, keyring, cfg.JWT.RotationPeriod)
+	}
+
+	roleService := services.NewRoleService(storage, storage)
+	bootstrapAdmins(logger, roleService, cfg.RBAC.Admins)
+
+	authzPolicy := &policy.Policy{}
+	if cfg.Authz.PolicyPath != "" {
+		authzPolicy, err = policy.Load(cfg.Authz.PolicyPath)
+		if err != nil {
+			logger.Error("failed to load authorization policy: ", "error", err.Error())
+			return
+		}
+	}
+	policyService := services.NewPolicyService(authzPolicy, storage, storage, storage, storage)
+	orgService := services.NewOrganizationService(storage)
+	groupService := services.NewGroupService(storage)
+	mailSender := newMailer(cfg.Mail, logger)
+	invitationService := services.NewInvitationService(storage, storage, storage, mailSender, services.InvitationConfig{
+		TTL:       cfg.Invitations.TTL,
+		AcceptURL: cfg.Invitations.AcceptURL,
+	})
+	accountService := services.NewAccountService(logger, storage, storage, userService, userService, mailSender, services.AccountConfig{
+		VerificationTTL:      cfg.EmailVerification.TokenTTL,
+		ResendInterval:       cfg.EmailVerification.ResendInterval,
+		VerifyURL:            cfg.EmailVerification.VerifyURL,
+		ResetTTL:             cfg.PasswordReset.TokenTTL,
+		ResetResendInterval:  cfg.PasswordReset.ResendInterval,
+		ResetURL:             cfg.PasswordReset.ResetURL,
+		ChangeTTL:            cfg.EmailChange.TokenTTL,
+		ChangeResendInterval: cfg.EmailChange.ResendInterval,
+		ChangeConfirmURL:     cfg.EmailChange.ConfirmURL,
+		UndoTTL:              cfg.EmailChange.UndoTTL,
+		UndoURL:              cfg.EmailChange.UndoURL,
+	})
+
+	clients := make([]domain.Client, 0, len(cfg.OAuth.Clients))
+	for _, client := range cfg.OAuth.Clients {
+		clients = append(clients, domain.Client{
+			ID:           client.ID,
+			Name:         client.Name,
+			SecretHash:   client.SecretHash,
+			GrantTypes:   client.GrantTypes,
+			Scopes:       client.Scopes,
+			RedirectURIs: client.RedirectURIs,
+			Exchange: domain.ExchangePolicy{
+				Audiences: client.Exchange.Audiences,
+				Scopes:    client.Exchange.Scopes,
+				TokenTTL:  client.Exchange.TokenTTL,
+			},
+		})
+	}
+	if err := checkIDTokenKey(clients, keyring.Active()); err != nil {
+		logger.Error("invalid OpenID Connect setup: ", "error", err.Error())
+		return
+	}
+	// ID tokens are JWT whatever format access tokens have
+	idTokenSigner := auth.NewManager(keyring, auth.ManagerConfig{TokenTTL: cfg.TokenTTL, Issuer: cfg.JWT.Issuer})
+	oauthService := services.NewOAuthService(memory.NewClientStorage(clients), storage, storage, storage, userService, userService, tokenManager, idTokenSigner, services.OAuthConfig{
+		Issuer:                cfg.JWT.Issuer,
+		AccessTokenTTL:        cfg.TokenTTL,
+		AuthorizationCodeTTL:  cfg.OAuth.CodeTTL,
+		ConsentURL:            cfg.OAuth.ConsentURL,
+		DeviceCodeTTL:         cfg.OAuth.DeviceCodeTTL,
+		DevicePollInterval:    cfg.OAuth.DevicePollInterval,
+		VerificationURL:       cfg.OAuth.VerificationURL,
+		UserCodeMaxAttempts:   cfg.OAuth.UserCodeMaxAttempts,
+		UserCodeAttemptWindow: cfg.OAuth.UserCodeAttemptWindow,
+	})
 
-	userService := services.NewUserService(storage, tokenManager)
+	dpopVerifier := auth.NewDPoPVerifier(cfg.DPoP.ProofMaxAge, cfg.JWT.Leeway)
 
-	h := http.NewHandler(logger, userService)
+	h := http.NewHandler(logger, userService, oauthService, roleService, policyService, orgService, groupService, invitationService, accountService, tokenManager, dpopVerifier, cfg.HTTP.ExternalURL)
 
 	srv := server.New(cfg, h.Init())
 	logger.Info("starting server on port: ", "port", cfg.Port)
@@ -40,4 +143,163 @@ func Run(cfg *config.Config) {
 	if err := srv.Stop(ctx); err != nil {
 		logger.Error("failed to stop server: ", "error", err.Error())
 	}
+	// password reset emails are sent in background
+	accountService.Wait()
+}
+
+// newMailer returns SMTP sender, or sender which only logs emails if SMTP server is not configured
+func newMailer(cfg config.Mail, logger *slog.Logger) services.Mailer {
+	if cfg.SMTPHost == "" {
+		return mailer.NewLogSender(logger, cfg.LogBody)
+	}
+	return mailer.NewSMTPSender(cfg.SMTPHost, cfg.SMTPPort, cfg.Username, cfg.Password, cfg.From)
+}
+
+// bootstrapAdmins assigns the admin role to users with emails, not yet registered users are skipped
+func bootstrapAdmins(logger *slog.Logger, roleService *services.RoleService, emails []string) {
+	for _, email := range emails {
+		err := roleService.AssignRoleByEmail(context.Background(), email, "admin")
+		if err != nil {
+			if errors.Is(err, domain.ErrUserNotFound) {
+				logger.Warn("admin user is not registered: ", "email", email)
+				continue
+			}
+			logger.Error("failed to assign admin role: ", "email", email, "error", err.Error())
+		}
+	}
+}
+
+// pruneRevokedTokens periodically deletes revocation entries of expired tokens until ctx is done
+func pruneRevokedTokens(ctx context.Context, logger *slog.Logger, userService *services.UserService, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			pruned, err := userService.PruneRevokedTokens(ctx)
+			if err != nil {
+				logger.Error("failed to prune revoked tokens: ", "error", err.Error())
+				continue
+			}
+			logger.Debug("pruned revoked tokens", "count", pruned)
+		}
+	}
+}
+
+type tokenManager interface {
+	auth.TokenManager
+	JWKS() auth.JWKS
+}
+
+// newTokenManager creates token manager for the configured token format
+func newTokenManager(cfg *config.Config, keyring *auth.Keyring) (tokenManager, error) {
+	managerCfg := auth.ManagerConfig{
+		TokenTTL: cfg.TokenTTL,
+		Issuer:   cfg.JWT.Issuer,
+		Audience: cfg.JWT.Audience,
+		Leeway:   cfg.JWT.Leeway,
+	}
+	switch cfg.TokenFormat {
+	case "", "jwt":
+		return auth.NewManager(keyring, managerCfg), nil
+	case "paseto." + auth.PasetoV4Public:
+		return auth.NewPasetoPublicManager(keyring, managerCfg)
+	case "paseto." + auth.PasetoV4Local:
+		key, err := hex.DecodeString(os.Getenv("PASETO_LOCAL_KEY"))
+		if err != nil {
+			return nil, fmt.Errorf("PASETO_LOCAL_KEY: %w", err)
+		}
+		return auth.NewPasetoLocalManager(key, managerCfg)
+	default:
+		return nil, fmt.Errorf("unknown token format %q", cfg.TokenFormat)
+	}
+}
+
+// rotateSigningKeys periodically replaces the active signing key with a generated one of the same type until ctx is done.
+// Generated keys live only in this process, tokens signed by them are rejected by other instances and after restart
+func rotateSigningKeys(ctx context.Context, logger *slog.Logger, keyring *auth.Keyring, period time.Duration) {
+	ticker := time.NewTicker(period)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			key, err := auth.GenerateSigningKey(keyring.Active().Method)
+			if err == nil {
+				err = keyring.Rotate(key)
+			}
+			if err != nil {
+				logger.Error("failed to rotate signing key: ", "error", err.Error())
+				continue
+			}
+			logger.Info("signing key rotated", "kid", key.ID)
+		}
+	}
+}
+
+// loadKeyring loads the active signing key and previous verification keys which retire after the retirement period
+func loadKeyring(cfg config.JWT) (*auth.Keyring, error) {
+	active, err := loadSigningKey(cfg)
+	if err != nil {
+		return nil, err
+	}
+	keyring := auth.NewKeyring(active, cfg.RetirementPeriod)
+
+	retiresAt := time.Now().Add(cfg.RetirementPeriod)
+	for _, keyCfg := range cfg.PreviousKeys {
+		var key *auth.SigningKey
+		switch {
+		case keyCfg.PublicKeyPath != "":
+			key, err = auth.LoadPublicKeyFile(keyCfg.KeyID, keyCfg.PublicKeyPath)
+			if err != nil {
+				return nil, err
+			}
+		case keyCfg.SecretEnv != "" && keyCfg.KeyID != "":
+			secret := os.Getenv(keyCfg.SecretEnv)
+			if secret == "" {
+				return nil, fmt.Errorf("previous key %q: %s is not set", keyCfg.KeyID, keyCfg.SecretEnv)
+			}
+			key = auth.NewHMACKey(keyCfg.KeyID, []byte(secret))
+		default:
+			return nil, fmt.Errorf("previous key %q: public_key_path or key_id with secret_env must be set", keyCfg.KeyID)
+		}
+		if err := keyring.AddVerificationKey(key, retiresAt); err != nil {
+			return nil, err
+		}
+	}
+	return keyring, nil
+}
+
+// loadSigningKey loads private key from PEM file or falls back to HS256 with JWT_SECRET
+func loadSigningKey(cfg config.JWT) (*auth.SigningKey, error) {
+	if cfg.PrivateKeyPath != "" {
+		return auth.LoadPrivateKeyFile(cfg.KeyID, cfg.PrivateKeyPath)
+	}
+
+	jwtSecret := os.Getenv("JWT_SECRET")
+	if jwtSecret == "" {
+		return nil, errors.New("JWT_SECRET is not set and jwt.private_key_path is empty")
+	}
+	keyID := cfg.KeyID
+	if keyID == "" {
+		keyID = "default"
+	}
+	return auth.NewHMACKey(keyID, []byte(jwtSecret)), nil
+}
+
+// checkIDTokenKey fails if a client may request the openid scope while the active key is symmetric,
+// relying parties can not verify ID tokens signed with a secret they do not have
+func checkIDTokenKey(clients []domain.Client, active *auth.SigningKey) error {
+	if !active.Symmetric() {
+		return nil
+	}
+	for _, client := range clients {
+		if slices.Contains(client.Scopes, domain.ScopeOpenID) {
+			return fmt.Errorf("client %q has the openid scope, set jwt.private_key_path to an asymmetric key to sign ID tokens", client.ID)
+		}
+	}
+	return nil
 }
@@ -12,14 +12,198 @@ import (
 type Config struct {
 	StoragePath string        `yaml:"storage_path"`
 	TokenTTL    time.Duration `yaml:"token_ttl"`
+	// TokenFormat is a format of access tokens: jwt, paseto.v4.public (signed with Ed25519 jwt key)
+	// or paseto.v4.local (encrypted with hex encoded 32 bytes PASETO_LOCAL_KEY)
+	TokenFormat     string        `yaml:"token_format" env-default:"jwt"`
+	RefreshTokenTTL time.Duration `yaml:"refresh_token_ttl" env-default:"720h"`
+	// RevocationPruneInterval is how often revocation entries of expired tokens are deleted
+	RevocationPruneInterval time.Duration `yaml:"revocation_prune_interval" env-default:"1h"`
+	JWT                     `yaml:"jwt"`
+	Session                 `yaml:"session"`
+	OAuth                   `yaml:"oauth"`
+	DPoP                    `yaml:"dpop"`
+	RBAC                    `yaml:"rbac"`
+	Authz                   `yaml:"authz"`
+	Signup                  `yaml:"signup"`
+	EmailVerification       `yaml:"email_verification"`
+	PasswordReset           `yaml:"password_reset"`
+	EmailChange             `yaml:"email_change"`
+	Invitations             `yaml:"invitations"`
+	Mail                    `yaml:"mail"`
+	PersonalTokens          `yaml:"personal_tokens"`
 	HTTP
 }
 
+type Signup struct {
+	// InviteOnly disables self registration, accounts are created only by accepting invitations
+	InviteOnly bool `yaml:"invite_only"`
+}
+
+type EmailVerification struct {
+	// Policy restricts users with not verified email: sign_in rejects their sign in, scopes limits permissions
+	// of their tokens to unverified_scopes. Nothing is restricted if empty
+	Policy           string   `yaml:"policy"`
+	UnverifiedScopes []string `yaml:"unverified_scopes"`
+	// TokenTTL is lifetime of verification links
+	TokenTTL time.Duration `yaml:"token_ttl" env-default:"24h"`
+	// ResendInterval is the minimal time between two verification emails to the user
+	ResendInterval time.Duration `yaml:"resend_interval" env-default:"1m"`
+	// VerifyURL is the page of the client which verifies email, the token is added as token query param
+	VerifyURL string `yaml:"verify_url"`
+}
+
+type PasswordReset struct {
+	// TokenTTL is lifetime of password reset links
+	TokenTTL time.Duration `yaml:"token_ttl" env-default:"1h"`
+	// ResendInterval is the minimal time between two password reset emails to the user
+	ResendInterval time.Duration `yaml:"resend_interval" env-default:"1m"`
+	// ResetURL is the page of the client which sets a new password, the token is added as token query param
+	ResetURL string `yaml:"reset_url"`
+}
+
+type EmailChange struct {
+	// TokenTTL is lifetime of links confirming the new email
+	TokenTTL time.Duration `yaml:"token_ttl" env-default:"24h"`
+	// ResendInterval is the minimal time between two email change requests of the user
+	ResendInterval time.Duration `yaml:"resend_interval" env-default:"1m"`
+	// ConfirmURL is the page of the client which confirms the new email, the token is added as token query param
+	ConfirmURL string `yaml:"confirm_url"`
+	// UndoTTL is lifetime of links restoring the previous email
+	UndoTTL time.Duration `yaml:"undo_ttl" env-default:"168h"`
+	// UndoURL is the page of the client which restores the previous email, the token is added as token query param
+	UndoURL string `yaml:"undo_url"`
+}
+
+type PersonalTokens struct {
+	// MaxTTL limits lifetime of personal access tokens and is used when no expiration is requested,
+	// 0 allows tokens without expiration
+	MaxTTL time.Duration `yaml:"max_ttl" env-default:"8760h"`
+}
+
+type Invitations struct {
+	TTL time.Duration `yaml:"ttl" env-default:"168h"`
+	// AcceptURL is the page of the client which accepts invitation, the token is added as token query param
+	AcceptURL string `yaml:"accept_url"`
+}
+
+type Mail struct {
+	// SMTPHost is the SMTP server address, emails are only logged if it is empty
+	SMTPHost string `yaml:"smtp_host"`
+	SMTPPort int    `yaml:"smtp_port" env-default:"587"`
+	Username string `yaml:"username"`
+	Password string `yaml:"-" env:"SMTP_PASSWORD"`
+	From     string `yaml:"from"`
+	// LogBody writes bodies of not sent emails to the log at debug level if SMTP is not configured. The bodies
+	// contain live links, it is meant only for development
+	LogBody bool `yaml:"log_body"`
+}
+
+type Authz struct {
+	// PolicyPath is a path to the YAML policy file, every request is denied if it is empty
+	PolicyPath string `yaml:"policy_path"`
+}
+
+type RBAC struct {
+	// Admins are emails of users who are assigned the admin role on start
+	Admins []string `yaml:"admins"`
+}
+
+type DPoP struct {
+	// ProofMaxAge is how long after iat DPoP proofs are accepted, used jti are remembered for this period
+	ProofMaxAge time.Duration `yaml:"proof_max_age" env-default:"5m"`
+}
+
+type OAuth struct {
+	Clients []Client `yaml:"clients"`
+	// ConsentURL is the page GET /oauth/authorize redirects to, it signs the user in and approves the request
+	// with POST /oauth/authorize
+	ConsentURL string `yaml:"consent_url"`
+	// CodeTTL is lifetime of authorization codes
+	CodeTTL time.Duration `yaml:"code_ttl" env-default:"1m"`
+	// VerificationURL is the page where users enter the user code shown by a device and approve it
+	// with POST /oauth/device
+	VerificationURL string `yaml:"verification_url"`
+	// DeviceCodeTTL is lifetime of device codes
+	DeviceCodeTTL time.Duration `yaml:"device_code_ttl" env-default:"10m"`
+	// DevicePollInterval is the minimal time devices wait between token requests
+	DevicePollInterval time.Duration `yaml:"device_poll_interval" env-default:"5s"`
+	// UserCodeMaxAttempts limits wrong user codes a user can enter per UserCodeAttemptWindow, 0 disables the limit
+	UserCodeMaxAttempts   int           `yaml:"user_code_max_attempts" env-default:"5"`
+	UserCodeAttemptWindow time.Duration `yaml:"user_code_attempt_window" env-default:"1m"`
+}
+
+type Client struct {
+	ID   string `yaml:"id"`
+	Name string `yaml:"name"`
+	// SecretHash is bcrypt hash of the client secret, for example from `htpasswd -bnBC 10 "" secret`.
+	// Clients without secret are public, e.g. SPAs, and can use only the authorization code grant with PKCE
+	SecretHash string `yaml:"secret_hash"`
+	// GrantTypes are grant types the client may use at POST /oauth/token, e.g. client_credentials
+	GrantTypes []string `yaml:"grant_types"`
+	// Scopes are permissions the client may request
+	Scopes []string `yaml:"scopes"`
+	// RedirectURIs are allowed redirect URIs of the authorization code flow
+	RedirectURIs []string `yaml:"redirect_uris"`
+	// Exchange is the policy of the token exchange grant, the client can not exchange tokens without audiences
+	Exchange Exchange `yaml:"exchange"`
+}
+
+type Exchange struct {
+	// Audiences are services the client may request tokens for
+	Audiences []string `yaml:"audiences"`
+	// Scopes are permissions of the user exchanged tokens may keep
+	Scopes []string `yaml:"scopes"`
+	// TokenTTL is lifetime of exchanged tokens, token_ttl if not set
+	TokenTTL time.Duration `yaml:"token_ttl"`
+}
+
+type JWT struct {
+	// PrivateKeyPath is a path to PEM encoded RSA, ECDSA or Ed25519 private key used to sign tokens.
+	// If empty, tokens are signed with HS256 using JWT_SECRET
+	PrivateKeyPath string `yaml:"private_key_path"`
+	// KeyID is put to the kid header of tokens, defaults to the key thumbprint
+	KeyID string `yaml:"key_id"`
+	// Issuer is put to the iss claim of tokens, tokens with another issuer are rejected
+	Issuer string `yaml:"issuer" env-required:"true"`
+	// Audience is put to the aud claim of tokens, tokens for none of these audiences are rejected.
+	// If empty, tokens with aud claim, e.g. issued by token exchange for other services, are rejected
+	Audience []string `yaml:"audience"`
+	// Leeway is the allowed clock skew when validating exp, nbf and iat claims
+	Leeway time.Duration `yaml:"leeway" env-default:"30s"`
+	// PreviousKeys are accepted only for verification of tokens signed before rotation until retirement period passes
+	PreviousKeys []VerificationKey `yaml:"previous_keys"`
+	// RotationPeriod is how often a new signing key is generated in memory, 0 disables automatic rotation.
+	// Generated keys are not stored or shared, so it requires a single instance
+	RotationPeriod time.Duration `yaml:"rotation_period"`
+	// RetirementPeriod is how long replaced keys are accepted for verification, should be not less than token_ttl
+	RetirementPeriod time.Duration `yaml:"retirement_period" env-default:"4h"`
+	// GroupsClaim puts names of the groups of the user in the active organization to the groups claim
+	GroupsClaim bool `yaml:"groups_claim"`
+}
+
+type VerificationKey struct {
+	KeyID string `yaml:"key_id"`
+	// PublicKeyPath is a path to PEM encoded public key of asymmetric key
+	PublicKeyPath string `yaml:"public_key_path"`
+	// SecretEnv is a name of env variable with the previous HS256 secret
+	SecretEnv string `yaml:"secret_env"`
+}
+
+type Session struct {
+	// IdleTimeout ends session if it was not used for this duration
+	IdleTimeout time.Duration `yaml:"idle_timeout" env-default:"168h"`
+	// AbsoluteTimeout ends session after this duration since sign in regardless of activity
+	AbsoluteTimeout time.Duration `yaml:"absolute_timeout" env-default:"720h"`
+}
+
 type HTTP struct {
 	Host         string        `yaml:"host"`
 	Port         string        `yaml:"port"`
 	ReadTimeOut  time.Duration `yaml:"read_timeout"`
 	WriteTimeOut time.Duration `yaml:"write_timeout"`
+	// ExternalURL is the URL clients reach the service at, e.g. behind a TLS terminating proxy. Request URLs
+	// compared with htu of DPoP proofs are built from it, or from the host and TLS of the request if empty
+	ExternalURL string `yaml:"external_url"`
 }
 
 // Load load config, panic if has error
@@ -44,5 +228,10 @@ func Load() *Config {
 	if err != nil {
 		panic(err)
 	}
+	switch cfg.EmailVerification.Policy {
+	case "", "sign_in", "scopes":
+	default:
+		panic("unknown email_verification.policy: " + cfg.EmailVerification.Policy)
+	}
 	return &cfg
 }
@@ -0,0 +1,34 @@
+package domain
+
+import "time"
+
+const (
+	// AccountTokenEmailVerification confirms that the user owns the email
+	AccountTokenEmailVerification = "email_verification"
+	// AccountTokenPasswordReset allows to set a new password without the current one
+	AccountTokenPasswordReset = "password_reset"
+	// AccountTokenEmailChange confirms the new email of the user, the token is sent to the new address
+	AccountTokenEmailChange = "email_change"
+	// AccountTokenEmailChangeUndo restores the previous email of the user, the token is sent to the previous address
+	AccountTokenEmailChangeUndo = "email_change_undo"
+)
+
+// AccountToken is a single-use token sent by email to confirm an action on the account, only its hash is stored
+type AccountToken struct {
+	ID      uint
+	UserID  uint
+	Purpose string
+	// Email is the address the token was sent to
+	Email string
+	// SessionID is the session which requested the action, empty if it was not requested by the user
+	SessionID string
+	TokenHash string
+	CreatedAt time.Time
+	ExpiresAt time.Time
+	UsedAt    *time.Time
+}
+
+// Valid reports whether token is neither used nor expired
+func (t AccountToken) Valid(now time.Time) bool {
+	return t.UsedAt == nil && now.Before(t.ExpiresAt)
+}
@@ -0,0 +1,49 @@
+package domain
+
+import "time"
+
+const (
+	DeviceCodePending  = "pending"
+	DeviceCodeApproved = "approved"
+	DeviceCodeDenied   = "denied"
+)
+
+// DeviceCode is a pending authorization of a device which can not open a browser (RFC 8628). The user enters
+// the user code on another device and approves it, while the device polls the token endpoint with the device code
+type DeviceCode struct {
+	DeviceCodeHash string
+	// UserCode is stored without separators in upper case
+	UserCode string
+	ClientID string
+	Scopes   []string
+	// Status is DeviceCodePending until the user approves or denies the request
+	Status string
+	// UserID and OrgID are set by the user who approved the request
+	UserID uint
+	OrgID  uint
+	// Interval is the minimal time between polls, it grows if the device polls too often
+	Interval     time.Duration
+	LastPolledAt *time.Time
+	CreatedAt    time.Time
+	ExpiresAt    time.Time
+	UsedAt       *time.Time
+}
+
+// DeviceAuthorization is a response of the device authorization endpoint (RFC 8628 section 3.2)
+type DeviceAuthorization struct {
+	DeviceCode              string `json:"device_code"`
+	UserCode                string `json:"user_code"`
+	VerificationURI         string `json:"verification_uri"`
+	VerificationURIComplete string `json:"verification_uri_complete"`
+	ExpiresIn               int64  `json:"expires_in"`
+	Interval                int64  `json:"interval"`
+}
+
+// DeviceVerification describes the device authorization request shown to the user before approval
+type DeviceVerification struct {
+	UserCode   string    `json:"user_code"`
+	ClientID   string    `json:"client_id"`
+	ClientName string    `json:"client_name"`
+	Scopes     []string  `json:"scopes"`
+	ExpiresAt  time.Time `json:"expires_at"`
+}
@@ -3,7 +3,49 @@ package domain
 import "errors"
 
 var (
-	ErrEmailExists        = errors.New("user with email already exists")
-	ErrUserNotFound       = errors.New("user not found")
-	ErrInvalidCredentials = errors.New("invalid credentials")
+	ErrEmailExists         = errors.New("user with email already exists")
+	ErrUserNotFound        = errors.New("user not found")
+	ErrInvalidCredentials  = errors.New("invalid credentials")
+	ErrInvalidRefreshToken = errors.New("invalid refresh token")
+	ErrRefreshTokenReused  = errors.New("refresh token reused")
+	ErrTokenRevoked        = errors.New("token revoked")
+	ErrSessionNotFound     = errors.New("session not found")
+	ErrSessionExpired      = errors.New("session expired")
+	ErrInvalidToken        = errors.New("invalid token")
+	ErrInvalidClient       = errors.New("invalid client")
+	ErrInvalidDPoPProof    = errors.New("invalid DPoP proof")
+	ErrRoleNotFound        = errors.New("role not found")
+	ErrOrgNotFound         = errors.New("organization not found")
+	ErrOrgExists           = errors.New("organization with slug already exists")
+	ErrNotOrgMember        = errors.New("user is not a member of the organization")
+	ErrNoActiveOrg         = errors.New("no active organization")
+	ErrAlreadyMember       = errors.New("user is already a member of the organization")
+	ErrLastOrgAdmin        = errors.New("organization must keep at least one org_admin")
+	ErrInvitationNotFound  = errors.New("invitation not found")
+	ErrInvalidInvitation   = errors.New("invalid or expired invitation")
+	ErrSignUpDisabled      = errors.New("sign up is available only by invitation")
+	ErrPasswordRequired    = errors.New("password is required to create account")
+	ErrGroupNotFound       = errors.New("group not found")
+	ErrGroupExists         = errors.New("group with name already exists")
+	ErrGroupCycle          = errors.New("group can not contain itself")
+	ErrTokenNotFound       = errors.New("token not found")
+	ErrInvalidScope        = errors.New("scope exceeds permissions of the user")
+	ErrInvalidExpiration   = errors.New("token expiration exceeds the allowed maximum")
+	ErrSessionRequired     = errors.New("action requires a signed in session")
+	ErrUnauthorizedClient  = errors.New("client is not allowed to use the grant type")
+	ErrScopeNotAllowed     = errors.New("requested scope is not allowed for the client")
+	ErrInvalidRedirectURI  = errors.New("redirect uri is not registered for the client")
+	ErrInvalidAuthRequest  = errors.New("invalid authorization request")
+	ErrInvalidGrant        = errors.New("invalid, expired or used authorization grant")
+	ErrDeviceCodeNotFound  = errors.New("user code is invalid or expired")
+	ErrAuthPending         = errors.New("authorization is pending")
+	ErrSlowDown            = errors.New("polling too frequently")
+	ErrAccessDenied        = errors.New("user denied the authorization request")
+	ErrExpiredToken        = errors.New("device code expired")
+	ErrInvalidExchange     = errors.New("invalid token exchange request")
+	ErrInvalidTarget       = errors.New("requested audience is not allowed for the client")
+	ErrEmailNotVerified    = errors.New("email is not verified")
+	ErrEmailUpdate         = errors.New("email is changed only by a confirmed email change")
+	ErrInvalidAccountToken = errors.New("invalid, expired or used token")
+	ErrTooManyRequests     = errors.New("too many requests, try again later")
 )
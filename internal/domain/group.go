@@ -0,0 +1,16 @@
+package domain
+
+import "time"
+
+// Group is a set of organization members and other groups of the same organization. Members of a group
+// are transitively members of its parent groups and have organization roles of all of them
+type Group struct {
+	ID        uint      `json:"id"`
+	OrgID     uint      `json:"org_id"`
+	Name      string    `json:"name"`
+	CreatedAt time.Time `json:"created_at"`
+	// Roles, Members and Groups are direct roles, members and child groups, they are filled only for a single group
+	Roles   []string     `json:"roles,omitempty"`
+	Members []Membership `json:"members,omitempty"`
+	Groups  []Group      `json:"groups,omitempty"`
+}
@@ -0,0 +1,22 @@
+package domain
+
+import "time"
+
+// Invitation invites a person by email to join organization with pre-assigned organization roles
+type Invitation struct {
+	ID         uint       `json:"id"`
+	OrgID      uint       `json:"org_id"`
+	Email      string     `json:"email"`
+	Roles      []string   `json:"roles"`
+	TokenHash  string     `json:"-"`
+	InvitedBy  uint       `json:"invited_by"`
+	CreatedAt  time.Time  `json:"created_at"`
+	ExpiresAt  time.Time  `json:"expires_at"`
+	AcceptedAt *time.Time `json:"-"`
+	RevokedAt  *time.Time `json:"-"`
+}
+
+// Pending reports whether invitation can still be accepted
+func (i Invitation) Pending(now time.Time) bool {
+	return i.AcceptedAt == nil && i.RevokedAt == nil && now.Before(i.ExpiresAt)
+}
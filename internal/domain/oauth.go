@@ -0,0 +1,186 @@
+package domain
+
+import "time"
+
+const (
+	GrantTypeClientCredentials = "client_credentials"
+	GrantTypeAuthorizationCode = "authorization_code"
+	GrantTypeRefreshToken      = "refresh_token"
+	GrantTypeDeviceCode        = "urn:ietf:params:oauth:grant-type:device_code"
+	GrantTypeTokenExchange     = "urn:ietf:params:oauth:grant-type:token-exchange"
+)
+
+// TokenTypeAccessToken identifies access tokens in token exchange requests and responses (RFC 8693 section 3)
+const TokenTypeAccessToken = "urn:ietf:params:oauth:token-type:access_token"
+
+// OpenID Connect scopes, they are requested like permissions but grant access to the user profile
+const (
+	ScopeOpenID  = "openid"
+	ScopeProfile = "profile"
+	ScopeEmail   = "email"
+	ScopePhone   = "phone"
+)
+
+// OIDCScopes are scopes of OpenID Connect, they are not permissions
+var OIDCScopes = []string{ScopeOpenID, ScopeProfile, ScopeEmail, ScopePhone}
+
+// Client is a registered OAuth 2.0 client
+type Client struct {
+	ID   string
+	Name string
+	// SecretHash is bcrypt hash of the client secret
+	SecretHash string
+	// GrantTypes are grant types the client may use at the token endpoint
+	GrantTypes []string
+	// Scopes are permissions the client may request, tokens can not be granted other scopes
+	Scopes []string
+	// RedirectURIs are allowed redirect URIs of the authorization code flow, compared exactly
+	RedirectURIs []string
+	// Exchange limits tokens the client can get by token exchange
+	Exchange ExchangePolicy
+}
+
+// ExchangePolicy defines which tokens a client can get by token exchange on behalf of users
+type ExchangePolicy struct {
+	// Audiences are services the client may request tokens for
+	Audiences []string
+	// Scopes are permissions exchanged tokens may keep, other permissions of the subject token are dropped
+	Scopes []string
+	// TokenTTL is lifetime of exchanged tokens, they never outlive the subject token
+	TokenTTL time.Duration
+}
+
+// AllowsGrant reports whether client may use the grant type
+func (c Client) AllowsGrant(grantType string) bool {
+	for _, g := range c.GrantTypes {
+		if g == grantType {
+			return true
+		}
+	}
+	return false
+}
+
+// AuthorizationRequest is a request of the authorization endpoint (RFC 6749 section 4.1.1) with PKCE (RFC 7636)
+// and OpenID Connect nonce
+type AuthorizationRequest struct {
+	ResponseType        string `json:"response_type"`
+	ClientID            string `json:"client_id"`
+	RedirectURI         string `json:"redirect_uri"`
+	Scope               string `json:"scope"`
+	State               string `json:"state"`
+	CodeChallenge       string `json:"code_challenge"`
+	CodeChallengeMethod string `json:"code_challenge_method"`
+	// Nonce is put to the ID token if openid scope is requested
+	Nonce string `json:"nonce"`
+}
+
+// TokenExchangeRequest is a token exchange request of the token endpoint (RFC 8693 section 2.1)
+type TokenExchangeRequest struct {
+	SubjectToken       string
+	SubjectTokenType   string
+	RequestedTokenType string
+	// Audience is the service the token is requested for
+	Audience string
+	// Scope is a space separated list of requested permissions
+	Scope string
+}
+
+// AuthorizationCode is a short-lived single-use code the client exchanges for tokens
+type AuthorizationCode struct {
+	CodeHash      string
+	ClientID      string
+	UserID        uint
+	OrgID         uint
+	RedirectURI   string
+	Scopes        []string
+	CodeChallenge string
+	Nonce         string
+	CreatedAt     time.Time
+	ExpiresAt     time.Time
+	UsedAt        *time.Time
+}
+
+// Consent records scopes the user allowed the client to access
+type Consent struct {
+	UserID    uint      `json:"-"`
+	ClientID  string    `json:"client_id"`
+	Scopes    []string  `json:"scopes"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// Authorization is the result of authorization request approved by the user
+type Authorization struct {
+	// RedirectURI is the client redirect URI with code and state params, or with error if access was denied
+	RedirectURI string `json:"redirect_uri,omitempty"`
+	// ConsentRequired is set if the user has to approve the scopes for the client
+	ConsentRequired bool     `json:"consent_required,omitempty"`
+	ClientName      string   `json:"client_name,omitempty"`
+	Scopes          []string `json:"scopes,omitempty"`
+}
+
+// TokenResponse is a successful response of the token endpoint (RFC 6749 section 5.1)
+type TokenResponse struct {
+	AccessToken  string `json:"access_token"`
+	TokenType    string `json:"token_type"`
+	ExpiresIn    int64  `json:"expires_in"`
+	RefreshToken string `json:"refresh_token,omitempty"`
+	Scope        string `json:"scope,omitempty"`
+	// IDToken is issued if openid scope was granted
+	IDToken string `json:"id_token,omitempty"`
+	// IssuedTokenType is set for token exchange responses
+	IssuedTokenType string `json:"issued_token_type,omitempty"`
+}
+
+// UserInfo holds OpenID Connect standard claims of the user, claims are set only for granted scopes
+type UserInfo struct {
+	Sub           string `json:"sub"`
+	Name          string `json:"name,omitempty"`
+	Email         string `json:"email,omitempty"`
+	EmailVerified *bool  `json:"email_verified,omitempty"`
+	PhoneNumber   string `json:"phone_number,omitempty"`
+	// Birthdate is in YYYY-MM-DD format
+	Birthdate string `json:"birthdate,omitempty"`
+}
+
+// OpenIDConfiguration is the OpenID Provider metadata served by the discovery endpoint (OpenID Connect Discovery 1.0)
+type OpenIDConfiguration struct {
+	Issuer                            string   `json:"issuer"`
+	AuthorizationEndpoint             string   `json:"authorization_endpoint"`
+	TokenEndpoint                     string   `json:"token_endpoint"`
+	UserInfoEndpoint                  string   `json:"userinfo_endpoint"`
+	JWKSURI                           string   `json:"jwks_uri"`
+	IntrospectionEndpoint             string   `json:"introspection_endpoint"`
+	DeviceAuthorizationEndpoint       string   `json:"device_authorization_endpoint"`
+	ScopesSupported                   []string `json:"scopes_supported"`
+	ResponseTypesSupported            []string `json:"response_types_supported"`
+	GrantTypesSupported               []string `json:"grant_types_supported"`
+	SubjectTypesSupported             []string `json:"subject_types_supported"`
+	IDTokenSigningAlgValuesSupported  []string `json:"id_token_signing_alg_values_supported"`
+	TokenEndpointAuthMethodsSupported []string `json:"token_endpoint_auth_methods_supported"`
+	CodeChallengeMethodsSupported     []string `json:"code_challenge_methods_supported"`
+	ClaimsSupported                   []string `json:"claims_supported"`
+}
+
+// Introspection is a token introspection response (RFC 7662)
+type Introspection struct {
+	Active    bool     `json:"active"`
+	Scope     string   `json:"scope,omitempty"`
+	ClientID  string   `json:"client_id,omitempty"`
+	TokenType string   `json:"token_type,omitempty"`
+	Exp       int64    `json:"exp,omitempty"`
+	Iat       int64    `json:"iat,omitempty"`
+	Nbf       int64    `json:"nbf,omitempty"`
+	Sub       string   `json:"sub,omitempty"`
+	Aud       []string `json:"aud,omitempty"`
+	Iss       string   `json:"iss,omitempty"`
+	Jti       string   `json:"jti,omitempty"`
+	SessionID string   `json:"sid,omitempty"`
+	OrgID     uint     `json:"org_id,omitempty"`
+	// Cnf contains thumbprint of the DPoP key the token is bound to
+	Cnf *Confirmation `json:"cnf,omitempty"`
+}
+
+type Confirmation struct {
+	JKT string `json:"jkt"`
+}
@@ -0,0 +1,27 @@
+package domain
+
+import "time"
+
+const (
+	RoleScopeGlobal = "global"
+	RoleScopeOrg    = "org"
+)
+
+// Organization is a customer company (tenant) users are members of
+type Organization struct {
+	ID        uint      `json:"id"`
+	Name      string    `json:"name"`
+	Slug      string    `json:"slug"`
+	CreatedAt time.Time `json:"created_at"`
+	// Roles are names of the roles the user from context has in the organization
+	Roles []string `json:"roles,omitempty"`
+}
+
+// Membership is a user in an organization with roles in it
+type Membership struct {
+	OrgID     uint      `json:"org_id"`
+	UserID    uint      `json:"user_id"`
+	Email     string    `json:"email"`
+	Roles     []string  `json:"roles"`
+	CreatedAt time.Time `json:"created_at"`
+}
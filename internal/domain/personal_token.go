@@ -0,0 +1,25 @@
+package domain
+
+import "time"
+
+// PersonalToken is a long-lived token the user creates to call APIs without signing in, e.g. from scripts.
+// Only hash of the token is stored, Hint is its beginning to recognize it in the list
+type PersonalToken struct {
+	ID     uint   `json:"id"`
+	UserID uint   `json:"-"`
+	Name   string `json:"name"`
+	Hint   string `json:"hint"`
+	// OrgID is the organization the token acts in, 0 if none
+	OrgID      uint       `json:"org_id,omitempty"`
+	Scopes     []string   `json:"scopes"`
+	TokenHash  string     `json:"-"`
+	CreatedAt  time.Time  `json:"created_at"`
+	ExpiresAt  *time.Time `json:"expires_at"`
+	LastUsedAt *time.Time `json:"last_used_at"`
+	RevokedAt  *time.Time `json:"-"`
+}
+
+// Active reports whether token is neither revoked nor expired
+func (t PersonalToken) Active(now time.Time) bool {
+	return t.RevokedAt == nil && (t.ExpiresAt == nil || now.Before(*t.ExpiresAt))
+}
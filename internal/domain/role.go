@@ -0,0 +1,11 @@
+package domain
+
+// Role is a named set of permissions assigned to users
+type Role struct {
+	ID          uint   `json:"-"`
+	Name        string `json:"name"`
+	Description string `json:"description"`
+	// Scope is RoleScopeGlobal for roles assigned platform wide or RoleScopeOrg for roles within organizations
+	Scope       string   `json:"scope"`
+	Permissions []string `json:"permissions"`
+}
@@ -0,0 +1,46 @@
+package domain
+
+import "time"
+
+type Session struct {
+	ID         string     `json:"id"`
+	UserID     uint       `json:"-"`
+	Device     string     `json:"device"`
+	UserAgent  string     `json:"user_agent"`
+	IP         string     `json:"ip"`
+	CreatedAt  time.Time  `json:"created_at"`
+	LastSeenAt time.Time  `json:"last_seen_at"`
+	ExpiresAt  time.Time  `json:"expires_at"`
+	RevokedAt  *time.Time `json:"-"`
+	Current    bool       `json:"current"`
+	// OrgID is the active organization of the session, 0 if none
+	OrgID uint `json:"org_id,omitempty"`
+	// DPoPJKT is thumbprint of the DPoP key tokens of the session are bound to, empty for bearer tokens
+	DPoPJKT string `json:"-"`
+	// ClientID is the OAuth client the session was authorized for, empty for sessions started by sign in
+	ClientID string `json:"client_id,omitempty"`
+	// Scopes limit permissions of tokens of client sessions
+	Scopes []string `json:"scopes,omitempty"`
+}
+
+// SessionMeta describes the client that signs in
+type SessionMeta struct {
+	Device    string
+	UserAgent string
+	IP        string
+	// DPoPJKT is thumbprint of the key from verified DPoP proof of the sign in request
+	DPoPJKT string
+	// OrgID is the initial active organization of the session
+	OrgID uint
+	// ClientID and Scopes are set for sessions authorized for an OAuth client
+	ClientID string
+	Scopes   []string
+}
+
+// Active reports whether session is neither revoked nor expired by absolute or idle timeout
+func (s Session) Active(now time.Time, idleTimeout time.Duration) bool {
+	if s.RevokedAt != nil || !now.Before(s.ExpiresAt) {
+		return false
+	}
+	return idleTimeout <= 0 || now.Before(s.LastSeenAt.Add(idleTimeout))
+}
@@ -0,0 +1,21 @@
+package domain
+
+import "time"
+
+type Tokens struct {
+	AccessToken  string
+	RefreshToken string
+	// Scope is the scope claim of the access token
+	Scope string
+}
+
+type RefreshToken struct {
+	ID        uint
+	UserID    uint
+	FamilyID  string
+	TokenHash string
+	ExpiresAt time.Time
+	UsedAt    *time.Time
+	RevokedAt *time.Time
+	CreatedAt time.Time
+}
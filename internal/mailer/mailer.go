@@ -0,0 +1,77 @@
+package mailer
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"mime"
+	"net"
+	"net/smtp"
+	"strconv"
+	"strings"
+)
+
+// Message is a plain text email
+type Message struct {
+	To      string
+	Subject string
+	Body    string
+}
+
+// SMTPSender sends emails through SMTP server
+type SMTPSender struct {
+	addr string
+	from string
+	auth smtp.Auth
+}
+
+// NewSMTPSender creates a new SMTP sender, PLAIN authentication is used if username is not empty
+func NewSMTPSender(host string, port int, username, password, from string) *SMTPSender {
+	s := &SMTPSender{addr: net.JoinHostPort(host, strconv.Itoa(port)), from: from}
+	if username != "" {
+		s.auth = smtp.PlainAuth("", username, password, host)
+	}
+	return s
+}
+
+// ErrInvalidHeader is returned when the recipient contains line breaks, they would start new headers
+var ErrInvalidHeader = errors.New("mailer: recipient contains line breaks")
+
+func (s *SMTPSender) Send(_ context.Context, msg Message) error {
+	if strings.ContainsAny(msg.To, "\r\n") {
+		return ErrInvalidHeader
+	}
+	var b strings.Builder
+	b.WriteString("From: " + s.from + "\r\n")
+	b.WriteString("To: " + msg.To + "\r\n")
+	// subject may contain user input like organization names, encoding also escapes line breaks
+	b.WriteString("Subject: " + mime.QEncoding.Encode("UTF-8", msg.Subject) + "\r\n")
+	b.WriteString("MIME-Version: 1.0\r\n")
+	b.WriteString("Content-Type: text/plain; charset=UTF-8\r\n\r\n")
+	b.WriteString(strings.ReplaceAll(msg.Body, "\n", "\r\n"))
+
+	if err := smtp.SendMail(s.addr, s.auth, s.from, []string{msg.To}, []byte(b.String())); err != nil {
+		return fmt.Errorf("smtp.SendMail: %w", err)
+	}
+	return nil
+}
+
+// LogSender writes emails to the log instead of sending them, it is used when SMTP is not configured.
+// Bodies hold links with tokens, they are logged at debug level only if logBody is set
+type LogSender struct {
+	log     *slog.Logger
+	logBody bool
+}
+
+func NewLogSender(log *slog.Logger, logBody bool) *LogSender {
+	return &LogSender{log: log, logBody: logBody}
+}
+
+func (s *LogSender) Send(_ context.Context, msg Message) error {
+	s.log.Info("email is not sent, SMTP is not configured: ", "to", msg.To, "subject", msg.Subject)
+	if s.logBody {
+		s.log.Debug("body of not sent email: ", "to", msg.To, "body", msg.Body)
+	}
+	return nil
+}
@@ -0,0 +1,429 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/qPyth/mobydev-internship-auth/internal/domain"
+	"github.com/qPyth/mobydev-internship-auth/internal/mailer"
+	"github.com/qPyth/mobydev-internship-auth/pkg/auth"
+	"golang.org/x/crypto/bcrypt"
+	"log/slog"
+	"net/url"
+	"sync"
+	"time"
+)
+
+// AccountService confirms actions on accounts by single-use links sent by email
+type AccountService struct {
+	log                 *slog.Logger
+	userStorage         UserStorage
+	accountTokenStorage AccountTokenStorage
+	passwordResetter    PasswordResetter
+	tokenRevoker        TokenRevoker
+	mailer              Mailer
+	cfg                 AccountConfig
+	// sending tracks emails sent in background
+	sending sync.WaitGroup
+}
+
+type AccountConfig struct {
+	// VerificationTTL is lifetime of email verification links
+	VerificationTTL time.Duration
+	// ResendInterval is the minimal time between two verification emails to the user
+	ResendInterval time.Duration
+	// VerifyURL is the page which verifies email, the token is added as token query param
+	VerifyURL string
+	// ResetTTL is lifetime of password reset links
+	ResetTTL time.Duration
+	// ResetResendInterval is the minimal time between two password reset emails to the user
+	ResetResendInterval time.Duration
+	// ResetURL is the page which sets a new password, the token is added as token query param
+	ResetURL string
+	// ChangeTTL is lifetime of links confirming a new email
+	ChangeTTL time.Duration
+	// ChangeResendInterval is the minimal time between two email change requests of the user
+	ChangeResendInterval time.Duration
+	// ChangeConfirmURL is the page which confirms a new email, the token is added as token query param
+	ChangeConfirmURL string
+	// UndoTTL is lifetime of links restoring the previous email
+	UndoTTL time.Duration
+	// UndoURL is the page which restores the previous email, the token is added as token query param
+	UndoURL string
+}
+
+type AccountTokenStorage interface {
+	CreateAccountToken(ctx context.Context, token *domain.AccountToken) error
+	GetAccountToken(ctx context.Context, tokenHash, purpose string) (domain.AccountToken, error)
+	LatestAccountToken(ctx context.Context, userID uint, purpose string) (domain.AccountToken, error)
+	UseAccountToken(ctx context.Context, id uint, usedAt time.Time) error
+	UseLaterAccountTokens(ctx context.Context, userID uint, purpose string, afterID uint, usedAt time.Time) error
+	DeleteAccountToken(ctx context.Context, id uint) error
+}
+
+// PasswordResetter sets a new password of the user and ends all sessions of the user
+type PasswordResetter interface {
+	ResetPassword(ctx context.Context, userID uint, password string) error
+}
+
+// TokenRevoker signs the user out everywhere or everywhere except one session
+type TokenRevoker interface {
+	RevokeAllTokens(ctx context.Context, userID uint) error
+	RevokeOtherSessions(ctx context.Context, userID uint, keepID string) error
+}
+
+// NewAccountService creates a new account service
+func NewAccountService(log *slog.Logger, userStorage UserStorage, accountTokenStorage AccountTokenStorage, passwordResetter PasswordResetter, tokenRevoker TokenRevoker, mailer Mailer, cfg AccountConfig) *AccountService {
+	return &AccountService{
+		log:                 log,
+		userStorage:         userStorage,
+		accountTokenStorage: accountTokenStorage,
+		passwordResetter:    passwordResetter,
+		tokenRevoker:        tokenRevoker,
+		mailer:              mailer,
+		cfg:                 cfg,
+	}
+}
+
+// SendVerification emails a link which verifies email of the user. To not reveal whether the email is registered
+// it returns nil when there is no such user, the email is already verified or a link was sent less than resend
+// interval ago, nothing is sent then
+func (a *AccountService) SendVerification(ctx context.Context, email string) error {
+	op := "AccountService.SendVerification"
+	user, err := a.userStorage.GetUser(ctx, email)
+	if err != nil {
+		if errors.Is(err, domain.ErrUserNotFound) {
+			return nil
+		}
+		return fmt.Errorf("%s: userStorage.GetUser: %w", op, err)
+	}
+	if user.EmailVerified {
+		return nil
+	}
+
+	token, accountToken, err := a.newAccountToken(ctx, user.ID, "", domain.AccountTokenEmailVerification, user.Email, a.cfg.VerificationTTL, a.cfg.ResendInterval)
+	if err != nil {
+		if errors.Is(err, domain.ErrTooManyRequests) {
+			return nil
+		}
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	err = a.send(ctx, mailer.Message{
+		To:      user.Email,
+		Subject: "Verify your email",
+		Body: fmt.Sprintf("Confirm that this is your email: %s\n\nThe link expires at %s.\n",
+			tokenLink(a.cfg.VerifyURL, token), accountToken.ExpiresAt.UTC().Format(time.RFC1123)),
+	}, accountToken)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	return nil
+}
+
+// VerifyEmail marks email of the user as verified by token from the verification link.
+// Returns domain.ErrInvalidAccountToken if token is unknown, expired, used or the user has changed the email since
+func (a *AccountService) VerifyEmail(ctx context.Context, token string) error {
+	op := "AccountService.VerifyEmail"
+	accountToken, err := a.useAccountToken(ctx, token, domain.AccountTokenEmailVerification)
+	if err != nil {
+		if errors.Is(err, domain.ErrInvalidAccountToken) {
+			return err
+		}
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	if err := a.userStorage.SetEmailVerified(ctx, accountToken.UserID, accountToken.Email); err != nil {
+		if errors.Is(err, domain.ErrUserNotFound) {
+			return domain.ErrInvalidAccountToken
+		}
+		return fmt.Errorf("%s: userStorage.SetEmailVerified: %w", op, err)
+	}
+	return nil
+}
+
+// ForgotPassword emails a link which allows to set a new password. To not reveal whether the email is registered
+// it returns nil when there is no such user or a link was sent less than resend interval ago, nothing is sent then.
+// The email is sent in background, see Wait
+func (a *AccountService) ForgotPassword(ctx context.Context, email string) error {
+	op := "AccountService.ForgotPassword"
+	user, err := a.userStorage.GetUser(ctx, email)
+	if err != nil {
+		if errors.Is(err, domain.ErrUserNotFound) {
+			return nil
+		}
+		return fmt.Errorf("%s: userStorage.GetUser: %w", op, err)
+	}
+
+	token, accountToken, err := a.newAccountToken(ctx, user.ID, "", domain.AccountTokenPasswordReset, user.Email, a.cfg.ResetTTL, a.cfg.ResetResendInterval)
+	if err != nil {
+		if errors.Is(err, domain.ErrTooManyRequests) {
+			return nil
+		}
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	// the email is sent in background, otherwise the response would take longer for registered emails
+	a.sendInBackground(ctx, mailer.Message{
+		To:      user.Email,
+		Subject: "Reset your password",
+		Body: fmt.Sprintf("Set a new password: %s\n\nThe link expires at %s. If you did not ask to reset the password, ignore this email.\n",
+			tokenLink(a.cfg.ResetURL, token), accountToken.ExpiresAt.UTC().Format(time.RFC1123)),
+	}, accountToken)
+	return nil
+}
+
+// ResetPassword sets a new password of the user by token from the reset link and signs the user out everywhere.
+// The email is verified too as the link was received by it. Returns domain.ErrInvalidAccountToken if token is unknown,
+// expired, used or the user has changed the email since
+func (a *AccountService) ResetPassword(ctx context.Context, token, password string) error {
+	op := "AccountService.ResetPassword"
+	accountToken, err := a.useAccountToken(ctx, token, domain.AccountTokenPasswordReset)
+	if err != nil {
+		if errors.Is(err, domain.ErrInvalidAccountToken) {
+			return err
+		}
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	if err := a.userStorage.SetEmailVerified(ctx, accountToken.UserID, accountToken.Email); err != nil {
+		if errors.Is(err, domain.ErrUserNotFound) {
+			return domain.ErrInvalidAccountToken
+		}
+		return fmt.Errorf("%s: userStorage.SetEmailVerified: %w", op, err)
+	}
+	if err := a.passwordResetter.ResetPassword(ctx, accountToken.UserID, password); err != nil {
+		if errors.Is(err, domain.ErrUserNotFound) {
+			return domain.ErrInvalidAccountToken
+		}
+		return fmt.Errorf("%s: passwordResetter.ResetPassword: %w", op, err)
+	}
+	return nil
+}
+
+// RequestEmailChange starts changing email of the user from context if the current password is correct. The email
+// is changed only after confirmation by the link sent to the new address, the previous address gets a notification
+// with a link which undoes the change. Returns domain.ErrInvalidCredentials if current password is wrong,
+// domain.ErrSessionRequired if called with a personal access token, domain.ErrEmailExists if another user
+// has such email and domain.ErrTooManyRequests if a change was requested less than resend interval ago
+func (a *AccountService) RequestEmailChange(ctx context.Context, email, currentPassword string) error {
+	op := "AccountService.RequestEmailChange"
+	claims, ok := auth.ClaimsFromContext(ctx)
+	if !ok {
+		return fmt.Errorf("token claims not found in context")
+	}
+	if claims.SessionID == "" {
+		return domain.ErrSessionRequired
+	}
+	userID, err := claims.UserID()
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	user, err := a.userStorage.GetUserByID(ctx, userID)
+	if err != nil {
+		return fmt.Errorf("%s: userStorage.GetUserByID: %w", op, err)
+	}
+	if err := bcrypt.CompareHashAndPassword([]byte(user.HashPass), []byte(currentPassword)); err != nil {
+		return domain.ErrInvalidCredentials
+	}
+	if user.Email == email {
+		return nil
+	}
+	_, err = a.userStorage.GetUser(ctx, email)
+	switch {
+	case err == nil:
+		return domain.ErrEmailExists
+	case !errors.Is(err, domain.ErrUserNotFound):
+		return fmt.Errorf("%s: userStorage.GetUser: %w", op, err)
+	}
+
+	token, accountToken, err := a.newAccountToken(ctx, user.ID, claims.SessionID, domain.AccountTokenEmailChange, email, a.cfg.ChangeTTL, a.cfg.ChangeResendInterval)
+	if err != nil {
+		if errors.Is(err, domain.ErrTooManyRequests) {
+			return err
+		}
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	undoToken, undoAccountToken, err := a.newAccountToken(ctx, user.ID, "", domain.AccountTokenEmailChangeUndo, user.Email, a.cfg.UndoTTL, 0)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	err = a.send(ctx, mailer.Message{
+		To:      email,
+		Subject: "Confirm your new email",
+		Body: fmt.Sprintf("Confirm that this is your new email: %s\n\nThe link expires at %s.\n",
+			tokenLink(a.cfg.ChangeConfirmURL, token), accountToken.ExpiresAt.UTC().Format(time.RFC1123)),
+	}, accountToken, undoAccountToken)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	err = a.send(ctx, mailer.Message{
+		To:      user.Email,
+		Subject: "Your email is being changed",
+		Body: fmt.Sprintf("A change of your account email to %s was requested.\n\nIf it was not you, keep this email "+
+			"and sign out all sessions: %s\n\nThen reset your password.\n", email, tokenLink(a.cfg.UndoURL, undoToken)),
+	}, accountToken, undoAccountToken)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	return nil
+}
+
+// ConfirmEmailChange sets the new email of the user by token from the confirmation link and revokes every session
+// of the user except the one which requested the change. Returns domain.ErrInvalidAccountToken if token is unknown, expired or used
+// and domain.ErrEmailExists if another user has taken the email since
+func (a *AccountService) ConfirmEmailChange(ctx context.Context, token string) error {
+	op := "AccountService.ConfirmEmailChange"
+	accountToken, err := a.useAccountToken(ctx, token, domain.AccountTokenEmailChange)
+	if err != nil {
+		if errors.Is(err, domain.ErrInvalidAccountToken) {
+			return err
+		}
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	if err := a.userStorage.UpdateEmail(ctx, accountToken.UserID, accountToken.Email); err != nil {
+		if errors.Is(err, domain.ErrEmailExists) {
+			return err
+		}
+		if errors.Is(err, domain.ErrUserNotFound) {
+			return domain.ErrInvalidAccountToken
+		}
+		return fmt.Errorf("%s: userStorage.UpdateEmail: %w", op, err)
+	}
+	if err := a.tokenRevoker.RevokeOtherSessions(ctx, accountToken.UserID, accountToken.SessionID); err != nil {
+		return fmt.Errorf("%s: tokenRevoker.RevokeOtherSessions: %w", op, err)
+	}
+	return nil
+}
+
+// UndoEmailChange restores the previous email of the user by token from the notification, cancels the change if it
+// is not confirmed yet and revokes every session and token of the user. Undo links of later changes stop working,
+// so they can not set the email back. Returns domain.ErrInvalidAccountToken
+// if token is unknown, expired or used and domain.ErrEmailExists if another user has taken the previous email since
+func (a *AccountService) UndoEmailChange(ctx context.Context, token string) error {
+	op := "AccountService.UndoEmailChange"
+	accountToken, err := a.useAccountToken(ctx, token, domain.AccountTokenEmailChangeUndo)
+	if err != nil {
+		if errors.Is(err, domain.ErrInvalidAccountToken) {
+			return err
+		}
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	pending, err := a.accountTokenStorage.LatestAccountToken(ctx, accountToken.UserID, domain.AccountTokenEmailChange)
+	switch {
+	case err == nil:
+		err = a.accountTokenStorage.UseAccountToken(ctx, pending.ID, time.Now())
+		if err != nil && !errors.Is(err, domain.ErrInvalidAccountToken) {
+			return fmt.Errorf("%s: accountTokenStorage.UseAccountToken: %w", op, err)
+		}
+	case !errors.Is(err, domain.ErrTokenNotFound):
+		return fmt.Errorf("%s: accountTokenStorage.LatestAccountToken: %w", op, err)
+	}
+	err = a.accountTokenStorage.UseLaterAccountTokens(ctx, accountToken.UserID, domain.AccountTokenEmailChangeUndo, accountToken.ID, time.Now())
+	if err != nil {
+		return fmt.Errorf("%s: accountTokenStorage.UseLaterAccountTokens: %w", op, err)
+	}
+
+	if err := a.userStorage.UpdateEmail(ctx, accountToken.UserID, accountToken.Email); err != nil {
+		if errors.Is(err, domain.ErrEmailExists) {
+			return err
+		}
+		if errors.Is(err, domain.ErrUserNotFound) {
+			return domain.ErrInvalidAccountToken
+		}
+		return fmt.Errorf("%s: userStorage.UpdateEmail: %w", op, err)
+	}
+	if err := a.tokenRevoker.RevokeAllTokens(ctx, accountToken.UserID); err != nil {
+		return fmt.Errorf("%s: tokenRevoker.RevokeAllTokens: %w", op, err)
+	}
+	return nil
+}
+
+// Wait blocks until emails sent in background are sent
+func (a *AccountService) Wait() {
+	a.sending.Wait()
+}
+
+// sendInBackground sends the email like send without waiting for it, failures are logged
+func (a *AccountService) sendInBackground(ctx context.Context, msg mailer.Message, tokens ...domain.AccountToken) {
+	a.sending.Add(1)
+	go func() {
+		defer a.sending.Done()
+		if err := a.send(context.WithoutCancel(ctx), msg, tokens...); err != nil {
+			a.log.Error("failed to send email: ", "subject", msg.Subject, "error", err.Error())
+		}
+	}()
+}
+
+// send sends the email with links of the tokens. The tokens are deleted if it could not be sent, so the user
+// can ask for a new email without waiting for the resend interval
+func (a *AccountService) send(ctx context.Context, msg mailer.Message, tokens ...domain.AccountToken) error {
+	err := a.mailer.Send(ctx, msg)
+	if err == nil {
+		return nil
+	}
+	for _, token := range tokens {
+		if delErr := a.accountTokenStorage.DeleteAccountToken(ctx, token.ID); delErr != nil {
+			return fmt.Errorf("mailer.Send: %w, accountTokenStorage.DeleteAccountToken: %w", err, delErr)
+		}
+	}
+	return fmt.Errorf("mailer.Send: %w", err)
+}
+
+// newAccountToken creates a token of the user for the purpose which replaces the previous one, sessionID is
+// the session which requested it. Returns domain.ErrTooManyRequests if the previous token was created less than
+// resendInterval ago
+func (a *AccountService) newAccountToken(ctx context.Context, userID uint, sessionID, purpose, email string, ttl, resendInterval time.Duration) (string, domain.AccountToken, error) {
+	now := time.Now()
+	latest, err := a.accountTokenStorage.LatestAccountToken(ctx, userID, purpose)
+	switch {
+	case err == nil && now.Before(latest.CreatedAt.Add(resendInterval)):
+		return "", domain.AccountToken{}, domain.ErrTooManyRequests
+	case err != nil && !errors.Is(err, domain.ErrTokenNotFound):
+		return "", domain.AccountToken{}, fmt.Errorf("accountTokenStorage.LatestAccountToken: %w", err)
+	}
+
+	token, err := auth.RandomString(32)
+	if err != nil {
+		return "", domain.AccountToken{}, fmt.Errorf("auth.RandomString: %w", err)
+	}
+	accountToken := domain.AccountToken{
+		UserID:    userID,
+		Purpose:   purpose,
+		Email:     email,
+		SessionID: sessionID,
+		TokenHash: auth.HashToken(token),
+		CreatedAt: now,
+		ExpiresAt: now.Add(ttl),
+	}
+	if err := a.accountTokenStorage.CreateAccountToken(ctx, &accountToken); err != nil {
+		return "", domain.AccountToken{}, fmt.Errorf("accountTokenStorage.CreateAccountToken: %w", err)
+	}
+	return token, accountToken, nil
+}
+
+// useAccountToken marks valid token for the purpose as used and returns it.
+// Returns domain.ErrInvalidAccountToken if token is unknown, expired or already used
+func (a *AccountService) useAccountToken(ctx context.Context, token, purpose string) (domain.AccountToken, error) {
+	now := time.Now()
+	accountToken, err := a.accountTokenStorage.GetAccountToken(ctx, auth.HashToken(token), purpose)
+	if err != nil {
+		if errors.Is(err, domain.ErrInvalidAccountToken) {
+			return domain.AccountToken{}, err
+		}
+		return domain.AccountToken{}, fmt.Errorf("accountTokenStorage.GetAccountToken: %w", err)
+	}
+	if !accountToken.Valid(now) {
+		return domain.AccountToken{}, domain.ErrInvalidAccountToken
+	}
+	if err := a.accountTokenStorage.UseAccountToken(ctx, accountToken.ID, now); err != nil {
+		if errors.Is(err, domain.ErrInvalidAccountToken) {
+			return domain.AccountToken{}, err
+		}
+		return domain.AccountToken{}, fmt.Errorf("accountTokenStorage.UseAccountToken: %w", err)
+	}
+	return accountToken, nil
+}
+
+// tokenLink adds token as token query param to the page url
+func tokenLink(page, token string) string {
+	return redirectURI(page, url.Values{"token": {token}})
+}
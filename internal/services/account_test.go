@@ -0,0 +1,226 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"github.com/qPyth/mobydev-internship-auth/internal/domain"
+	"github.com/qPyth/mobydev-internship-auth/internal/storage/sqlite"
+	"io"
+	"log/slog"
+	"testing"
+	"time"
+)
+
+func newTestAccountService(storage *sqlite.Storage, users *UserService, mails *mailbox) *AccountService {
+	return NewAccountService(slog.New(slog.NewTextHandler(io.Discard, nil)), storage, storage, users, users, mails, AccountConfig{
+		VerificationTTL:  time.Hour,
+		VerifyURL:        "https://app.test/verify",
+		ResetTTL:         time.Hour,
+		ResetURL:         "https://app.test/reset",
+		ChangeTTL:        time.Hour,
+		ChangeConfirmURL: "https://app.test/email/confirm",
+		UndoTTL:          time.Hour,
+		UndoURL:          "https://app.test/email/undo",
+	})
+}
+
+// resetToken asks for a password reset link and returns its token
+func resetToken(t *testing.T, accounts *AccountService, mails *mailbox, email string) string {
+	t.Helper()
+	if err := accounts.ForgotPassword(context.Background(), email); err != nil {
+		t.Fatalf("ForgotPassword: %v", err)
+	}
+	accounts.Wait()
+	return mails.lastToken(t, email)
+}
+
+func TestAccountService_ResetTokenIsSingleUse(t *testing.T) {
+	storage := newTestStorage(t)
+	users := newTestUserService(t, storage)
+	mails := &mailbox{}
+	accounts := newTestAccountService(storage, users, mails)
+	ctx, _, _ := signUpAndIn(t, users, "user@example.com", "password1")
+
+	if err := accounts.ForgotPassword(ctx, "unknown@example.com"); err != nil {
+		t.Fatalf("ForgotPassword of unknown email: %v", err)
+	}
+	token := resetToken(t, accounts, mails, "user@example.com")
+	if len(mails.messages) != 1 {
+		t.Fatalf("got %d emails, want 1", len(mails.messages))
+	}
+
+	if err := accounts.ResetPassword(ctx, token, "password2"); err != nil {
+		t.Fatalf("ResetPassword: %v", err)
+	}
+	if err := accounts.ResetPassword(ctx, token, "password3"); !errors.Is(err, domain.ErrInvalidAccountToken) {
+		t.Fatalf("second use: got error %v, want ErrInvalidAccountToken", err)
+	}
+	if _, err := users.SignIn(ctx, "user@example.com", "password1", domain.SessionMeta{}); !errors.Is(err, domain.ErrInvalidCredentials) {
+		t.Fatalf("sign in with the previous password: got error %v, want ErrInvalidCredentials", err)
+	}
+	if _, err := users.SignIn(ctx, "user@example.com", "password2", domain.SessionMeta{}); err != nil {
+		t.Fatalf("sign in with the new password: %v", err)
+	}
+}
+
+func TestAccountService_ResetRevokesAllTokens(t *testing.T) {
+	storage := newTestStorage(t)
+	users := newTestUserService(t, storage)
+	oauth := newTestOAuthService(t, users, storage)
+	mails := &mailbox{}
+	accounts := newTestAccountService(storage, users, mails)
+	ctx, _, tokens := signUpAndIn(t, users, "user@example.com", "password1")
+
+	_, personalToken, err := users.CreatePersonalToken(ctx, "ci", nil, time.Hour)
+	if err != nil {
+		t.Fatalf("CreatePersonalToken: %v", err)
+	}
+	client, err := oauth.PublicClient(ctx, testClientID)
+	if err != nil {
+		t.Fatalf("PublicClient: %v", err)
+	}
+	code := authorizationCode(t, ctx, oauth, testAuthorizationRequest(testCodeVerifier))
+	client.GrantTypes = append(client.GrantTypes, domain.GrantTypeDeviceCode)
+	device, err := oauth.DeviceAuthorization(ctx, client, "")
+	if err != nil {
+		t.Fatalf("DeviceAuthorization: %v", err)
+	}
+	if err := oauth.VerifyDevice(ctx, device.UserCode, true); err != nil {
+		t.Fatalf("VerifyDevice: %v", err)
+	}
+
+	if err := accounts.ResetPassword(ctx, resetToken(t, accounts, mails, "user@example.com"), "password2"); err != nil {
+		t.Fatalf("ResetPassword: %v", err)
+	}
+
+	if _, err := users.VerifyAccessToken(ctx, tokens.AccessToken); !errors.Is(err, domain.ErrInvalidToken) {
+		t.Fatalf("access token: got error %v, want ErrInvalidToken", err)
+	}
+	if _, err := users.RefreshTokens(ctx, tokens.RefreshToken, ""); err == nil {
+		t.Fatal("refresh token was accepted")
+	}
+	if _, err := users.VerifyAccessToken(ctx, personalToken); !errors.Is(err, domain.ErrInvalidToken) {
+		t.Fatalf("personal token: got error %v, want ErrInvalidToken", err)
+	}
+	_, err = oauth.ExchangeAuthorizationCode(ctx, client, code, testRedirectURI, testCodeVerifier, domain.SessionMeta{})
+	if !errors.Is(err, domain.ErrInvalidGrant) {
+		t.Fatalf("authorization code: got error %v, want ErrInvalidGrant", err)
+	}
+	if _, err := oauth.ExchangeDeviceCode(ctx, client, device.DeviceCode, domain.SessionMeta{}); !errors.Is(err, domain.ErrAccessDenied) {
+		t.Fatalf("device code: got error %v, want ErrAccessDenied", err)
+	}
+}
+
+func TestAccountService_ConfirmEmailChange(t *testing.T) {
+	storage := newTestStorage(t)
+	users := newTestUserService(t, storage)
+	mails := &mailbox{}
+	accounts := newTestAccountService(storage, users, mails)
+	ctx, userID, current := signUpAndIn(t, users, "user@example.com", "password1")
+	other, err := users.SignIn(ctx, "user@example.com", "password1", domain.SessionMeta{})
+	if err != nil {
+		t.Fatalf("SignIn: %v", err)
+	}
+
+	if err := accounts.RequestEmailChange(ctx, "new@example.com", "password2"); !errors.Is(err, domain.ErrInvalidCredentials) {
+		t.Fatalf("wrong password: got error %v, want ErrInvalidCredentials", err)
+	}
+	if len(mails.messages) != 0 {
+		t.Fatalf("got %d emails after wrong password, want 0", len(mails.messages))
+	}
+	if err := accounts.RequestEmailChange(ctx, "new@example.com", "password1"); err != nil {
+		t.Fatalf("RequestEmailChange: %v", err)
+	}
+	token := mails.lastToken(t, "new@example.com")
+	if err := accounts.ConfirmEmailChange(ctx, token); err != nil {
+		t.Fatalf("ConfirmEmailChange: %v", err)
+	}
+	if err := accounts.ConfirmEmailChange(ctx, token); !errors.Is(err, domain.ErrInvalidAccountToken) {
+		t.Fatalf("second use: got error %v, want ErrInvalidAccountToken", err)
+	}
+
+	user, err := storage.GetUserByID(ctx, userID)
+	if err != nil {
+		t.Fatalf("GetUserByID: %v", err)
+	}
+	if user.Email != "new@example.com" {
+		t.Fatalf("got email %s, want new@example.com", user.Email)
+	}
+	if _, err := users.VerifyAccessToken(ctx, current.AccessToken); err != nil {
+		t.Fatalf("session which requested the change: %v", err)
+	}
+	if _, err := users.VerifyAccessToken(ctx, other.AccessToken); !errors.Is(err, domain.ErrInvalidToken) {
+		t.Fatalf("other session: got error %v, want ErrInvalidToken", err)
+	}
+}
+
+func TestAccountService_UndoEmailChange(t *testing.T) {
+	storage := newTestStorage(t)
+	users := newTestUserService(t, storage)
+	mails := &mailbox{}
+	accounts := newTestAccountService(storage, users, mails)
+	ctx, userID, tokens := signUpAndIn(t, users, "user@example.com", "password1")
+
+	// the email is changed to first@example.com, then a change to second@example.com is requested from it
+	if err := accounts.RequestEmailChange(ctx, "first@example.com", "password1"); err != nil {
+		t.Fatalf("RequestEmailChange: %v", err)
+	}
+	if err := accounts.ConfirmEmailChange(ctx, mails.lastToken(t, "first@example.com")); err != nil {
+		t.Fatalf("ConfirmEmailChange: %v", err)
+	}
+	if err := accounts.RequestEmailChange(ctx, "second@example.com", "password1"); err != nil {
+		t.Fatalf("second RequestEmailChange: %v", err)
+	}
+	undo := mails.lastToken(t, "user@example.com")
+	laterUndo := mails.lastToken(t, "first@example.com")
+	pending := mails.lastToken(t, "second@example.com")
+
+	if err := accounts.UndoEmailChange(ctx, undo); err != nil {
+		t.Fatalf("UndoEmailChange of the first change: %v", err)
+	}
+	user, err := storage.GetUserByID(ctx, userID)
+	if err != nil {
+		t.Fatalf("GetUserByID: %v", err)
+	}
+	if user.Email != "user@example.com" {
+		t.Fatalf("got email %s, want user@example.com", user.Email)
+	}
+	if _, err := users.VerifyAccessToken(ctx, tokens.AccessToken); !errors.Is(err, domain.ErrInvalidToken) {
+		t.Fatalf("access token: got error %v, want ErrInvalidToken", err)
+	}
+	if err := accounts.ConfirmEmailChange(ctx, pending); !errors.Is(err, domain.ErrInvalidAccountToken) {
+		t.Fatalf("pending change: got error %v, want ErrInvalidAccountToken", err)
+	}
+	if err := accounts.UndoEmailChange(ctx, laterUndo); !errors.Is(err, domain.ErrInvalidAccountToken) {
+		t.Fatalf("undo of the later change: got error %v, want ErrInvalidAccountToken", err)
+	}
+	if err := accounts.UndoEmailChange(ctx, undo); !errors.Is(err, domain.ErrInvalidAccountToken) {
+		t.Fatalf("second use: got error %v, want ErrInvalidAccountToken", err)
+	}
+}
+
+func TestAccountService_FailedSendDoesNotThrottle(t *testing.T) {
+	storage := newTestStorage(t)
+	users := newTestUserService(t, storage)
+	mails := &mailbox{}
+	accounts := newTestAccountService(storage, users, mails)
+	accounts.cfg.ResetResendInterval = time.Hour
+	accounts.cfg.ChangeResendInterval = time.Hour
+	ctx, _, _ := signUpAndIn(t, users, "user@example.com", "password1")
+
+	mails.err = errors.New("smtp is down")
+	if err := accounts.RequestEmailChange(ctx, "new@example.com", "password1"); err == nil {
+		t.Fatal("RequestEmailChange: got no error when the email could not be sent")
+	}
+	if err := accounts.ForgotPassword(ctx, "user@example.com"); err != nil {
+		t.Fatalf("ForgotPassword: %v", err)
+	}
+	accounts.Wait()
+
+	mails.err = nil
+	if err := accounts.RequestEmailChange(ctx, "new@example.com", "password1"); err != nil {
+		t.Fatalf("RequestEmailChange after failed send: %v", err)
+	}
+	mails.lastToken(t, "new@example.com")
+	resetToken(t, accounts, mails, "user@example.com")
+}
@@ -0,0 +1,302 @@
+package services
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"github.com/qPyth/mobydev-internship-auth/internal/domain"
+	"github.com/qPyth/mobydev-internship-auth/pkg/auth"
+	"net/url"
+	"slices"
+	"time"
+)
+
+const (
+	ResponseTypeCode        = "code"
+	CodeChallengeMethodS256 = "S256"
+)
+
+const (
+	// oauthErrAccessDenied is sent to the client if the user denied the authorization request
+	oauthErrAccessDenied = "access_denied"
+	// code verifier length limits (RFC 7636 section 4.1)
+	minCodeVerifierLen = 43
+	maxCodeVerifierLen = 128
+)
+
+type AuthorizationStorage interface {
+	CreateAuthorizationCode(ctx context.Context, code domain.AuthorizationCode) error
+	UseAuthorizationCode(ctx context.Context, codeHash string, usedAt time.Time) (domain.AuthorizationCode, error)
+	GetConsent(ctx context.Context, userID uint, clientID string) (domain.Consent, error)
+	SaveConsent(ctx context.Context, consent domain.Consent) error
+}
+
+// TokenIssuer starts sessions of users authorized for clients, implemented by UserService
+type TokenIssuer interface {
+	IssueTokens(ctx context.Context, userID uint, meta domain.SessionMeta) (domain.Tokens, error)
+	RefreshClientTokens(ctx context.Context, clientID, refreshToken, dpopJKT string) (domain.Tokens, error)
+}
+
+// validateAuthorization checks authorization request and returns its client and requested scopes, all scopes of the
+// client if none requested. Returns domain.ErrInvalidClient or domain.ErrInvalidRedirectURI if the user must not be
+// redirected back to the client, domain.ErrInvalidAuthRequest, domain.ErrUnauthorizedClient
+// or domain.ErrScopeNotAllowed otherwise
+func (o *OAuthService) validateAuthorization(ctx context.Context, req domain.AuthorizationRequest) (domain.Client, []string, error) {
+	op := "OAuthService.validateAuthorization"
+	client, err := o.clientStorage.GetClient(ctx, req.ClientID)
+	if err != nil {
+		if errors.Is(err, domain.ErrInvalidClient) {
+			return domain.Client{}, nil, err
+		}
+		return domain.Client{}, nil, fmt.Errorf("%s: clientStorage.GetClient: %w", op, err)
+	}
+	if req.RedirectURI == "" || !slices.Contains(client.RedirectURIs, req.RedirectURI) {
+		return domain.Client{}, nil, domain.ErrInvalidRedirectURI
+	}
+
+	switch {
+	case req.ResponseType != ResponseTypeCode:
+		return client, nil, fmt.Errorf("%w: response_type must be code", domain.ErrInvalidAuthRequest)
+	case !client.AllowsGrant(domain.GrantTypeAuthorizationCode):
+		return client, nil, domain.ErrUnauthorizedClient
+	case req.CodeChallengeMethod != CodeChallengeMethodS256:
+		return client, nil, fmt.Errorf("%w: code_challenge_method must be S256", domain.ErrInvalidAuthRequest)
+	case len(req.CodeChallenge) != base64.RawURLEncoding.EncodedLen(sha256.Size):
+		return client, nil, fmt.Errorf("%w: invalid code_challenge", domain.ErrInvalidAuthRequest)
+	}
+	scopes, err := clientScopes(client, req.Scope)
+	if err != nil {
+		return client, nil, err
+	}
+	return client, scopes, nil
+}
+
+// StartAuthorization validates authorization request of the browser and returns the URL to redirect it to:
+// the consent page with the request params, or the client redirect uri with error if request is not valid.
+// Returns domain.ErrInvalidClient or domain.ErrInvalidRedirectURI if the browser must not be redirected to the client
+func (o *OAuthService) StartAuthorization(ctx context.Context, req domain.AuthorizationRequest) (string, error) {
+	if _, _, err := o.validateAuthorization(ctx, req); err != nil {
+		if uri, ok := authorizationErrorRedirect(req, err); ok {
+			return uri, nil
+		}
+		return "", err
+	}
+	return redirectURI(o.cfg.ConsentURL, url.Values{
+		"response_type":         {req.ResponseType},
+		"client_id":             {req.ClientID},
+		"redirect_uri":          {req.RedirectURI},
+		"scope":                 {req.Scope},
+		"state":                 {req.State},
+		"code_challenge":        {req.CodeChallenge},
+		"code_challenge_method": {req.CodeChallengeMethod},
+		"nonce":                 {req.Nonce},
+	}), nil
+}
+
+// Authorize handles authorization request of the user from context. If approve is nil, a code is issued only if the
+// user already consented to the requested scopes, otherwise consent is required. If approve is true, consent is
+// recorded and a code is issued, if false the client is told that access was denied. Invalid requests are reported
+// to the client redirect uri too. Returns domain.ErrInvalidClient, domain.ErrInvalidRedirectURI or
+// domain.ErrSessionRequired if the token is not a first party session token
+func (o *OAuthService) Authorize(ctx context.Context, req domain.AuthorizationRequest, approve *bool) (domain.Authorization, error) {
+	op := "OAuthService.Authorize"
+	claims, ok := auth.ClaimsFromContext(ctx)
+	if !ok {
+		return domain.Authorization{}, fmt.Errorf("token claims not found in context")
+	}
+	if !firstPartySession(claims) {
+		return domain.Authorization{}, domain.ErrSessionRequired
+	}
+	userID, err := claims.UserID()
+	if err != nil {
+		return domain.Authorization{}, fmt.Errorf("%s: %w", op, err)
+	}
+	client, scopes, err := o.validateAuthorization(ctx, req)
+	if err != nil {
+		if uri, ok := authorizationErrorRedirect(req, err); ok {
+			return domain.Authorization{RedirectURI: uri}, nil
+		}
+		return domain.Authorization{}, err
+	}
+
+	if approve != nil && !*approve {
+		return domain.Authorization{RedirectURI: redirectURI(req.RedirectURI, url.Values{
+			"error": {oauthErrAccessDenied},
+			"state": {req.State},
+		})}, nil
+	}
+
+	now := time.Now()
+	consent, err := o.authorizationStorage.GetConsent(ctx, userID, client.ID)
+	if err != nil {
+		return domain.Authorization{}, fmt.Errorf("%s: authorizationStorage.GetConsent: %w", op, err)
+	}
+	consented := !slices.ContainsFunc(scopes, func(s string) bool { return !slices.Contains(consent.Scopes, s) })
+	switch {
+	case approve == nil && !consented:
+		return domain.Authorization{ConsentRequired: true, ClientName: client.Name, Scopes: scopes}, nil
+	case !consented:
+		if consent.CreatedAt.IsZero() {
+			consent.CreatedAt = now
+		}
+		for _, s := range scopes {
+			if !slices.Contains(consent.Scopes, s) {
+				consent.Scopes = append(consent.Scopes, s)
+			}
+		}
+		consent.UpdatedAt = now
+		if err := o.authorizationStorage.SaveConsent(ctx, consent); err != nil {
+			return domain.Authorization{}, fmt.Errorf("%s: authorizationStorage.SaveConsent: %w", op, err)
+		}
+	}
+
+	code, err := auth.RandomString(32)
+	if err != nil {
+		return domain.Authorization{}, fmt.Errorf("%s: auth.RandomString: %w", op, err)
+	}
+	err = o.authorizationStorage.CreateAuthorizationCode(ctx, domain.AuthorizationCode{
+		CodeHash:      auth.HashToken(code),
+		ClientID:      client.ID,
+		UserID:        userID,
+		OrgID:         claims.OrgID,
+		RedirectURI:   req.RedirectURI,
+		Scopes:        scopes,
+		CodeChallenge: req.CodeChallenge,
+		Nonce:         req.Nonce,
+		CreatedAt:     now,
+		ExpiresAt:     now.Add(o.cfg.AuthorizationCodeTTL),
+	})
+	if err != nil {
+		return domain.Authorization{}, fmt.Errorf("%s: authorizationStorage.CreateAuthorizationCode: %w", op, err)
+	}
+	return domain.Authorization{RedirectURI: redirectURI(req.RedirectURI, url.Values{"code": {code}, "state": {req.State}})}, nil
+}
+
+// ExchangeAuthorizationCode issues tokens of a new session of the user for the authorization code
+// (RFC 6749 section 4.1.3) after checking its PKCE code verifier, and ID token if openid scope was granted. Returns domain.ErrUnauthorizedClient
+// and domain.ErrInvalidGrant if the code is unknown, used, expired, issued to another client or redirect uri,
+// or the verifier does not match
+func (o *OAuthService) ExchangeAuthorizationCode(ctx context.Context, client domain.Client, code, redirectURI, codeVerifier string, meta domain.SessionMeta) (domain.TokenResponse, error) {
+	op := "OAuthService.ExchangeAuthorizationCode"
+	if !client.AllowsGrant(domain.GrantTypeAuthorizationCode) {
+		return domain.TokenResponse{}, domain.ErrUnauthorizedClient
+	}
+	now := time.Now()
+	authCode, err := o.authorizationStorage.UseAuthorizationCode(ctx, auth.HashToken(code), now)
+	if err != nil {
+		if errors.Is(err, domain.ErrInvalidGrant) {
+			return domain.TokenResponse{}, err
+		}
+		return domain.TokenResponse{}, fmt.Errorf("%s: authorizationStorage.UseAuthorizationCode: %w", op, err)
+	}
+	if authCode.ClientID != client.ID || authCode.RedirectURI != redirectURI || !now.Before(authCode.ExpiresAt) {
+		return domain.TokenResponse{}, domain.ErrInvalidGrant
+	}
+	if !verifyCodeChallenge(authCode.CodeChallenge, codeVerifier) {
+		return domain.TokenResponse{}, fmt.Errorf("%w: code verifier does not match", domain.ErrInvalidGrant)
+	}
+
+	meta.OrgID, meta.ClientID, meta.Scopes = authCode.OrgID, client.ID, authCode.Scopes
+	if meta.Device == "" {
+		meta.Device = client.Name
+	}
+	tokens, err := o.tokenIssuer.IssueTokens(ctx, authCode.UserID, meta)
+	if err != nil {
+		return domain.TokenResponse{}, fmt.Errorf("%s: tokenIssuer.IssueTokens: %w", op, err)
+	}
+	resp := o.tokenResponse(tokens, meta.DPoPJKT)
+	if resp.IDToken, err = o.idToken(ctx, authCode.UserID, client.ID, authCode.Nonce, authCode.Scopes); err != nil {
+		return domain.TokenResponse{}, fmt.Errorf("%s: %w", op, err)
+	}
+	return resp, nil
+}
+
+// RefreshToken exchanges refresh token of a session authorized for the client for new tokens (RFC 6749 section 6).
+// Returns domain.ErrUnauthorizedClient, domain.ErrInvalidGrant if refresh token is not valid
+// and domain.ErrInvalidDPoPProof if the session is bound to another DPoP key
+func (o *OAuthService) RefreshToken(ctx context.Context, client domain.Client, refreshToken, dpopJKT string) (domain.TokenResponse, error) {
+	op := "OAuthService.RefreshToken"
+	if !client.AllowsGrant(domain.GrantTypeRefreshToken) {
+		return domain.TokenResponse{}, domain.ErrUnauthorizedClient
+	}
+	tokens, err := o.tokenIssuer.RefreshClientTokens(ctx, client.ID, refreshToken, dpopJKT)
+	if err != nil {
+		if errors.Is(err, domain.ErrInvalidRefreshToken) || errors.Is(err, domain.ErrRefreshTokenReused) {
+			return domain.TokenResponse{}, fmt.Errorf("%w: %w", domain.ErrInvalidGrant, err)
+		}
+		if errors.Is(err, domain.ErrInvalidDPoPProof) {
+			return domain.TokenResponse{}, err
+		}
+		return domain.TokenResponse{}, fmt.Errorf("%s: tokenIssuer.RefreshClientTokens: %w", op, err)
+	}
+	return o.tokenResponse(tokens, dpopJKT), nil
+}
+
+func (o *OAuthService) tokenResponse(tokens domain.Tokens, dpopJKT string) domain.TokenResponse {
+	tokenType := "Bearer"
+	if dpopJKT != "" {
+		tokenType = "DPoP"
+	}
+	return domain.TokenResponse{
+		AccessToken:  tokens.AccessToken,
+		TokenType:    tokenType,
+		ExpiresIn:    int64(o.cfg.AccessTokenTTL.Seconds()),
+		RefreshToken: tokens.RefreshToken,
+		Scope:        tokens.Scope,
+	}
+}
+
+// authorizationErrorRedirect returns the client redirect uri with error of invalid authorization request
+// (RFC 6749 section 4.1.2.1), false if the error must not be sent to the redirect uri
+func authorizationErrorRedirect(req domain.AuthorizationRequest, err error) (string, bool) {
+	var code string
+	switch {
+	case errors.Is(err, domain.ErrInvalidAuthRequest):
+		code = "invalid_request"
+	case errors.Is(err, domain.ErrUnauthorizedClient):
+		code = "unauthorized_client"
+	case errors.Is(err, domain.ErrScopeNotAllowed):
+		code = "invalid_scope"
+	default:
+		return "", false
+	}
+	return redirectURI(req.RedirectURI, url.Values{
+		"error":             {code},
+		"error_description": {err.Error()},
+		"state":             {req.State},
+	}), true
+}
+
+// verifyCodeChallenge reports whether S256 code challenge was derived from the code verifier (RFC 7636 section 4.6)
+func verifyCodeChallenge(challenge, verifier string) bool {
+	if len(verifier) < minCodeVerifierLen || len(verifier) > maxCodeVerifierLen {
+		return false
+	}
+	sum := sha256.Sum256([]byte(verifier))
+	return subtle.ConstantTimeCompare([]byte(base64.RawURLEncoding.EncodeToString(sum[:])), []byte(challenge)) == 1
+}
+
+// redirectURI adds non empty params to the query of the redirect uri
+func redirectURI(uri string, params url.Values) string {
+	u, err := url.Parse(uri)
+	if err != nil {
+		return uri
+	}
+	query := u.Query()
+	for key, values := range params {
+		if len(values) > 0 && values[0] != "" {
+			query.Set(key, values[0])
+		}
+	}
+	u.RawQuery = query.Encode()
+	return u.String()
+}
+
+// firstPartySession reports whether the token belongs to a session the user signed in to this service with.
+// Personal access tokens, tokens issued to clients and tokens of clients themselves can not approve clients
+func firstPartySession(claims *auth.Claims) bool {
+	return claims.SessionID != "" && claims.ClientID == "" && !claims.IsClient()
+}
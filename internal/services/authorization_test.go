@@ -0,0 +1,234 @@
+package services
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"github.com/qPyth/mobydev-internship-auth/internal/domain"
+	"github.com/qPyth/mobydev-internship-auth/internal/storage/memory"
+	"github.com/qPyth/mobydev-internship-auth/pkg/auth"
+	"net/url"
+	"testing"
+	"time"
+)
+
+const (
+	testClientID     = "web"
+	testRedirectURI  = "https://app.test/callback"
+	testCodeVerifier = "dBjftJeZ4CVP-mB92K27uhbUJU1p1r_wW1gFWFOEjXk"
+)
+
+func newTestOAuthService(t *testing.T, users *UserService, storage oauthTestStorage) *OAuthService {
+	t.Helper()
+	clients := memory.NewClientStorage([]domain.Client{{
+		ID:           testClientID,
+		Name:         "Web",
+		GrantTypes:   []string{domain.GrantTypeAuthorizationCode, domain.GrantTypeRefreshToken},
+		RedirectURIs: []string{testRedirectURI},
+	}})
+	return NewOAuthService(clients, storage, storage, storage, users, users, users.TokenManager, newTestTokenManager(t), OAuthConfig{
+		Issuer:               testIssuer,
+		AccessTokenTTL:       15 * time.Minute,
+		AuthorizationCodeTTL: time.Minute,
+		DeviceCodeTTL:        time.Minute,
+		DevicePollInterval:   time.Second,
+	})
+}
+
+// oauthTestStorage is implemented by sqlite.Storage
+type oauthTestStorage interface {
+	AuthorizationStorage
+	DeviceCodeStorage
+	UserStorage
+}
+
+func testAuthorizationRequest(verifier string) domain.AuthorizationRequest {
+	sum := sha256.Sum256([]byte(verifier))
+	return domain.AuthorizationRequest{
+		ResponseType:        ResponseTypeCode,
+		ClientID:            testClientID,
+		RedirectURI:         testRedirectURI,
+		State:               "state",
+		CodeChallenge:       base64.RawURLEncoding.EncodeToString(sum[:]),
+		CodeChallengeMethod: CodeChallengeMethodS256,
+	}
+}
+
+// authorizationCode approves the request and returns the code from the redirect uri
+func authorizationCode(t *testing.T, ctx context.Context, oauth *OAuthService, req domain.AuthorizationRequest) string {
+	t.Helper()
+	approve := true
+	authorization, err := oauth.Authorize(ctx, req, &approve)
+	if err != nil {
+		t.Fatalf("Authorize: %v", err)
+	}
+	redirect, err := url.Parse(authorization.RedirectURI)
+	if err != nil {
+		t.Fatalf("url.Parse: %v", err)
+	}
+	code := redirect.Query().Get("code")
+	if code == "" {
+		t.Fatalf("no code in redirect %s", authorization.RedirectURI)
+	}
+	return code
+}
+
+func TestOAuthService_ExchangeAuthorizationCode(t *testing.T) {
+	tests := []struct {
+		name string
+		// exchange exchanges the code of a request with testCodeVerifier challenge
+		exchange func(ctx context.Context, oauth *OAuthService, client domain.Client, code string) error
+		wantErr  error
+	}{
+		{
+			name: "valid verifier",
+			exchange: func(ctx context.Context, oauth *OAuthService, client domain.Client, code string) error {
+				resp, err := oauth.ExchangeAuthorizationCode(ctx, client, code, testRedirectURI, testCodeVerifier, domain.SessionMeta{})
+				if err == nil && resp.AccessToken == "" {
+					err = errors.New("no access token")
+				}
+				return err
+			},
+		},
+		{
+			name: "wrong verifier",
+			exchange: func(ctx context.Context, oauth *OAuthService, client domain.Client, code string) error {
+				_, err := oauth.ExchangeAuthorizationCode(ctx, client, code, testRedirectURI, testCodeVerifier[1:]+"x", domain.SessionMeta{})
+				return err
+			},
+			wantErr: domain.ErrInvalidGrant,
+		},
+		{
+			name: "missing verifier",
+			exchange: func(ctx context.Context, oauth *OAuthService, client domain.Client, code string) error {
+				_, err := oauth.ExchangeAuthorizationCode(ctx, client, code, testRedirectURI, "", domain.SessionMeta{})
+				return err
+			},
+			wantErr: domain.ErrInvalidGrant,
+		},
+		{
+			name: "code is single use",
+			exchange: func(ctx context.Context, oauth *OAuthService, client domain.Client, code string) error {
+				if _, err := oauth.ExchangeAuthorizationCode(ctx, client, code, testRedirectURI, testCodeVerifier, domain.SessionMeta{}); err != nil {
+					return err
+				}
+				_, err := oauth.ExchangeAuthorizationCode(ctx, client, code, testRedirectURI, testCodeVerifier, domain.SessionMeta{})
+				return err
+			},
+			wantErr: domain.ErrInvalidGrant,
+		},
+		{
+			name: "code is used by a failed attempt",
+			exchange: func(ctx context.Context, oauth *OAuthService, client domain.Client, code string) error {
+				if _, err := oauth.ExchangeAuthorizationCode(ctx, client, code, testRedirectURI, "wrong-verifier-wrong-verifier-wrong-verifier", domain.SessionMeta{}); !errors.Is(err, domain.ErrInvalidGrant) {
+					return err
+				}
+				_, err := oauth.ExchangeAuthorizationCode(ctx, client, code, testRedirectURI, testCodeVerifier, domain.SessionMeta{})
+				return err
+			},
+			wantErr: domain.ErrInvalidGrant,
+		},
+		{
+			name: "another redirect uri",
+			exchange: func(ctx context.Context, oauth *OAuthService, client domain.Client, code string) error {
+				_, err := oauth.ExchangeAuthorizationCode(ctx, client, code, "https://app.test/other", testCodeVerifier, domain.SessionMeta{})
+				return err
+			},
+			wantErr: domain.ErrInvalidGrant,
+		},
+		{
+			name: "another client",
+			exchange: func(ctx context.Context, oauth *OAuthService, client domain.Client, code string) error {
+				client.ID = "other"
+				_, err := oauth.ExchangeAuthorizationCode(ctx, client, code, testRedirectURI, testCodeVerifier, domain.SessionMeta{})
+				return err
+			},
+			wantErr: domain.ErrInvalidGrant,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			storage := newTestStorage(t)
+			users := newTestUserService(t, storage)
+			oauth := newTestOAuthService(t, users, storage)
+			ctx, _, _ := signUpAndIn(t, users, "user@example.com", "password1")
+			client, err := oauth.PublicClient(ctx, testClientID)
+			if err != nil {
+				t.Fatalf("PublicClient: %v", err)
+			}
+
+			code := authorizationCode(t, ctx, oauth, testAuthorizationRequest(testCodeVerifier))
+			if err := tt.exchange(context.Background(), oauth, client, code); !errors.Is(err, tt.wantErr) {
+				t.Fatalf("got error %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestOAuthService_AuthorizeValidatesRequest(t *testing.T) {
+	storage := newTestStorage(t)
+	users := newTestUserService(t, storage)
+	oauth := newTestOAuthService(t, users, storage)
+	ctx, _, _ := signUpAndIn(t, users, "user@example.com", "password1")
+	approve := true
+
+	req := testAuthorizationRequest(testCodeVerifier)
+	req.RedirectURI = "https://evil.test/callback"
+	if _, err := oauth.Authorize(ctx, req, &approve); !errors.Is(err, domain.ErrInvalidRedirectURI) {
+		t.Fatalf("unregistered redirect uri: got error %v, want ErrInvalidRedirectURI", err)
+	}
+
+	for name, edit := range map[string]func(req *domain.AuthorizationRequest){
+		"plain challenge method": func(req *domain.AuthorizationRequest) { req.CodeChallengeMethod = "plain" },
+		"missing challenge":      func(req *domain.AuthorizationRequest) { req.CodeChallenge, req.CodeChallengeMethod = "", "" },
+	} {
+		req := testAuthorizationRequest(testCodeVerifier)
+		edit(&req)
+		authorization, err := oauth.Authorize(ctx, req, &approve)
+		if err != nil {
+			t.Fatalf("%s: Authorize: %v", name, err)
+		}
+		redirect, err := url.Parse(authorization.RedirectURI)
+		if err != nil {
+			t.Fatalf("%s: url.Parse: %v", name, err)
+		}
+		if redirect.Query().Get("error") != "invalid_request" || redirect.Query().Get("code") != "" {
+			t.Fatalf("%s: got redirect %s, want invalid_request error", name, authorization.RedirectURI)
+		}
+	}
+}
+
+func TestOAuthService_AuthorizeRequiresFirstPartySession(t *testing.T) {
+	storage := newTestStorage(t)
+	users := newTestUserService(t, storage)
+	oauth := newTestOAuthService(t, users, storage)
+	ctx, _, _ := signUpAndIn(t, users, "user@example.com", "password1")
+	claims, _ := auth.ClaimsFromContext(ctx)
+	approve := true
+
+	_, personalToken, err := users.CreatePersonalToken(ctx, "ci", nil, time.Hour)
+	if err != nil {
+		t.Fatalf("CreatePersonalToken: %v", err)
+	}
+	personalClaims, err := users.VerifyAccessToken(ctx, personalToken)
+	if err != nil {
+		t.Fatalf("VerifyAccessToken: %v", err)
+	}
+	clientSession := *claims
+	clientSession.ClientID = testClientID
+	clientToken := *claims
+	clientToken.SessionID, clientToken.ClientID, clientToken.Subject = "", testClientID, auth.ClientSubjectPrefix+testClientID
+
+	for name, claims := range map[string]*auth.Claims{
+		"personal access token":      personalClaims,
+		"token issued to a client":   &clientSession,
+		"token of the client itself": &clientToken,
+	} {
+		_, err := oauth.Authorize(auth.WithClaims(ctx, claims), testAuthorizationRequest(testCodeVerifier), &approve)
+		if !errors.Is(err, domain.ErrSessionRequired) {
+			t.Fatalf("%s: got error %v, want ErrSessionRequired", name, err)
+		}
+	}
+}
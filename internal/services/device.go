@@ -0,0 +1,246 @@
+package services
+
+import (
+	"context"
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"github.com/qPyth/mobydev-internship-auth/internal/domain"
+	"github.com/qPyth/mobydev-internship-auth/pkg/auth"
+	"math/big"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// userCodeAlphabet has no vowels to avoid forming words and no characters easily confused with digits (RFC 8628 section 6.1)
+	userCodeAlphabet = "BCDFGHJKLMNPQRSTVWXZ"
+	userCodeLen      = 8
+	// slowDownStep is added to the polling interval every time the device polls too often (RFC 8628 section 3.5)
+	slowDownStep = 5 * time.Second
+)
+
+type DeviceCodeStorage interface {
+	CreateDeviceCode(ctx context.Context, code domain.DeviceCode) error
+	GetDeviceCode(ctx context.Context, deviceCodeHash string) (domain.DeviceCode, error)
+	GetPendingDeviceCode(ctx context.Context, userCode string, now time.Time) (domain.DeviceCode, error)
+	DecideDeviceCode(ctx context.Context, userCode, status string, userID, orgID uint, now time.Time) error
+	UpdateDevicePoll(ctx context.Context, deviceCodeHash string, polledAt time.Time, interval time.Duration) error
+	UseDeviceCode(ctx context.Context, deviceCodeHash string, usedAt time.Time) error
+}
+
+// DeviceAuthorization starts authorization of a device which can not open a browser (RFC 8628 section 3.1).
+// scope is a space separated list of requested scopes, all client scopes if empty. Returns
+// domain.ErrUnauthorizedClient if client may not use the device code grant and domain.ErrScopeNotAllowed
+func (o *OAuthService) DeviceAuthorization(ctx context.Context, client domain.Client, scope string) (domain.DeviceAuthorization, error) {
+	op := "OAuthService.DeviceAuthorization"
+	if !client.AllowsGrant(domain.GrantTypeDeviceCode) {
+		return domain.DeviceAuthorization{}, domain.ErrUnauthorizedClient
+	}
+	scopes, err := clientScopes(client, scope)
+	if err != nil {
+		return domain.DeviceAuthorization{}, err
+	}
+
+	deviceCode, err := auth.RandomString(32)
+	if err != nil {
+		return domain.DeviceAuthorization{}, fmt.Errorf("%s: auth.RandomString: %w", op, err)
+	}
+	userCode, err := newUserCode()
+	if err != nil {
+		return domain.DeviceAuthorization{}, fmt.Errorf("%s: %w", op, err)
+	}
+	now := time.Now()
+	err = o.deviceCodeStorage.CreateDeviceCode(ctx, domain.DeviceCode{
+		DeviceCodeHash: auth.HashToken(deviceCode),
+		UserCode:       userCode,
+		ClientID:       client.ID,
+		Scopes:         scopes,
+		Status:         domain.DeviceCodePending,
+		Interval:       o.cfg.DevicePollInterval,
+		CreatedAt:      now,
+		ExpiresAt:      now.Add(o.cfg.DeviceCodeTTL),
+	})
+	if err != nil {
+		return domain.DeviceAuthorization{}, fmt.Errorf("%s: deviceCodeStorage.CreateDeviceCode: %w", op, err)
+	}
+
+	displayCode := formatUserCode(userCode)
+	return domain.DeviceAuthorization{
+		DeviceCode:              deviceCode,
+		UserCode:                displayCode,
+		VerificationURI:         o.cfg.VerificationURL,
+		VerificationURIComplete: redirectURI(o.cfg.VerificationURL, url.Values{"user_code": {displayCode}}),
+		ExpiresIn:               int64(o.cfg.DeviceCodeTTL.Seconds()),
+		Interval:                int64(o.cfg.DevicePollInterval.Seconds()),
+	}, nil
+}
+
+// DeviceVerification returns the client and scopes of the pending device authorization to show them to the user
+// from context before approval. Returns domain.ErrDeviceCodeNotFound if user code is unknown, expired or already
+// decided and domain.ErrTooManyRequests if the user entered too many wrong codes
+func (o *OAuthService) DeviceVerification(ctx context.Context, userCode string) (domain.DeviceVerification, error) {
+	op := "OAuthService.DeviceVerification"
+	userID, ok := auth.UserIDFromContext(ctx)
+	if !ok {
+		return domain.DeviceVerification{}, fmt.Errorf("userID not found in context")
+	}
+	limitKey := strconv.FormatUint(uint64(userID), 10)
+	if !o.userCodeLimiter.Allow(limitKey) {
+		return domain.DeviceVerification{}, domain.ErrTooManyRequests
+	}
+	code, err := o.deviceCodeStorage.GetPendingDeviceCode(ctx, normalizeUserCode(userCode), time.Now())
+	if err != nil {
+		if errors.Is(err, domain.ErrDeviceCodeNotFound) {
+			o.userCodeLimiter.Fail(limitKey)
+			return domain.DeviceVerification{}, err
+		}
+		return domain.DeviceVerification{}, fmt.Errorf("%s: deviceCodeStorage.GetPendingDeviceCode: %w", op, err)
+	}
+	client, err := o.clientStorage.GetClient(ctx, code.ClientID)
+	if err != nil {
+		if errors.Is(err, domain.ErrInvalidClient) {
+			// client was removed from configuration after the device authorization started
+			return domain.DeviceVerification{}, domain.ErrDeviceCodeNotFound
+		}
+		return domain.DeviceVerification{}, fmt.Errorf("%s: clientStorage.GetClient: %w", op, err)
+	}
+	return domain.DeviceVerification{
+		UserCode:   formatUserCode(code.UserCode),
+		ClientID:   client.ID,
+		ClientName: client.Name,
+		Scopes:     code.Scopes,
+		ExpiresAt:  code.ExpiresAt,
+	}, nil
+}
+
+// VerifyDevice approves or denies the pending device authorization for the user from context, tokens are issued
+// for the active organization of the user. Returns domain.ErrDeviceCodeNotFound if user code is unknown,
+// expired or already decided, domain.ErrTooManyRequests if the user entered too many wrong codes
+// and domain.ErrSessionRequired if the token is not a first party session token
+func (o *OAuthService) VerifyDevice(ctx context.Context, userCode string, approve bool) error {
+	op := "OAuthService.VerifyDevice"
+	claims, ok := auth.ClaimsFromContext(ctx)
+	if !ok {
+		return fmt.Errorf("token claims not found in context")
+	}
+	if !firstPartySession(claims) {
+		return domain.ErrSessionRequired
+	}
+	userID, err := claims.UserID()
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	limitKey := strconv.FormatUint(uint64(userID), 10)
+	if !o.userCodeLimiter.Allow(limitKey) {
+		return domain.ErrTooManyRequests
+	}
+	status := domain.DeviceCodeDenied
+	if approve {
+		status = domain.DeviceCodeApproved
+	}
+	err = o.deviceCodeStorage.DecideDeviceCode(ctx, normalizeUserCode(userCode), status, userID, claims.OrgID, time.Now())
+	if err != nil {
+		if errors.Is(err, domain.ErrDeviceCodeNotFound) {
+			o.userCodeLimiter.Fail(limitKey)
+			return err
+		}
+		return fmt.Errorf("%s: deviceCodeStorage.DecideDeviceCode: %w", op, err)
+	}
+	return nil
+}
+
+// ExchangeDeviceCode issues tokens of a new session of the user who approved the device code (RFC 8628 section 3.4).
+// Until then domain.ErrAuthPending is returned, or domain.ErrSlowDown if the device polls more often than the
+// interval, which is then increased. Returns domain.ErrAccessDenied if the user denied the request,
+// domain.ErrExpiredToken, domain.ErrUnauthorizedClient and domain.ErrInvalidGrant if the code is unknown,
+// used or issued to another client
+func (o *OAuthService) ExchangeDeviceCode(ctx context.Context, client domain.Client, deviceCode string, meta domain.SessionMeta) (domain.TokenResponse, error) {
+	op := "OAuthService.ExchangeDeviceCode"
+	if !client.AllowsGrant(domain.GrantTypeDeviceCode) {
+		return domain.TokenResponse{}, domain.ErrUnauthorizedClient
+	}
+	now := time.Now()
+	deviceCodeHash := auth.HashToken(deviceCode)
+	code, err := o.deviceCodeStorage.GetDeviceCode(ctx, deviceCodeHash)
+	if err != nil {
+		if errors.Is(err, domain.ErrInvalidGrant) {
+			return domain.TokenResponse{}, err
+		}
+		return domain.TokenResponse{}, fmt.Errorf("%s: deviceCodeStorage.GetDeviceCode: %w", op, err)
+	}
+	if code.ClientID != client.ID {
+		return domain.TokenResponse{}, domain.ErrInvalidGrant
+	}
+	if !now.Before(code.ExpiresAt) {
+		return domain.TokenResponse{}, domain.ErrExpiredToken
+	}
+
+	switch code.Status {
+	case domain.DeviceCodePending:
+		interval := code.Interval
+		tooOften := code.LastPolledAt != nil && now.Sub(*code.LastPolledAt) < interval
+		if tooOften {
+			interval += slowDownStep
+		}
+		if err := o.deviceCodeStorage.UpdateDevicePoll(ctx, deviceCodeHash, now, interval); err != nil {
+			return domain.TokenResponse{}, fmt.Errorf("%s: deviceCodeStorage.UpdateDevicePoll: %w", op, err)
+		}
+		if tooOften {
+			return domain.TokenResponse{}, domain.ErrSlowDown
+		}
+		return domain.TokenResponse{}, domain.ErrAuthPending
+	case domain.DeviceCodeDenied:
+		return domain.TokenResponse{}, domain.ErrAccessDenied
+	}
+
+	if err := o.deviceCodeStorage.UseDeviceCode(ctx, deviceCodeHash, now); err != nil {
+		if errors.Is(err, domain.ErrInvalidGrant) {
+			return domain.TokenResponse{}, err
+		}
+		return domain.TokenResponse{}, fmt.Errorf("%s: deviceCodeStorage.UseDeviceCode: %w", op, err)
+	}
+	meta.OrgID, meta.ClientID, meta.Scopes = code.OrgID, client.ID, code.Scopes
+	if meta.Device == "" {
+		meta.Device = client.Name
+	}
+	tokens, err := o.tokenIssuer.IssueTokens(ctx, code.UserID, meta)
+	if err != nil {
+		return domain.TokenResponse{}, fmt.Errorf("%s: tokenIssuer.IssueTokens: %w", op, err)
+	}
+	resp := o.tokenResponse(tokens, meta.DPoPJKT)
+	if resp.IDToken, err = o.idToken(ctx, code.UserID, client.ID, "", code.Scopes); err != nil {
+		return domain.TokenResponse{}, fmt.Errorf("%s: %w", op, err)
+	}
+	return resp, nil
+}
+
+// newUserCode returns a random user code of userCodeLen characters of userCodeAlphabet
+func newUserCode() (string, error) {
+	code := make([]byte, userCodeLen)
+	for i := range code {
+		n, err := rand.Int(rand.Reader, big.NewInt(int64(len(userCodeAlphabet))))
+		if err != nil {
+			return "", fmt.Errorf("rand.Int: %w", err)
+		}
+		code[i] = userCodeAlphabet[n.Int64()]
+	}
+	return string(code), nil
+}
+
+// formatUserCode splits user code in two halves with a dash to make it easier to type
+func formatUserCode(code string) string {
+	return code[:len(code)/2] + "-" + code[len(code)/2:]
+}
+
+// normalizeUserCode returns user code as typed by the user in the stored form, without separators in upper case
+func normalizeUserCode(code string) string {
+	return strings.Map(func(r rune) rune {
+		if r == '-' || r == ' ' {
+			return -1
+		}
+		return r
+	}, strings.ToUpper(code))
+}
@@ -0,0 +1,36 @@
+package services
+
+import (
+	"errors"
+	"github.com/qPyth/mobydev-internship-auth/internal/domain"
+	"github.com/qPyth/mobydev-internship-auth/pkg/auth"
+	"testing"
+	"time"
+)
+
+func TestOAuthService_VerifyDevice(t *testing.T) {
+	storage := newTestStorage(t)
+	users := newTestUserService(t, storage)
+	oauth := newTestOAuthService(t, users, storage)
+	oauth.userCodeLimiter = auth.NewAttemptLimiter(2, time.Minute)
+	ctx, _, _ := signUpAndIn(t, users, "user@example.com", "password1")
+	claims, _ := auth.ClaimsFromContext(ctx)
+
+	clientSession := *claims
+	clientSession.ClientID = testClientID
+	if err := oauth.VerifyDevice(auth.WithClaims(ctx, &clientSession), "BCDF-GHJK", true); !errors.Is(err, domain.ErrSessionRequired) {
+		t.Fatalf("token issued to a client: got error %v, want ErrSessionRequired", err)
+	}
+
+	for i := 0; i < 2; i++ {
+		if err := oauth.VerifyDevice(ctx, "BCDF-GHJK", true); !errors.Is(err, domain.ErrDeviceCodeNotFound) {
+			t.Fatalf("wrong code %d: got error %v, want ErrDeviceCodeNotFound", i+1, err)
+		}
+	}
+	if err := oauth.VerifyDevice(ctx, "BCDF-GHJK", true); !errors.Is(err, domain.ErrTooManyRequests) {
+		t.Fatalf("after max attempts: got error %v, want ErrTooManyRequests", err)
+	}
+	if _, err := oauth.DeviceVerification(ctx, "BCDF-GHJK"); !errors.Is(err, domain.ErrTooManyRequests) {
+		t.Fatalf("lookup after max attempts: got error %v, want ErrTooManyRequests", err)
+	}
+}
@@ -0,0 +1,122 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/qPyth/mobydev-internship-auth/internal/domain"
+	"github.com/qPyth/mobydev-internship-auth/pkg/auth"
+	"slices"
+	"strings"
+	"time"
+)
+
+// ExchangeToken exchanges access token of a user for a token the client can send to another service on the user's
+// behalf (RFC 8693). The new token is restricted to the requested audience, keeps only permissions of the subject
+// token allowed by exchange policy of the client, names the client in the act claim and expires not later than
+// the subject token. A subject token bound to a DPoP key is exchanged only with a proof of that key, dpopJKT, and
+// the new token is bound to it too. Returns domain.ErrUnauthorizedClient, domain.ErrInvalidExchange if the request
+// or the subject token is not valid, domain.ErrInvalidDPoPProof, domain.ErrInvalidTarget and domain.ErrScopeNotAllowed
+func (o *OAuthService) ExchangeToken(ctx context.Context, client domain.Client, req domain.TokenExchangeRequest, dpopJKT string) (domain.TokenResponse, error) {
+	op := "OAuthService.ExchangeToken"
+	if !client.AllowsGrant(domain.GrantTypeTokenExchange) {
+		return domain.TokenResponse{}, domain.ErrUnauthorizedClient
+	}
+	if req.SubjectTokenType != domain.TokenTypeAccessToken {
+		return domain.TokenResponse{}, fmt.Errorf("%w: unsupported subject_token_type", domain.ErrInvalidExchange)
+	}
+	if req.RequestedTokenType != "" && req.RequestedTokenType != domain.TokenTypeAccessToken {
+		return domain.TokenResponse{}, fmt.Errorf("%w: unsupported requested_token_type", domain.ErrInvalidExchange)
+	}
+
+	claims, err := o.tokenVerifier.VerifyAccessToken(ctx, req.SubjectToken)
+	if err != nil {
+		if errors.Is(err, domain.ErrInvalidToken) {
+			// the reason is not disclosed to the client
+			return domain.TokenResponse{}, fmt.Errorf("%w: invalid subject_token", domain.ErrInvalidExchange)
+		}
+		return domain.TokenResponse{}, fmt.Errorf("%s: tokenVerifier.VerifyAccessToken: %w", op, err)
+	}
+	if claims.IsClient() || claims.SessionID == "" {
+		// only tokens of signed in users are exchanged, not personal access tokens or tokens of clients
+		return domain.TokenResponse{}, fmt.Errorf("%w: subject_token must be an access token of a user session", domain.ErrInvalidExchange)
+	}
+	userID, err := claims.UserID()
+	if err != nil {
+		return domain.TokenResponse{}, fmt.Errorf("%w: invalid subject_token", domain.ErrInvalidExchange)
+	}
+	if jkt := claims.DPoPJKT(); jkt != "" && jkt != dpopJKT {
+		// otherwise a stolen bound token could be exchanged for a bearer one
+		return domain.TokenResponse{}, domain.ErrInvalidDPoPProof
+	}
+
+	policy := client.Exchange
+	audience := req.Audience
+	if audience == "" && len(policy.Audiences) == 1 {
+		audience = policy.Audiences[0]
+	}
+	if !slices.Contains(policy.Audiences, audience) {
+		return domain.TokenResponse{}, domain.ErrInvalidTarget
+	}
+	scopes, err := exchangeScopes(policy, strings.Fields(claims.Scope), req.Scope)
+	if err != nil {
+		return domain.TokenResponse{}, err
+	}
+
+	ttl := policy.TokenTTL
+	if ttl <= 0 {
+		ttl = o.cfg.AccessTokenTTL
+	}
+	if remaining := time.Until(claims.ExpiresAt.Time).Truncate(time.Second); remaining < ttl {
+		ttl = remaining
+	}
+	if ttl <= 0 {
+		return domain.TokenResponse{}, fmt.Errorf("%w: subject_token expired", domain.ErrInvalidExchange)
+	}
+
+	accessToken, err := o.tokenManager.NewAccessToken(auth.TokenParams{
+		UserID:      userID,
+		ClientID:    client.ID,
+		SessionID:   claims.SessionID,
+		OrgID:       claims.OrgID,
+		Permissions: scopes,
+		DPoPJKT:     dpopJKT,
+		Audience:    []string{audience},
+		Actor:       &auth.Actor{Subject: client.ID, Actor: claims.Actor},
+		TTL:         ttl,
+	})
+	if err != nil {
+		return domain.TokenResponse{}, fmt.Errorf("%s: tokenManager.NewAccessToken: %w", op, err)
+	}
+	tokenType := "Bearer"
+	if dpopJKT != "" {
+		tokenType = "DPoP"
+	}
+	return domain.TokenResponse{
+		AccessToken:     accessToken,
+		TokenType:       tokenType,
+		ExpiresIn:       int64(ttl.Seconds()),
+		Scope:           strings.Join(scopes, " "),
+		IssuedTokenType: domain.TokenTypeAccessToken,
+	}, nil
+}
+
+// exchangeScopes returns requested scopes if the subject token has them and the policy allows them, all such scopes
+// if none requested. Returns domain.ErrScopeNotAllowed if any requested scope is not allowed
+func exchangeScopes(policy domain.ExchangePolicy, subjectScopes []string, scope string) ([]string, error) {
+	allowed := slices.DeleteFunc(subjectScopes, func(s string) bool { return !slices.Contains(policy.Scopes, s) })
+	requested := strings.Fields(scope)
+	if len(requested) == 0 {
+		return allowed, nil
+	}
+	scopes := make([]string, 0, len(requested))
+	for _, s := range requested {
+		if !slices.Contains(allowed, s) {
+			return nil, domain.ErrScopeNotAllowed
+		}
+		if !slices.Contains(scopes, s) {
+			scopes = append(scopes, s)
+		}
+	}
+	return scopes, nil
+}
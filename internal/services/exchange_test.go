@@ -0,0 +1,149 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/qPyth/mobydev-internship-auth/internal/domain"
+	"github.com/qPyth/mobydev-internship-auth/pkg/auth"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+// exchangeTestClient may exchange tokens for the orders service keeping users:read
+var exchangeTestClient = domain.Client{
+	ID:         "gateway",
+	Name:       "Gateway",
+	GrantTypes: []string{domain.GrantTypeTokenExchange},
+	Exchange: domain.ExchangePolicy{
+		Audiences: []string{"orders"},
+		Scopes:    []string{"users:read"},
+		TokenTTL:  5 * time.Minute,
+	},
+}
+
+// exchangedClaims returns claims of the exchanged token, its audience is not accepted by the test token manager
+func exchangedClaims(t *testing.T, token string) *auth.Claims {
+	t.Helper()
+	var claims auth.Claims
+	if _, _, err := jwt.NewParser().ParseUnverified(token, &claims); err != nil {
+		t.Fatalf("ParseUnverified: %v", err)
+	}
+	return &claims
+}
+
+func TestOAuthService_ExchangeToken(t *testing.T) {
+	tests := []struct {
+		name   string
+		client func(client domain.Client) domain.Client
+		req    domain.TokenExchangeRequest
+		// subjectJKT binds the subject token to a DPoP key, dpopJKT is thumbprint of the proof sent with the request
+		subjectJKT string
+		dpopJKT    string
+		wantErr    error
+		wantScope  string
+		wantJKT    string
+	}{
+		{name: "permissions allowed by the policy", wantScope: "users:read"},
+		{name: "requested scope", req: domain.TokenExchangeRequest{Scope: "users:read"}, wantScope: "users:read"},
+		{name: "scope not allowed by the policy", req: domain.TokenExchangeRequest{Scope: "users:write"}, wantErr: domain.ErrScopeNotAllowed},
+		{name: "audience of the policy", req: domain.TokenExchangeRequest{Audience: "orders"}, wantScope: "users:read"},
+		{name: "audience not in the policy", req: domain.TokenExchangeRequest{Audience: "billing"}, wantErr: domain.ErrInvalidTarget},
+		{name: "no audience with several in the policy", client: func(client domain.Client) domain.Client {
+			client.Exchange.Audiences = []string{"orders", "billing"}
+			return client
+		}, wantErr: domain.ErrInvalidTarget},
+		{name: "client without the grant", client: func(client domain.Client) domain.Client {
+			client.GrantTypes = []string{domain.GrantTypeClientCredentials}
+			return client
+		}, wantErr: domain.ErrUnauthorizedClient},
+		{name: "unsupported subject token type", req: domain.TokenExchangeRequest{SubjectTokenType: "urn:ietf:params:oauth:token-type:id_token"}, wantErr: domain.ErrInvalidExchange},
+		{name: "invalid subject token", req: domain.TokenExchangeRequest{SubjectToken: "invalid"}, wantErr: domain.ErrInvalidExchange},
+		{name: "bearer subject token with a proof is bound to its key", dpopJKT: "client-key", wantScope: "users:read", wantJKT: "client-key"},
+		{name: "bound subject token with a proof of its key", subjectJKT: "user-key", dpopJKT: "user-key", wantScope: "users:read", wantJKT: "user-key"},
+		{name: "bound subject token without a proof", subjectJKT: "user-key", wantErr: domain.ErrInvalidDPoPProof},
+		{name: "bound subject token with a proof of another key", subjectJKT: "user-key", dpopJKT: "client-key", wantErr: domain.ErrInvalidDPoPProof},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			storage := newTestStorage(t)
+			users := newTestUserService(t, storage)
+			oauth := newTestOAuthService(t, users, storage)
+			ctx := context.Background()
+			if err := users.SignUp(ctx, "user@example.com", "password1"); err != nil {
+				t.Fatalf("SignUp: %v", err)
+			}
+			if err := NewRoleService(storage, storage).AssignRoleByEmail(ctx, "user@example.com", "admin"); err != nil {
+				t.Fatalf("AssignRoleByEmail: %v", err)
+			}
+			tokens, err := users.SignIn(ctx, "user@example.com", "password1", domain.SessionMeta{DPoPJKT: tt.subjectJKT})
+			if err != nil {
+				t.Fatalf("SignIn: %v", err)
+			}
+
+			client := exchangeTestClient
+			if tt.client != nil {
+				client = tt.client(client)
+			}
+			req := tt.req
+			if req.SubjectToken == "" {
+				req.SubjectToken = tokens.AccessToken
+			}
+			if req.SubjectTokenType == "" {
+				req.SubjectTokenType = domain.TokenTypeAccessToken
+			}
+
+			resp, err := oauth.ExchangeToken(ctx, client, req, tt.dpopJKT)
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Fatalf("got error %v, want %v", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ExchangeToken: %v", err)
+			}
+			if resp.Scope != tt.wantScope {
+				t.Fatalf("got scope %q, want %q", resp.Scope, tt.wantScope)
+			}
+			claims := exchangedClaims(t, resp.AccessToken)
+			if !slices.Equal(claims.Audience, jwt.ClaimStrings{"orders"}) {
+				t.Fatalf("got audience %v, want orders", claims.Audience)
+			}
+			if claims.Actor == nil || claims.Actor.Subject != client.ID {
+				t.Fatalf("got actor %+v, want %s", claims.Actor, client.ID)
+			}
+			if strings.Contains(claims.Scope, "users:write") {
+				t.Fatalf("got scope %q, users:write is not allowed by the policy", claims.Scope)
+			}
+			if claims.DPoPJKT() != tt.wantJKT {
+				t.Fatalf("got jkt %q, want %q", claims.DPoPJKT(), tt.wantJKT)
+			}
+			if ttl := claims.ExpiresAt.Sub(claims.IssuedAt.Time); ttl > client.Exchange.TokenTTL {
+				t.Fatalf("got lifetime %s, want at most %s", ttl, client.Exchange.TokenTTL)
+			}
+		})
+	}
+}
+
+func TestOAuthService_ExchangeTokenRequiresUserSession(t *testing.T) {
+	storage := newTestStorage(t)
+	users := newTestUserService(t, storage)
+	oauth := newTestOAuthService(t, users, storage)
+	ctx, _, _ := signUpAndIn(t, users, "user@example.com", "password1")
+	_, personalToken, err := users.CreatePersonalToken(ctx, "ci", nil, time.Hour)
+	if err != nil {
+		t.Fatalf("CreatePersonalToken: %v", err)
+	}
+
+	_, err = oauth.ExchangeToken(ctx, exchangeTestClient, domain.TokenExchangeRequest{
+		SubjectToken:     personalToken,
+		SubjectTokenType: domain.TokenTypeAccessToken,
+	}, "")
+	if !errors.Is(err, domain.ErrInvalidExchange) {
+		t.Fatalf("got error %v, want ErrInvalidExchange", err)
+	}
+}
@@ -0,0 +1,178 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/qPyth/mobydev-internship-auth/internal/domain"
+	"time"
+)
+
+// GroupService manages groups of the active organization from context
+type GroupService struct {
+	groupStorage GroupStorage
+}
+
+type GroupStorage interface {
+	CreateGroup(ctx context.Context, group *domain.Group) error
+	ListGroups(ctx context.Context, orgID uint) ([]domain.Group, error)
+	GetGroup(ctx context.Context, orgID, id uint) (domain.Group, error)
+	DeleteGroup(ctx context.Context, orgID, id uint) error
+	ListGroupMembers(ctx context.Context, orgID, groupID uint, transitive bool) ([]domain.Membership, error)
+	AddGroupMember(ctx context.Context, orgID, groupID, userID uint) error
+	RemoveGroupMember(ctx context.Context, orgID, groupID, userID uint) error
+	AddSubgroup(ctx context.Context, orgID, parentID, childID uint) error
+	RemoveSubgroup(ctx context.Context, orgID, parentID, childID uint) error
+	AssignGroupRole(ctx context.Context, orgID, groupID uint, role string) error
+	UnassignGroupRole(ctx context.Context, orgID, groupID uint, role string) error
+	GetUserGroups(ctx context.Context, orgID, userID uint) ([]domain.Group, error)
+}
+
+// groupErrors are returned by GroupService without wrapping
+var groupErrors = []error{
+	domain.ErrGroupNotFound,
+	domain.ErrGroupExists,
+	domain.ErrGroupCycle,
+	domain.ErrNotOrgMember,
+	domain.ErrRoleNotFound,
+}
+
+// NewGroupService creates a new group service
+func NewGroupService(groupStorage GroupStorage) *GroupService {
+	return &GroupService{groupStorage: groupStorage}
+}
+
+// CreateGroup creates group in the active organization. Returns domain.ErrNoActiveOrg or domain.ErrGroupExists
+func (g *GroupService) CreateGroup(ctx context.Context, name string) (domain.Group, error) {
+	orgID, err := activeOrgID(ctx)
+	if err != nil {
+		return domain.Group{}, err
+	}
+	group := domain.Group{OrgID: orgID, Name: name, CreatedAt: time.Now()}
+	err = g.groupStorage.CreateGroup(ctx, &group)
+	return group, groupError("GroupService.CreateGroup: groupStorage.CreateGroup", err)
+}
+
+// ListGroups returns groups of the active organization. Returns domain.ErrNoActiveOrg
+func (g *GroupService) ListGroups(ctx context.Context) ([]domain.Group, error) {
+	orgID, err := activeOrgID(ctx)
+	if err != nil {
+		return nil, err
+	}
+	groups, err := g.groupStorage.ListGroups(ctx, orgID)
+	return groups, groupError("GroupService.ListGroups: groupStorage.ListGroups", err)
+}
+
+// GetGroup returns group of the active organization with its direct roles, members and child groups.
+// Returns domain.ErrNoActiveOrg or domain.ErrGroupNotFound
+func (g *GroupService) GetGroup(ctx context.Context, id uint) (domain.Group, error) {
+	orgID, err := activeOrgID(ctx)
+	if err != nil {
+		return domain.Group{}, err
+	}
+	group, err := g.groupStorage.GetGroup(ctx, orgID, id)
+	return group, groupError("GroupService.GetGroup: groupStorage.GetGroup", err)
+}
+
+// DeleteGroup deletes group of the active organization. Returns domain.ErrNoActiveOrg or domain.ErrGroupNotFound
+func (g *GroupService) DeleteGroup(ctx context.Context, id uint) error {
+	orgID, err := activeOrgID(ctx)
+	if err != nil {
+		return err
+	}
+	return groupError("GroupService.DeleteGroup: groupStorage.DeleteGroup", g.groupStorage.DeleteGroup(ctx, orgID, id))
+}
+
+// ListGroupMembers returns direct or, if transitive, also members of nested groups of the group.
+// Returns domain.ErrNoActiveOrg or domain.ErrGroupNotFound
+func (g *GroupService) ListGroupMembers(ctx context.Context, groupID uint, transitive bool) ([]domain.Membership, error) {
+	orgID, err := activeOrgID(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := g.groupStorage.GetGroup(ctx, orgID, groupID); err != nil {
+		return nil, groupError("GroupService.ListGroupMembers: groupStorage.GetGroup", err)
+	}
+	members, err := g.groupStorage.ListGroupMembers(ctx, orgID, groupID, transitive)
+	return members, groupError("GroupService.ListGroupMembers: groupStorage.ListGroupMembers", err)
+}
+
+// AddGroupMember adds member of the active organization to the group.
+// Returns domain.ErrNoActiveOrg, domain.ErrGroupNotFound or domain.ErrNotOrgMember
+func (g *GroupService) AddGroupMember(ctx context.Context, groupID, userID uint) error {
+	orgID, err := activeOrgID(ctx)
+	if err != nil {
+		return err
+	}
+	return groupError("GroupService.AddGroupMember: groupStorage.AddGroupMember", g.groupStorage.AddGroupMember(ctx, orgID, groupID, userID))
+}
+
+// RemoveGroupMember removes user from the group. Returns domain.ErrNoActiveOrg or domain.ErrGroupNotFound
+func (g *GroupService) RemoveGroupMember(ctx context.Context, groupID, userID uint) error {
+	orgID, err := activeOrgID(ctx)
+	if err != nil {
+		return err
+	}
+	return groupError("GroupService.RemoveGroupMember: groupStorage.RemoveGroupMember", g.groupStorage.RemoveGroupMember(ctx, orgID, groupID, userID))
+}
+
+// AddSubgroup makes child group a member of parent group.
+// Returns domain.ErrNoActiveOrg, domain.ErrGroupNotFound or domain.ErrGroupCycle if it would make a cycle
+func (g *GroupService) AddSubgroup(ctx context.Context, parentID, childID uint) error {
+	orgID, err := activeOrgID(ctx)
+	if err != nil {
+		return err
+	}
+	return groupError("GroupService.AddSubgroup: groupStorage.AddSubgroup", g.groupStorage.AddSubgroup(ctx, orgID, parentID, childID))
+}
+
+// RemoveSubgroup removes child group from parent group. Returns domain.ErrNoActiveOrg or domain.ErrGroupNotFound
+func (g *GroupService) RemoveSubgroup(ctx context.Context, parentID, childID uint) error {
+	orgID, err := activeOrgID(ctx)
+	if err != nil {
+		return err
+	}
+	return groupError("GroupService.RemoveSubgroup: groupStorage.RemoveSubgroup", g.groupStorage.RemoveSubgroup(ctx, orgID, parentID, childID))
+}
+
+// AssignGroupRole assigns organization role to the group, it is granted to all transitive members.
+// Returns domain.ErrNoActiveOrg, domain.ErrGroupNotFound or domain.ErrRoleNotFound
+func (g *GroupService) AssignGroupRole(ctx context.Context, groupID uint, role string) error {
+	orgID, err := activeOrgID(ctx)
+	if err != nil {
+		return err
+	}
+	return groupError("GroupService.AssignGroupRole: groupStorage.AssignGroupRole", g.groupStorage.AssignGroupRole(ctx, orgID, groupID, role))
+}
+
+// UnassignGroupRole removes organization role from the group.
+// Returns domain.ErrNoActiveOrg, domain.ErrGroupNotFound or domain.ErrRoleNotFound
+func (g *GroupService) UnassignGroupRole(ctx context.Context, groupID uint, role string) error {
+	orgID, err := activeOrgID(ctx)
+	if err != nil {
+		return err
+	}
+	return groupError("GroupService.UnassignGroupRole: groupStorage.UnassignGroupRole", g.groupStorage.UnassignGroupRole(ctx, orgID, groupID, role))
+}
+
+// groupError returns nil and domain errors as is and wraps other errors with op
+func groupError(op string, err error) error {
+	if err == nil {
+		return nil
+	}
+	for _, target := range groupErrors {
+		if errors.Is(err, target) {
+			return err
+		}
+	}
+	return fmt.Errorf("%s: %w", op, err)
+}
+
+// groupNames returns names of the groups
+func groupNames(groups []domain.Group) []string {
+	names := make([]string, 0, len(groups))
+	for _, group := range groups {
+		names = append(names, group.Name)
+	}
+	return names
+}
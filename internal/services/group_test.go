@@ -0,0 +1,115 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"github.com/qPyth/mobydev-internship-auth/internal/domain"
+	"testing"
+)
+
+func TestGroupService_AddSubgroupRejectsCycles(t *testing.T) {
+	storage := newTestStorage(t)
+	groups := NewGroupService(storage)
+	ctx, _, _ := signUpAndIn(t, newTestUserService(t, storage), "owner@example.com", "password1")
+	ctx, _ = createTestOrg(t, ctx, NewOrganizationService(storage))
+
+	// a contains b, b contains c
+	a, b, c := createTestGroup(t, ctx, groups, "a"), createTestGroup(t, ctx, groups, "b"), createTestGroup(t, ctx, groups, "c")
+	if err := groups.AddSubgroup(ctx, a, b); err != nil {
+		t.Fatalf("AddSubgroup: %v", err)
+	}
+	if err := groups.AddSubgroup(ctx, b, c); err != nil {
+		t.Fatalf("AddSubgroup: %v", err)
+	}
+
+	tests := []struct {
+		name          string
+		parent, child uint
+		wantErr       error
+	}{
+		{name: "group into itself", parent: a, child: a, wantErr: domain.ErrGroupCycle},
+		{name: "parent into child", parent: b, child: a, wantErr: domain.ErrGroupCycle},
+		{name: "ancestor into descendant", parent: c, child: a, wantErr: domain.ErrGroupCycle},
+		{name: "unknown group", parent: a, child: 100, wantErr: domain.ErrGroupNotFound},
+		{name: "descendant into ancestor directly", parent: a, child: c},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := groups.AddSubgroup(ctx, tt.parent, tt.child)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("got error %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestGroupService_RolesOfNestedGroups(t *testing.T) {
+	storage := newTestStorage(t)
+	users := newTestUserService(t, storage)
+	groups := NewGroupService(storage)
+	ctx, _, _ := signUpAndIn(t, users, "owner@example.com", "password1")
+	ctx, org := createTestOrg(t, ctx, NewOrganizationService(storage))
+	_, memberID, _ := signUpAndIn(t, users, "member@example.com", "password1")
+	addTestMember(t, storage, org.ID, memberID, "member@example.com")
+
+	// the member is in c, c is in b, b is in a, a has org_admin
+	a, b, c := createTestGroup(t, ctx, groups, "a"), createTestGroup(t, ctx, groups, "b"), createTestGroup(t, ctx, groups, "c")
+	for _, err := range []error{
+		groups.AddSubgroup(ctx, a, b),
+		groups.AddSubgroup(ctx, b, c),
+		groups.AddGroupMember(ctx, c, memberID),
+		groups.AssignGroupRole(ctx, a, OrgOwnerRole),
+	} {
+		if err != nil {
+			t.Fatalf("setup: %v", err)
+		}
+	}
+
+	if !hasRole(t, storage, org.ID, memberID, OrgOwnerRole) {
+		t.Fatal("role of the ancestor group is not granted")
+	}
+	members, err := groups.ListGroupMembers(ctx, a, true)
+	if err != nil {
+		t.Fatalf("ListGroupMembers: %v", err)
+	}
+	if len(members) != 1 || members[0].UserID != memberID {
+		t.Fatalf("got transitive members %v, want the member", members)
+	}
+	direct, err := groups.ListGroupMembers(ctx, a, false)
+	if err != nil {
+		t.Fatalf("ListGroupMembers: %v", err)
+	}
+	if len(direct) != 0 {
+		t.Fatalf("got direct members %v, want none", direct)
+	}
+
+	if err := groups.RemoveSubgroup(ctx, b, c); err != nil {
+		t.Fatalf("RemoveSubgroup: %v", err)
+	}
+	if hasRole(t, storage, org.ID, memberID, OrgOwnerRole) {
+		t.Fatal("role is granted after the group left the ancestor")
+	}
+}
+
+func createTestGroup(t *testing.T, ctx context.Context, groups *GroupService, name string) uint {
+	t.Helper()
+	group, err := groups.CreateGroup(ctx, name)
+	if err != nil {
+		t.Fatalf("CreateGroup: %v", err)
+	}
+	return group.ID
+}
+
+func hasRole(t *testing.T, storage OrgStorage, orgID, userID uint, name string) bool {
+	t.Helper()
+	roles, err := storage.GetMemberRoles(context.Background(), orgID, userID)
+	if err != nil {
+		t.Fatalf("GetMemberRoles: %v", err)
+	}
+	for _, role := range roles {
+		if role.Name == name {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,272 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/qPyth/mobydev-internship-auth/internal/domain"
+	"github.com/qPyth/mobydev-internship-auth/internal/mailer"
+	"github.com/qPyth/mobydev-internship-auth/pkg/auth"
+	"net/url"
+	"time"
+)
+
+type InvitationService struct {
+	invitationStorage InvitationStorage
+	orgStorage        OrgStorage
+	userStorage       UserStorage
+	mailer            Mailer
+	cfg               InvitationConfig
+}
+
+type InvitationConfig struct {
+	TTL time.Duration
+	// AcceptURL is the page which accepts invitation, the token is added as token query param
+	AcceptURL string
+}
+
+type InvitationStorage interface {
+	CreateInvitation(ctx context.Context, invitation *domain.Invitation) error
+	MarkInvitationSent(ctx context.Context, invitation domain.Invitation, sentAt time.Time) error
+	DeleteInvitation(ctx context.Context, id uint) error
+	GetInvitation(ctx context.Context, orgID, id uint) (domain.Invitation, error)
+	GetInvitationByToken(ctx context.Context, tokenHash string) (domain.Invitation, error)
+	ListInvitations(ctx context.Context, orgID uint) ([]domain.Invitation, error)
+	RenewInvitation(ctx context.Context, orgID, id uint, tokenHash string, expiresAt time.Time) error
+	RevokeInvitation(ctx context.Context, orgID, id uint) error
+	AcceptInvitation(ctx context.Context, invitation domain.Invitation, user *domain.User, now time.Time) error
+}
+
+type Mailer interface {
+	Send(ctx context.Context, msg mailer.Message) error
+}
+
+// NewInvitationService creates a new invitation service
+func NewInvitationService(invitationStorage InvitationStorage, orgStorage OrgStorage, userStorage UserStorage, mailer Mailer, cfg InvitationConfig) *InvitationService {
+	return &InvitationService{
+		invitationStorage: invitationStorage,
+		orgStorage:        orgStorage,
+		userStorage:       userStorage,
+		mailer:            mailer,
+		cfg:               cfg,
+	}
+}
+
+// Invite invites email to the active organization from context with organization roles and sends the invitation link.
+// Pending invitations of the same email are revoked once it is sent, the invitation is deleted if it can not be sent.
+// Returns domain.ErrNoActiveOrg, domain.ErrRoleNotFound or domain.ErrAlreadyMember
+func (i *InvitationService) Invite(ctx context.Context, email string, roles []string) (domain.Invitation, error) {
+	op := "InvitationService.Invite"
+	orgID, err := activeOrgID(ctx)
+	if err != nil {
+		return domain.Invitation{}, err
+	}
+	userID, ok := auth.UserIDFromContext(ctx)
+	if !ok {
+		return domain.Invitation{}, fmt.Errorf("userID not found in context")
+	}
+
+	token, err := auth.RandomString(32)
+	if err != nil {
+		return domain.Invitation{}, fmt.Errorf("%s: auth.RandomString: %w", op, err)
+	}
+	now := time.Now()
+	invitation := domain.Invitation{
+		OrgID:     orgID,
+		Email:     email,
+		Roles:     roles,
+		TokenHash: auth.HashToken(token),
+		InvitedBy: userID,
+		CreatedAt: now,
+		ExpiresAt: now.Add(i.cfg.TTL),
+	}
+	msg, err := i.message(ctx, invitation, token)
+	if err != nil {
+		return domain.Invitation{}, fmt.Errorf("%s: %w", op, err)
+	}
+	// the email is sent after commit, so the database is not locked while the mail server responds
+	if err := i.invitationStorage.CreateInvitation(ctx, &invitation); err != nil {
+		if errors.Is(err, domain.ErrRoleNotFound) || errors.Is(err, domain.ErrAlreadyMember) {
+			return domain.Invitation{}, err
+		}
+		return domain.Invitation{}, fmt.Errorf("%s: invitationStorage.CreateInvitation: %w", op, err)
+	}
+	if err := i.mailer.Send(ctx, msg); err != nil {
+		if deleteErr := i.invitationStorage.DeleteInvitation(ctx, invitation.ID); deleteErr != nil {
+			return domain.Invitation{}, fmt.Errorf("%s: mailer.Send: %w, invitationStorage.DeleteInvitation: %w", op, err, deleteErr)
+		}
+		return domain.Invitation{}, fmt.Errorf("%s: mailer.Send: %w", op, err)
+	}
+	if err := i.invitationStorage.MarkInvitationSent(ctx, invitation, time.Now()); err != nil {
+		return domain.Invitation{}, fmt.Errorf("%s: invitationStorage.MarkInvitationSent: %w", op, err)
+	}
+	return invitation, nil
+}
+
+// ListInvitations returns pending invitations of the active organization from context.
+// Returns domain.ErrNoActiveOrg if the token has no active organization
+func (i *InvitationService) ListInvitations(ctx context.Context) ([]domain.Invitation, error) {
+	op := "InvitationService.ListInvitations"
+	orgID, err := activeOrgID(ctx)
+	if err != nil {
+		return nil, err
+	}
+	invitations, err := i.invitationStorage.ListInvitations(ctx, orgID)
+	if err != nil {
+		return nil, fmt.Errorf("%s: invitationStorage.ListInvitations: %w", op, err)
+	}
+	return invitations, nil
+}
+
+// Resend sends invitation of the active organization from context again with a new token and expiration time,
+// the previous link stops working. If the email can not be sent the previous link is restored. Returns domain.ErrNoActiveOrg or domain.ErrInvitationNotFound
+func (i *InvitationService) Resend(ctx context.Context, id uint) error {
+	op := "InvitationService.Resend"
+	orgID, err := activeOrgID(ctx)
+	if err != nil {
+		return err
+	}
+	invitation, err := i.invitationStorage.GetInvitation(ctx, orgID, id)
+	if err != nil {
+		if errors.Is(err, domain.ErrInvitationNotFound) {
+			return err
+		}
+		return fmt.Errorf("%s: invitationStorage.GetInvitation: %w", op, err)
+	}
+
+	token, err := auth.RandomString(32)
+	if err != nil {
+		return fmt.Errorf("%s: auth.RandomString: %w", op, err)
+	}
+	previous := invitation
+	invitation.ExpiresAt = time.Now().Add(i.cfg.TTL)
+	if err := i.invitationStorage.RenewInvitation(ctx, orgID, id, auth.HashToken(token), invitation.ExpiresAt); err != nil {
+		if errors.Is(err, domain.ErrInvitationNotFound) {
+			return err
+		}
+		return fmt.Errorf("%s: invitationStorage.RenewInvitation: %w", op, err)
+	}
+
+	if err := i.send(ctx, invitation, token); err != nil {
+		restoreErr := i.invitationStorage.RenewInvitation(ctx, orgID, id, previous.TokenHash, previous.ExpiresAt)
+		if restoreErr != nil && !errors.Is(restoreErr, domain.ErrInvitationNotFound) {
+			return fmt.Errorf("%s: %w, invitationStorage.RenewInvitation: %w", op, err, restoreErr)
+		}
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	return nil
+}
+
+// Revoke revokes pending invitation of the active organization from context.
+// Returns domain.ErrNoActiveOrg or domain.ErrInvitationNotFound
+func (i *InvitationService) Revoke(ctx context.Context, id uint) error {
+	op := "InvitationService.Revoke"
+	orgID, err := activeOrgID(ctx)
+	if err != nil {
+		return err
+	}
+	if err := i.invitationStorage.RevokeInvitation(ctx, orgID, id); err != nil {
+		if errors.Is(err, domain.ErrInvitationNotFound) {
+			return err
+		}
+		return fmt.Errorf("%s: invitationStorage.RevokeInvitation: %w", op, err)
+	}
+	return nil
+}
+
+// Accept accepts invitation by its token. Existing user with the invitation email is added to the organization,
+// otherwise a new user is created with password. The email of the user becomes verified. Returns domain.ErrInvalidInvitation if token is unknown,
+// expired, revoked or already used and domain.ErrPasswordRequired if a new user is created without password
+func (i *InvitationService) Accept(ctx context.Context, token, password string) (domain.Invitation, error) {
+	op := "InvitationService.Accept"
+	invitation, err := i.invitationStorage.GetInvitationByToken(ctx, auth.HashToken(token))
+	if err != nil {
+		if errors.Is(err, domain.ErrInvalidInvitation) {
+			return domain.Invitation{}, err
+		}
+		return domain.Invitation{}, fmt.Errorf("%s: invitationStorage.GetInvitationByToken: %w", op, err)
+	}
+	now := time.Now()
+	if !invitation.Pending(now) {
+		return domain.Invitation{}, domain.ErrInvalidInvitation
+	}
+
+	user, err := i.invitedUser(ctx, invitation.Email, password)
+	if err != nil {
+		if errors.Is(err, domain.ErrPasswordRequired) {
+			return domain.Invitation{}, err
+		}
+		return domain.Invitation{}, fmt.Errorf("%s: %w", op, err)
+	}
+	err = i.invitationStorage.AcceptInvitation(ctx, invitation, &user, now)
+	if errors.Is(err, domain.ErrEmailExists) {
+		// the user signed up after being looked up
+		user, err = i.invitedUser(ctx, invitation.Email, password)
+		if err != nil {
+			return domain.Invitation{}, fmt.Errorf("%s: %w", op, err)
+		}
+		err = i.invitationStorage.AcceptInvitation(ctx, invitation, &user, now)
+	}
+	if err != nil {
+		if errors.Is(err, domain.ErrInvalidInvitation) {
+			return domain.Invitation{}, err
+		}
+		return domain.Invitation{}, fmt.Errorf("%s: invitationStorage.AcceptInvitation: %w", op, err)
+	}
+	invitation.AcceptedAt = &now
+	return invitation, nil
+}
+
+// invitedUser returns existing user with the invitation email or a new user without id which is created
+// together with accepting the invitation. Returns domain.ErrPasswordRequired if there is no user and no password
+func (i *InvitationService) invitedUser(ctx context.Context, email, password string) (domain.User, error) {
+	user, err := i.userStorage.GetUser(ctx, email)
+	if err == nil {
+		return user, nil
+	}
+	if !errors.Is(err, domain.ErrUserNotFound) {
+		return domain.User{}, fmt.Errorf("userStorage.GetUser: %w", err)
+	}
+	if password == "" {
+		return domain.User{}, domain.ErrPasswordRequired
+	}
+	hashPass, err := hashPassword(password)
+	if err != nil {
+		return domain.User{}, err
+	}
+	return domain.User{Email: email, HashPass: string(hashPass)}, nil
+}
+
+// send emails invitation link with token
+func (i *InvitationService) send(ctx context.Context, invitation domain.Invitation, token string) error {
+	msg, err := i.message(ctx, invitation, token)
+	if err != nil {
+		return err
+	}
+	if err := i.mailer.Send(ctx, msg); err != nil {
+		return fmt.Errorf("mailer.Send: %w", err)
+	}
+	return nil
+}
+
+// message returns email with invitation link with token
+func (i *InvitationService) message(ctx context.Context, invitation domain.Invitation, token string) (mailer.Message, error) {
+	org, err := i.orgStorage.GetOrganization(ctx, invitation.OrgID)
+	if err != nil {
+		return mailer.Message{}, fmt.Errorf("orgStorage.GetOrganization: %w", err)
+	}
+	link, err := url.Parse(i.cfg.AcceptURL)
+	if err != nil {
+		return mailer.Message{}, fmt.Errorf("invalid accept url: %w", err)
+	}
+	query := link.Query()
+	query.Set("token", token)
+	link.RawQuery = query.Encode()
+
+	return mailer.Message{
+		To:      invitation.Email,
+		Subject: fmt.Sprintf("Invitation to join %s", org.Name),
+		Body: fmt.Sprintf("You have been invited to join %s.\n\nAccept the invitation: %s\n\nThe link expires at %s.\n",
+			org.Name, link.String(), invitation.ExpiresAt.UTC().Format(time.RFC1123)),
+	}, nil
+}
@@ -0,0 +1,98 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"github.com/qPyth/mobydev-internship-auth/internal/domain"
+	"testing"
+	"time"
+)
+
+func TestInvitationService_Accept(t *testing.T) {
+	storage := newTestStorage(t)
+	users := newTestUserService(t, storage)
+	orgs := NewOrganizationService(storage)
+	mail := &mailbox{}
+	invitations := NewInvitationService(storage, storage, storage, mail, InvitationConfig{TTL: time.Hour, AcceptURL: "http://app.test/accept"})
+
+	ctx, _, _ := signUpAndIn(t, users, "owner@example.com", "password1")
+	ctx, org := createTestOrg(t, ctx, orgs)
+
+	mail.err = errors.New("smtp is down")
+	if _, err := invitations.Invite(ctx, "new@example.com", []string{"org_member"}); err == nil {
+		t.Fatal("Invite succeeded without email")
+	}
+	mail.err = nil
+	pending, err := invitations.ListInvitations(ctx)
+	if err != nil {
+		t.Fatalf("ListInvitations: %v", err)
+	}
+	if len(pending) != 0 {
+		t.Fatalf("got %d pending invitations after failed email, want 0", len(pending))
+	}
+
+	if _, err := invitations.Invite(ctx, "new@example.com", []string{"org_member"}); err != nil {
+		t.Fatalf("Invite: %v", err)
+	}
+	token := mail.lastToken(t, "new@example.com")
+
+	if _, err := invitations.Accept(context.Background(), token, ""); !errors.Is(err, domain.ErrPasswordRequired) {
+		t.Fatalf("accept without password: got error %v, want ErrPasswordRequired", err)
+	}
+	if _, err := storage.GetUser(context.Background(), "new@example.com"); !errors.Is(err, domain.ErrUserNotFound) {
+		t.Fatalf("user was created by failed accept: %v", err)
+	}
+
+	if _, err := invitations.Accept(context.Background(), token, "password2"); err != nil {
+		t.Fatalf("Accept: %v", err)
+	}
+	user, err := storage.GetUser(context.Background(), "new@example.com")
+	if err != nil {
+		t.Fatalf("GetUser: %v", err)
+	}
+	if !user.EmailVerified {
+		t.Fatal("email of the invited user is not verified")
+	}
+	if _, err := storage.GetMemberRoles(context.Background(), org.ID, user.ID); err != nil {
+		t.Fatalf("GetMemberRoles: %v", err)
+	}
+	if _, err := invitations.Accept(context.Background(), token, "password2"); !errors.Is(err, domain.ErrInvalidInvitation) {
+		t.Fatalf("second accept: got error %v, want ErrInvalidInvitation", err)
+	}
+}
+
+func TestInvitationService_FailedEmailKeepsPreviousLink(t *testing.T) {
+	storage := newTestStorage(t)
+	users := newTestUserService(t, storage)
+	orgs := NewOrganizationService(storage)
+	mail := &mailbox{}
+	invitations := NewInvitationService(storage, storage, storage, mail, InvitationConfig{TTL: time.Hour, AcceptURL: "http://app.test/accept"})
+	ctx, _, _ := signUpAndIn(t, users, "owner@example.com", "password1")
+	ctx, _ = createTestOrg(t, ctx, orgs)
+
+	invitation, err := invitations.Invite(ctx, "new@example.com", nil)
+	if err != nil {
+		t.Fatalf("Invite: %v", err)
+	}
+	token := mail.lastToken(t, "new@example.com")
+
+	mail.err = errors.New("smtp is down")
+	if _, err := invitations.Invite(ctx, "new@example.com", nil); err == nil {
+		t.Fatal("second Invite succeeded without email")
+	}
+	if err := invitations.Resend(ctx, invitation.ID); err == nil {
+		t.Fatal("Resend succeeded without email")
+	}
+	mail.err = nil
+
+	pending, err := invitations.ListInvitations(ctx)
+	if err != nil {
+		t.Fatalf("ListInvitations: %v", err)
+	}
+	if len(pending) != 1 || pending[0].ID != invitation.ID {
+		t.Fatalf("got pending invitations %+v, want only the first one", pending)
+	}
+	if _, err := invitations.Accept(context.Background(), token, "password2"); err != nil {
+		t.Fatalf("Accept of the previous link: %v", err)
+	}
+}
@@ -0,0 +1,141 @@
+package services
+
+import (
+	"context"
+	"github.com/golang-jwt/jwt/v5"
+	_ "github.com/golang-migrate/migrate/v4/source/file"
+	"github.com/qPyth/mobydev-internship-auth/internal/domain"
+	"github.com/qPyth/mobydev-internship-auth/internal/mailer"
+	"github.com/qPyth/mobydev-internship-auth/internal/storage/sqlite"
+	"github.com/qPyth/mobydev-internship-auth/pkg/auth"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+const testIssuer = "http://auth.test"
+
+func TestMain(m *testing.M) {
+	// migrations are read from ./migrations of the working directory
+	if err := os.Chdir("../.."); err != nil {
+		panic(err)
+	}
+	os.Exit(m.Run())
+}
+
+// newTestStorage returns migrated sqlite storage in a temporary directory
+func newTestStorage(t *testing.T) *sqlite.Storage {
+	t.Helper()
+	return sqlite.New(filepath.Join(t.TempDir(), "auth.db"))
+}
+
+func newTestTokenManager(t *testing.T) *auth.Manager {
+	t.Helper()
+	key, err := auth.GenerateSigningKey(jwt.SigningMethodES256)
+	if err != nil {
+		t.Fatalf("GenerateSigningKey: %v", err)
+	}
+	return auth.NewManager(auth.NewKeyring(key, time.Hour), auth.ManagerConfig{
+		TokenTTL: 15 * time.Minute,
+		Issuer:   testIssuer,
+		Audience: []string{"mobydev-api"},
+	})
+}
+
+func newTestUserService(t *testing.T, storage *sqlite.Storage) *UserService {
+	t.Helper()
+	return NewUserService(storage, storage, storage, storage, storage, storage, storage, newTestTokenManager(t), Config{
+		AccessTokenTTL:         15 * time.Minute,
+		RefreshTokenTTL:        time.Hour,
+		SessionIdleTimeout:     time.Hour,
+		SessionAbsoluteTimeout: 24 * time.Hour,
+	})
+}
+
+// signUpAndIn creates a user and signs the user in, the returned context carries claims of the access token
+func signUpAndIn(t *testing.T, users *UserService, email, password string) (context.Context, uint, domain.Tokens) {
+	t.Helper()
+	ctx := context.Background()
+	if err := users.SignUp(ctx, email, password); err != nil {
+		t.Fatalf("SignUp: %v", err)
+	}
+	tokens, err := users.SignIn(ctx, email, password, domain.SessionMeta{})
+	if err != nil {
+		t.Fatalf("SignIn: %v", err)
+	}
+	claims, err := users.VerifyAccessToken(ctx, tokens.AccessToken)
+	if err != nil {
+		t.Fatalf("VerifyAccessToken: %v", err)
+	}
+	userID, _ := claims.UserID()
+	return auth.WithClaims(ctx, claims), userID, tokens
+}
+
+// createTestOrg creates organization of the user from ctx and returns ctx with it as the active organization
+func createTestOrg(t *testing.T, ctx context.Context, orgs *OrganizationService) (context.Context, domain.Organization) {
+	t.Helper()
+	org, err := orgs.CreateOrganization(ctx, "Org", "org")
+	if err != nil {
+		t.Fatalf("CreateOrganization: %v", err)
+	}
+	claims, _ := auth.ClaimsFromContext(ctx)
+	claims.OrgID = org.ID
+	return auth.WithClaims(ctx, claims), org
+}
+
+// addTestMember adds the user to the organization with roles
+func addTestMember(t *testing.T, storage *sqlite.Storage, orgID, userID uint, email string, roles ...string) {
+	t.Helper()
+	ctx, now := context.Background(), time.Now()
+	invitation := domain.Invitation{OrgID: orgID, Email: email, Roles: roles, TokenHash: "hash-" + email,
+		CreatedAt: now, ExpiresAt: now.Add(time.Hour)}
+	if err := storage.CreateInvitation(ctx, &invitation); err != nil {
+		t.Fatalf("CreateInvitation: %v", err)
+	}
+	if err := storage.MarkInvitationSent(ctx, invitation, now); err != nil {
+		t.Fatalf("MarkInvitationSent: %v", err)
+	}
+	if err := storage.AcceptInvitation(ctx, invitation, &domain.User{ID: userID}, now); err != nil {
+		t.Fatalf("AcceptInvitation: %v", err)
+	}
+}
+
+// mailbox records sent emails, err is returned by Send instead if set
+type mailbox struct {
+	mu       sync.Mutex
+	messages []mailer.Message
+	err      error
+}
+
+func (m *mailbox) Send(_ context.Context, msg mailer.Message) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.err != nil {
+		return m.err
+	}
+	m.messages = append(m.messages, msg)
+	return nil
+}
+
+// lastToken returns token query param of the link in the last email sent to the address
+func (m *mailbox) lastToken(t *testing.T, to string) string {
+	t.Helper()
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for i := len(m.messages) - 1; i >= 0; i-- {
+		if m.messages[i].To != to {
+			continue
+		}
+		for _, field := range strings.Fields(m.messages[i].Body) {
+			if link, err := url.Parse(field); err == nil && link.Query().Get("token") != "" {
+				return link.Query().Get("token")
+			}
+		}
+	}
+	t.Fatalf("no email with token to %s", to)
+	return ""
+}
@@ -0,0 +1,237 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/qPyth/mobydev-internship-auth/internal/domain"
+	"github.com/qPyth/mobydev-internship-auth/pkg/auth"
+	"golang.org/x/crypto/bcrypt"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	TokenTypeHintAccessToken  = "access_token"
+	TokenTypeHintRefreshToken = "refresh_token"
+)
+
+type OAuthService struct {
+	clientStorage        ClientStorage
+	authorizationStorage AuthorizationStorage
+	deviceCodeStorage    DeviceCodeStorage
+	userStorage          UserStorage
+	tokenVerifier        TokenVerifier
+	tokenIssuer          TokenIssuer
+	tokenManager         auth.TokenManager
+	idTokenSigner        IDTokenSigner
+	// userCodeLimiter limits wrong user codes entered by a user (RFC 8628 section 5.1)
+	userCodeLimiter *auth.AttemptLimiter
+	cfg             OAuthConfig
+}
+
+type OAuthConfig struct {
+	// Issuer identifies the OpenID Provider, endpoints in discovery metadata are resolved against it
+	Issuer string
+	// AccessTokenTTL is lifetime of access tokens issued by tokenManager, reported as expires_in
+	AccessTokenTTL time.Duration
+	// AuthorizationCodeTTL is lifetime of authorization codes
+	AuthorizationCodeTTL time.Duration
+	// ConsentURL is the page which signs the user in and asks to approve authorization requests
+	ConsentURL string
+	// DeviceCodeTTL is lifetime of device and user codes of the device authorization grant
+	DeviceCodeTTL time.Duration
+	// DevicePollInterval is the minimal time devices wait between token requests
+	DevicePollInterval time.Duration
+	// VerificationURL is the page where the user enters the user code and approves the device
+	VerificationURL string
+	// UserCodeMaxAttempts limits wrong user codes a user can enter per UserCodeAttemptWindow, 0 disables the limit
+	UserCodeMaxAttempts   int
+	UserCodeAttemptWindow time.Duration
+}
+
+type ClientStorage interface {
+	GetClient(ctx context.Context, id string) (domain.Client, error)
+}
+
+type TokenVerifier interface {
+	VerifyAccessToken(ctx context.Context, token string) (*auth.Claims, error)
+	InspectAccessToken(ctx context.Context, token string) (*auth.Claims, error)
+	VerifyRefreshToken(ctx context.Context, refreshToken string) (domain.RefreshToken, error)
+}
+
+// NewOAuthService creates a new OAuth 2.0 and OpenID Connect service
+func NewOAuthService(clientStorage ClientStorage, authorizationStorage AuthorizationStorage, deviceCodeStorage DeviceCodeStorage, userStorage UserStorage, tokenVerifier TokenVerifier, tokenIssuer TokenIssuer, tokenManager auth.TokenManager, idTokenSigner IDTokenSigner, cfg OAuthConfig) *OAuthService {
+	return &OAuthService{
+		clientStorage:        clientStorage,
+		authorizationStorage: authorizationStorage,
+		deviceCodeStorage:    deviceCodeStorage,
+		userStorage:          userStorage,
+		tokenVerifier:        tokenVerifier,
+		tokenIssuer:          tokenIssuer,
+		tokenManager:         tokenManager,
+		idTokenSigner:        idTokenSigner,
+		userCodeLimiter:      auth.NewAttemptLimiter(cfg.UserCodeMaxAttempts, cfg.UserCodeAttemptWindow),
+		cfg:                  cfg,
+	}
+}
+
+// AuthenticateClient returns confidential client by credentials.
+// Returns domain.ErrInvalidClient if client is unknown, public or secret is incorrect
+func (o *OAuthService) AuthenticateClient(ctx context.Context, clientID, clientSecret string) (domain.Client, error) {
+	op := "OAuthService.AuthenticateClient"
+	client, err := o.clientStorage.GetClient(ctx, clientID)
+	if err != nil {
+		if errors.Is(err, domain.ErrInvalidClient) {
+			return domain.Client{}, err
+		}
+		return domain.Client{}, fmt.Errorf("%s: clientStorage.GetClient: %w", op, err)
+	}
+	if client.SecretHash == "" {
+		return domain.Client{}, domain.ErrInvalidClient
+	}
+	if err := bcrypt.CompareHashAndPassword([]byte(client.SecretHash), []byte(clientSecret)); err != nil {
+		return domain.Client{}, domain.ErrInvalidClient
+	}
+	return client, nil
+}
+
+// PublicClient returns public client, which has no secret, by id. Returns domain.ErrInvalidClient if client
+// is unknown or confidential
+func (o *OAuthService) PublicClient(ctx context.Context, clientID string) (domain.Client, error) {
+	op := "OAuthService.PublicClient"
+	client, err := o.clientStorage.GetClient(ctx, clientID)
+	if err != nil {
+		if errors.Is(err, domain.ErrInvalidClient) {
+			return domain.Client{}, err
+		}
+		return domain.Client{}, fmt.Errorf("%s: clientStorage.GetClient: %w", op, err)
+	}
+	if client.SecretHash != "" {
+		return domain.Client{}, domain.ErrInvalidClient
+	}
+	return client, nil
+}
+
+// ClientCredentials issues access token to the authenticated client itself (RFC 6749 section 4.4), sub and client_id
+// claims of the token are the client id. scope is a space separated list of requested permissions, all scopes of the
+// client are granted if empty. Returns domain.ErrUnauthorizedClient if client may not use the grant
+// and domain.ErrScopeNotAllowed if any of requested scopes is not allowed for the client
+func (o *OAuthService) ClientCredentials(ctx context.Context, client domain.Client, scope string) (domain.TokenResponse, error) {
+	op := "OAuthService.ClientCredentials"
+	if !client.AllowsGrant(domain.GrantTypeClientCredentials) {
+		return domain.TokenResponse{}, domain.ErrUnauthorizedClient
+	}
+	scopes, err := clientScopes(client, scope)
+	if err != nil {
+		return domain.TokenResponse{}, err
+	}
+
+	accessToken, err := o.tokenManager.NewAccessToken(auth.TokenParams{ClientID: client.ID, Permissions: scopes})
+	if err != nil {
+		return domain.TokenResponse{}, fmt.Errorf("%s: tokenManager.NewAccessToken: %w", op, err)
+	}
+	return domain.TokenResponse{
+		AccessToken: accessToken,
+		TokenType:   "Bearer",
+		ExpiresIn:   int64(o.cfg.AccessTokenTTL.Seconds()),
+		Scope:       strings.Join(scopes, " "),
+	}, nil
+}
+
+// clientScopes returns requested scopes if all of them are allowed for the client, or all client scopes if none requested
+func clientScopes(client domain.Client, scope string) ([]string, error) {
+	requested := strings.Fields(scope)
+	if len(requested) == 0 {
+		return client.Scopes, nil
+	}
+	scopes := make([]string, 0, len(requested))
+	for _, s := range requested {
+		if !slices.Contains(client.Scopes, s) {
+			return nil, domain.ErrScopeNotAllowed
+		}
+		if !slices.Contains(scopes, s) {
+			scopes = append(scopes, s)
+		}
+	}
+	return scopes, nil
+}
+
+// Introspect returns state of access or refresh token (RFC 7662). Unknown, expired, revoked tokens and tokens of
+// ended sessions are reported as not active. tokenTypeHint defines which token type is checked first
+func (o *OAuthService) Introspect(ctx context.Context, token, tokenTypeHint string) (domain.Introspection, error) {
+	op := "OAuthService.Introspect"
+	checks := []func(context.Context, string) (domain.Introspection, error){o.introspectAccessToken, o.introspectRefreshToken}
+	if tokenTypeHint == TokenTypeHintRefreshToken {
+		checks[0], checks[1] = checks[1], checks[0]
+	}
+
+	for _, check := range checks {
+		introspection, err := check(ctx, token)
+		if err != nil {
+			return domain.Introspection{}, fmt.Errorf("%s: %w", op, err)
+		}
+		if introspection.Active {
+			return introspection, nil
+		}
+	}
+	return domain.Introspection{Active: false}, nil
+}
+
+func (o *OAuthService) introspectAccessToken(ctx context.Context, token string) (domain.Introspection, error) {
+	claims, err := o.tokenVerifier.InspectAccessToken(ctx, token)
+	if err != nil {
+		if errors.Is(err, domain.ErrInvalidToken) {
+			return domain.Introspection{Active: false}, nil
+		}
+		return domain.Introspection{}, fmt.Errorf("tokenVerifier.InspectAccessToken: %w", err)
+	}
+
+	introspection := domain.Introspection{
+		Active:    true,
+		Scope:     claims.Scope,
+		TokenType: "Bearer",
+		Sub:       claims.Subject,
+		Aud:       claims.Audience,
+		Iss:       claims.Issuer,
+		Jti:       claims.ID,
+		SessionID: claims.SessionID,
+		OrgID:     claims.OrgID,
+		ClientID:  claims.ClientID,
+	}
+	if claims.ExpiresAt != nil {
+		introspection.Exp = claims.ExpiresAt.Unix()
+	}
+	if claims.IssuedAt != nil {
+		introspection.Iat = claims.IssuedAt.Unix()
+	}
+	if claims.NotBefore != nil {
+		introspection.Nbf = claims.NotBefore.Unix()
+	}
+	if jkt := claims.DPoPJKT(); jkt != "" {
+		introspection.TokenType = "DPoP"
+		introspection.Cnf = &domain.Confirmation{JKT: jkt}
+	}
+	return introspection, nil
+}
+
+func (o *OAuthService) introspectRefreshToken(ctx context.Context, token string) (domain.Introspection, error) {
+	refreshToken, err := o.tokenVerifier.VerifyRefreshToken(ctx, token)
+	if err != nil {
+		if errors.Is(err, domain.ErrInvalidRefreshToken) {
+			return domain.Introspection{Active: false}, nil
+		}
+		return domain.Introspection{}, fmt.Errorf("tokenVerifier.VerifyRefreshToken: %w", err)
+	}
+
+	return domain.Introspection{
+		Active:    true,
+		TokenType: TokenTypeHintRefreshToken,
+		Sub:       strconv.FormatUint(uint64(refreshToken.UserID), 10),
+		Exp:       refreshToken.ExpiresAt.Unix(),
+		Iat:       refreshToken.CreatedAt.Unix(),
+		SessionID: refreshToken.FamilyID,
+	}, nil
+}
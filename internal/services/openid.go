@@ -0,0 +1,113 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"github.com/qPyth/mobydev-internship-auth/internal/domain"
+	"github.com/qPyth/mobydev-internship-auth/pkg/auth"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// birthdateLayout is the format of the birthdate claim (OpenID Connect Core section 5.1)
+const birthdateLayout = "2006-01-02"
+
+// IDTokenSigner issues OpenID Connect ID tokens, implemented by auth.Manager
+type IDTokenSigner interface {
+	NewIDToken(params auth.IDTokenParams) (string, error)
+	IDTokenSigningAlgorithms() []string
+}
+
+// UserInfo returns claims of the user from context allowed by scopes of the access token (OpenID Connect Core
+// section 5.3). Token must grant the openid scope
+func (o *OAuthService) UserInfo(ctx context.Context) (domain.UserInfo, error) {
+	op := "OAuthService.UserInfo"
+	claims, ok := auth.ClaimsFromContext(ctx)
+	if !ok {
+		return domain.UserInfo{}, fmt.Errorf("token claims not found in context")
+	}
+	userID, err := claims.UserID()
+	if err != nil {
+		return domain.UserInfo{}, fmt.Errorf("%s: %w", op, err)
+	}
+	user, err := o.userStorage.GetUserByID(ctx, userID)
+	if err != nil {
+		return domain.UserInfo{}, fmt.Errorf("%s: userStorage.GetUserByID: %w", op, err)
+	}
+	return userInfo(user, strings.Fields(claims.Scope)), nil
+}
+
+// idToken returns ID token of the user for the client if openid scope was granted, empty string otherwise
+func (o *OAuthService) idToken(ctx context.Context, userID uint, clientID, nonce string, scopes []string) (string, error) {
+	if !slices.Contains(scopes, domain.ScopeOpenID) {
+		return "", nil
+	}
+	user, err := o.userStorage.GetUserByID(ctx, userID)
+	if err != nil {
+		return "", fmt.Errorf("userStorage.GetUserByID: %w", err)
+	}
+	info := userInfo(user, scopes)
+	token, err := o.idTokenSigner.NewIDToken(auth.IDTokenParams{
+		UserID:        user.ID,
+		ClientID:      clientID,
+		Nonce:         nonce,
+		Name:          info.Name,
+		Email:         info.Email,
+		EmailVerified: info.EmailVerified,
+		PhoneNumber:   info.PhoneNumber,
+		Birthdate:     info.Birthdate,
+	})
+	if err != nil {
+		return "", fmt.Errorf("idTokenSigner.NewIDToken: %w", err)
+	}
+	return token, nil
+}
+
+// Discovery returns OpenID Provider metadata, endpoints are resolved against the issuer. Only asymmetric algorithms
+// are advertised for ID tokens, without them the openid scope is not advertised
+func (o *OAuthService) Discovery() domain.OpenIDConfiguration {
+	issuer := strings.TrimSuffix(o.cfg.Issuer, "/")
+	grantTypes := []string{domain.GrantTypeAuthorizationCode, domain.GrantTypeRefreshToken, domain.GrantTypeClientCredentials,
+		domain.GrantTypeDeviceCode, domain.GrantTypeTokenExchange}
+	algorithms := o.idTokenSigner.IDTokenSigningAlgorithms()
+	scopes := domain.OIDCScopes
+	if len(algorithms) == 0 {
+		scopes = slices.DeleteFunc(slices.Clone(scopes), func(s string) bool { return s == domain.ScopeOpenID })
+	}
+	return domain.OpenIDConfiguration{
+		Issuer:                            issuer,
+		AuthorizationEndpoint:             issuer + "/oauth/authorize",
+		TokenEndpoint:                     issuer + "/oauth/token",
+		UserInfoEndpoint:                  issuer + "/userinfo",
+		JWKSURI:                           issuer + "/.well-known/jwks.json",
+		IntrospectionEndpoint:             issuer + "/oauth/introspect",
+		DeviceAuthorizationEndpoint:       issuer + "/oauth/device_authorization",
+		ScopesSupported:                   scopes,
+		ResponseTypesSupported:            []string{ResponseTypeCode},
+		GrantTypesSupported:               grantTypes,
+		SubjectTypesSupported:             []string{"public"},
+		IDTokenSigningAlgValuesSupported:  algorithms,
+		TokenEndpointAuthMethodsSupported: []string{"client_secret_basic", "client_secret_post", "none"},
+		CodeChallengeMethodsSupported:     []string{CodeChallengeMethodS256},
+		ClaimsSupported:                   []string{"sub", "iss", "aud", "exp", "iat", "nonce", "azp", "name", "email", "email_verified", "phone_number", "birthdate"},
+	}
+}
+
+// userInfo returns claims of the user allowed by the profile, email and phone scopes
+func userInfo(user domain.User, scopes []string) domain.UserInfo {
+	info := domain.UserInfo{Sub: strconv.FormatUint(uint64(user.ID), 10)}
+	if slices.Contains(scopes, domain.ScopeProfile) {
+		info.Name = user.Name
+		if !user.BDay.IsZero() {
+			info.Birthdate = user.BDay.Format(birthdateLayout)
+		}
+	}
+	if slices.Contains(scopes, domain.ScopeEmail) {
+		info.Email, info.EmailVerified = user.Email, &user.EmailVerified
+	}
+	if slices.Contains(scopes, domain.ScopePhone) {
+		info.PhoneNumber = user.PhoneNumber
+	}
+	return info
+}
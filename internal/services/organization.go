@@ -0,0 +1,194 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/qPyth/mobydev-internship-auth/internal/domain"
+	"github.com/qPyth/mobydev-internship-auth/pkg/auth"
+	"time"
+)
+
+// OrgOwnerRole is assigned to the user who creates an organization
+const OrgOwnerRole = "org_admin"
+
+type OrganizationService struct {
+	orgStorage OrgStorage
+}
+
+type OrgStorage interface {
+	CreateOrganization(ctx context.Context, org *domain.Organization, ownerID uint, ownerRole string) error
+	GetOrganization(ctx context.Context, id uint) (domain.Organization, error)
+	ListUserOrganizations(ctx context.Context, userID uint) ([]domain.Organization, error)
+	GetMemberRoles(ctx context.Context, orgID, userID uint) ([]domain.Role, error)
+	ListMembers(ctx context.Context, orgID uint) ([]domain.Membership, error)
+	AssignMemberRole(ctx context.Context, orgID, userID uint, role string) error
+	UnassignMemberRole(ctx context.Context, orgID, userID uint, role, ownerRole string) error
+	RemoveMember(ctx context.Context, orgID, userID uint, ownerRole string) error
+}
+
+// NewOrganizationService creates a new organization service
+func NewOrganizationService(orgStorage OrgStorage) *OrganizationService {
+	return &OrganizationService{orgStorage: orgStorage}
+}
+
+// CreateOrganization creates organization owned by the user from context.
+// Returns domain.ErrOrgExists if organization with such slug already exists
+func (o *OrganizationService) CreateOrganization(ctx context.Context, name, slug string) (domain.Organization, error) {
+	op := "OrganizationService.CreateOrganization"
+	userID, ok := auth.UserIDFromContext(ctx)
+	if !ok {
+		return domain.Organization{}, fmt.Errorf("userID not found in context")
+	}
+
+	org := domain.Organization{Name: name, Slug: slug, CreatedAt: time.Now(), Roles: []string{OrgOwnerRole}}
+	if err := o.orgStorage.CreateOrganization(ctx, &org, userID, OrgOwnerRole); err != nil {
+		if errors.Is(err, domain.ErrOrgExists) {
+			return domain.Organization{}, err
+		}
+		return domain.Organization{}, fmt.Errorf("%s: orgStorage.CreateOrganization: %w", op, err)
+	}
+	return org, nil
+}
+
+// ListOrganizations returns organizations of the user from context with the user's roles in them
+func (o *OrganizationService) ListOrganizations(ctx context.Context) ([]domain.Organization, error) {
+	op := "OrganizationService.ListOrganizations"
+	userID, ok := auth.UserIDFromContext(ctx)
+	if !ok {
+		return nil, fmt.Errorf("userID not found in context")
+	}
+	orgs, err := o.orgStorage.ListUserOrganizations(ctx, userID)
+	if err != nil {
+		return nil, fmt.Errorf("%s: orgStorage.ListUserOrganizations: %w", op, err)
+	}
+	return orgs, nil
+}
+
+// ListMembers returns members of the active organization from context.
+// Returns domain.ErrNoActiveOrg if the token has no active organization
+func (o *OrganizationService) ListMembers(ctx context.Context) ([]domain.Membership, error) {
+	op := "OrganizationService.ListMembers"
+	orgID, err := activeOrgID(ctx)
+	if err != nil {
+		return nil, err
+	}
+	members, err := o.orgStorage.ListMembers(ctx, orgID)
+	if err != nil {
+		return nil, fmt.Errorf("%s: orgStorage.ListMembers: %w", op, err)
+	}
+	return members, nil
+}
+
+// AssignMemberRole assigns organization role to the member of the active organization from context.
+// Returns domain.ErrNoActiveOrg, domain.ErrNotOrgMember or domain.ErrRoleNotFound
+func (o *OrganizationService) AssignMemberRole(ctx context.Context, userID uint, role string) error {
+	op := "OrganizationService.AssignMemberRole"
+	orgID, err := activeOrgID(ctx)
+	if err != nil {
+		return err
+	}
+	if err := o.orgStorage.AssignMemberRole(ctx, orgID, userID, role); err != nil {
+		if errors.Is(err, domain.ErrNotOrgMember) || errors.Is(err, domain.ErrRoleNotFound) {
+			return err
+		}
+		return fmt.Errorf("%s: orgStorage.AssignMemberRole: %w", op, err)
+	}
+	return nil
+}
+
+// UnassignMemberRole removes organization role from the member of the active organization from context.
+// Returns domain.ErrNoActiveOrg, domain.ErrNotOrgMember, domain.ErrRoleNotFound or domain.ErrLastOrgAdmin
+// if it is the last OrgOwnerRole of the organization
+func (o *OrganizationService) UnassignMemberRole(ctx context.Context, userID uint, role string) error {
+	op := "OrganizationService.UnassignMemberRole"
+	orgID, err := activeOrgID(ctx)
+	if err != nil {
+		return err
+	}
+	if err := o.orgStorage.UnassignMemberRole(ctx, orgID, userID, role, OrgOwnerRole); err != nil {
+		if errors.Is(err, domain.ErrNotOrgMember) || errors.Is(err, domain.ErrRoleNotFound) || errors.Is(err, domain.ErrLastOrgAdmin) {
+			return err
+		}
+		return fmt.Errorf("%s: orgStorage.UnassignMemberRole: %w", op, err)
+	}
+	return nil
+}
+
+// RemoveMember removes user from the active organization from context.
+// Returns domain.ErrNoActiveOrg, domain.ErrNotOrgMember or domain.ErrLastOrgAdmin if the user is the last OrgOwnerRole
+func (o *OrganizationService) RemoveMember(ctx context.Context, userID uint) error {
+	op := "OrganizationService.RemoveMember"
+	orgID, err := activeOrgID(ctx)
+	if err != nil {
+		return err
+	}
+	if err := o.orgStorage.RemoveMember(ctx, orgID, userID, OrgOwnerRole); err != nil {
+		if errors.Is(err, domain.ErrNotOrgMember) || errors.Is(err, domain.ErrLastOrgAdmin) {
+			return err
+		}
+		return fmt.Errorf("%s: orgStorage.RemoveMember: %w", op, err)
+	}
+	return nil
+}
+
+// SwitchOrganization makes orgID the active organization of the current session and returns new tokens
+// with roles of the user in it, 0 switches to no organization. The current access token is revoked.
+// Returns domain.ErrNotOrgMember if user is not a member of the organization
+// and domain.ErrSessionRequired if called with a personal access token
+func (u *UserService) SwitchOrganization(ctx context.Context, orgID uint) (domain.Tokens, error) {
+	op := "AuthService.SwitchOrganization"
+	claims, ok := auth.ClaimsFromContext(ctx)
+	if !ok {
+		return domain.Tokens{}, fmt.Errorf("token claims not found in context")
+	}
+	if claims.SessionID == "" {
+		return domain.Tokens{}, domain.ErrSessionRequired
+	}
+	userID, err := claims.UserID()
+	if err != nil {
+		return domain.Tokens{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	if orgID != 0 {
+		if _, err := u.orgStorage.GetMemberRoles(ctx, orgID, userID); err != nil {
+			if errors.Is(err, domain.ErrNotOrgMember) {
+				return domain.Tokens{}, err
+			}
+			return domain.Tokens{}, fmt.Errorf("%s: orgStorage.GetMemberRoles: %w", op, err)
+		}
+	}
+
+	session, err := u.touchSession(ctx, claims.SessionID, userID)
+	if err != nil {
+		return domain.Tokens{}, fmt.Errorf("%s: %w", op, err)
+	}
+	if err := u.sessionStorage.SetSessionOrg(ctx, session.ID, orgID); err != nil {
+		return domain.Tokens{}, fmt.Errorf("%s: sessionStorage.SetSessionOrg: %w", op, err)
+	}
+	session.OrgID = orgID
+
+	tokens, refreshToken, err := u.newTokens(ctx, userID, session)
+	if err != nil {
+		return domain.Tokens{}, fmt.Errorf("%s: %w", op, err)
+	}
+	if err := u.tokenStorage.CreateRefreshToken(ctx, refreshToken); err != nil {
+		return domain.Tokens{}, fmt.Errorf("%s: tokenStorage.CreateRefreshToken: %w", op, err)
+	}
+	if err := u.tokenStorage.RevokeToken(ctx, claims.ID, userID, claims.ExpiresAt.Time); err != nil {
+		return domain.Tokens{}, fmt.Errorf("%s: tokenStorage.RevokeToken: %w", op, err)
+	}
+	return tokens, nil
+}
+
+// activeOrgID returns the active organization of the token from context
+func activeOrgID(ctx context.Context) (uint, error) {
+	claims, ok := auth.ClaimsFromContext(ctx)
+	if !ok {
+		return 0, fmt.Errorf("token claims not found in context")
+	}
+	if claims.OrgID == 0 {
+		return 0, domain.ErrNoActiveOrg
+	}
+	return claims.OrgID, nil
+}
@@ -0,0 +1,100 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"github.com/qPyth/mobydev-internship-auth/internal/domain"
+	"testing"
+)
+
+func TestOrganizationService_KeepsLastOrgAdmin(t *testing.T) {
+	tests := []struct {
+		name string
+		// memberRole is the role of the second member, "" if there is none
+		memberRole string
+		run        func(ctx context.Context, orgs *OrganizationService, ownerID, memberID uint) error
+		wantErr    error
+	}{
+		{
+			name: "last admin can not be demoted",
+			run: func(ctx context.Context, orgs *OrganizationService, ownerID, _ uint) error {
+				return orgs.UnassignMemberRole(ctx, ownerID, OrgOwnerRole)
+			},
+			wantErr: domain.ErrLastOrgAdmin,
+		},
+		{
+			name: "last admin can not be removed",
+			run: func(ctx context.Context, orgs *OrganizationService, ownerID, _ uint) error {
+				return orgs.RemoveMember(ctx, ownerID)
+			},
+			wantErr: domain.ErrLastOrgAdmin,
+		},
+		{
+			name:       "last admin can not be removed by another member",
+			memberRole: "org_member",
+			run: func(ctx context.Context, orgs *OrganizationService, ownerID, _ uint) error {
+				return orgs.RemoveMember(ctx, ownerID)
+			},
+			wantErr: domain.ErrLastOrgAdmin,
+		},
+		{
+			name:       "member without the role can be removed",
+			memberRole: "org_member",
+			run: func(ctx context.Context, orgs *OrganizationService, _, memberID uint) error {
+				return orgs.RemoveMember(ctx, memberID)
+			},
+		},
+		{
+			name:       "admin can be demoted while another one is left",
+			memberRole: OrgOwnerRole,
+			run: func(ctx context.Context, orgs *OrganizationService, ownerID, _ uint) error {
+				return orgs.UnassignMemberRole(ctx, ownerID, OrgOwnerRole)
+			},
+		},
+		{
+			name:       "admin can be removed while another one is left",
+			memberRole: OrgOwnerRole,
+			run: func(ctx context.Context, orgs *OrganizationService, ownerID, _ uint) error {
+				return orgs.RemoveMember(ctx, ownerID)
+			},
+		},
+		{
+			name:       "second admin can not be demoted after the first one is removed",
+			memberRole: OrgOwnerRole,
+			run: func(ctx context.Context, orgs *OrganizationService, ownerID, memberID uint) error {
+				if err := orgs.RemoveMember(ctx, ownerID); err != nil {
+					return err
+				}
+				return orgs.UnassignMemberRole(ctx, memberID, OrgOwnerRole)
+			},
+			wantErr: domain.ErrLastOrgAdmin,
+		},
+		{
+			name: "unknown member",
+			run: func(ctx context.Context, orgs *OrganizationService, _, _ uint) error {
+				return orgs.RemoveMember(ctx, 100)
+			},
+			wantErr: domain.ErrNotOrgMember,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			storage := newTestStorage(t)
+			users := newTestUserService(t, storage)
+			orgs := NewOrganizationService(storage)
+			ctx, ownerID, _ := signUpAndIn(t, users, "owner@example.com", "password1")
+			_, memberID, _ := signUpAndIn(t, users, "member@example.com", "password1")
+
+			ctx, org := createTestOrg(t, ctx, orgs)
+			if tt.memberRole != "" {
+				addTestMember(t, storage, org.ID, memberID, "member@example.com", tt.memberRole)
+			}
+
+			err := tt.run(ctx, orgs, ownerID, memberID)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("got error %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+}
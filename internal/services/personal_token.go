@@ -0,0 +1,180 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/qPyth/mobydev-internship-auth/internal/domain"
+	"github.com/qPyth/mobydev-internship-auth/pkg/auth"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// PersonalTokenPrefix starts every personal access token, so they are told apart from access tokens
+	// and can be found by secret scanners
+	PersonalTokenPrefix = "mdp_"
+	// personalTokenHintLen is how many first characters of the token are stored to recognize it
+	personalTokenHintLen = len(PersonalTokenPrefix) + 6
+	// personalTokenTouchInterval limits how often last used time of a token is written to the storage
+	personalTokenTouchInterval = time.Minute
+)
+
+type PersonalTokenStorage interface {
+	CreatePersonalToken(ctx context.Context, token *domain.PersonalToken) error
+	GetPersonalToken(ctx context.Context, tokenHash string) (domain.PersonalToken, error)
+	ListPersonalTokens(ctx context.Context, userID uint) ([]domain.PersonalToken, error)
+	TouchPersonalToken(ctx context.Context, id uint, lastUsedAt time.Time) error
+	RevokePersonalToken(ctx context.Context, userID, id uint, revokedAt time.Time) error
+}
+
+// CreatePersonalToken creates personal access token of the user from context acting in the user's active organization.
+// Scopes must be granted by the current access token, ttl 0 uses the maximum lifetime. The token is returned only
+// here. Returns domain.ErrSessionRequired if called with a personal access token or a token issued to a client,
+// domain.ErrInvalidScope or domain.ErrInvalidExpiration
+func (u *UserService) CreatePersonalToken(ctx context.Context, name string, scopes []string, ttl time.Duration) (domain.PersonalToken, string, error) {
+	op := "AuthService.CreatePersonalToken"
+	claims, ok := auth.ClaimsFromContext(ctx)
+	if !ok {
+		return domain.PersonalToken{}, "", fmt.Errorf("token claims not found in context")
+	}
+	// tokens of clients are limited to their session and scopes, a personal token would outlive both
+	if !firstPartySession(claims) {
+		return domain.PersonalToken{}, "", domain.ErrSessionRequired
+	}
+	userID, err := claims.UserID()
+	if err != nil {
+		return domain.PersonalToken{}, "", fmt.Errorf("%s: %w", op, err)
+	}
+	tokenScopes := make([]string, 0, len(scopes))
+	for _, scope := range scopes {
+		if !claims.HasScope(scope) {
+			return domain.PersonalToken{}, "", domain.ErrInvalidScope
+		}
+		if !slices.Contains(tokenScopes, scope) {
+			tokenScopes = append(tokenScopes, scope)
+		}
+	}
+	maxTTL := u.cfg.PersonalTokenMaxTTL
+	if ttl < 0 || (maxTTL > 0 && ttl > maxTTL) {
+		return domain.PersonalToken{}, "", domain.ErrInvalidExpiration
+	}
+	if ttl == 0 {
+		ttl = maxTTL
+	}
+
+	secret, err := auth.RandomString(32)
+	if err != nil {
+		return domain.PersonalToken{}, "", fmt.Errorf("%s: auth.RandomString: %w", op, err)
+	}
+	token := PersonalTokenPrefix + secret
+	now := time.Now()
+	personalToken := domain.PersonalToken{
+		UserID:    userID,
+		Name:      name,
+		Hint:      token[:personalTokenHintLen],
+		OrgID:     claims.OrgID,
+		Scopes:    tokenScopes,
+		TokenHash: auth.HashToken(token),
+		CreatedAt: now,
+	}
+	if ttl > 0 {
+		expiresAt := now.Add(ttl)
+		personalToken.ExpiresAt = &expiresAt
+	}
+	if err := u.personalTokenStorage.CreatePersonalToken(ctx, &personalToken); err != nil {
+		return domain.PersonalToken{}, "", fmt.Errorf("%s: personalTokenStorage.CreatePersonalToken: %w", op, err)
+	}
+	return personalToken, token, nil
+}
+
+// ListPersonalTokens returns not revoked personal access tokens of the user from context
+func (u *UserService) ListPersonalTokens(ctx context.Context) ([]domain.PersonalToken, error) {
+	op := "AuthService.ListPersonalTokens"
+	userID, ok := auth.UserIDFromContext(ctx)
+	if !ok {
+		return nil, fmt.Errorf("userID not found in context")
+	}
+	tokens, err := u.personalTokenStorage.ListPersonalTokens(ctx, userID)
+	if err != nil {
+		return nil, fmt.Errorf("%s: personalTokenStorage.ListPersonalTokens: %w", op, err)
+	}
+	return tokens, nil
+}
+
+// RevokePersonalToken revokes personal access token of the user from context.
+// Returns domain.ErrTokenNotFound if user has no such token
+func (u *UserService) RevokePersonalToken(ctx context.Context, id uint) error {
+	op := "AuthService.RevokePersonalToken"
+	userID, ok := auth.UserIDFromContext(ctx)
+	if !ok {
+		return fmt.Errorf("userID not found in context")
+	}
+	if err := u.personalTokenStorage.RevokePersonalToken(ctx, userID, id, time.Now()); err != nil {
+		if errors.Is(err, domain.ErrTokenNotFound) {
+			return err
+		}
+		return fmt.Errorf("%s: personalTokenStorage.RevokePersonalToken: %w", op, err)
+	}
+	return nil
+}
+
+// verifyPersonalToken returns claims of active personal access token. Its scope is limited to the permissions
+// the user still has, so removed roles take effect immediately. Returns domain.ErrInvalidToken if token is not valid
+func (u *UserService) verifyPersonalToken(ctx context.Context, token string, touch bool) (*auth.Claims, error) {
+	op := "AuthService.verifyPersonalToken"
+	personalToken, err := u.personalTokenStorage.GetPersonalToken(ctx, auth.HashToken(token))
+	if err != nil {
+		if errors.Is(err, domain.ErrTokenNotFound) {
+			return nil, fmt.Errorf("%w: %w", domain.ErrInvalidToken, err)
+		}
+		return nil, fmt.Errorf("%s: personalTokenStorage.GetPersonalToken: %w", op, err)
+	}
+	now := time.Now()
+	if !personalToken.Active(now) {
+		return nil, fmt.Errorf("%w: personal token expired or revoked", domain.ErrInvalidToken)
+	}
+	jti := "pat_" + strconv.FormatUint(uint64(personalToken.ID), 10)
+	revoked, err := u.tokenStorage.IsTokenRevoked(ctx, jti, personalToken.UserID, personalToken.CreatedAt)
+	if err != nil {
+		return nil, fmt.Errorf("%s: tokenStorage.IsTokenRevoked: %w", op, err)
+	}
+	if revoked {
+		return nil, fmt.Errorf("%w: %w", domain.ErrInvalidToken, domain.ErrTokenRevoked)
+	}
+
+	userRoles, orgID, err := u.userRoles(ctx, personalToken.UserID, personalToken.OrgID)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	_, permissions := rolesAndPermissions(userRoles)
+	scopes := make([]string, 0, len(personalToken.Scopes))
+	for _, scope := range personalToken.Scopes {
+		if slices.Contains(permissions, scope) {
+			scopes = append(scopes, scope)
+		}
+	}
+
+	if touch && (personalToken.LastUsedAt == nil || now.Sub(*personalToken.LastUsedAt) >= personalTokenTouchInterval) {
+		if err := u.personalTokenStorage.TouchPersonalToken(ctx, personalToken.ID, now); err != nil {
+			return nil, fmt.Errorf("%s: personalTokenStorage.TouchPersonalToken: %w", op, err)
+		}
+	}
+
+	claims := &auth.Claims{
+		RegisteredClaims: jwt.RegisteredClaims{
+			Subject:  strconv.FormatUint(uint64(personalToken.UserID), 10),
+			ID:       jti,
+			IssuedAt: jwt.NewNumericDate(personalToken.CreatedAt),
+		},
+		OrgID: orgID,
+		Scope: strings.Join(scopes, " "),
+	}
+	if personalToken.ExpiresAt != nil {
+		claims.ExpiresAt = jwt.NewNumericDate(*personalToken.ExpiresAt)
+	}
+	return claims, nil
+}
@@ -0,0 +1,70 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"github.com/qPyth/mobydev-internship-auth/internal/domain"
+	"github.com/qPyth/mobydev-internship-auth/pkg/auth"
+	"testing"
+	"time"
+)
+
+func TestUserService_PersonalTokenRevocation(t *testing.T) {
+	tests := []struct {
+		name   string
+		revoke func(ctx context.Context, users *UserService, userID uint) error
+	}{
+		{name: "sign out all", revoke: func(ctx context.Context, users *UserService, _ uint) error {
+			return users.SignOutAll(ctx)
+		}},
+		{name: "password reset", revoke: func(ctx context.Context, users *UserService, userID uint) error {
+			return users.ResetPassword(ctx, userID, "password2")
+		}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			storage := newTestStorage(t)
+			users := newTestUserService(t, storage)
+			ctx, userID, _ := signUpAndIn(t, users, "user@example.com", "password1")
+			_, token, err := users.CreatePersonalToken(ctx, "ci", nil, time.Hour)
+			if err != nil {
+				t.Fatalf("CreatePersonalToken: %v", err)
+			}
+			if _, err := users.VerifyAccessToken(ctx, token); err != nil {
+				t.Fatalf("VerifyAccessToken of a new token: %v", err)
+			}
+
+			if err := tt.revoke(ctx, users, userID); err != nil {
+				t.Fatalf("revoke: %v", err)
+			}
+			if _, err := users.VerifyAccessToken(ctx, token); !errors.Is(err, domain.ErrInvalidToken) {
+				t.Fatalf("got error %v, want ErrInvalidToken", err)
+			}
+			// revocation entries are pruned after the access token lifetime, personal tokens must stay revoked
+			if _, err := storage.PruneRevokedTokens(ctx, time.Now().Add(24*time.Hour)); err != nil {
+				t.Fatalf("PruneRevokedTokens: %v", err)
+			}
+			if _, err := users.VerifyAccessToken(ctx, token); !errors.Is(err, domain.ErrInvalidToken) {
+				t.Fatalf("after pruning: got error %v, want ErrInvalidToken", err)
+			}
+		})
+	}
+}
+
+func TestUserService_CreatePersonalTokenRequiresFirstPartySession(t *testing.T) {
+	storage := newTestStorage(t)
+	users := newTestUserService(t, storage)
+	ctx, _, _ := signUpAndIn(t, users, "user@example.com", "password1")
+	claims, _ := auth.ClaimsFromContext(ctx)
+
+	clientSession := *claims
+	clientSession.ClientID = testClientID
+	_, _, err := users.CreatePersonalToken(auth.WithClaims(ctx, &clientSession), "ci", nil, time.Hour)
+	if !errors.Is(err, domain.ErrSessionRequired) {
+		t.Fatalf("token issued to a client: got error %v, want ErrSessionRequired", err)
+	}
+	if _, _, err := users.CreatePersonalToken(ctx, "ci", nil, time.Hour); err != nil {
+		t.Fatalf("token of a first party session: %v", err)
+	}
+}
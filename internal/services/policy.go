@@ -0,0 +1,101 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/qPyth/mobydev-internship-auth/internal/domain"
+	"github.com/qPyth/mobydev-internship-auth/pkg/policy"
+	"strconv"
+)
+
+// PolicyService decides whether users may perform actions on resources by the attribute based policy
+type PolicyService struct {
+	policy       *policy.Policy
+	userStorage  UserStorage
+	roleStorage  RoleStorage
+	orgStorage   OrgStorage
+	groupStorage GroupStorage
+}
+
+// NewPolicyService creates a new policy service
+func NewPolicyService(p *policy.Policy, userStorage UserStorage, roleStorage RoleStorage, orgStorage OrgStorage, groupStorage GroupStorage) *PolicyService {
+	return &PolicyService{
+		policy:       p,
+		userStorage:  userStorage,
+		roleStorage:  roleStorage,
+		orgStorage:   orgStorage,
+		groupStorage: groupStorage,
+	}
+}
+
+// Check decides whether user acting in organization orgID, 0 if none, may perform action on resource.
+// With explain the decision reports how every rule was evaluated.
+// Returns domain.ErrUserNotFound if user does not exist and domain.ErrNotOrgMember if the user is not a member of the organization
+func (p *PolicyService) Check(ctx context.Context, userID, orgID uint, action, resource string, explain bool) (policy.Decision, error) {
+	op := "PolicyService.Check"
+	subject, err := p.subject(ctx, userID, orgID)
+	if err != nil {
+		if errors.Is(err, domain.ErrUserNotFound) || errors.Is(err, domain.ErrNotOrgMember) {
+			return policy.Decision{}, err
+		}
+		return policy.Decision{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	req := policy.Request{Subject: subject, Action: action, Resource: resource}
+	if explain {
+		return p.policy.Explain(req), nil
+	}
+	return p.policy.Evaluate(req), nil
+}
+
+// subject loads attributes of the user policy rules are evaluated over, the organization is identified by its slug
+// and roles include roles of the user in it, groups are groups of the user in the organization
+func (p *PolicyService) subject(ctx context.Context, userID, orgID uint) (policy.Subject, error) {
+	user, err := p.userStorage.GetUserByID(ctx, userID)
+	if err != nil {
+		if errors.Is(err, domain.ErrUserNotFound) {
+			return policy.Subject{}, err
+		}
+		return policy.Subject{}, fmt.Errorf("userStorage.GetUserByID: %w", err)
+	}
+	userRoles, err := p.roleStorage.GetUserRoles(ctx, userID)
+	if err != nil {
+		return policy.Subject{}, fmt.Errorf("roleStorage.GetUserRoles: %w", err)
+	}
+
+	var org string
+	var groups []string
+	if orgID != 0 {
+		memberRoles, err := p.orgStorage.GetMemberRoles(ctx, orgID, userID)
+		if err != nil {
+			if errors.Is(err, domain.ErrNotOrgMember) {
+				return policy.Subject{}, err
+			}
+			return policy.Subject{}, fmt.Errorf("orgStorage.GetMemberRoles: %w", err)
+		}
+		userRoles = append(userRoles, memberRoles...)
+
+		organization, err := p.orgStorage.GetOrganization(ctx, orgID)
+		if err != nil {
+			return policy.Subject{}, fmt.Errorf("orgStorage.GetOrganization: %w", err)
+		}
+		org = organization.Slug
+
+		userGroups, err := p.groupStorage.GetUserGroups(ctx, orgID, userID)
+		if err != nil {
+			return policy.Subject{}, fmt.Errorf("groupStorage.GetUserGroups: %w", err)
+		}
+		groups = groupNames(userGroups)
+	}
+	roles, _ := rolesAndPermissions(userRoles)
+
+	return policy.Subject{
+		ID:            strconv.FormatUint(uint64(user.ID), 10),
+		Email:         user.Email,
+		EmailVerified: user.EmailVerified,
+		Roles:         roles,
+		Groups:        groups,
+		Org:           org,
+	}, nil
+}
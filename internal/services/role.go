@@ -0,0 +1,105 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/qPyth/mobydev-internship-auth/internal/domain"
+	"sort"
+)
+
+type RoleService struct {
+	roleStorage RoleStorage
+	userStorage UserStorage
+}
+
+type RoleStorage interface {
+	ListRoles(ctx context.Context) ([]domain.Role, error)
+	GetUserRoles(ctx context.Context, userID uint) ([]domain.Role, error)
+	AssignRole(ctx context.Context, userID uint, role string) error
+	UnassignRole(ctx context.Context, userID uint, role string) error
+}
+
+// NewRoleService creates a new role service
+func NewRoleService(roleStorage RoleStorage, userStorage UserStorage) *RoleService {
+	return &RoleService{roleStorage: roleStorage, userStorage: userStorage}
+}
+
+// ListRoles returns all roles with their permissions
+func (r *RoleService) ListRoles(ctx context.Context) ([]domain.Role, error) {
+	op := "RoleService.ListRoles"
+	roles, err := r.roleStorage.ListRoles(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("%s: roleStorage.ListRoles: %w", op, err)
+	}
+	return roles, nil
+}
+
+// GetUserRoles returns roles assigned to the user
+func (r *RoleService) GetUserRoles(ctx context.Context, userID uint) ([]domain.Role, error) {
+	op := "RoleService.GetUserRoles"
+	roles, err := r.roleStorage.GetUserRoles(ctx, userID)
+	if err != nil {
+		return nil, fmt.Errorf("%s: roleStorage.GetUserRoles: %w", op, err)
+	}
+	return roles, nil
+}
+
+// AssignRole assigns role to the user, it is put to tokens issued after that.
+// Returns domain.ErrUserNotFound or domain.ErrRoleNotFound if user or role does not exist
+func (r *RoleService) AssignRole(ctx context.Context, userID uint, role string) error {
+	op := "RoleService.AssignRole"
+	if err := r.roleStorage.AssignRole(ctx, userID, role); err != nil {
+		if errors.Is(err, domain.ErrUserNotFound) || errors.Is(err, domain.ErrRoleNotFound) {
+			return err
+		}
+		return fmt.Errorf("%s: roleStorage.AssignRole: %w", op, err)
+	}
+	return nil
+}
+
+// UnassignRole removes role from the user, tokens issued before keep it until they expire.
+// Returns domain.ErrUserNotFound or domain.ErrRoleNotFound if user or role does not exist
+func (r *RoleService) UnassignRole(ctx context.Context, userID uint, role string) error {
+	op := "RoleService.UnassignRole"
+	if err := r.roleStorage.UnassignRole(ctx, userID, role); err != nil {
+		if errors.Is(err, domain.ErrUserNotFound) || errors.Is(err, domain.ErrRoleNotFound) {
+			return err
+		}
+		return fmt.Errorf("%s: roleStorage.UnassignRole: %w", op, err)
+	}
+	return nil
+}
+
+// AssignRoleByEmail assigns role to the user with email, used to bootstrap administrators.
+// Returns domain.ErrUserNotFound or domain.ErrRoleNotFound if user or role does not exist
+func (r *RoleService) AssignRoleByEmail(ctx context.Context, email, role string) error {
+	op := "RoleService.AssignRoleByEmail"
+	user, err := r.userStorage.GetUser(ctx, email)
+	if err != nil {
+		if errors.Is(err, domain.ErrUserNotFound) {
+			return err
+		}
+		return fmt.Errorf("%s: userStorage.GetUser: %w", op, err)
+	}
+	return r.AssignRole(ctx, user.ID, role)
+}
+
+// rolesAndPermissions returns sorted names of the roles and sorted unique permissions granted by them
+func rolesAndPermissions(roles []domain.Role) ([]string, []string) {
+	names := make([]string, 0, len(roles))
+	seen := make(map[string]bool)
+	var permissions []string
+	for _, role := range roles {
+		names = append(names, role.Name)
+		for _, p := range role.Permissions {
+			if !seen[p] {
+				seen[p] = true
+				permissions = append(permissions, p)
+			}
+		}
+	}
+	sort.Strings(names)
+	sort.Strings(permissions)
+	return names, permissions
+}
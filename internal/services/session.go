@@ -0,0 +1,130 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/qPyth/mobydev-internship-auth/internal/domain"
+	"github.com/qPyth/mobydev-internship-auth/pkg/auth"
+	"time"
+)
+
+// sessionTouchInterval limits how often last seen time of a session is written to the storage
+const sessionTouchInterval = time.Minute
+
+type SessionStorage interface {
+	CreateSession(ctx context.Context, session *domain.Session) error
+	GetSession(ctx context.Context, id string) (domain.Session, error)
+	ListSessions(ctx context.Context, userID uint, now time.Time) ([]domain.Session, error)
+	TouchSession(ctx context.Context, id string, lastSeenAt time.Time) error
+	SetSessionOrg(ctx context.Context, id string, orgID uint) error
+	RevokeSession(ctx context.Context, id string, userID uint) error
+	RevokeOtherSessions(ctx context.Context, userID uint, keepID string, revokedAt time.Time) error
+}
+
+// ListSessions returns active sessions of the user from context, the session of the current token is marked as current
+func (u *UserService) ListSessions(ctx context.Context) ([]domain.Session, error) {
+	op := "AuthService.ListSessions"
+	claims, ok := auth.ClaimsFromContext(ctx)
+	if !ok {
+		return nil, fmt.Errorf("token claims not found in context")
+	}
+	userID, err := claims.UserID()
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	now := time.Now()
+	sessions, err := u.sessionStorage.ListSessions(ctx, userID, now)
+	if err != nil {
+		return nil, fmt.Errorf("%s: sessionStorage.ListSessions: %w", op, err)
+	}
+
+	active := make([]domain.Session, 0, len(sessions))
+	for _, session := range sessions {
+		if !session.Active(now, u.cfg.SessionIdleTimeout) {
+			continue
+		}
+		session.Current = session.ID == claims.SessionID
+		active = append(active, session)
+	}
+	return active, nil
+}
+
+// RevokeSession ends session of the user from context. Returns domain.ErrSessionNotFound if user has no such session
+func (u *UserService) RevokeSession(ctx context.Context, sessionID string) error {
+	op := "AuthService.RevokeSession"
+	userID, ok := auth.UserIDFromContext(ctx)
+	if !ok {
+		return fmt.Errorf("userID not found in context")
+	}
+
+	if err := u.sessionStorage.RevokeSession(ctx, sessionID, userID); err != nil {
+		if errors.Is(err, domain.ErrSessionNotFound) {
+			return err
+		}
+		return fmt.Errorf("%s: sessionStorage.RevokeSession: %w", op, err)
+	}
+	return nil
+}
+
+func (u *UserService) startSession(ctx context.Context, userID uint, meta domain.SessionMeta) (domain.Session, error) {
+	id, err := auth.RandomString(16)
+	if err != nil {
+		return domain.Session{}, fmt.Errorf("auth.RandomString: %w", err)
+	}
+
+	now := time.Now()
+	session := domain.Session{
+		ID:         id,
+		UserID:     userID,
+		Device:     meta.Device,
+		UserAgent:  meta.UserAgent,
+		IP:         meta.IP,
+		CreatedAt:  now,
+		LastSeenAt: now,
+		ExpiresAt:  now.Add(u.cfg.SessionAbsoluteTimeout),
+		DPoPJKT:    meta.DPoPJKT,
+		OrgID:      meta.OrgID,
+		ClientID:   meta.ClientID,
+		Scopes:     meta.Scopes,
+	}
+	if err := u.sessionStorage.CreateSession(ctx, &session); err != nil {
+		return domain.Session{}, fmt.Errorf("sessionStorage.CreateSession: %w", err)
+	}
+	return session, nil
+}
+
+// activeSession returns the session of the user if it has not ended
+func (u *UserService) activeSession(ctx context.Context, sessionID string, userID uint) (domain.Session, error) {
+	session, err := u.sessionStorage.GetSession(ctx, sessionID)
+	if err != nil {
+		if errors.Is(err, domain.ErrSessionNotFound) {
+			return session, err
+		}
+		return session, fmt.Errorf("sessionStorage.GetSession: %w", err)
+	}
+	if session.UserID != userID {
+		return session, domain.ErrSessionNotFound
+	}
+	if !session.Active(time.Now(), u.cfg.SessionIdleTimeout) {
+		return session, domain.ErrSessionExpired
+	}
+	return session, nil
+}
+
+// touchSession returns the active session like activeSession and records its use, which extends the idle timeout
+func (u *UserService) touchSession(ctx context.Context, sessionID string, userID uint) (domain.Session, error) {
+	session, err := u.activeSession(ctx, sessionID, userID)
+	if err != nil {
+		return session, err
+	}
+	now := time.Now()
+	if now.Sub(session.LastSeenAt) >= sessionTouchInterval {
+		if err := u.sessionStorage.TouchSession(ctx, session.ID, now); err != nil {
+			return session, fmt.Errorf("sessionStorage.TouchSession: %w", err)
+		}
+		session.LastSeenAt = now
+	}
+	return session, nil
+}
@@ -7,62 +7,544 @@ import (
 	"github.com/qPyth/mobydev-internship-auth/internal/domain"
 	"github.com/qPyth/mobydev-internship-auth/pkg/auth"
 	"golang.org/x/crypto/bcrypt"
+	"slices"
+	"strings"
+	"time"
 )
 
 type UserService struct {
-	userStorage  UserStorage
-	TokenManager auth.TokenManager
+	userStorage          UserStorage
+	tokenStorage         TokenStorage
+	sessionStorage       SessionStorage
+	roleStorage          RoleStorage
+	orgStorage           OrgStorage
+	groupStorage         GroupStorage
+	personalTokenStorage PersonalTokenStorage
+	TokenManager         auth.TokenManager
+	cfg                  Config
 }
 
+type Config struct {
+	AccessTokenTTL  time.Duration
+	RefreshTokenTTL time.Duration
+	// SessionIdleTimeout ends session if it was not used for this duration
+	SessionIdleTimeout time.Duration
+	// SessionAbsoluteTimeout ends session after this duration since sign in regardless of activity
+	SessionAbsoluteTimeout time.Duration
+	// InviteOnly disables sign up, accounts are created only by accepting invitations
+	InviteOnly bool
+	// GroupsClaim puts names of the groups of the user in the active organization to the groups claim
+	GroupsClaim bool
+	// PersonalTokenMaxTTL limits lifetime of personal access tokens, 0 allows tokens without expiration
+	PersonalTokenMaxTTL time.Duration
+	// EmailVerification restricts users with not verified email: EmailVerificationSignIn or EmailVerificationScopes,
+	// no restrictions if empty
+	EmailVerification string
+	// UnverifiedScopes are permissions tokens of users with not verified email may have with EmailVerificationScopes
+	UnverifiedScopes []string
+}
+
+const (
+	// EmailVerificationSignIn rejects sign in of users with not verified email
+	EmailVerificationSignIn = "sign_in"
+	// EmailVerificationScopes limits permissions of users with not verified email to Config.UnverifiedScopes
+	EmailVerificationScopes = "scopes"
+)
+
 type UserStorage interface {
 	CreateUser(ctx context.Context, email string, hashPass []byte) error
 	GetUser(ctx context.Context, email string) (domain.User, error)
+	GetUserByID(ctx context.Context, id uint) (domain.User, error)
 	UpdateUser(ctx context.Context, req *domain.UserProfileUpdateReq) error
+	SetEmailVerified(ctx context.Context, userID uint, email string) error
+	UpdatePassword(ctx context.Context, userID uint, hashPass []byte) error
+	UpdateEmail(ctx context.Context, userID uint, email string) error
+}
+
+type TokenStorage interface {
+	CreateRefreshToken(ctx context.Context, token *domain.RefreshToken) error
+	GetRefreshToken(ctx context.Context, tokenHash string) (domain.RefreshToken, error)
+	RotateRefreshToken(ctx context.Context, oldID uint, next *domain.RefreshToken) error
+	RevokeToken(ctx context.Context, jti string, userID uint, expiresAt time.Time) error
+	RevokeUserTokens(ctx context.Context, userID uint, revokedAt, expiresAt time.Time) error
+	IsTokenRevoked(ctx context.Context, jti string, userID uint, issuedAt time.Time) (bool, error)
+	PruneRevokedTokens(ctx context.Context, now time.Time) (int64, error)
 }
 
 // NewUserService creates a new user service
-func NewUserService(userStorage UserStorage, tokenManager auth.TokenManager) *UserService {
-	return &UserService{userStorage: userStorage, TokenManager: tokenManager}
+func NewUserService(userStorage UserStorage, tokenStorage TokenStorage, sessionStorage SessionStorage, roleStorage RoleStorage, orgStorage OrgStorage, groupStorage GroupStorage, personalTokenStorage PersonalTokenStorage, tokenManager auth.TokenManager, cfg Config) *UserService {
+	return &UserService{
+		userStorage:          userStorage,
+		tokenStorage:         tokenStorage,
+		sessionStorage:       sessionStorage,
+		roleStorage:          roleStorage,
+		orgStorage:           orgStorage,
+		groupStorage:         groupStorage,
+		personalTokenStorage: personalTokenStorage,
+		TokenManager:         tokenManager,
+		cfg:                  cfg,
+	}
 }
 
 // SignUp creates a new user, returns domain.ErrEmailExists if user with such email already exists
+// and domain.ErrSignUpDisabled if accounts are created only by invitations
 func (u *UserService) SignUp(ctx context.Context, email, password string) error {
 	op := "AuthService.SignUp"
-	hashPass, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if u.cfg.InviteOnly {
+		return domain.ErrSignUpDisabled
+	}
+	hashPass, err := hashPassword(password)
 	if err != nil {
-		return fmt.Errorf("%s: bcrypt.GenerateFromPassword: %w", op, err)
+		return fmt.Errorf("%s: %w", op, err)
 	}
 	return u.userStorage.CreateUser(ctx, email, hashPass)
 }
 
-// SignIn GetUser returns token for user by credentials. Returns domain.ErrInvalidCredentials if email or password is incorrect
-func (u *UserService) SignIn(ctx context.Context, email, password string) (token string, err error) {
+// SignIn starts a new session and returns access and refresh tokens for user by credentials.
+// Returns domain.ErrInvalidCredentials if email or password is incorrect and domain.ErrEmailNotVerified
+// if sign in requires verified email
+func (u *UserService) SignIn(ctx context.Context, email, password string, meta domain.SessionMeta) (domain.Tokens, error) {
 	op := "AuthService.SignIn"
 	user, err := u.userStorage.GetUser(ctx, email)
 	if err != nil {
 		if errors.Is(err, domain.ErrUserNotFound) {
-			return "", domain.ErrInvalidCredentials
+			return domain.Tokens{}, domain.ErrInvalidCredentials
 		}
-		return "", fmt.Errorf("%s: userStorage.GetUser: %w", op, err)
+		return domain.Tokens{}, fmt.Errorf("%s: userStorage.GetUser: %w", op, err)
 	}
 	if err := bcrypt.CompareHashAndPassword([]byte(user.HashPass), []byte(password)); err != nil {
-		return "", domain.ErrInvalidCredentials
+		return domain.Tokens{}, domain.ErrInvalidCredentials
+	}
+	if u.cfg.EmailVerification == EmailVerificationSignIn && !user.EmailVerified {
+		return domain.Tokens{}, domain.ErrEmailNotVerified
 	}
 
-	token, err = u.TokenManager.NewJWT(user.ID)
+	tokens, err := u.IssueTokens(ctx, user.ID, meta)
 	if err != nil {
-		return "", fmt.Errorf("%s: tokenManager.NewJWT: %w", op, err)
+		return domain.Tokens{}, fmt.Errorf("%s: %w", op, err)
 	}
+	return tokens, nil
+}
 
+// IssueTokens starts a new session of the already authenticated user and returns its tokens.
+// Tokens of sessions authorized for a client are limited to meta.Scopes
+func (u *UserService) IssueTokens(ctx context.Context, userID uint, meta domain.SessionMeta) (domain.Tokens, error) {
+	session, err := u.startSession(ctx, userID, meta)
+	if err != nil {
+		return domain.Tokens{}, err
+	}
+
+	tokens, refreshToken, err := u.newTokens(ctx, userID, session)
+	if err != nil {
+		return domain.Tokens{}, err
+	}
+	if err := u.tokenStorage.CreateRefreshToken(ctx, refreshToken); err != nil {
+		return domain.Tokens{}, fmt.Errorf("tokenStorage.CreateRefreshToken: %w", err)
+	}
+	return tokens, nil
+}
+
+// RefreshTokens exchanges refresh token for a new pair of tokens, the used refresh token becomes invalid.
+// dpopJKT is thumbprint of the key from verified DPoP proof, it is required if the session is bound to a DPoP key.
+// Returns domain.ErrInvalidRefreshToken if token is unknown, expired or revoked, or its session has ended,
+// domain.ErrInvalidDPoPProof if DPoP key does not match the session one and domain.ErrRefreshTokenReused
+// if token was already used, in that case the whole session is revoked
+func (u *UserService) RefreshTokens(ctx context.Context, refreshToken, dpopJKT string) (domain.Tokens, error) {
+	op := "AuthService.RefreshTokens"
+	old, err := u.tokenStorage.GetRefreshToken(ctx, auth.HashToken(refreshToken))
+	if err != nil {
+		if errors.Is(err, domain.ErrInvalidRefreshToken) {
+			return domain.Tokens{}, err
+		}
+		return domain.Tokens{}, fmt.Errorf("%s: tokenStorage.GetRefreshToken: %w", op, err)
+	}
+
+	if old.UsedAt != nil {
+		return domain.Tokens{}, u.revokeReusedFamily(ctx, op, old)
+	}
+	if old.RevokedAt != nil || time.Now().After(old.ExpiresAt) {
+		return domain.Tokens{}, domain.ErrInvalidRefreshToken
+	}
+
+	// refresh token family id is the id of the session it was issued for
+	session, err := u.touchSession(ctx, old.FamilyID, old.UserID)
+	if err != nil {
+		if errors.Is(err, domain.ErrSessionNotFound) || errors.Is(err, domain.ErrSessionExpired) {
+			return domain.Tokens{}, domain.ErrInvalidRefreshToken
+		}
+		return domain.Tokens{}, fmt.Errorf("%s: %w", op, err)
+	}
+	if session.DPoPJKT != "" && session.DPoPJKT != dpopJKT {
+		return domain.Tokens{}, domain.ErrInvalidDPoPProof
+	}
+
+	tokens, next, err := u.newTokens(ctx, old.UserID, session)
+	if err != nil {
+		return domain.Tokens{}, fmt.Errorf("%s: %w", op, err)
+	}
+	if err := u.tokenStorage.RotateRefreshToken(ctx, old.ID, next); err != nil {
+		if errors.Is(err, domain.ErrRefreshTokenReused) {
+			return domain.Tokens{}, u.revokeReusedFamily(ctx, op, old)
+		}
+		return domain.Tokens{}, fmt.Errorf("%s: tokenStorage.RotateRefreshToken: %w", op, err)
+	}
+
+	return tokens, nil
+}
+
+// RefreshClientTokens exchanges refresh token of a session authorized for the client like RefreshTokens.
+// Returns domain.ErrInvalidRefreshToken if the session was authorized for another client
+func (u *UserService) RefreshClientTokens(ctx context.Context, clientID, refreshToken, dpopJKT string) (domain.Tokens, error) {
+	op := "AuthService.RefreshClientTokens"
+	token, err := u.tokenStorage.GetRefreshToken(ctx, auth.HashToken(refreshToken))
+	if err != nil {
+		if errors.Is(err, domain.ErrInvalidRefreshToken) {
+			return domain.Tokens{}, err
+		}
+		return domain.Tokens{}, fmt.Errorf("%s: tokenStorage.GetRefreshToken: %w", op, err)
+	}
+	session, err := u.sessionStorage.GetSession(ctx, token.FamilyID)
+	if err != nil {
+		if errors.Is(err, domain.ErrSessionNotFound) {
+			return domain.Tokens{}, domain.ErrInvalidRefreshToken
+		}
+		return domain.Tokens{}, fmt.Errorf("%s: sessionStorage.GetSession: %w", op, err)
+	}
+	if session.ClientID != clientID {
+		return domain.Tokens{}, domain.ErrInvalidRefreshToken
+	}
+	return u.RefreshTokens(ctx, refreshToken, dpopJKT)
+}
+
+// SignOut revokes the access token and the session from context together with its refresh tokens.
+// Returns domain.ErrSessionRequired if called with a personal access token
+func (u *UserService) SignOut(ctx context.Context) error {
+	op := "AuthService.SignOut"
+	claims, ok := auth.ClaimsFromContext(ctx)
+	if !ok {
+		return fmt.Errorf("token claims not found in context")
+	}
+	if claims.SessionID == "" {
+		return domain.ErrSessionRequired
+	}
+	userID, err := claims.UserID()
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	if err := u.sessionStorage.RevokeSession(ctx, claims.SessionID, userID); err != nil && !errors.Is(err, domain.ErrSessionNotFound) {
+		return fmt.Errorf("%s: sessionStorage.RevokeSession: %w", op, err)
+	}
+	if err := u.tokenStorage.RevokeToken(ctx, claims.ID, userID, claims.ExpiresAt.Time); err != nil {
+		return fmt.Errorf("%s: tokenStorage.RevokeToken: %w", op, err)
+	}
+	return nil
+}
+
+// SignOutAll revokes all tokens of the user from context like RevokeAllTokens
+func (u *UserService) SignOutAll(ctx context.Context) error {
+	op := "AuthService.SignOutAll"
+	userID, ok := auth.UserIDFromContext(ctx)
+	if !ok {
+		return fmt.Errorf("userID not found in context")
+	}
+	if err := u.RevokeAllTokens(ctx, userID); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	return nil
+}
+
+// ResetPassword sets a new password of the user and revokes all sessions, access, refresh and personal access tokens of the user.
+// Returns domain.ErrUserNotFound if user not found
+func (u *UserService) ResetPassword(ctx context.Context, userID uint, password string) error {
+	op := "AuthService.ResetPassword"
+	hashPass, err := hashPassword(password)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	if err := u.userStorage.UpdatePassword(ctx, userID, hashPass); err != nil {
+		if errors.Is(err, domain.ErrUserNotFound) {
+			return err
+		}
+		return fmt.Errorf("%s: userStorage.UpdatePassword: %w", op, err)
+	}
+
+	if err := u.RevokeAllTokens(ctx, userID); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	return nil
+}
+
+// RevokeAllTokens revokes every session, access, refresh and personal access token of the user,
+// authorization and device codes not exchanged yet stop working too
+func (u *UserService) RevokeAllTokens(ctx context.Context, userID uint) error {
+	op := "AuthService.RevokeAllTokens"
+	now := time.Now()
+	if err := u.tokenStorage.RevokeUserTokens(ctx, userID, now, now.Add(u.cfg.AccessTokenTTL)); err != nil {
+		return fmt.Errorf("%s: tokenStorage.RevokeUserTokens: %w", op, err)
+	}
+	return nil
+}
+
+// RevokeOtherSessions revokes every session of the user except keepID with their refresh tokens
+func (u *UserService) RevokeOtherSessions(ctx context.Context, userID uint, keepID string) error {
+	op := "AuthService.RevokeOtherSessions"
+	if err := u.sessionStorage.RevokeOtherSessions(ctx, userID, keepID, time.Now()); err != nil {
+		return fmt.Errorf("%s: sessionStorage.RevokeOtherSessions: %w", op, err)
+	}
+	return nil
+}
+
+// ChangePassword sets a new password of the user from context if the current one is correct. If signOutOthers is set,
+// every other session of the user is revoked with its refresh tokens, the current session is kept.
+// Returns domain.ErrInvalidCredentials if current password is wrong and domain.ErrSessionRequired
+// if called with a personal access token
+func (u *UserService) ChangePassword(ctx context.Context, currentPassword, newPassword string, signOutOthers bool) error {
+	op := "AuthService.ChangePassword"
+	claims, ok := auth.ClaimsFromContext(ctx)
+	if !ok {
+		return fmt.Errorf("token claims not found in context")
+	}
+	if claims.SessionID == "" {
+		return domain.ErrSessionRequired
+	}
+	userID, err := claims.UserID()
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	user, err := u.userStorage.GetUserByID(ctx, userID)
+	if err != nil {
+		return fmt.Errorf("%s: userStorage.GetUserByID: %w", op, err)
+	}
+	if err := bcrypt.CompareHashAndPassword([]byte(user.HashPass), []byte(currentPassword)); err != nil {
+		return domain.ErrInvalidCredentials
+	}
+	hashPass, err := hashPassword(newPassword)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	if err := u.userStorage.UpdatePassword(ctx, userID, hashPass); err != nil {
+		return fmt.Errorf("%s: userStorage.UpdatePassword: %w", op, err)
+	}
+
+	if signOutOthers {
+		if err := u.RevokeOtherSessions(ctx, userID, claims.SessionID); err != nil {
+			return fmt.Errorf("%s: %w", op, err)
+		}
+	}
+	return nil
+}
+
+// VerifyAccessToken parses access token and checks that neither the token was revoked nor its session has ended.
+// Personal access tokens and tokens of clients are accepted too, their claims have no session. Returns domain.ErrInvalidToken if token is not valid
+func (u *UserService) VerifyAccessToken(ctx context.Context, token string) (*auth.Claims, error) {
+	return u.verifyAccessToken(ctx, token, true)
+}
+
+// InspectAccessToken checks access token like VerifyAccessToken for those asking about the token on behalf of its
+// holder, e.g. introspection. It is not a use of the token, so the session idle timeout is not extended
+func (u *UserService) InspectAccessToken(ctx context.Context, token string) (*auth.Claims, error) {
+	return u.verifyAccessToken(ctx, token, false)
+}
+
+// verifyAccessToken checks access token, the use of its session or personal token is recorded only if touch is set
+func (u *UserService) verifyAccessToken(ctx context.Context, token string, touch bool) (*auth.Claims, error) {
+	op := "AuthService.verifyAccessToken"
+	if strings.HasPrefix(token, PersonalTokenPrefix) {
+		return u.verifyPersonalToken(ctx, token, touch)
+	}
+	claims, err := u.TokenManager.Parse(token)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", domain.ErrInvalidToken, err)
+	}
+	var userID uint
+	if !claims.IsClient() {
+		userID, err = claims.UserID()
+		if err != nil {
+			return nil, fmt.Errorf("%w: %w", domain.ErrInvalidToken, err)
+		}
+	}
+
+	revoked, err := u.tokenStorage.IsTokenRevoked(ctx, claims.ID, userID, claims.IssuedAt.Time)
+	if err != nil {
+		return nil, fmt.Errorf("%s: tokenStorage.IsTokenRevoked: %w", op, err)
+	}
+	if revoked {
+		return nil, fmt.Errorf("%w: %w", domain.ErrInvalidToken, domain.ErrTokenRevoked)
+	}
+	if claims.IsClient() {
+		// tokens of clients have no session
+		return claims, nil
+	}
+
+	checkSession := u.activeSession
+	if touch {
+		checkSession = u.touchSession
+	}
+	if _, err := checkSession(ctx, claims.SessionID, userID); err != nil {
+		if errors.Is(err, domain.ErrSessionNotFound) || errors.Is(err, domain.ErrSessionExpired) {
+			return nil, fmt.Errorf("%w: %w", domain.ErrInvalidToken, err)
+		}
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	return claims, nil
+}
+
+// VerifyRefreshToken returns refresh token if it can be exchanged for new tokens, the token is not used.
+// Returns domain.ErrInvalidRefreshToken if token is unknown, used, expired, revoked or its session has ended
+func (u *UserService) VerifyRefreshToken(ctx context.Context, refreshToken string) (domain.RefreshToken, error) {
+	op := "AuthService.VerifyRefreshToken"
+	token, err := u.tokenStorage.GetRefreshToken(ctx, auth.HashToken(refreshToken))
+	if err != nil {
+		if errors.Is(err, domain.ErrInvalidRefreshToken) {
+			return token, err
+		}
+		return token, fmt.Errorf("%s: tokenStorage.GetRefreshToken: %w", op, err)
+	}
+	if token.UsedAt != nil || token.RevokedAt != nil || time.Now().After(token.ExpiresAt) {
+		return token, domain.ErrInvalidRefreshToken
+	}
+
+	session, err := u.sessionStorage.GetSession(ctx, token.FamilyID)
+	if err != nil {
+		if errors.Is(err, domain.ErrSessionNotFound) {
+			return token, domain.ErrInvalidRefreshToken
+		}
+		return token, fmt.Errorf("%s: sessionStorage.GetSession: %w", op, err)
+	}
+	if !session.Active(time.Now(), u.cfg.SessionIdleTimeout) {
+		return token, domain.ErrInvalidRefreshToken
+	}
 	return token, nil
 }
 
-// UpdateUserProfile updates user profile. Returns domain.ErrUserNotFound if user with such id not found
+// PruneRevokedTokens removes revocation entries of already expired tokens
+func (u *UserService) PruneRevokedTokens(ctx context.Context) (int64, error) {
+	op := "AuthService.PruneRevokedTokens"
+	pruned, err := u.tokenStorage.PruneRevokedTokens(ctx, time.Now())
+	if err != nil {
+		return pruned, fmt.Errorf("%s: tokenStorage.PruneRevokedTokens: %w", op, err)
+	}
+	return pruned, nil
+}
+
+// UpdateUserProfile updates user profile. Returns domain.ErrEmailUpdate if email is set, it is changed only after
+// confirmation, see AccountService.RequestEmailChange, and domain.ErrUserNotFound if user with such id not found
 func (u *UserService) UpdateUserProfile(ctx context.Context, req domain.UserProfileUpdateReq) error {
-	userID, ok := ctx.Value("userID").(float64)
+	userID, ok := auth.UserIDFromContext(ctx)
 	if !ok {
 		return fmt.Errorf("userID not found in context")
 	}
-	req.ID = uint(userID)
+	if req.Email != nil {
+		return domain.ErrEmailUpdate
+	}
+	req.ID = userID
 	return u.userStorage.UpdateUser(ctx, &req)
 }
+
+// newTokens issues access token with current global roles of the user and the user's roles and groups in the active
+// organization of the session, and a refresh token for the session
+func (u *UserService) newTokens(ctx context.Context, userID uint, session domain.Session) (domain.Tokens, *domain.RefreshToken, error) {
+	userRoles, orgID, err := u.userRoles(ctx, userID, session.OrgID)
+	if err != nil {
+		return domain.Tokens{}, nil, err
+	}
+	var groups []string
+	if orgID != 0 && u.cfg.GroupsClaim {
+		userGroups, err := u.groupStorage.GetUserGroups(ctx, orgID, userID)
+		if err != nil {
+			return domain.Tokens{}, nil, fmt.Errorf("groupStorage.GetUserGroups: %w", err)
+		}
+		groups = groupNames(userGroups)
+	}
+	roles, permissions := rolesAndPermissions(userRoles)
+	if u.cfg.EmailVerification == EmailVerificationScopes {
+		user, err := u.userStorage.GetUserByID(ctx, userID)
+		if err != nil {
+			return domain.Tokens{}, nil, fmt.Errorf("userStorage.GetUserByID: %w", err)
+		}
+		if !user.EmailVerified {
+			permissions = slices.DeleteFunc(permissions, func(p string) bool { return !slices.Contains(u.cfg.UnverifiedScopes, p) })
+		}
+	}
+	if session.ClientID != "" {
+		// tokens of client sessions get only the authorized scopes the user still has
+		permissions = slices.DeleteFunc(permissions, func(p string) bool { return !slices.Contains(session.Scopes, p) })
+		// OpenID Connect scopes are not permissions of the user, they grant access to the userinfo endpoint
+		for _, s := range domain.OIDCScopes {
+			if slices.Contains(session.Scopes, s) && !slices.Contains(permissions, s) {
+				permissions = append(permissions, s)
+			}
+		}
+	}
+
+	accessToken, err := u.TokenManager.NewAccessToken(auth.TokenParams{
+		UserID:      userID,
+		SessionID:   session.ID,
+		OrgID:       orgID,
+		Roles:       roles,
+		Groups:      groups,
+		Permissions: permissions,
+		DPoPJKT:     session.DPoPJKT,
+		ClientID:    session.ClientID,
+	})
+	if err != nil {
+		return domain.Tokens{}, nil, fmt.Errorf("tokenManager.NewAccessToken: %w", err)
+	}
+	refreshToken, err := u.TokenManager.NewRefreshToken()
+	if err != nil {
+		return domain.Tokens{}, nil, fmt.Errorf("tokenManager.NewRefreshToken: %w", err)
+	}
+
+	now := time.Now()
+	expiresAt := now.Add(u.cfg.RefreshTokenTTL)
+	if session.ExpiresAt.Before(expiresAt) {
+		expiresAt = session.ExpiresAt
+	}
+	tokens := domain.Tokens{AccessToken: accessToken, RefreshToken: refreshToken, Scope: strings.Join(permissions, " ")}
+	return tokens, &domain.RefreshToken{
+		UserID:    userID,
+		FamilyID:  session.ID,
+		TokenHash: auth.HashToken(refreshToken),
+		ExpiresAt: expiresAt,
+		CreatedAt: now,
+	}, nil
+}
+
+// userRoles returns global roles of the user and the user's roles in the organization, orgID is reset to 0 if user
+// is not a member of it anymore
+func (u *UserService) userRoles(ctx context.Context, userID, orgID uint) ([]domain.Role, uint, error) {
+	roles, err := u.roleStorage.GetUserRoles(ctx, userID)
+	if err != nil {
+		return nil, 0, fmt.Errorf("roleStorage.GetUserRoles: %w", err)
+	}
+	if orgID == 0 {
+		return roles, 0, nil
+	}
+	memberRoles, err := u.orgStorage.GetMemberRoles(ctx, orgID, userID)
+	switch {
+	case errors.Is(err, domain.ErrNotOrgMember):
+		// user was removed from the organization after switching to it
+		return roles, 0, nil
+	case err != nil:
+		return nil, 0, fmt.Errorf("orgStorage.GetMemberRoles: %w", err)
+	}
+	return append(roles, memberRoles...), orgID, nil
+}
+
+func hashPassword(password string) ([]byte, error) {
+	hashPass, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return nil, fmt.Errorf("bcrypt.GenerateFromPassword: %w", err)
+	}
+	return hashPass, nil
+}
+
+func (u *UserService) revokeReusedFamily(ctx context.Context, op string, token domain.RefreshToken) error {
+	err := u.sessionStorage.RevokeSession(ctx, token.FamilyID, token.UserID)
+	if err != nil && !errors.Is(err, domain.ErrSessionNotFound) {
+		return fmt.Errorf("%s: sessionStorage.RevokeSession: %w", op, err)
+	}
+	return domain.ErrRefreshTokenReused
+}
@@ -0,0 +1,329 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"github.com/qPyth/mobydev-internship-auth/internal/domain"
+	"testing"
+	"time"
+)
+
+func TestUserService_RefreshTokens(t *testing.T) {
+	tests := []struct {
+		name string
+		// run uses the refresh token of a new session and returns the error of the checked call
+		run     func(ctx context.Context, users *UserService, refreshToken string) error
+		wantErr error
+	}{
+		{
+			name: "rotates refresh token",
+			run: func(ctx context.Context, users *UserService, refreshToken string) error {
+				tokens, err := users.RefreshTokens(ctx, refreshToken, "")
+				if err != nil {
+					return err
+				}
+				if tokens.RefreshToken == refreshToken {
+					return errors.New("refresh token was not rotated")
+				}
+				_, err = users.VerifyAccessToken(ctx, tokens.AccessToken)
+				return err
+			},
+		},
+		{
+			name: "rotated token refreshes again",
+			run: func(ctx context.Context, users *UserService, refreshToken string) error {
+				tokens, err := users.RefreshTokens(ctx, refreshToken, "")
+				if err != nil {
+					return err
+				}
+				_, err = users.RefreshTokens(ctx, tokens.RefreshToken, "")
+				return err
+			},
+		},
+		{
+			name: "used token is reported as reused",
+			run: func(ctx context.Context, users *UserService, refreshToken string) error {
+				if _, err := users.RefreshTokens(ctx, refreshToken, ""); err != nil {
+					return err
+				}
+				_, err := users.RefreshTokens(ctx, refreshToken, "")
+				return err
+			},
+			wantErr: domain.ErrRefreshTokenReused,
+		},
+		{
+			name: "reuse revokes the whole family",
+			run: func(ctx context.Context, users *UserService, refreshToken string) error {
+				tokens, err := users.RefreshTokens(ctx, refreshToken, "")
+				if err != nil {
+					return err
+				}
+				if _, err := users.RefreshTokens(ctx, refreshToken, ""); !errors.Is(err, domain.ErrRefreshTokenReused) {
+					return err
+				}
+				_, err = users.RefreshTokens(ctx, tokens.RefreshToken, "")
+				return err
+			},
+			wantErr: domain.ErrInvalidRefreshToken,
+		},
+		{
+			name: "reuse ends the session",
+			run: func(ctx context.Context, users *UserService, refreshToken string) error {
+				tokens, err := users.RefreshTokens(ctx, refreshToken, "")
+				if err != nil {
+					return err
+				}
+				if _, err := users.RefreshTokens(ctx, refreshToken, ""); !errors.Is(err, domain.ErrRefreshTokenReused) {
+					return err
+				}
+				_, err = users.VerifyAccessToken(ctx, tokens.AccessToken)
+				return err
+			},
+			wantErr: domain.ErrInvalidToken,
+		},
+		{
+			name: "unknown token",
+			run: func(ctx context.Context, users *UserService, _ string) error {
+				_, err := users.RefreshTokens(ctx, "unknown", "")
+				return err
+			},
+			wantErr: domain.ErrInvalidRefreshToken,
+		},
+		{
+			name: "token of ended session",
+			run: func(ctx context.Context, users *UserService, refreshToken string) error {
+				if err := users.SignOut(ctx); err != nil {
+					return err
+				}
+				_, err := users.RefreshTokens(ctx, refreshToken, "")
+				return err
+			},
+			wantErr: domain.ErrInvalidRefreshToken,
+		},
+		{
+			name: "token bound to DPoP key requires the key",
+			run: func(ctx context.Context, users *UserService, _ string) error {
+				tokens, err := users.SignIn(ctx, "user@example.com", "password1", domain.SessionMeta{DPoPJKT: "thumbprint"})
+				if err != nil {
+					return err
+				}
+				_, err = users.RefreshTokens(ctx, tokens.RefreshToken, "another")
+				return err
+			},
+			wantErr: domain.ErrInvalidDPoPProof,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			users := newTestUserService(t, newTestStorage(t))
+			ctx, _, tokens := signUpAndIn(t, users, "user@example.com", "password1")
+
+			err := tt.run(ctx, users, tokens.RefreshToken)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("got error %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestUserService_UpdateUserProfileRejectsEmail(t *testing.T) {
+	storage := newTestStorage(t)
+	users := newTestUserService(t, storage)
+	ctx, userID, _ := signUpAndIn(t, users, "user@example.com", "password1")
+
+	name, email := "User", "new@example.com"
+	err := users.UpdateUserProfile(ctx, domain.UserProfileUpdateReq{Name: &name, Email: &email})
+	if !errors.Is(err, domain.ErrEmailUpdate) {
+		t.Fatalf("got error %v, want ErrEmailUpdate", err)
+	}
+	user, err := storage.GetUserByID(ctx, userID)
+	if err != nil {
+		t.Fatalf("GetUserByID: %v", err)
+	}
+	if user.Email != "user@example.com" || user.Name == name {
+		t.Fatalf("profile was updated: %+v", user)
+	}
+}
+
+func TestUserService_InspectAccessTokenKeepsSessionIdle(t *testing.T) {
+	storage := newTestStorage(t)
+	users := newTestUserService(t, storage)
+	ctx, _, tokens := signUpAndIn(t, users, "user@example.com", "password1")
+	claims, err := users.TokenManager.Parse(tokens.AccessToken)
+	if err != nil {
+		t.Fatalf("Parse: %v", err)
+	}
+	lastSeenAt := time.Now().Add(-30 * time.Minute).UTC().Truncate(time.Second)
+	if err := storage.TouchSession(ctx, claims.SessionID, lastSeenAt); err != nil {
+		t.Fatalf("TouchSession: %v", err)
+	}
+
+	if _, err := users.InspectAccessToken(ctx, tokens.AccessToken); err != nil {
+		t.Fatalf("InspectAccessToken: %v", err)
+	}
+	session, err := storage.GetSession(ctx, claims.SessionID)
+	if err != nil {
+		t.Fatalf("GetSession: %v", err)
+	}
+	if !session.LastSeenAt.Equal(lastSeenAt) {
+		t.Fatalf("inspection moved last seen time from %s to %s", lastSeenAt, session.LastSeenAt)
+	}
+
+	if _, err := users.VerifyAccessToken(ctx, tokens.AccessToken); err != nil {
+		t.Fatalf("VerifyAccessToken: %v", err)
+	}
+	session, err = storage.GetSession(ctx, claims.SessionID)
+	if err != nil {
+		t.Fatalf("GetSession: %v", err)
+	}
+	if !session.LastSeenAt.After(lastSeenAt) {
+		t.Fatalf("verification kept last seen time %s", session.LastSeenAt)
+	}
+}
+
+func TestUserService_SessionExpiry(t *testing.T) {
+	storage := newTestStorage(t)
+	users := newTestUserService(t, storage)
+
+	t.Run("idle timeout", func(t *testing.T) {
+		ctx, _, tokens := signUpAndIn(t, users, "idle@example.com", "password1")
+		claims, err := users.TokenManager.Parse(tokens.AccessToken)
+		if err != nil {
+			t.Fatalf("Parse: %v", err)
+		}
+
+		// activity within the idle timeout keeps the session
+		if err := storage.TouchSession(ctx, claims.SessionID, time.Now().Add(-59*time.Minute)); err != nil {
+			t.Fatalf("TouchSession: %v", err)
+		}
+		if _, err := users.VerifyAccessToken(ctx, tokens.AccessToken); err != nil {
+			t.Fatalf("VerifyAccessToken within idle timeout: %v", err)
+		}
+		session, err := storage.GetSession(ctx, claims.SessionID)
+		if err != nil {
+			t.Fatalf("GetSession: %v", err)
+		}
+		if time.Since(session.LastSeenAt) > time.Minute {
+			t.Fatalf("use of the token did not move last seen time %s", session.LastSeenAt)
+		}
+
+		if err := storage.TouchSession(ctx, claims.SessionID, time.Now().Add(-time.Hour)); err != nil {
+			t.Fatalf("TouchSession: %v", err)
+		}
+		if _, err := users.VerifyAccessToken(ctx, tokens.AccessToken); !errors.Is(err, domain.ErrInvalidToken) {
+			t.Fatalf("VerifyAccessToken: got error %v, want ErrInvalidToken", err)
+		}
+		if _, err := users.RefreshTokens(ctx, tokens.RefreshToken, ""); !errors.Is(err, domain.ErrInvalidRefreshToken) {
+			t.Fatalf("RefreshTokens: got error %v, want ErrInvalidRefreshToken", err)
+		}
+		sessions, err := users.ListSessions(ctx)
+		if err != nil {
+			t.Fatalf("ListSessions: %v", err)
+		}
+		if len(sessions) != 0 {
+			t.Fatalf("got %d sessions, want the idle one omitted", len(sessions))
+		}
+	})
+
+	t.Run("absolute timeout", func(t *testing.T) {
+		users := NewUserService(storage, storage, storage, storage, storage, storage, storage, users.TokenManager, Config{
+			AccessTokenTTL:         15 * time.Minute,
+			RefreshTokenTTL:        time.Hour,
+			SessionIdleTimeout:     time.Hour,
+			SessionAbsoluteTimeout: time.Second,
+		})
+		ctx, _, tokens := signUpAndIn(t, users, "absolute@example.com", "password1")
+		if _, err := users.VerifyAccessToken(ctx, tokens.AccessToken); err != nil {
+			t.Fatalf("VerifyAccessToken: %v", err)
+		}
+
+		// the session ends even though it is in use
+		time.Sleep(1100 * time.Millisecond)
+		if _, err := users.VerifyAccessToken(ctx, tokens.AccessToken); !errors.Is(err, domain.ErrInvalidToken) {
+			t.Fatalf("VerifyAccessToken: got error %v, want ErrInvalidToken", err)
+		}
+		if _, err := users.RefreshTokens(ctx, tokens.RefreshToken, ""); !errors.Is(err, domain.ErrInvalidRefreshToken) {
+			t.Fatalf("RefreshTokens: got error %v, want ErrInvalidRefreshToken", err)
+		}
+	})
+}
+
+func TestUserService_ScopeFollowsRoles(t *testing.T) {
+	storage := newTestStorage(t)
+	users := newTestUserService(t, storage)
+	ctx, _, tokens := signUpAndIn(t, users, "user@example.com", "password1")
+	claims, err := users.VerifyAccessToken(ctx, tokens.AccessToken)
+	if err != nil {
+		t.Fatalf("VerifyAccessToken: %v", err)
+	}
+	if claims.HasScope("users:read") {
+		t.Fatalf("token of a user without roles has scope %q", claims.Scope)
+	}
+
+	if err := NewRoleService(storage, storage).AssignRoleByEmail(ctx, "user@example.com", "admin"); err != nil {
+		t.Fatalf("AssignRoleByEmail: %v", err)
+	}
+	tokens, err = users.RefreshTokens(ctx, tokens.RefreshToken, "")
+	if err != nil {
+		t.Fatalf("RefreshTokens: %v", err)
+	}
+	claims, err = users.VerifyAccessToken(ctx, tokens.AccessToken)
+	if err != nil {
+		t.Fatalf("VerifyAccessToken: %v", err)
+	}
+	for _, permission := range []string{"users:read", "users:write", "roles:read", "roles:write"} {
+		if !claims.HasScope(permission) {
+			t.Fatalf("token of an admin has scope %q, want %s in it", claims.Scope, permission)
+		}
+	}
+}
+
+func TestUserService_ChangePassword(t *testing.T) {
+	tests := []struct {
+		name          string
+		signOutOthers bool
+	}{
+		{name: "keeps other sessions"},
+		{name: "signs out other sessions", signOutOthers: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			storage := newTestStorage(t)
+			users := newTestUserService(t, storage)
+			ctx, _, current := signUpAndIn(t, users, "user@example.com", "password1")
+			other, err := users.SignIn(ctx, "user@example.com", "password1", domain.SessionMeta{})
+			if err != nil {
+				t.Fatalf("SignIn: %v", err)
+			}
+
+			if err := users.ChangePassword(ctx, "password3", "password2", tt.signOutOthers); !errors.Is(err, domain.ErrInvalidCredentials) {
+				t.Fatalf("wrong current password: got error %v, want ErrInvalidCredentials", err)
+			}
+			if err := users.ChangePassword(ctx, "password1", "password2", tt.signOutOthers); err != nil {
+				t.Fatalf("ChangePassword: %v", err)
+			}
+			if _, err := users.SignIn(ctx, "user@example.com", "password1", domain.SessionMeta{}); !errors.Is(err, domain.ErrInvalidCredentials) {
+				t.Fatalf("sign in with the previous password: got error %v, want ErrInvalidCredentials", err)
+			}
+
+			if _, err := users.VerifyAccessToken(ctx, current.AccessToken); err != nil {
+				t.Fatalf("current session: %v", err)
+			}
+			if _, err := users.RefreshTokens(ctx, current.RefreshToken, ""); err != nil {
+				t.Fatalf("refresh of the current session: %v", err)
+			}
+			_, verifyErr := users.VerifyAccessToken(ctx, other.AccessToken)
+			_, refreshErr := users.RefreshTokens(ctx, other.RefreshToken, "")
+			if tt.signOutOthers {
+				if !errors.Is(verifyErr, domain.ErrInvalidToken) || !errors.Is(refreshErr, domain.ErrInvalidRefreshToken) {
+					t.Fatalf("other session: got errors %v and %v, want ErrInvalidToken and ErrInvalidRefreshToken", verifyErr, refreshErr)
+				}
+				return
+			}
+			if verifyErr != nil || refreshErr != nil {
+				t.Fatalf("other session: got errors %v and %v, want it kept", verifyErr, refreshErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,29 @@
+package memory
+
+import (
+	"context"
+
+	"github.com/qPyth/mobydev-internship-auth/internal/domain"
+)
+
+// ClientStorage keeps OAuth clients registered in the config
+type ClientStorage struct {
+	clients map[string]domain.Client
+}
+
+func NewClientStorage(clients []domain.Client) *ClientStorage {
+	s := &ClientStorage{clients: make(map[string]domain.Client, len(clients))}
+	for _, client := range clients {
+		s.clients[client.ID] = client
+	}
+	return s
+}
+
+// GetClient returns client by id. Returns domain.ErrInvalidClient if client is not registered
+func (s *ClientStorage) GetClient(_ context.Context, id string) (domain.Client, error) {
+	client, ok := s.clients[id]
+	if !ok {
+		return domain.Client{}, domain.ErrInvalidClient
+	}
+	return client, nil
+}
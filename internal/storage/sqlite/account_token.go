@@ -0,0 +1,131 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/qPyth/mobydev-internship-auth/internal/domain"
+)
+
+// CreateAccountToken stores a new account token and sets its id, previous tokens of the user for the same purpose
+// are removed so only the latest link works. Undo tokens of email changes replace only the token for the same
+// previous address, so a later change does not disable undoing an earlier one
+func (s *Storage) CreateAccountToken(ctx context.Context, token *domain.AccountToken) error {
+	op := "sqlite.CreateAccountToken"
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("%s: db.BeginTx: %w", op, err)
+	}
+	defer tx.Rollback()
+
+	query, args := "DELETE FROM account_tokens WHERE user_id = ? AND purpose = ?", []interface{}{token.UserID, token.Purpose}
+	if token.Purpose == domain.AccountTokenEmailChangeUndo {
+		query += " AND email = ?"
+		args = append(args, token.Email)
+	}
+	if _, err := tx.ExecContext(ctx, query, args...); err != nil {
+		return fmt.Errorf("%s: tx.Exec: %w", op, err)
+	}
+	res, err := tx.ExecContext(ctx, `INSERT INTO account_tokens(user_id, purpose, email, session_id, token_hash, created_at, expires_at)
+		VALUES(?, ?, ?, ?, ?, ?, ?)`, token.UserID, token.Purpose, token.Email, sql.NullString{String: token.SessionID, Valid: token.SessionID != ""},
+		token.TokenHash, token.CreatedAt, token.ExpiresAt)
+	if err != nil {
+		return fmt.Errorf("%s: tx.Exec: %w", op, err)
+	}
+	id, err := res.LastInsertId()
+	if err != nil {
+		return fmt.Errorf("%s: res.LastInsertId: %w", op, err)
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("%s: tx.Commit: %w", op, err)
+	}
+	token.ID = uint(id)
+	return nil
+}
+
+// GetAccountToken returns account token by hash and purpose. Returns domain.ErrInvalidAccountToken if there is none
+func (s *Storage) GetAccountToken(ctx context.Context, tokenHash, purpose string) (domain.AccountToken, error) {
+	op := "sqlite.GetAccountToken"
+	row := s.db.QueryRowContext(ctx, `SELECT id, user_id, purpose, email, session_id, token_hash, created_at, expires_at, used_at
+		FROM account_tokens WHERE token_hash = ? AND purpose = ?`, tokenHash, purpose)
+	token, err := scanAccountToken(row)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return domain.AccountToken{}, domain.ErrInvalidAccountToken
+		}
+		return domain.AccountToken{}, fmt.Errorf("%s: row.Scan: %w", op, err)
+	}
+	return token, nil
+}
+
+// LatestAccountToken returns the last account token created for the user for the purpose.
+// Returns domain.ErrTokenNotFound if there is none
+func (s *Storage) LatestAccountToken(ctx context.Context, userID uint, purpose string) (domain.AccountToken, error) {
+	op := "sqlite.LatestAccountToken"
+	row := s.db.QueryRowContext(ctx, `SELECT id, user_id, purpose, email, session_id, token_hash, created_at, expires_at, used_at
+		FROM account_tokens WHERE user_id = ? AND purpose = ? ORDER BY created_at DESC LIMIT 1`, userID, purpose)
+	token, err := scanAccountToken(row)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return domain.AccountToken{}, domain.ErrTokenNotFound
+		}
+		return domain.AccountToken{}, fmt.Errorf("%s: row.Scan: %w", op, err)
+	}
+	return token, nil
+}
+
+// UseAccountToken marks account token as used, so it can be used once.
+// Returns domain.ErrInvalidAccountToken if token is unknown or already used
+func (s *Storage) UseAccountToken(ctx context.Context, id uint, usedAt time.Time) error {
+	op := "sqlite.UseAccountToken"
+	res, err := s.db.ExecContext(ctx, "UPDATE account_tokens SET used_at = ? WHERE id = ? AND used_at IS NULL", usedAt, id)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("%s: res.RowsAffected: %w", op, err)
+	}
+	if affected == 0 {
+		return domain.ErrInvalidAccountToken
+	}
+	return nil
+}
+
+// UseLaterAccountTokens marks not used tokens of the user for the purpose created after the token with afterID as used
+func (s *Storage) UseLaterAccountTokens(ctx context.Context, userID uint, purpose string, afterID uint, usedAt time.Time) error {
+	op := "sqlite.UseLaterAccountTokens"
+	_, err := s.db.ExecContext(ctx, "UPDATE account_tokens SET used_at = ? WHERE user_id = ? AND purpose = ? AND id > ? AND used_at IS NULL",
+		usedAt, userID, purpose, afterID)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	return nil
+}
+
+// DeleteAccountToken deletes the not used token whose email could not be sent, so it does not count for the resend interval
+func (s *Storage) DeleteAccountToken(ctx context.Context, id uint) error {
+	op := "sqlite.DeleteAccountToken"
+	if _, err := s.db.ExecContext(ctx, "DELETE FROM account_tokens WHERE id = ? AND used_at IS NULL", id); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	return nil
+}
+
+func scanAccountToken(row scanner) (domain.AccountToken, error) {
+	var token domain.AccountToken
+	var sessionID sql.NullString
+	var usedAt sql.NullTime
+	err := row.Scan(&token.ID, &token.UserID, &token.Purpose, &token.Email, &sessionID, &token.TokenHash, &token.CreatedAt, &token.ExpiresAt, &usedAt)
+	if err != nil {
+		return token, err
+	}
+	token.SessionID = sessionID.String
+	if usedAt.Valid {
+		token.UsedAt = &usedAt.Time
+	}
+	return token, nil
+}
@@ -0,0 +1,100 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/qPyth/mobydev-internship-auth/internal/domain"
+)
+
+// CreateAuthorizationCode stores a new authorization code, codes expired before it was created are removed
+func (s *Storage) CreateAuthorizationCode(ctx context.Context, code domain.AuthorizationCode) error {
+	op := "sqlite.CreateAuthorizationCode"
+	if _, err := s.db.ExecContext(ctx, "DELETE FROM oauth_codes WHERE expires_at < ?", code.CreatedAt); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	_, err := s.db.ExecContext(ctx, `INSERT INTO oauth_codes(code_hash, client_id, user_id, org_id, redirect_uri, scopes, code_challenge, nonce, created_at, expires_at)
+		VALUES(?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`, code.CodeHash, code.ClientID, code.UserID,
+		sql.NullInt64{Int64: int64(code.OrgID), Valid: code.OrgID != 0}, code.RedirectURI, strings.Join(code.Scopes, " "),
+		code.CodeChallenge, code.Nonce, code.CreatedAt, code.ExpiresAt)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	return nil
+}
+
+// UseAuthorizationCode marks authorization code as used and returns it, so every code can be used once.
+// Returns domain.ErrInvalidGrant if code is unknown or already used
+func (s *Storage) UseAuthorizationCode(ctx context.Context, codeHash string, usedAt time.Time) (domain.AuthorizationCode, error) {
+	op := "sqlite.UseAuthorizationCode"
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return domain.AuthorizationCode{}, fmt.Errorf("%s: db.BeginTx: %w", op, err)
+	}
+	defer tx.Rollback()
+
+	var code domain.AuthorizationCode
+	var orgID sql.NullInt64
+	var scopes string
+	err = tx.QueryRowContext(ctx, `SELECT code_hash, client_id, user_id, org_id, redirect_uri, scopes, code_challenge, nonce, created_at, expires_at
+		FROM oauth_codes WHERE code_hash = ? AND used_at IS NULL`, codeHash).Scan(&code.CodeHash, &code.ClientID, &code.UserID,
+		&orgID, &code.RedirectURI, &scopes, &code.CodeChallenge, &code.Nonce, &code.CreatedAt, &code.ExpiresAt)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return domain.AuthorizationCode{}, domain.ErrInvalidGrant
+		}
+		return domain.AuthorizationCode{}, fmt.Errorf("%s: row.Scan: %w", op, err)
+	}
+	code.OrgID, code.Scopes = uint(orgID.Int64), strings.Fields(scopes)
+
+	res, err := tx.ExecContext(ctx, "UPDATE oauth_codes SET used_at = ? WHERE code_hash = ? AND used_at IS NULL", usedAt, codeHash)
+	if err != nil {
+		return domain.AuthorizationCode{}, fmt.Errorf("%s: tx.Exec: %w", op, err)
+	}
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return domain.AuthorizationCode{}, fmt.Errorf("%s: res.RowsAffected: %w", op, err)
+	}
+	if affected == 0 {
+		return domain.AuthorizationCode{}, domain.ErrInvalidGrant
+	}
+
+	if err := tx.Commit(); err != nil {
+		return domain.AuthorizationCode{}, fmt.Errorf("%s: tx.Commit: %w", op, err)
+	}
+	code.UsedAt = &usedAt
+	return code, nil
+}
+
+// GetConsent returns scopes the user allowed the client to access, consent has no scopes if there is none
+func (s *Storage) GetConsent(ctx context.Context, userID uint, clientID string) (domain.Consent, error) {
+	op := "sqlite.GetConsent"
+	consent := domain.Consent{UserID: userID, ClientID: clientID}
+	var scopes string
+	err := s.db.QueryRowContext(ctx, "SELECT scopes, created_at, updated_at FROM oauth_consents WHERE user_id = ? AND client_id = ?",
+		userID, clientID).Scan(&scopes, &consent.CreatedAt, &consent.UpdatedAt)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return consent, nil
+		}
+		return consent, fmt.Errorf("%s: row.Scan: %w", op, err)
+	}
+	consent.Scopes = strings.Fields(scopes)
+	return consent, nil
+}
+
+// SaveConsent creates or replaces consent of the user for the client
+func (s *Storage) SaveConsent(ctx context.Context, consent domain.Consent) error {
+	op := "sqlite.SaveConsent"
+	_, err := s.db.ExecContext(ctx, `INSERT INTO oauth_consents(user_id, client_id, scopes, created_at, updated_at) VALUES(?, ?, ?, ?, ?)
+		ON CONFLICT(user_id, client_id) DO UPDATE SET scopes = excluded.scopes, updated_at = excluded.updated_at`,
+		consent.UserID, consent.ClientID, strings.Join(consent.Scopes, " "), consent.CreatedAt, consent.UpdatedAt)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	return nil
+}
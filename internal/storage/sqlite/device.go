@@ -0,0 +1,133 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/qPyth/mobydev-internship-auth/internal/domain"
+)
+
+const deviceCodeColumns = `device_code_hash, user_code, client_id, scopes, status, user_id, org_id, poll_interval, last_polled_at,
+	created_at, expires_at, used_at`
+
+// CreateDeviceCode stores a new device code, codes expired before it was created are removed
+func (s *Storage) CreateDeviceCode(ctx context.Context, code domain.DeviceCode) error {
+	op := "sqlite.CreateDeviceCode"
+	if _, err := s.db.ExecContext(ctx, "DELETE FROM oauth_device_codes WHERE expires_at < ?", code.CreatedAt); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	_, err := s.db.ExecContext(ctx, `INSERT INTO oauth_device_codes(device_code_hash, user_code, client_id, scopes, status,
+		poll_interval, created_at, expires_at) VALUES(?, ?, ?, ?, ?, ?, ?, ?)`, code.DeviceCodeHash, code.UserCode, code.ClientID,
+		strings.Join(code.Scopes, " "), code.Status, int64(code.Interval.Seconds()), code.CreatedAt, code.ExpiresAt)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	return nil
+}
+
+// GetDeviceCode returns device code by hash. Returns domain.ErrInvalidGrant if code is unknown
+func (s *Storage) GetDeviceCode(ctx context.Context, deviceCodeHash string) (domain.DeviceCode, error) {
+	op := "sqlite.GetDeviceCode"
+	row := s.db.QueryRowContext(ctx, "SELECT "+deviceCodeColumns+" FROM oauth_device_codes WHERE device_code_hash = ?", deviceCodeHash)
+	code, err := scanDeviceCode(row)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return domain.DeviceCode{}, domain.ErrInvalidGrant
+		}
+		return domain.DeviceCode{}, fmt.Errorf("%s: row.Scan: %w", op, err)
+	}
+	return code, nil
+}
+
+// GetPendingDeviceCode returns not expired device code waiting for approval by user code.
+// Returns domain.ErrDeviceCodeNotFound if there is none
+func (s *Storage) GetPendingDeviceCode(ctx context.Context, userCode string, now time.Time) (domain.DeviceCode, error) {
+	op := "sqlite.GetPendingDeviceCode"
+	row := s.db.QueryRowContext(ctx, "SELECT "+deviceCodeColumns+` FROM oauth_device_codes
+		WHERE user_code = ? AND status = ? AND expires_at > ?`, userCode, domain.DeviceCodePending, now)
+	code, err := scanDeviceCode(row)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return domain.DeviceCode{}, domain.ErrDeviceCodeNotFound
+		}
+		return domain.DeviceCode{}, fmt.Errorf("%s: row.Scan: %w", op, err)
+	}
+	return code, nil
+}
+
+// DecideDeviceCode sets status of the pending device code and the user who approved or denied it.
+// Returns domain.ErrDeviceCodeNotFound if there is no such not expired pending code
+func (s *Storage) DecideDeviceCode(ctx context.Context, userCode, status string, userID, orgID uint, now time.Time) error {
+	op := "sqlite.DecideDeviceCode"
+	res, err := s.db.ExecContext(ctx, `UPDATE oauth_device_codes SET status = ?, user_id = ?, org_id = ?
+		WHERE user_code = ? AND status = ? AND expires_at > ?`, status, userID,
+		sql.NullInt64{Int64: int64(orgID), Valid: orgID != 0}, userCode, domain.DeviceCodePending, now)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("%s: res.RowsAffected: %w", op, err)
+	}
+	if affected == 0 {
+		return domain.ErrDeviceCodeNotFound
+	}
+	return nil
+}
+
+// UpdateDevicePoll records the time the device polled the token endpoint and the interval it must wait
+func (s *Storage) UpdateDevicePoll(ctx context.Context, deviceCodeHash string, polledAt time.Time, interval time.Duration) error {
+	op := "sqlite.UpdateDevicePoll"
+	_, err := s.db.ExecContext(ctx, "UPDATE oauth_device_codes SET last_polled_at = ?, poll_interval = ? WHERE device_code_hash = ?",
+		polledAt, int64(interval.Seconds()), deviceCodeHash)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	return nil
+}
+
+// UseDeviceCode marks approved device code as used, so tokens are issued once.
+// Returns domain.ErrInvalidGrant if code is not approved or already used
+func (s *Storage) UseDeviceCode(ctx context.Context, deviceCodeHash string, usedAt time.Time) error {
+	op := "sqlite.UseDeviceCode"
+	res, err := s.db.ExecContext(ctx, `UPDATE oauth_device_codes SET used_at = ?
+		WHERE device_code_hash = ? AND status = ? AND used_at IS NULL`, usedAt, deviceCodeHash, domain.DeviceCodeApproved)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("%s: res.RowsAffected: %w", op, err)
+	}
+	if affected == 0 {
+		return domain.ErrInvalidGrant
+	}
+	return nil
+}
+
+func scanDeviceCode(row scanner) (domain.DeviceCode, error) {
+	var code domain.DeviceCode
+	var scopes string
+	var userID, orgID sql.NullInt64
+	var interval int64
+	var lastPolledAt, usedAt sql.NullTime
+	err := row.Scan(&code.DeviceCodeHash, &code.UserCode, &code.ClientID, &scopes, &code.Status, &userID, &orgID, &interval,
+		&lastPolledAt, &code.CreatedAt, &code.ExpiresAt, &usedAt)
+	if err != nil {
+		return code, err
+	}
+	code.Scopes = strings.Fields(scopes)
+	code.UserID, code.OrgID = uint(userID.Int64), uint(orgID.Int64)
+	code.Interval = time.Duration(interval) * time.Second
+	if lastPolledAt.Valid {
+		code.LastPolledAt = &lastPolledAt.Time
+	}
+	if usedAt.Valid {
+		code.UsedAt = &usedAt.Time
+	}
+	return code, nil
+}
@@ -0,0 +1,365 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+
+	"github.com/mattn/go-sqlite3"
+	"github.com/qPyth/mobydev-internship-auth/internal/domain"
+)
+
+// Transitive membership is resolved by recursive queries over group_subgroups. UNION removes duplicates,
+// so the recursion stops even if the graph had a cycle
+
+// userGroupsCTE selects ids of groups of the organization the user is a direct or transitive member of
+const userGroupsCTE = `WITH RECURSIVE user_groups(id) AS (
+		SELECT gm.group_id FROM group_members gm JOIN groups g ON g.id = gm.group_id WHERE gm.user_id = ? AND g.org_id = ?
+		UNION
+		SELECT gs.parent_id FROM group_subgroups gs JOIN user_groups ug ON gs.child_id = ug.id
+	)`
+
+// descendantGroupsCTE selects id of the group and ids of all groups it transitively contains
+const descendantGroupsCTE = `WITH RECURSIVE descendants(id) AS (
+		SELECT ?
+		UNION
+		SELECT gs.child_id FROM group_subgroups gs JOIN descendants d ON gs.parent_id = d.id
+	)`
+
+// CreateGroup creates group in its organization. Returns domain.ErrGroupExists if the organization has group with such name
+func (s *Storage) CreateGroup(ctx context.Context, group *domain.Group) error {
+	op := "sqlite.CreateGroup"
+	res, err := s.db.ExecContext(ctx, "INSERT INTO groups(org_id, name, created_at) VALUES(?, ?, ?)", group.OrgID, group.Name, group.CreatedAt)
+	if err != nil {
+		var sqliteErr sqlite3.Error
+		if errors.As(err, &sqliteErr) && errors.Is(sqliteErr.ExtendedCode, sqlite3.ErrConstraintUnique) {
+			return domain.ErrGroupExists
+		}
+		return fmt.Errorf("%s: db.Exec: %w", op, err)
+	}
+	id, err := res.LastInsertId()
+	if err != nil {
+		return fmt.Errorf("%s: res.LastInsertId: %w", op, err)
+	}
+	group.ID = uint(id)
+	return nil
+}
+
+// ListGroups returns groups of the organization ordered by name
+func (s *Storage) ListGroups(ctx context.Context, orgID uint) ([]domain.Group, error) {
+	op := "sqlite.ListGroups"
+	groups, err := s.queryGroups(ctx, "SELECT id, org_id, name, created_at FROM groups WHERE org_id = ? ORDER BY name", orgID)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	return groups, nil
+}
+
+// GetGroup returns group of the organization with its direct roles, members and child groups.
+// Returns domain.ErrGroupNotFound if the organization has no such group
+func (s *Storage) GetGroup(ctx context.Context, orgID, id uint) (domain.Group, error) {
+	op := "sqlite.GetGroup"
+	var group domain.Group
+	err := s.db.QueryRowContext(ctx, "SELECT id, org_id, name, created_at FROM groups WHERE org_id = ? AND id = ?", orgID, id).
+		Scan(&group.ID, &group.OrgID, &group.Name, &group.CreatedAt)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return group, domain.ErrGroupNotFound
+		}
+		return group, fmt.Errorf("%s: row.Scan: %w", op, err)
+	}
+
+	roles, err := s.queryRoles(ctx, `SELECT r.id, r.name, r.description, r.scope, NULL FROM group_roles gr
+		JOIN roles r ON r.id = gr.role_id WHERE gr.group_id = ? ORDER BY r.name`, id)
+	if err != nil {
+		return group, fmt.Errorf("%s: %w", op, err)
+	}
+	group.Roles = make([]string, 0, len(roles))
+	for _, role := range roles {
+		group.Roles = append(group.Roles, role.Name)
+	}
+
+	group.Members, err = s.ListGroupMembers(ctx, orgID, id, false)
+	if err != nil {
+		return group, fmt.Errorf("%s: %w", op, err)
+	}
+	group.Groups, err = s.queryGroups(ctx, `SELECT g.id, g.org_id, g.name, g.created_at FROM group_subgroups gs
+		JOIN groups g ON g.id = gs.child_id WHERE gs.parent_id = ? ORDER BY g.name`, id)
+	if err != nil {
+		return group, fmt.Errorf("%s: %w", op, err)
+	}
+	return group, nil
+}
+
+// DeleteGroup deletes group of the organization with its memberships and roles, child groups are not deleted.
+// Returns domain.ErrGroupNotFound if the organization has no such group
+func (s *Storage) DeleteGroup(ctx context.Context, orgID, id uint) error {
+	op := "sqlite.DeleteGroup"
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("%s: db.BeginTx: %w", op, err)
+	}
+	defer tx.Rollback()
+
+	res, err := tx.ExecContext(ctx, "DELETE FROM groups WHERE org_id = ? AND id = ?", orgID, id)
+	if err != nil {
+		return fmt.Errorf("%s: tx.Exec: %w", op, err)
+	}
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("%s: res.RowsAffected: %w", op, err)
+	}
+	if affected == 0 {
+		return domain.ErrGroupNotFound
+	}
+	// foreign keys are not enforced by default, so references are deleted explicitly
+	for _, query := range []string{
+		"DELETE FROM group_members WHERE group_id = ?",
+		"DELETE FROM group_roles WHERE group_id = ?",
+		"DELETE FROM group_subgroups WHERE parent_id = ?1 OR child_id = ?1",
+	} {
+		if _, err := tx.ExecContext(ctx, query, id); err != nil {
+			return fmt.Errorf("%s: tx.Exec: %w", op, err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("%s: tx.Commit: %w", op, err)
+	}
+	return nil
+}
+
+// ListGroupMembers returns direct members of the group of the organization or, if transitive, also members
+// of all groups it contains. Members are ordered by email
+func (s *Storage) ListGroupMembers(ctx context.Context, orgID, groupID uint, transitive bool) ([]domain.Membership, error) {
+	op := "sqlite.ListGroupMembers"
+	query := `SELECT DISTINCT m.org_id, m.user_id, u.email, m.created_at FROM group_members gm
+		JOIN memberships m ON m.user_id = gm.user_id AND m.org_id = ?
+		JOIN users u ON u.id = gm.user_id
+		WHERE gm.group_id = ?
+		ORDER BY u.email`
+	if transitive {
+		query = descendantGroupsCTE + `
+		SELECT DISTINCT m.org_id, m.user_id, u.email, m.created_at FROM group_members gm
+		JOIN descendants d ON d.id = gm.group_id
+		JOIN memberships m ON m.user_id = gm.user_id AND m.org_id = ?
+		JOIN users u ON u.id = gm.user_id
+		ORDER BY u.email`
+	}
+	args := []interface{}{orgID, groupID}
+	if transitive {
+		args = []interface{}{groupID, orgID}
+	}
+
+	rows, err := s.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("%s: db.Query: %w", op, err)
+	}
+	defer rows.Close()
+
+	members := []domain.Membership{}
+	for rows.Next() {
+		var member domain.Membership
+		if err := rows.Scan(&member.OrgID, &member.UserID, &member.Email, &member.CreatedAt); err != nil {
+			return nil, fmt.Errorf("%s: rows.Scan: %w", op, err)
+		}
+		members = append(members, member)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("%s: rows.Err: %w", op, err)
+	}
+	return members, nil
+}
+
+// AddGroupMember adds member of the organization to its group, adding existing member is not an error.
+// Returns domain.ErrGroupNotFound or domain.ErrNotOrgMember
+func (s *Storage) AddGroupMember(ctx context.Context, orgID, groupID, userID uint) error {
+	op := "sqlite.AddGroupMember"
+	if err := s.checkGroups(ctx, orgID, groupID); err != nil {
+		if errors.Is(err, domain.ErrGroupNotFound) {
+			return err
+		}
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	if err := s.checkMember(ctx, orgID, userID); err != nil {
+		if errors.Is(err, domain.ErrNotOrgMember) {
+			return err
+		}
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	_, err := s.db.ExecContext(ctx, "INSERT OR IGNORE INTO group_members(group_id, user_id) VALUES(?, ?)", groupID, userID)
+	if err != nil {
+		return fmt.Errorf("%s: db.Exec: %w", op, err)
+	}
+	return nil
+}
+
+// RemoveGroupMember removes user from the group of the organization, removing not a member is not an error.
+// Returns domain.ErrGroupNotFound if the organization has no such group
+func (s *Storage) RemoveGroupMember(ctx context.Context, orgID, groupID, userID uint) error {
+	op := "sqlite.RemoveGroupMember"
+	if err := s.checkGroups(ctx, orgID, groupID); err != nil {
+		if errors.Is(err, domain.ErrGroupNotFound) {
+			return err
+		}
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	_, err := s.db.ExecContext(ctx, "DELETE FROM group_members WHERE group_id = ? AND user_id = ?", groupID, userID)
+	if err != nil {
+		return fmt.Errorf("%s: db.Exec: %w", op, err)
+	}
+	return nil
+}
+
+// AddSubgroup makes child group a member of parent group, both must belong to the organization.
+// Returns domain.ErrGroupNotFound or domain.ErrGroupCycle if parent is the child or is transitively contained in it
+func (s *Storage) AddSubgroup(ctx context.Context, orgID, parentID, childID uint) error {
+	op := "sqlite.AddSubgroup"
+	if err := s.checkGroups(ctx, orgID, parentID, childID); err != nil {
+		if errors.Is(err, domain.ErrGroupNotFound) {
+			return err
+		}
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("%s: db.BeginTx: %w", op, err)
+	}
+	defer tx.Rollback()
+
+	var cycles int
+	err = tx.QueryRowContext(ctx, descendantGroupsCTE+" SELECT COUNT(*) FROM descendants WHERE id = ?", childID, parentID).Scan(&cycles)
+	if err != nil {
+		return fmt.Errorf("%s: row.Scan: %w", op, err)
+	}
+	if cycles > 0 {
+		return domain.ErrGroupCycle
+	}
+	_, err = tx.ExecContext(ctx, "INSERT OR IGNORE INTO group_subgroups(parent_id, child_id) VALUES(?, ?)", parentID, childID)
+	if err != nil {
+		return fmt.Errorf("%s: tx.Exec: %w", op, err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("%s: tx.Commit: %w", op, err)
+	}
+	return nil
+}
+
+// RemoveSubgroup removes child group from parent group, removing not contained group is not an error.
+// Returns domain.ErrGroupNotFound if the organization has no such parent group
+func (s *Storage) RemoveSubgroup(ctx context.Context, orgID, parentID, childID uint) error {
+	op := "sqlite.RemoveSubgroup"
+	if err := s.checkGroups(ctx, orgID, parentID); err != nil {
+		if errors.Is(err, domain.ErrGroupNotFound) {
+			return err
+		}
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	_, err := s.db.ExecContext(ctx, "DELETE FROM group_subgroups WHERE parent_id = ? AND child_id = ?", parentID, childID)
+	if err != nil {
+		return fmt.Errorf("%s: db.Exec: %w", op, err)
+	}
+	return nil
+}
+
+// AssignGroupRole assigns organization role to the group of the organization, its transitive members get the role.
+// Returns domain.ErrGroupNotFound or domain.ErrRoleNotFound
+func (s *Storage) AssignGroupRole(ctx context.Context, orgID, groupID uint, role string) error {
+	op := "sqlite.AssignGroupRole"
+	roleID, err := s.groupRoleID(ctx, orgID, groupID, role)
+	if err != nil {
+		if errors.Is(err, domain.ErrGroupNotFound) || errors.Is(err, domain.ErrRoleNotFound) {
+			return err
+		}
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	_, err = s.db.ExecContext(ctx, "INSERT OR IGNORE INTO group_roles(group_id, role_id) VALUES(?, ?)", groupID, roleID)
+	if err != nil {
+		return fmt.Errorf("%s: db.Exec: %w", op, err)
+	}
+	return nil
+}
+
+// UnassignGroupRole removes organization role from the group of the organization.
+// Returns domain.ErrGroupNotFound or domain.ErrRoleNotFound
+func (s *Storage) UnassignGroupRole(ctx context.Context, orgID, groupID uint, role string) error {
+	op := "sqlite.UnassignGroupRole"
+	roleID, err := s.groupRoleID(ctx, orgID, groupID, role)
+	if err != nil {
+		if errors.Is(err, domain.ErrGroupNotFound) || errors.Is(err, domain.ErrRoleNotFound) {
+			return err
+		}
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	_, err = s.db.ExecContext(ctx, "DELETE FROM group_roles WHERE group_id = ? AND role_id = ?", groupID, roleID)
+	if err != nil {
+		return fmt.Errorf("%s: db.Exec: %w", op, err)
+	}
+	return nil
+}
+
+// GetUserGroups returns groups of the organization the user is a direct or transitive member of, ordered by name
+func (s *Storage) GetUserGroups(ctx context.Context, orgID, userID uint) ([]domain.Group, error) {
+	op := "sqlite.GetUserGroups"
+	groups, err := s.queryGroups(ctx, userGroupsCTE+`
+		SELECT g.id, g.org_id, g.name, g.created_at FROM groups g JOIN user_groups ug ON ug.id = g.id ORDER BY g.name`, userID, orgID)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	return groups, nil
+}
+
+// checkGroups returns domain.ErrGroupNotFound if any of the groups does not belong to the organization
+func (s *Storage) checkGroups(ctx context.Context, orgID uint, ids ...uint) error {
+	for _, id := range ids {
+		var one int
+		err := s.db.QueryRowContext(ctx, "SELECT 1 FROM groups WHERE org_id = ? AND id = ?", orgID, id).Scan(&one)
+		if err != nil {
+			if errors.Is(err, sql.ErrNoRows) {
+				return domain.ErrGroupNotFound
+			}
+			return err
+		}
+	}
+	return nil
+}
+
+// groupRoleID checks that group belongs to the organization and returns id of the organization role by name
+func (s *Storage) groupRoleID(ctx context.Context, orgID, groupID uint, role string) (uint, error) {
+	if err := s.checkGroups(ctx, orgID, groupID); err != nil {
+		return 0, err
+	}
+	var id uint
+	err := s.db.QueryRowContext(ctx, "SELECT id FROM roles WHERE name = ? AND scope = ?", role, domain.RoleScopeOrg).Scan(&id)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return 0, domain.ErrRoleNotFound
+		}
+		return 0, err
+	}
+	return id, nil
+}
+
+func (s *Storage) queryGroups(ctx context.Context, query string, args ...interface{}) ([]domain.Group, error) {
+	rows, err := s.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("db.Query: %w", err)
+	}
+	defer rows.Close()
+
+	groups := []domain.Group{}
+	for rows.Next() {
+		var group domain.Group
+		if err := rows.Scan(&group.ID, &group.OrgID, &group.Name, &group.CreatedAt); err != nil {
+			return nil, fmt.Errorf("rows.Scan: %w", err)
+		}
+		groups = append(groups, group)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("rows.Err: %w", err)
+	}
+	return groups, nil
+}
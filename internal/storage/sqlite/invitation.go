@@ -0,0 +1,259 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/mattn/go-sqlite3"
+	"github.com/qPyth/mobydev-internship-auth/internal/domain"
+)
+
+// CreateInvitation stores invitation which is not sent yet and sets its id, it can not be accepted until
+// MarkInvitationSent. Returns domain.ErrRoleNotFound if any of the roles is not an organization role
+// and domain.ErrAlreadyMember if user with the email is already a member
+func (s *Storage) CreateInvitation(ctx context.Context, invitation *domain.Invitation) error {
+	op := "sqlite.CreateInvitation"
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("%s: db.BeginTx: %w", op, err)
+	}
+	defer tx.Rollback()
+
+	roles := uniqueStrings(invitation.Roles)
+	if len(roles) > 0 {
+		args := []interface{}{domain.RoleScopeOrg}
+		for _, role := range roles {
+			args = append(args, role)
+		}
+		var found int
+		err := tx.QueryRowContext(ctx, "SELECT COUNT(*) FROM roles WHERE scope = ? AND name IN ("+
+			strings.TrimSuffix(strings.Repeat("?, ", len(roles)), ", ")+")", args...).Scan(&found)
+		if err != nil {
+			return fmt.Errorf("%s: row.Scan: %w", op, err)
+		}
+		if found != len(roles) {
+			return domain.ErrRoleNotFound
+		}
+	}
+
+	var members int
+	err = tx.QueryRowContext(ctx, `SELECT COUNT(*) FROM memberships m JOIN users u ON u.id = m.user_id
+		WHERE m.org_id = ? AND u.email = ?`, invitation.OrgID, invitation.Email).Scan(&members)
+	if err != nil {
+		return fmt.Errorf("%s: row.Scan: %w", op, err)
+	}
+	if members > 0 {
+		return domain.ErrAlreadyMember
+	}
+
+	res, err := tx.ExecContext(ctx, `INSERT INTO invitations(org_id, email, roles, token_hash, invited_by, created_at, expires_at)
+		VALUES(?, ?, ?, ?, ?, ?, ?)`, invitation.OrgID, invitation.Email, strings.Join(roles, " "), invitation.TokenHash,
+		invitation.InvitedBy, invitation.CreatedAt, invitation.ExpiresAt)
+	if err != nil {
+		return fmt.Errorf("%s: tx.Exec: %w", op, err)
+	}
+	id, err := res.LastInsertId()
+	if err != nil {
+		return fmt.Errorf("%s: res.LastInsertId: %w", op, err)
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("%s: tx.Commit: %w", op, err)
+	}
+	invitation.ID, invitation.Roles = uint(id), roles
+	return nil
+}
+
+// MarkInvitationSent marks invitation as sent, so it can be accepted, and revokes other pending invitations
+// of the same email to the organization
+func (s *Storage) MarkInvitationSent(ctx context.Context, invitation domain.Invitation, sentAt time.Time) error {
+	op := "sqlite.MarkInvitationSent"
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("%s: db.BeginTx: %w", op, err)
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx, "UPDATE invitations SET sent_at = ? WHERE id = ?", sentAt, invitation.ID); err != nil {
+		return fmt.Errorf("%s: tx.Exec: %w", op, err)
+	}
+	_, err = tx.ExecContext(ctx, `UPDATE invitations SET revoked_at = ?
+		WHERE org_id = ? AND email = ? AND id <> ? AND accepted_at IS NULL AND revoked_at IS NULL`, sentAt, invitation.OrgID, invitation.Email, invitation.ID)
+	if err != nil {
+		return fmt.Errorf("%s: tx.Exec: %w", op, err)
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("%s: tx.Commit: %w", op, err)
+	}
+	return nil
+}
+
+// DeleteInvitation deletes invitation which could not be sent
+func (s *Storage) DeleteInvitation(ctx context.Context, id uint) error {
+	op := "sqlite.DeleteInvitation"
+	if _, err := s.db.ExecContext(ctx, "DELETE FROM invitations WHERE id = ? AND sent_at IS NULL", id); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	return nil
+}
+
+// GetInvitation returns invitation of the organization by id. Returns domain.ErrInvitationNotFound if not found
+func (s *Storage) GetInvitation(ctx context.Context, orgID, id uint) (domain.Invitation, error) {
+	op := "sqlite.GetInvitation"
+	row := s.db.QueryRowContext(ctx, `SELECT id, org_id, email, roles, token_hash, invited_by, created_at, expires_at, accepted_at, revoked_at
+		FROM invitations WHERE org_id = ? AND id = ?`, orgID, id)
+	invitation, err := scanInvitation(row)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return invitation, domain.ErrInvitationNotFound
+		}
+		return invitation, fmt.Errorf("%s: row.Scan: %w", op, err)
+	}
+	return invitation, nil
+}
+
+// GetInvitationByToken returns invitation by token hash. Returns domain.ErrInvalidInvitation if not found
+func (s *Storage) GetInvitationByToken(ctx context.Context, tokenHash string) (domain.Invitation, error) {
+	op := "sqlite.GetInvitationByToken"
+	row := s.db.QueryRowContext(ctx, `SELECT id, org_id, email, roles, token_hash, invited_by, created_at, expires_at, accepted_at, revoked_at
+		FROM invitations WHERE token_hash = ?`, tokenHash)
+	invitation, err := scanInvitation(row)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return invitation, domain.ErrInvalidInvitation
+		}
+		return invitation, fmt.Errorf("%s: row.Scan: %w", op, err)
+	}
+	return invitation, nil
+}
+
+// ListInvitations returns sent, not accepted and not revoked invitations of the organization, newest first
+func (s *Storage) ListInvitations(ctx context.Context, orgID uint) ([]domain.Invitation, error) {
+	op := "sqlite.ListInvitations"
+	rows, err := s.db.QueryContext(ctx, `SELECT id, org_id, email, roles, token_hash, invited_by, created_at, expires_at, accepted_at, revoked_at
+		FROM invitations WHERE org_id = ? AND sent_at IS NOT NULL AND accepted_at IS NULL AND revoked_at IS NULL ORDER BY created_at DESC`, orgID)
+	if err != nil {
+		return nil, fmt.Errorf("%s: db.Query: %w", op, err)
+	}
+	defer rows.Close()
+
+	invitations := []domain.Invitation{}
+	for rows.Next() {
+		invitation, err := scanInvitation(rows)
+		if err != nil {
+			return nil, fmt.Errorf("%s: rows.Scan: %w", op, err)
+		}
+		invitations = append(invitations, invitation)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("%s: rows.Err: %w", op, err)
+	}
+	return invitations, nil
+}
+
+// RenewInvitation replaces token of not accepted and not revoked invitation of the organization and extends it.
+// Returns domain.ErrInvitationNotFound if there is no such invitation
+func (s *Storage) RenewInvitation(ctx context.Context, orgID, id uint, tokenHash string, expiresAt time.Time) error {
+	op := "sqlite.RenewInvitation"
+	res, err := s.db.ExecContext(ctx, `UPDATE invitations SET token_hash = ?, expires_at = ?
+		WHERE org_id = ? AND id = ? AND accepted_at IS NULL AND revoked_at IS NULL`, tokenHash, expiresAt, orgID, id)
+	if err != nil {
+		return fmt.Errorf("%s: db.Exec: %w", op, err)
+	}
+	return invitationAffected(op, res)
+}
+
+// RevokeInvitation revokes not accepted invitation of the organization.
+// Returns domain.ErrInvitationNotFound if there is no such invitation
+func (s *Storage) RevokeInvitation(ctx context.Context, orgID, id uint) error {
+	op := "sqlite.RevokeInvitation"
+	res, err := s.db.ExecContext(ctx, `UPDATE invitations SET revoked_at = ?
+		WHERE org_id = ? AND id = ? AND accepted_at IS NULL AND revoked_at IS NULL`, time.Now(), orgID, id)
+	if err != nil {
+		return fmt.Errorf("%s: db.Exec: %w", op, err)
+	}
+	return invitationAffected(op, res)
+}
+
+// AcceptInvitation marks pending invitation as accepted and adds the user to its organization with its roles,
+// the email of the user becomes verified. User without id is created with the invitation email and the given HashPass,
+// then the user id is set. Invitation can be accepted only once, returns domain.ErrInvalidInvitation if it is not pending anymore
+// and domain.ErrEmailExists if the new user already exists
+func (s *Storage) AcceptInvitation(ctx context.Context, invitation domain.Invitation, user *domain.User, now time.Time) error {
+	op := "sqlite.AcceptInvitation"
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("%s: db.BeginTx: %w", op, err)
+	}
+	defer tx.Rollback()
+
+	res, err := tx.ExecContext(ctx, `UPDATE invitations SET accepted_at = ?
+		WHERE id = ? AND sent_at IS NOT NULL AND accepted_at IS NULL AND revoked_at IS NULL AND expires_at > ?`, now, invitation.ID, now)
+	if err != nil {
+		return fmt.Errorf("%s: tx.Exec: %w", op, err)
+	}
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("%s: res.RowsAffected: %w", op, err)
+	}
+	if affected == 0 {
+		return domain.ErrInvalidInvitation
+	}
+
+	userID := user.ID
+	if userID == 0 {
+		// the email is confirmed by possession of the invitation token
+		res, err := tx.ExecContext(ctx, "INSERT INTO users(email, email_verified, password, created_at, updated_at) VALUES(?, 1, ?, ?, ?)",
+			invitation.Email, user.HashPass, now, now)
+		if err != nil {
+			var sqliteErr sqlite3.Error
+			if errors.As(err, &sqliteErr) && errors.Is(sqliteErr.ExtendedCode, sqlite3.ErrConstraintUnique) {
+				return domain.ErrEmailExists
+			}
+			return fmt.Errorf("%s: tx.Exec: %w", op, err)
+		}
+		id, err := res.LastInsertId()
+		if err != nil {
+			return fmt.Errorf("%s: res.LastInsertId: %w", op, err)
+		}
+		userID = uint(id)
+	} else {
+		_, err := tx.ExecContext(ctx, "UPDATE users SET email_verified = 1, updated_at = ? WHERE id = ? AND email = ? AND email_verified = 0",
+			now, userID, invitation.Email)
+		if err != nil {
+			return fmt.Errorf("%s: tx.Exec: %w", op, err)
+		}
+	}
+
+	if err := addMember(ctx, tx, invitation.OrgID, userID, invitation.Roles, now); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("%s: tx.Commit: %w", op, err)
+	}
+	user.ID, user.Email, user.EmailVerified = userID, invitation.Email, true
+	return nil
+}
+
+func invitationAffected(op string, res sql.Result) error {
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("%s: res.RowsAffected: %w", op, err)
+	}
+	if affected == 0 {
+		return domain.ErrInvitationNotFound
+	}
+	return nil
+}
+
+func scanInvitation(row scanner) (domain.Invitation, error) {
+	var invitation domain.Invitation
+	var roles string
+	err := row.Scan(&invitation.ID, &invitation.OrgID, &invitation.Email, &roles, &invitation.TokenHash, &invitation.InvitedBy,
+		&invitation.CreatedAt, &invitation.ExpiresAt, &invitation.AcceptedAt, &invitation.RevokedAt)
+	invitation.Roles = strings.Fields(roles)
+	return invitation, err
+}
@@ -0,0 +1,370 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/mattn/go-sqlite3"
+	"github.com/qPyth/mobydev-internship-auth/internal/domain"
+)
+
+// Every query of organization members is filtered by org_id, so members of one organization are never
+// returned or changed through another one
+
+// CreateOrganization creates organization with the owner as its member with ownerRole.
+// Returns domain.ErrOrgExists if organization with such slug already exists
+func (s *Storage) CreateOrganization(ctx context.Context, org *domain.Organization, ownerID uint, ownerRole string) error {
+	op := "sqlite.CreateOrganization"
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("%s: db.BeginTx: %w", op, err)
+	}
+	defer tx.Rollback()
+
+	res, err := tx.ExecContext(ctx, "INSERT INTO organizations(name, slug, created_at) VALUES(?, ?, ?)", org.Name, org.Slug, org.CreatedAt)
+	if err != nil {
+		var sqliteErr sqlite3.Error
+		if errors.As(err, &sqliteErr) && errors.Is(sqliteErr.ExtendedCode, sqlite3.ErrConstraintUnique) {
+			return domain.ErrOrgExists
+		}
+		return fmt.Errorf("%s: tx.Exec: %w", op, err)
+	}
+	id, err := res.LastInsertId()
+	if err != nil {
+		return fmt.Errorf("%s: res.LastInsertId: %w", op, err)
+	}
+	org.ID = uint(id)
+
+	if err := addMember(ctx, tx, org.ID, ownerID, []string{ownerRole}, org.CreatedAt); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("%s: tx.Commit: %w", op, err)
+	}
+	return nil
+}
+
+// GetOrganization returns organization by id. Returns domain.ErrOrgNotFound if organization not found
+func (s *Storage) GetOrganization(ctx context.Context, id uint) (domain.Organization, error) {
+	op := "sqlite.GetOrganization"
+	var org domain.Organization
+	err := s.db.QueryRowContext(ctx, "SELECT id, name, slug, created_at FROM organizations WHERE id = ?", id).
+		Scan(&org.ID, &org.Name, &org.Slug, &org.CreatedAt)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return org, domain.ErrOrgNotFound
+		}
+		return org, fmt.Errorf("%s: row.Scan: %w", op, err)
+	}
+	return org, nil
+}
+
+// ListUserOrganizations returns organizations the user is a member of with the user's roles in them
+func (s *Storage) ListUserOrganizations(ctx context.Context, userID uint) ([]domain.Organization, error) {
+	op := "sqlite.ListUserOrganizations"
+	rows, err := s.db.QueryContext(ctx, `SELECT o.id, o.name, o.slug, o.created_at, r.name FROM memberships m
+		JOIN organizations o ON o.id = m.org_id
+		LEFT JOIN membership_roles mr ON mr.org_id = m.org_id AND mr.user_id = m.user_id
+		LEFT JOIN roles r ON r.id = mr.role_id
+		WHERE m.user_id = ?
+		ORDER BY o.name, o.id, r.name`, userID)
+	if err != nil {
+		return nil, fmt.Errorf("%s: db.Query: %w", op, err)
+	}
+	defer rows.Close()
+
+	orgs := []domain.Organization{}
+	for rows.Next() {
+		var org domain.Organization
+		var role sql.NullString
+		if err := rows.Scan(&org.ID, &org.Name, &org.Slug, &org.CreatedAt, &role); err != nil {
+			return nil, fmt.Errorf("%s: rows.Scan: %w", op, err)
+		}
+		if len(orgs) == 0 || orgs[len(orgs)-1].ID != org.ID {
+			org.Roles = []string{}
+			orgs = append(orgs, org)
+		}
+		if role.Valid {
+			last := &orgs[len(orgs)-1]
+			last.Roles = append(last.Roles, role.String)
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("%s: rows.Err: %w", op, err)
+	}
+	return orgs, nil
+}
+
+// GetMemberRoles returns roles of the member in the organization with their permissions, both assigned directly
+// and through groups the user is a transitive member of. Returns domain.ErrNotOrgMember if user is not a member of the organization
+func (s *Storage) GetMemberRoles(ctx context.Context, orgID, userID uint) ([]domain.Role, error) {
+	op := "sqlite.GetMemberRoles"
+	if err := s.checkMember(ctx, orgID, userID); err != nil {
+		if errors.Is(err, domain.ErrNotOrgMember) {
+			return nil, err
+		}
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	roles, err := s.queryRoles(ctx, userGroupsCTE+`, member_roles(id) AS (
+			SELECT role_id FROM membership_roles WHERE org_id = ? AND user_id = ?
+			UNION
+			SELECT gr.role_id FROM group_roles gr JOIN user_groups ug ON ug.id = gr.group_id
+		)
+		SELECT r.id, r.name, r.description, r.scope, p.name FROM member_roles mr
+		JOIN roles r ON r.id = mr.id
+		LEFT JOIN role_permissions rp ON rp.role_id = r.id
+		LEFT JOIN permissions p ON p.id = rp.permission_id
+		ORDER BY r.name, p.name`, userID, orgID, orgID, userID)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	return roles, nil
+}
+
+// ListMembers returns members of the organization with their roles ordered by email
+func (s *Storage) ListMembers(ctx context.Context, orgID uint) ([]domain.Membership, error) {
+	op := "sqlite.ListMembers"
+	rows, err := s.db.QueryContext(ctx, `SELECT m.org_id, m.user_id, u.email, m.created_at, r.name FROM memberships m
+		JOIN users u ON u.id = m.user_id
+		LEFT JOIN membership_roles mr ON mr.org_id = m.org_id AND mr.user_id = m.user_id
+		LEFT JOIN roles r ON r.id = mr.role_id
+		WHERE m.org_id = ?
+		ORDER BY u.email, r.name`, orgID)
+	if err != nil {
+		return nil, fmt.Errorf("%s: db.Query: %w", op, err)
+	}
+	defer rows.Close()
+
+	members := []domain.Membership{}
+	for rows.Next() {
+		var member domain.Membership
+		var role sql.NullString
+		if err := rows.Scan(&member.OrgID, &member.UserID, &member.Email, &member.CreatedAt, &role); err != nil {
+			return nil, fmt.Errorf("%s: rows.Scan: %w", op, err)
+		}
+		if len(members) == 0 || members[len(members)-1].UserID != member.UserID {
+			member.Roles = []string{}
+			members = append(members, member)
+		}
+		if role.Valid {
+			last := &members[len(members)-1]
+			last.Roles = append(last.Roles, role.String)
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("%s: rows.Err: %w", op, err)
+	}
+	return members, nil
+}
+
+// AssignMemberRole assigns organization role to the member, assigning already assigned role is not an error.
+// Returns domain.ErrNotOrgMember if user is not a member of the organization and domain.ErrRoleNotFound
+// if there is no such organization role
+func (s *Storage) AssignMemberRole(ctx context.Context, orgID, userID uint, role string) error {
+	op := "sqlite.AssignMemberRole"
+	roleID, err := s.memberRoleID(ctx, orgID, userID, role)
+	if err != nil {
+		if errors.Is(err, domain.ErrNotOrgMember) || errors.Is(err, domain.ErrRoleNotFound) {
+			return err
+		}
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	_, err = s.db.ExecContext(ctx, "INSERT OR IGNORE INTO membership_roles(org_id, user_id, role_id) VALUES(?, ?, ?)", orgID, userID, roleID)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	return nil
+}
+
+// UnassignMemberRole removes organization role from the member, removing not assigned role is not an error.
+// Returns domain.ErrNotOrgMember if user is not a member of the organization and domain.ErrRoleNotFound
+// if there is no such organization role
+func (s *Storage) UnassignMemberRole(ctx context.Context, orgID, userID uint, role, ownerRole string) error {
+	op := "sqlite.UnassignMemberRole"
+	roleID, err := s.memberRoleID(ctx, orgID, userID, role)
+	if err != nil {
+		if errors.Is(err, domain.ErrNotOrgMember) || errors.Is(err, domain.ErrRoleNotFound) {
+			return err
+		}
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	query := "DELETE FROM membership_roles WHERE org_id = ? AND user_id = ? AND role_id = ?"
+	args := []interface{}{orgID, userID, roleID}
+	if role == ownerRole {
+		// checked in the same statement, so two owners can not demote each other at once
+		query += " AND NOT " + lastRoleHolderCond
+		args = append(args, lastRoleHolderArgs(orgID, userID, ownerRole)...)
+	}
+	res, err := s.db.ExecContext(ctx, query, args...)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("%s: res.RowsAffected: %w", op, err)
+	}
+	if affected == 0 && role == ownerRole {
+		last, err := isLastRoleHolder(ctx, s.db, orgID, userID, ownerRole)
+		if err != nil {
+			return fmt.Errorf("%s: %w", op, err)
+		}
+		if last {
+			return domain.ErrLastOrgAdmin
+		}
+	}
+	return nil
+}
+
+// RemoveMember removes user from the organization together with the user's roles and groups in it and clears it as active
+// organization of the user's sessions. Returns domain.ErrNotOrgMember if user is not a member of the organization
+// and domain.ErrLastOrgAdmin if the user is the only member with ownerRole
+func (s *Storage) RemoveMember(ctx context.Context, orgID, userID uint, ownerRole string) error {
+	op := "sqlite.RemoveMember"
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("%s: db.BeginTx: %w", op, err)
+	}
+	defer tx.Rollback()
+
+	args := append([]interface{}{orgID, userID}, lastRoleHolderArgs(orgID, userID, ownerRole)...)
+	res, err := tx.ExecContext(ctx, "DELETE FROM memberships WHERE org_id = ? AND user_id = ? AND NOT "+lastRoleHolderCond, args...)
+	if err != nil {
+		return fmt.Errorf("%s: tx.Exec: %w", op, err)
+	}
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("%s: res.RowsAffected: %w", op, err)
+	}
+	if affected == 0 {
+		last, err := isLastRoleHolder(ctx, tx, orgID, userID, ownerRole)
+		if err != nil {
+			return fmt.Errorf("%s: %w", op, err)
+		}
+		if last {
+			return domain.ErrLastOrgAdmin
+		}
+		return domain.ErrNotOrgMember
+	}
+	// foreign keys are not enforced by default, so roles are deleted explicitly
+	_, err = tx.ExecContext(ctx, "DELETE FROM membership_roles WHERE org_id = ? AND user_id = ?", orgID, userID)
+	if err != nil {
+		return fmt.Errorf("%s: tx.Exec: %w", op, err)
+	}
+	_, err = tx.ExecContext(ctx, "DELETE FROM group_members WHERE user_id = ? AND group_id IN (SELECT id FROM groups WHERE org_id = ?)", userID, orgID)
+	if err != nil {
+		return fmt.Errorf("%s: tx.Exec: %w", op, err)
+	}
+	_, err = tx.ExecContext(ctx, "UPDATE sessions SET org_id = NULL WHERE org_id = ? AND user_id = ?", orgID, userID)
+	if err != nil {
+		return fmt.Errorf("%s: tx.Exec: %w", op, err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("%s: tx.Commit: %w", op, err)
+	}
+	return nil
+}
+
+// addMember adds user to the organization with organization roles, roles of existing member are added to the member's roles.
+// Returns domain.ErrRoleNotFound if any of the roles is not an organization role
+func addMember(ctx context.Context, tx *sql.Tx, orgID, userID uint, roles []string, now time.Time) error {
+	roles = uniqueStrings(roles)
+	placeholders := strings.TrimSuffix(strings.Repeat("?, ", len(roles)), ", ")
+	args := []interface{}{domain.RoleScopeOrg}
+	for _, role := range roles {
+		args = append(args, role)
+	}
+
+	if len(roles) > 0 {
+		var found int
+		err := tx.QueryRowContext(ctx, "SELECT COUNT(*) FROM roles WHERE scope = ? AND name IN ("+placeholders+")", args...).Scan(&found)
+		if err != nil {
+			return fmt.Errorf("row.Scan: %w", err)
+		}
+		if found != len(roles) {
+			return domain.ErrRoleNotFound
+		}
+	}
+
+	_, err := tx.ExecContext(ctx, "INSERT OR IGNORE INTO memberships(org_id, user_id, created_at) VALUES(?, ?, ?)", orgID, userID, now)
+	if err != nil {
+		return fmt.Errorf("tx.Exec: %w", err)
+	}
+	if len(roles) == 0 {
+		return nil
+	}
+	_, err = tx.ExecContext(ctx, `INSERT OR IGNORE INTO membership_roles(org_id, user_id, role_id)
+		SELECT ?, ?, id FROM roles WHERE scope = ? AND name IN (`+placeholders+")", append([]interface{}{orgID, userID}, args...)...)
+	if err != nil {
+		return fmt.Errorf("tx.Exec: %w", err)
+	}
+	return nil
+}
+
+// checkMember returns domain.ErrNotOrgMember if user is not a member of the organization
+func (s *Storage) checkMember(ctx context.Context, orgID, userID uint) error {
+	var one int
+	err := s.db.QueryRowContext(ctx, "SELECT 1 FROM memberships WHERE org_id = ? AND user_id = ?", orgID, userID).Scan(&one)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return domain.ErrNotOrgMember
+		}
+		return err
+	}
+	return nil
+}
+
+// memberRoleID checks that user is a member of the organization and returns id of the organization role by name
+func (s *Storage) memberRoleID(ctx context.Context, orgID, userID uint, role string) (uint, error) {
+	if err := s.checkMember(ctx, orgID, userID); err != nil {
+		return 0, err
+	}
+	var id uint
+	err := s.db.QueryRowContext(ctx, "SELECT id FROM roles WHERE name = ? AND scope = ?", role, domain.RoleScopeOrg).Scan(&id)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return 0, domain.ErrRoleNotFound
+		}
+		return 0, err
+	}
+	return id, nil
+}
+
+// lastRoleHolderCond is true when the user has the organization role and no other member of the organization has it,
+// its arguments are returned by lastRoleHolderArgs
+const lastRoleHolderCond = `(EXISTS (SELECT 1 FROM membership_roles mr JOIN roles r ON r.id = mr.role_id
+		WHERE mr.org_id = ? AND mr.user_id = ? AND r.name = ? AND r.scope = ?)
+	AND NOT EXISTS (SELECT 1 FROM membership_roles mr JOIN roles r ON r.id = mr.role_id
+		WHERE mr.org_id = ? AND mr.user_id != ? AND r.name = ? AND r.scope = ?))`
+
+func lastRoleHolderArgs(orgID, userID uint, role string) []interface{} {
+	return []interface{}{orgID, userID, role, domain.RoleScopeOrg, orgID, userID, role, domain.RoleScopeOrg}
+}
+
+// isLastRoleHolder reports whether the user is the only member of the organization with the organization role
+func isLastRoleHolder(ctx context.Context, q interface {
+	QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row
+}, orgID, userID uint, role string) (bool, error) {
+	var last bool
+	err := q.QueryRowContext(ctx, "SELECT "+lastRoleHolderCond, lastRoleHolderArgs(orgID, userID, role)...).Scan(&last)
+	if err != nil {
+		return false, err
+	}
+	return last, nil
+}
+
+func uniqueStrings(values []string) []string {
+	seen := make(map[string]bool, len(values))
+	unique := make([]string, 0, len(values))
+	for _, v := range values {
+		if !seen[v] {
+			seen[v] = true
+			unique = append(unique, v)
+		}
+	}
+	return unique
+}
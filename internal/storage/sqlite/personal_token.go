@@ -0,0 +1,107 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/qPyth/mobydev-internship-auth/internal/domain"
+)
+
+// CreatePersonalToken stores a new personal access token
+func (s *Storage) CreatePersonalToken(ctx context.Context, token *domain.PersonalToken) error {
+	op := "sqlite.CreatePersonalToken"
+	res, err := s.db.ExecContext(ctx, `INSERT INTO personal_tokens(user_id, org_id, name, hint, scopes, token_hash, created_at, expires_at)
+		VALUES(?, ?, ?, ?, ?, ?, ?, ?)`, token.UserID, sql.NullInt64{Int64: int64(token.OrgID), Valid: token.OrgID != 0},
+		token.Name, token.Hint, strings.Join(token.Scopes, " "), token.TokenHash, token.CreatedAt, token.ExpiresAt)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	id, err := res.LastInsertId()
+	if err != nil {
+		return fmt.Errorf("%s: res.LastInsertId: %w", op, err)
+	}
+	token.ID = uint(id)
+	return nil
+}
+
+// GetPersonalToken returns personal access token by hash. Returns domain.ErrTokenNotFound if not found
+func (s *Storage) GetPersonalToken(ctx context.Context, tokenHash string) (domain.PersonalToken, error) {
+	op := "sqlite.GetPersonalToken"
+	row := s.db.QueryRowContext(ctx, `SELECT id, user_id, org_id, name, hint, scopes, token_hash, created_at, expires_at, last_used_at, revoked_at
+		FROM personal_tokens WHERE token_hash = ?`, tokenHash)
+	token, err := scanPersonalToken(row)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return token, domain.ErrTokenNotFound
+		}
+		return token, fmt.Errorf("%s: row.Scan: %w", op, err)
+	}
+	return token, nil
+}
+
+// ListPersonalTokens returns not revoked personal access tokens of the user, newest first
+func (s *Storage) ListPersonalTokens(ctx context.Context, userID uint) ([]domain.PersonalToken, error) {
+	op := "sqlite.ListPersonalTokens"
+	rows, err := s.db.QueryContext(ctx, `SELECT id, user_id, org_id, name, hint, scopes, token_hash, created_at, expires_at, last_used_at, revoked_at
+		FROM personal_tokens WHERE user_id = ? AND revoked_at IS NULL ORDER BY created_at DESC`, userID)
+	if err != nil {
+		return nil, fmt.Errorf("%s: db.Query: %w", op, err)
+	}
+	defer rows.Close()
+
+	tokens := []domain.PersonalToken{}
+	for rows.Next() {
+		token, err := scanPersonalToken(rows)
+		if err != nil {
+			return nil, fmt.Errorf("%s: rows.Scan: %w", op, err)
+		}
+		tokens = append(tokens, token)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("%s: rows.Err: %w", op, err)
+	}
+	return tokens, nil
+}
+
+// TouchPersonalToken updates last used time of the personal access token
+func (s *Storage) TouchPersonalToken(ctx context.Context, id uint, lastUsedAt time.Time) error {
+	op := "sqlite.TouchPersonalToken"
+	_, err := s.db.ExecContext(ctx, "UPDATE personal_tokens SET last_used_at = ? WHERE id = ?", lastUsedAt, id)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	return nil
+}
+
+// RevokePersonalToken revokes personal access token of the user.
+// Returns domain.ErrTokenNotFound if user has no such not revoked token
+func (s *Storage) RevokePersonalToken(ctx context.Context, userID, id uint, revokedAt time.Time) error {
+	op := "sqlite.RevokePersonalToken"
+	res, err := s.db.ExecContext(ctx, "UPDATE personal_tokens SET revoked_at = ? WHERE id = ? AND user_id = ? AND revoked_at IS NULL",
+		revokedAt, id, userID)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("%s: res.RowsAffected: %w", op, err)
+	}
+	if affected == 0 {
+		return domain.ErrTokenNotFound
+	}
+	return nil
+}
+
+func scanPersonalToken(row scanner) (domain.PersonalToken, error) {
+	var token domain.PersonalToken
+	var orgID sql.NullInt64
+	var scopes string
+	err := row.Scan(&token.ID, &token.UserID, &orgID, &token.Name, &token.Hint, &scopes, &token.TokenHash,
+		&token.CreatedAt, &token.ExpiresAt, &token.LastUsedAt, &token.RevokedAt)
+	token.OrgID, token.Scopes = uint(orgID.Int64), strings.Fields(scopes)
+	return token, err
+}
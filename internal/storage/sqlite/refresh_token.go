@@ -0,0 +1,87 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/qPyth/mobydev-internship-auth/internal/domain"
+)
+
+// CreateRefreshToken stores a new refresh token
+func (s *Storage) CreateRefreshToken(ctx context.Context, token *domain.RefreshToken) error {
+	op := "sqlite.CreateRefreshToken"
+	if err := createRefreshToken(ctx, s.db, token); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	return nil
+}
+
+// GetRefreshToken returns refresh token by its hash. Returns domain.ErrInvalidRefreshToken if token not found
+func (s *Storage) GetRefreshToken(ctx context.Context, tokenHash string) (domain.RefreshToken, error) {
+	op := "sqlite.GetRefreshToken"
+
+	var token domain.RefreshToken
+	row := s.db.QueryRowContext(ctx, `SELECT id, user_id, family_id, token_hash, expires_at, used_at, revoked_at, created_at
+		FROM refresh_tokens WHERE token_hash = ?`, tokenHash)
+	err := row.Scan(&token.ID, &token.UserID, &token.FamilyID, &token.TokenHash, &token.ExpiresAt, &token.UsedAt, &token.RevokedAt, &token.CreatedAt)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return token, domain.ErrInvalidRefreshToken
+		}
+		return token, fmt.Errorf("%s: row.Scan: %w", op, err)
+	}
+	return token, nil
+}
+
+// RotateRefreshToken marks the old token as used and stores the next one in a single transaction.
+// Returns domain.ErrRefreshTokenReused if the old token was already used or revoked
+func (s *Storage) RotateRefreshToken(ctx context.Context, oldID uint, next *domain.RefreshToken) error {
+	op := "sqlite.RotateRefreshToken"
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("%s: db.BeginTx: %w", op, err)
+	}
+	defer tx.Rollback()
+
+	res, err := tx.ExecContext(ctx, "UPDATE refresh_tokens SET used_at = ? WHERE id = ? AND used_at IS NULL AND revoked_at IS NULL", time.Now(), oldID)
+	if err != nil {
+		return fmt.Errorf("%s: tx.Exec: %w", op, err)
+	}
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("%s: res.RowsAffected: %w", op, err)
+	}
+	if affected == 0 {
+		return domain.ErrRefreshTokenReused
+	}
+
+	if err := createRefreshToken(ctx, tx, next); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("%s: tx.Commit: %w", op, err)
+	}
+	return nil
+}
+
+type execer interface {
+	ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error)
+}
+
+func createRefreshToken(ctx context.Context, db execer, token *domain.RefreshToken) error {
+	res, err := db.ExecContext(ctx, `INSERT INTO refresh_tokens(user_id, family_id, token_hash, expires_at, created_at)
+		VALUES(?, ?, ?, ?, ?)`, token.UserID, token.FamilyID, token.TokenHash, token.ExpiresAt, token.CreatedAt)
+	if err != nil {
+		return fmt.Errorf("db.Exec: %w", err)
+	}
+	id, err := res.LastInsertId()
+	if err != nil {
+		return fmt.Errorf("res.LastInsertId: %w", err)
+	}
+	token.ID = uint(id)
+	return nil
+}
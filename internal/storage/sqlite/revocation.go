@@ -0,0 +1,112 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/qPyth/mobydev-internship-auth/internal/domain"
+)
+
+// RevokeToken adds access token with given jti to the revocation list until it expires
+func (s *Storage) RevokeToken(ctx context.Context, jti string, userID uint, expiresAt time.Time) error {
+	op := "sqlite.RevokeToken"
+	_, err := s.db.ExecContext(ctx, "INSERT OR IGNORE INTO revoked_tokens(jti, user_id, expires_at) VALUES(?, ?, ?)", jti, userID, expiresAt)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	return nil
+}
+
+// RevokeUserTokens revokes every access token of the user issued before revokedAt, all sessions, refresh
+// and personal access tokens. Personal access tokens are revoked by themselves, they outlive the revocation entry.
+// Not exchanged authorization codes and approved device codes of the user stop working too
+func (s *Storage) RevokeUserTokens(ctx context.Context, userID uint, revokedAt, expiresAt time.Time) error {
+	op := "sqlite.RevokeUserTokens"
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("%s: db.BeginTx: %w", op, err)
+	}
+	defer tx.Rollback()
+
+	_, err = tx.ExecContext(ctx, `INSERT INTO user_token_revocations(user_id, revoked_at, expires_at) VALUES(?, ?, ?)
+		ON CONFLICT(user_id) DO UPDATE SET revoked_at = excluded.revoked_at, expires_at = excluded.expires_at`, userID, revokedAt, expiresAt)
+	if err != nil {
+		return fmt.Errorf("%s: tx.Exec: %w", op, err)
+	}
+	_, err = tx.ExecContext(ctx, "UPDATE refresh_tokens SET revoked_at = ? WHERE user_id = ? AND revoked_at IS NULL", revokedAt, userID)
+	if err != nil {
+		return fmt.Errorf("%s: tx.Exec: %w", op, err)
+	}
+	_, err = tx.ExecContext(ctx, "UPDATE sessions SET revoked_at = ? WHERE user_id = ? AND revoked_at IS NULL", revokedAt, userID)
+	if err != nil {
+		return fmt.Errorf("%s: tx.Exec: %w", op, err)
+	}
+	_, err = tx.ExecContext(ctx, "UPDATE personal_tokens SET revoked_at = ? WHERE user_id = ? AND revoked_at IS NULL", revokedAt, userID)
+	if err != nil {
+		return fmt.Errorf("%s: tx.Exec: %w", op, err)
+	}
+	_, err = tx.ExecContext(ctx, "UPDATE oauth_codes SET used_at = ? WHERE user_id = ? AND used_at IS NULL", revokedAt, userID)
+	if err != nil {
+		return fmt.Errorf("%s: tx.Exec: %w", op, err)
+	}
+	_, err = tx.ExecContext(ctx, "UPDATE oauth_device_codes SET status = ? WHERE user_id = ? AND status = ? AND used_at IS NULL",
+		domain.DeviceCodeDenied, userID, domain.DeviceCodeApproved)
+	if err != nil {
+		return fmt.Errorf("%s: tx.Exec: %w", op, err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("%s: tx.Commit: %w", op, err)
+	}
+	return nil
+}
+
+// IsTokenRevoked reports whether access token was revoked by its jti or by revocation of all user tokens
+func (s *Storage) IsTokenRevoked(ctx context.Context, jti string, userID uint, issuedAt time.Time) (bool, error) {
+	op := "sqlite.IsTokenRevoked"
+
+	var revoked bool
+	row := s.db.QueryRowContext(ctx, "SELECT EXISTS(SELECT 1 FROM revoked_tokens WHERE jti = ?)", jti)
+	if err := row.Scan(&revoked); err != nil {
+		return false, fmt.Errorf("%s: row.Scan: %w", op, err)
+	}
+	if revoked {
+		return true, nil
+	}
+
+	var revokedAt time.Time
+	row = s.db.QueryRowContext(ctx, "SELECT revoked_at FROM user_token_revocations WHERE user_id = ?", userID)
+	if err := row.Scan(&revokedAt); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return false, nil
+		}
+		return false, fmt.Errorf("%s: row.Scan: %w", op, err)
+	}
+
+	// iat has second precision, so a token issued in the same second as revocation is treated as revoked
+	return !issuedAt.After(revokedAt.Truncate(time.Second)), nil
+}
+
+// PruneRevokedTokens deletes revocation entries which tokens are already expired
+func (s *Storage) PruneRevokedTokens(ctx context.Context, now time.Time) (int64, error) {
+	op := "sqlite.PruneRevokedTokens"
+	var pruned int64
+	for _, query := range []string{
+		"DELETE FROM revoked_tokens WHERE expires_at < ?",
+		"DELETE FROM user_token_revocations WHERE expires_at < ?",
+	} {
+		res, err := s.db.ExecContext(ctx, query, now)
+		if err != nil {
+			return pruned, fmt.Errorf("%s: %w", op, err)
+		}
+		affected, err := res.RowsAffected()
+		if err != nil {
+			return pruned, fmt.Errorf("%s: res.RowsAffected: %w", op, err)
+		}
+		pruned += affected
+	}
+	return pruned, nil
+}
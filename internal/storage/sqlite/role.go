@@ -0,0 +1,128 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+
+	"github.com/qPyth/mobydev-internship-auth/internal/domain"
+)
+
+// ListRoles returns all global and organization roles with their permissions ordered by name
+func (s *Storage) ListRoles(ctx context.Context) ([]domain.Role, error) {
+	op := "sqlite.ListRoles"
+	roles, err := s.queryRoles(ctx, `SELECT r.id, r.name, r.description, r.scope, p.name FROM roles r
+		LEFT JOIN role_permissions rp ON rp.role_id = r.id
+		LEFT JOIN permissions p ON p.id = rp.permission_id
+		ORDER BY r.name, p.name`)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	return roles, nil
+}
+
+// GetUserRoles returns roles assigned to the user with their permissions ordered by name
+func (s *Storage) GetUserRoles(ctx context.Context, userID uint) ([]domain.Role, error) {
+	op := "sqlite.GetUserRoles"
+	roles, err := s.queryRoles(ctx, `SELECT r.id, r.name, r.description, r.scope, p.name FROM user_roles ur
+		JOIN roles r ON r.id = ur.role_id
+		LEFT JOIN role_permissions rp ON rp.role_id = r.id
+		LEFT JOIN permissions p ON p.id = rp.permission_id
+		WHERE ur.user_id = ?
+		ORDER BY r.name, p.name`, userID)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	return roles, nil
+}
+
+// AssignRole assigns global role to the user, assigning already assigned role is not an error.
+// Returns domain.ErrUserNotFound or domain.ErrRoleNotFound if user or role does not exist
+func (s *Storage) AssignRole(ctx context.Context, userID uint, role string) error {
+	op := "sqlite.AssignRole"
+	roleID, err := s.userRoleIDs(ctx, userID, role)
+	if err != nil {
+		if errors.Is(err, domain.ErrUserNotFound) || errors.Is(err, domain.ErrRoleNotFound) {
+			return err
+		}
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	_, err = s.db.ExecContext(ctx, "INSERT OR IGNORE INTO user_roles(user_id, role_id) VALUES(?, ?)", userID, roleID)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	return nil
+}
+
+// UnassignRole removes role from the user, removing not assigned role is not an error.
+// Returns domain.ErrUserNotFound or domain.ErrRoleNotFound if user or role does not exist
+func (s *Storage) UnassignRole(ctx context.Context, userID uint, role string) error {
+	op := "sqlite.UnassignRole"
+	roleID, err := s.userRoleIDs(ctx, userID, role)
+	if err != nil {
+		if errors.Is(err, domain.ErrUserNotFound) || errors.Is(err, domain.ErrRoleNotFound) {
+			return err
+		}
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	_, err = s.db.ExecContext(ctx, "DELETE FROM user_roles WHERE user_id = ? AND role_id = ?", userID, roleID)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	return nil
+}
+
+// userRoleIDs checks that user exists and returns id of the global role by name
+func (s *Storage) userRoleIDs(ctx context.Context, userID uint, role string) (uint, error) {
+	var id uint
+	err := s.db.QueryRowContext(ctx, "SELECT id FROM users WHERE id = ?", userID).Scan(&id)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return 0, domain.ErrUserNotFound
+		}
+		return 0, err
+	}
+	err = s.db.QueryRowContext(ctx, "SELECT id FROM roles WHERE name = ? AND scope = ?", role, domain.RoleScopeGlobal).Scan(&id)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return 0, domain.ErrRoleNotFound
+		}
+		return 0, err
+	}
+	return id, nil
+}
+
+// queryRoles runs query selecting role id, name, description, scope and permission name rows and groups them into roles
+func (s *Storage) queryRoles(ctx context.Context, query string, args ...interface{}) ([]domain.Role, error) {
+	rows, err := s.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("db.Query: %w", err)
+	}
+	defer rows.Close()
+
+	roles := []domain.Role{}
+	for rows.Next() {
+		var (
+			role        domain.Role
+			description sql.NullString
+			permission  sql.NullString
+		)
+		if err := rows.Scan(&role.ID, &role.Name, &description, &role.Scope, &permission); err != nil {
+			return nil, fmt.Errorf("rows.Scan: %w", err)
+		}
+		if len(roles) == 0 || roles[len(roles)-1].ID != role.ID {
+			role.Description = description.String
+			role.Permissions = []string{}
+			roles = append(roles, role)
+		}
+		if permission.Valid {
+			last := &roles[len(roles)-1]
+			last.Permissions = append(last.Permissions, permission.String)
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("rows.Err: %w", err)
+	}
+	return roles, nil
+}
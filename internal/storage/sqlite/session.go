@@ -0,0 +1,164 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/qPyth/mobydev-internship-auth/internal/domain"
+)
+
+// CreateSession stores a new session
+func (s *Storage) CreateSession(ctx context.Context, session *domain.Session) error {
+	op := "sqlite.CreateSession"
+	_, err := s.db.ExecContext(ctx, `INSERT INTO sessions(id, user_id, device, user_agent, ip, created_at, last_seen_at, expires_at, dpop_jkt, org_id, client_id, scopes)
+		VALUES(?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`, session.ID, session.UserID, session.Device, session.UserAgent, session.IP,
+		session.CreatedAt, session.LastSeenAt, session.ExpiresAt, session.DPoPJKT,
+		sql.NullInt64{Int64: int64(session.OrgID), Valid: session.OrgID != 0},
+		sql.NullString{String: session.ClientID, Valid: session.ClientID != ""}, strings.Join(session.Scopes, " "))
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	return nil
+}
+
+// GetSession returns session by id. Returns domain.ErrSessionNotFound if session not found
+func (s *Storage) GetSession(ctx context.Context, id string) (domain.Session, error) {
+	op := "sqlite.GetSession"
+
+	row := s.db.QueryRowContext(ctx, `SELECT id, user_id, device, user_agent, ip, created_at, last_seen_at, expires_at, revoked_at, dpop_jkt, org_id, client_id, scopes
+		FROM sessions WHERE id = ?`, id)
+	session, err := scanSession(row)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return session, domain.ErrSessionNotFound
+		}
+		return session, fmt.Errorf("%s: row.Scan: %w", op, err)
+	}
+	return session, nil
+}
+
+// ListSessions returns not revoked and not expired sessions of the user, most recently used first
+func (s *Storage) ListSessions(ctx context.Context, userID uint, now time.Time) ([]domain.Session, error) {
+	op := "sqlite.ListSessions"
+
+	rows, err := s.db.QueryContext(ctx, `SELECT id, user_id, device, user_agent, ip, created_at, last_seen_at, expires_at, revoked_at, dpop_jkt, org_id, client_id, scopes
+		FROM sessions WHERE user_id = ? AND revoked_at IS NULL AND expires_at > ? ORDER BY last_seen_at DESC`, userID, now)
+	if err != nil {
+		return nil, fmt.Errorf("%s: db.Query: %w", op, err)
+	}
+	defer rows.Close()
+
+	var sessions []domain.Session
+	for rows.Next() {
+		session, err := scanSession(rows)
+		if err != nil {
+			return nil, fmt.Errorf("%s: rows.Scan: %w", op, err)
+		}
+		sessions = append(sessions, session)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("%s: rows.Err: %w", op, err)
+	}
+	return sessions, nil
+}
+
+// TouchSession updates last seen time of the session
+func (s *Storage) TouchSession(ctx context.Context, id string, lastSeenAt time.Time) error {
+	op := "sqlite.TouchSession"
+	_, err := s.db.ExecContext(ctx, "UPDATE sessions SET last_seen_at = ? WHERE id = ?", lastSeenAt, id)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	return nil
+}
+
+// SetSessionOrg sets the active organization of the session, 0 clears it
+func (s *Storage) SetSessionOrg(ctx context.Context, id string, orgID uint) error {
+	op := "sqlite.SetSessionOrg"
+	_, err := s.db.ExecContext(ctx, "UPDATE sessions SET org_id = ? WHERE id = ?", sql.NullInt64{Int64: int64(orgID), Valid: orgID != 0}, id)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	return nil
+}
+
+// RevokeSession revokes user session and all refresh tokens issued for it.
+// Returns domain.ErrSessionNotFound if user has no such active session
+func (s *Storage) RevokeSession(ctx context.Context, id string, userID uint) error {
+	op := "sqlite.RevokeSession"
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("%s: db.BeginTx: %w", op, err)
+	}
+	defer tx.Rollback()
+
+	now := time.Now()
+	res, err := tx.ExecContext(ctx, "UPDATE sessions SET revoked_at = ? WHERE id = ? AND user_id = ? AND revoked_at IS NULL", now, id, userID)
+	if err != nil {
+		return fmt.Errorf("%s: tx.Exec: %w", op, err)
+	}
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("%s: res.RowsAffected: %w", op, err)
+	}
+	if affected == 0 {
+		return domain.ErrSessionNotFound
+	}
+
+	// refresh tokens of a session share its id as family id
+	_, err = tx.ExecContext(ctx, "UPDATE refresh_tokens SET revoked_at = ? WHERE family_id = ? AND revoked_at IS NULL", now, id)
+	if err != nil {
+		return fmt.Errorf("%s: tx.Exec: %w", op, err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("%s: tx.Commit: %w", op, err)
+	}
+	return nil
+}
+
+// RevokeOtherSessions revokes every active session of the user except the kept one with their refresh tokens
+func (s *Storage) RevokeOtherSessions(ctx context.Context, userID uint, keepID string, revokedAt time.Time) error {
+	op := "sqlite.RevokeOtherSessions"
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("%s: db.BeginTx: %w", op, err)
+	}
+	defer tx.Rollback()
+
+	_, err = tx.ExecContext(ctx, "UPDATE sessions SET revoked_at = ? WHERE user_id = ? AND id != ? AND revoked_at IS NULL", revokedAt, userID, keepID)
+	if err != nil {
+		return fmt.Errorf("%s: tx.Exec: %w", op, err)
+	}
+	_, err = tx.ExecContext(ctx, "UPDATE refresh_tokens SET revoked_at = ? WHERE user_id = ? AND family_id != ? AND revoked_at IS NULL", revokedAt, userID, keepID)
+	if err != nil {
+		return fmt.Errorf("%s: tx.Exec: %w", op, err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("%s: tx.Commit: %w", op, err)
+	}
+	return nil
+}
+
+type scanner interface {
+	Scan(dest ...any) error
+}
+
+func scanSession(row scanner) (domain.Session, error) {
+	var session domain.Session
+	var device, userAgent, ip, dpopJKT, clientID, scopes sql.NullString
+	var orgID sql.NullInt64
+	err := row.Scan(&session.ID, &session.UserID, &device, &userAgent, &ip, &session.CreatedAt,
+		&session.LastSeenAt, &session.ExpiresAt, &session.RevokedAt, &dpopJKT, &orgID, &clientID, &scopes)
+	session.Device, session.UserAgent, session.IP, session.DPoPJKT = device.String, userAgent.String, ip.String, dpopJKT.String
+	session.OrgID, session.ClientID = uint(orgID.Int64), clientID.String
+	if session.ClientID != "" {
+		session.Scopes = strings.Fields(scopes.String)
+	}
+	return session, err
+}
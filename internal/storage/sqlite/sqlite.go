@@ -21,6 +21,9 @@ var (
 	migrationsPath = "file://migrations"
 )
 
+// minVersionNumber is SQLite 3.35.0, the first version with ALTER TABLE DROP COLUMN used by down migrations
+const minVersionNumber = 3035000
+
 type Storage struct {
 	db *sql.DB
 }
@@ -33,6 +36,10 @@ func New(storagePath string) *Storage {
 		}
 	}
 
+	if version, number, _ := sqlite3.Version(); number < minVersionNumber {
+		panic("SQLite 3.35.0 or newer is required, linked version is " + version)
+	}
+
 	db, err := sql.Open("sqlite3", storagePath)
 	if err != nil {
 		panic("failed to open db: " + err.Error())
@@ -90,18 +97,95 @@ func (s *Storage) GetUser(ctx context.Context, email string) (domain.User, error
 
 	var user domain.User
 
-	row := s.db.QueryRowContext(ctx, "SELECT id, email, password FROM users WHERE email = ?", email)
-	err := row.Scan(&user.ID, &user.Email, &user.HashPass)
+	row := s.db.QueryRowContext(ctx, "SELECT id, email, email_verified, password FROM users WHERE email = ?", email)
+	err := row.Scan(&user.ID, &user.Email, &user.EmailVerified, &user.HashPass)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return user, domain.ErrUserNotFound
+		}
+		return user, fmt.Errorf("%s: row.Scan: %w", op, err)
+	}
+	return user, nil
+}
+
+// GetUserByID returns user by id. Returns domain.ErrUserNotFound if user not found
+func (s *Storage) GetUserByID(ctx context.Context, id uint) (domain.User, error) {
+	op := "sqlite.GetUserByID"
+
+	var user domain.User
+
+	var name, phoneNumber sql.NullString
+	var bDay sql.NullTime
+	row := s.db.QueryRowContext(ctx, "SELECT id, name, email, email_verified, password, phone_number, b_day, created_at, updated_at FROM users WHERE id = ?", id)
+	err := row.Scan(&user.ID, &name, &user.Email, &user.EmailVerified, &user.HashPass, &phoneNumber, &bDay, &user.CreatedAt, &user.UpdatedAt)
 	if err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
 			return user, domain.ErrUserNotFound
 		}
 		return user, fmt.Errorf("%s: row.Scan: %w", op, err)
 	}
+	user.Name, user.PhoneNumber, user.BDay = name.String, phoneNumber.String, bDay.Time
 	return user, nil
 }
 
-// UpdateUser updates user profile. Returns domain.ErrUserNotFound if user not found
+// SetEmailVerified marks email of the user as verified if it is still the email of the user.
+// Returns domain.ErrUserNotFound if there is no user with such id and email
+func (s *Storage) SetEmailVerified(ctx context.Context, userID uint, email string) error {
+	op := "sqlite.SetEmailVerified"
+	res, err := s.db.ExecContext(ctx, "UPDATE users SET email_verified = 1, updated_at = ? WHERE id = ? AND email = ?", time.Now(), userID, email)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("%s: res.RowsAffected: %w", op, err)
+	}
+	if affected == 0 {
+		return domain.ErrUserNotFound
+	}
+	return nil
+}
+
+// UpdatePassword sets password hash of the user. Returns domain.ErrUserNotFound if user not found
+func (s *Storage) UpdatePassword(ctx context.Context, userID uint, hashPass []byte) error {
+	op := "sqlite.UpdatePassword"
+	res, err := s.db.ExecContext(ctx, "UPDATE users SET password = ?, updated_at = ? WHERE id = ?", hashPass, time.Now(), userID)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("%s: res.RowsAffected: %w", op, err)
+	}
+	if affected == 0 {
+		return domain.ErrUserNotFound
+	}
+	return nil
+}
+
+// UpdateEmail sets a confirmed email of the user. Returns domain.ErrEmailExists if another user has such email
+// and domain.ErrUserNotFound if user not found
+func (s *Storage) UpdateEmail(ctx context.Context, userID uint, email string) error {
+	op := "sqlite.UpdateEmail"
+	res, err := s.db.ExecContext(ctx, "UPDATE users SET email = ?, email_verified = 1, updated_at = ? WHERE id = ?", email, time.Now(), userID)
+	if err != nil {
+		var sqliteErr sqlite3.Error
+		if errors.As(err, &sqliteErr) && errors.Is(sqliteErr.ExtendedCode, sqlite3.ErrConstraintUnique) {
+			return domain.ErrEmailExists
+		}
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("%s: res.RowsAffected: %w", op, err)
+	}
+	if affected == 0 {
+		return domain.ErrUserNotFound
+	}
+	return nil
+}
+
+// UpdateUser updates user profile except the email, which is changed by UpdateEmail. Returns domain.ErrUserNotFound if user not found
 func (s *Storage) UpdateUser(ctx context.Context, update *domain.UserProfileUpdateReq) error {
 	op := "sqlite.UpdateUser"
 	row := s.db.QueryRowContext(ctx, "SELECT id FROM users WHERE id = ?", update.ID)
@@ -123,11 +207,6 @@ func (s *Storage) UpdateUser(ctx context.Context, update *domain.UserProfileUpda
 		queryBuilder.WriteString("name = ?, ")
 		args = append(args, *update.Name)
 	}
-	if update.Email != nil {
-		queryBuilder.WriteString("email = ?, ")
-		args = append(args, *update.Email)
-	}
-
 	if update.BDay != nil {
 		queryBuilder.WriteString("b_day = ?, ")
 		args = append(args, *update.BDay)
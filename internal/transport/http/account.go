@@ -0,0 +1,242 @@
+package http
+
+import (
+	"context"
+	"errors"
+	"github.com/go-chi/chi/v5"
+	"github.com/qPyth/mobydev-internship-auth/internal/domain"
+	"github.com/qPyth/mobydev-internship-auth/internal/validators"
+	"net/http"
+)
+
+type AccountService interface {
+	SendVerification(ctx context.Context, email string) error
+	VerifyEmail(ctx context.Context, token string) error
+	ForgotPassword(ctx context.Context, email string) error
+	ResetPassword(ctx context.Context, token, password string) error
+	RequestEmailChange(ctx context.Context, email, currentPassword string) error
+	ConfirmEmailChange(ctx context.Context, token string) error
+	UndoEmailChange(ctx context.Context, token string) error
+}
+
+func (h *Handler) InitAccountRoutes(r chi.Router) {
+	r.Route("/user/email", func(r chi.Router) {
+		r.Post("/verify", h.VerifyEmail)
+		r.Post("/verify/resend", h.ResendVerification)
+		r.With(h.TokenAuthMiddleware).Post("/change", h.RequestEmailChange)
+		r.Post("/change/confirm", h.ConfirmEmailChange)
+		r.Post("/change/undo", h.UndoEmailChange)
+	})
+	// not a sub router, it would hide /user/password/change of the user routes
+	r.Post("/user/password/forgot", h.ForgotPassword)
+	r.Post("/user/password/reset", h.ResetPassword)
+}
+
+type verifyEmailReq struct {
+	Token string `json:"token"`
+}
+
+type resendVerificationReq struct {
+	Email string `json:"email"`
+}
+
+type emailChangeReq struct {
+	Email           string `json:"email"`
+	CurrentPassword string `json:"current_password"`
+}
+
+type emailChangeTokenReq struct {
+	Token string `json:"token"`
+}
+
+type forgotPasswordReq struct {
+	Email string `json:"email"`
+}
+
+type resetPasswordReq struct {
+	Token    string `json:"token"`
+	Password string `json:"password"`
+	PassConf string `json:"pass_conf"`
+}
+
+// VerifyEmail verifies email of the user by token from the verification link
+func (h *Handler) VerifyEmail(w http.ResponseWriter, r *http.Request) {
+	var req verifyEmailReq
+	if err := h.bindData(r, &req); err != nil {
+		h.log.Error("failed to bind verify email request: ", "error", err.Error())
+		h.error(w, http.StatusBadRequest, ErrBadReq)
+		return
+	}
+
+	if err := h.accountService.VerifyEmail(r.Context(), req.Token); err != nil {
+		h.log.Error("failed to verify email: ", "error", err.Error())
+		if errors.Is(err, domain.ErrInvalidAccountToken) {
+			h.error(w, http.StatusBadRequest, err)
+			return
+		}
+		h.error(w, http.StatusInternalServerError, internalSrvErrorMsg)
+		return
+	}
+	_, err := w.Write([]byte("ok"))
+	if err != nil {
+		h.log.Error("failed to write response: ", "error", err.Error())
+	}
+}
+
+// ResendVerification sends the verification link again. The response does not tell whether the email is registered
+func (h *Handler) ResendVerification(w http.ResponseWriter, r *http.Request) {
+	var req resendVerificationReq
+	if err := h.bindData(r, &req); err != nil {
+		h.log.Error("failed to bind resend verification request: ", "error", err.Error())
+		h.error(w, http.StatusBadRequest, ErrBadReq)
+		return
+	}
+
+	if err := h.accountService.SendVerification(r.Context(), req.Email); err != nil {
+		h.log.Error("failed to resend email verification: ", "error", err.Error())
+		h.error(w, http.StatusInternalServerError, internalSrvErrorMsg)
+		return
+	}
+	_, err := w.Write([]byte("ok"))
+	if err != nil {
+		h.log.Error("failed to write response: ", "error", err.Error())
+	}
+}
+
+// ForgotPassword emails a password reset link. The response does not tell whether the email is registered
+func (h *Handler) ForgotPassword(w http.ResponseWriter, r *http.Request) {
+	var req forgotPasswordReq
+	if err := h.bindData(r, &req); err != nil {
+		h.log.Error("failed to bind forgot password request: ", "error", err.Error())
+		h.error(w, http.StatusBadRequest, ErrBadReq)
+		return
+	}
+
+	if err := h.accountService.ForgotPassword(r.Context(), req.Email); err != nil {
+		h.log.Error("failed to send password reset: ", "error", err.Error())
+		h.error(w, http.StatusInternalServerError, internalSrvErrorMsg)
+		return
+	}
+	_, err := w.Write([]byte("ok"))
+	if err != nil {
+		h.log.Error("failed to write response: ", "error", err.Error())
+	}
+}
+
+// ResetPassword sets a new password by token from the reset link, all sessions of the user are ended
+func (h *Handler) ResetPassword(w http.ResponseWriter, r *http.Request) {
+	var req resetPasswordReq
+	if err := h.bindData(r, &req); err != nil {
+		h.log.Error("failed to bind reset password request: ", "error", err.Error())
+		h.error(w, http.StatusBadRequest, ErrBadReq)
+		return
+	}
+	if err := passwordValidation(req.Password, req.PassConf); err != nil {
+		h.log.Error("failed to validate reset password request: ", "error", err.Error())
+		if errors.Is(err, ErrInvalidPassword) || errors.Is(err, ErrPassConfirm) {
+			h.error(w, http.StatusBadRequest, err)
+			return
+		}
+		h.error(w, http.StatusInternalServerError, internalSrvErrorMsg)
+		return
+	}
+
+	if err := h.accountService.ResetPassword(r.Context(), req.Token, req.Password); err != nil {
+		h.log.Error("failed to reset password: ", "error", err.Error())
+		if errors.Is(err, domain.ErrInvalidAccountToken) {
+			h.error(w, http.StatusBadRequest, err)
+			return
+		}
+		h.error(w, http.StatusInternalServerError, internalSrvErrorMsg)
+		return
+	}
+	_, err := w.Write([]byte("ok"))
+	if err != nil {
+		h.log.Error("failed to write response: ", "error", err.Error())
+	}
+}
+
+// RequestEmailChange sends a confirmation link to the new email of the user, the current password is required
+func (h *Handler) RequestEmailChange(w http.ResponseWriter, r *http.Request) {
+	var req emailChangeReq
+	if err := h.bindData(r, &req); err != nil {
+		h.log.Error("failed to bind email change request: ", "error", err.Error())
+		h.error(w, http.StatusBadRequest, ErrBadReq)
+		return
+	}
+	emailValid, err := validators.EmailIsValid(req.Email)
+	if err != nil || !emailValid {
+		h.error(w, http.StatusBadRequest, ErrInvalidEmail)
+		return
+	}
+
+	if err := h.accountService.RequestEmailChange(r.Context(), req.Email, req.CurrentPassword); err != nil {
+		h.log.Error("failed to request email change: ", "error", err.Error())
+		if errors.Is(err, domain.ErrEmailExists) || errors.Is(err, domain.ErrInvalidCredentials) {
+			h.error(w, http.StatusBadRequest, err)
+			return
+		}
+		if errors.Is(err, domain.ErrSessionRequired) {
+			h.error(w, http.StatusForbidden, err)
+			return
+		}
+		if errors.Is(err, domain.ErrTooManyRequests) {
+			h.error(w, http.StatusTooManyRequests, err)
+			return
+		}
+		h.error(w, http.StatusInternalServerError, internalSrvErrorMsg)
+		return
+	}
+	_, err = w.Write([]byte("ok"))
+	if err != nil {
+		h.log.Error("failed to write response: ", "error", err.Error())
+	}
+}
+
+// ConfirmEmailChange sets the new email of the user by token from the confirmation link and ends other sessions of the user
+func (h *Handler) ConfirmEmailChange(w http.ResponseWriter, r *http.Request) {
+	var req emailChangeTokenReq
+	if err := h.bindData(r, &req); err != nil {
+		h.log.Error("failed to bind confirm email change request: ", "error", err.Error())
+		h.error(w, http.StatusBadRequest, ErrBadReq)
+		return
+	}
+
+	if err := h.accountService.ConfirmEmailChange(r.Context(), req.Token); err != nil {
+		h.log.Error("failed to confirm email change: ", "error", err.Error())
+		if errors.Is(err, domain.ErrInvalidAccountToken) || errors.Is(err, domain.ErrEmailExists) {
+			h.error(w, http.StatusBadRequest, err)
+			return
+		}
+		h.error(w, http.StatusInternalServerError, internalSrvErrorMsg)
+		return
+	}
+	_, err := w.Write([]byte("ok"))
+	if err != nil {
+		h.log.Error("failed to write response: ", "error", err.Error())
+	}
+}
+
+// UndoEmailChange restores the previous email of the user by token from the notification and signs the user out everywhere
+func (h *Handler) UndoEmailChange(w http.ResponseWriter, r *http.Request) {
+	var req emailChangeTokenReq
+	if err := h.bindData(r, &req); err != nil {
+		h.log.Error("failed to bind undo email change request: ", "error", err.Error())
+		h.error(w, http.StatusBadRequest, ErrBadReq)
+		return
+	}
+
+	if err := h.accountService.UndoEmailChange(r.Context(), req.Token); err != nil {
+		h.log.Error("failed to undo email change: ", "error", err.Error())
+		if errors.Is(err, domain.ErrInvalidAccountToken) || errors.Is(err, domain.ErrEmailExists) {
+			h.error(w, http.StatusBadRequest, err)
+			return
+		}
+		h.error(w, http.StatusInternalServerError, internalSrvErrorMsg)
+		return
+	}
+	_, err := w.Write([]byte("ok"))
+	if err != nil {
+		h.log.Error("failed to write response: ", "error", err.Error())
+	}
+}
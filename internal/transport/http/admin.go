@@ -0,0 +1,114 @@
+package http
+
+import (
+	"context"
+	"errors"
+	"github.com/go-chi/chi/v5"
+	"github.com/qPyth/mobydev-internship-auth/internal/domain"
+	"net/http"
+	"strconv"
+)
+
+const (
+	PermissionUsersRead  = "users:read"
+	PermissionRolesRead  = "roles:read"
+	PermissionRolesWrite = "roles:write"
+)
+
+var (
+	ErrForbidden     = errors.New("insufficient permissions")
+	ErrInvalidUserID = errors.New("invalid user id")
+)
+
+type RoleService interface {
+	ListRoles(ctx context.Context) ([]domain.Role, error)
+	GetUserRoles(ctx context.Context, userID uint) ([]domain.Role, error)
+	AssignRole(ctx context.Context, userID uint, role string) error
+	UnassignRole(ctx context.Context, userID uint, role string) error
+}
+
+type assignRoleReq struct {
+	Role string `json:"role" binding:"required"`
+}
+
+func (h *Handler) InitAdminRoutes(r chi.Router) {
+	r.Route("/admin", func(r chi.Router) {
+		r.Use(h.TokenAuthMiddleware)
+		r.With(h.RequirePermission(PermissionRolesRead)).Get("/roles", h.ListRoles)
+		r.With(h.RequirePermission(PermissionUsersRead)).Get("/users/{id}/roles", h.GetUserRoles)
+		r.With(h.RequirePermission(PermissionRolesWrite)).Post("/users/{id}/roles", h.AssignRole)
+		r.With(h.RequirePermission(PermissionRolesWrite)).Delete("/users/{id}/roles/{role}", h.UnassignRole)
+	})
+}
+
+func (h *Handler) ListRoles(w http.ResponseWriter, r *http.Request) {
+	roles, err := h.roleService.ListRoles(r.Context())
+	if err != nil {
+		h.log.Error("failed to list roles: ", "error", err.Error())
+		h.error(w, http.StatusInternalServerError, internalSrvErrorMsg)
+		return
+	}
+	h.NewResponse(w, http.StatusOK, roles)
+}
+
+func (h *Handler) GetUserRoles(w http.ResponseWriter, r *http.Request) {
+	userID, err := userIDParam(r)
+	if err != nil {
+		h.error(w, http.StatusBadRequest, err)
+		return
+	}
+	roles, err := h.roleService.GetUserRoles(r.Context(), userID)
+	if err != nil {
+		h.log.Error("failed to get user roles: ", "error", err.Error())
+		h.error(w, http.StatusInternalServerError, internalSrvErrorMsg)
+		return
+	}
+	h.NewResponse(w, http.StatusOK, roles)
+}
+
+func (h *Handler) AssignRole(w http.ResponseWriter, r *http.Request) {
+	userID, err := userIDParam(r)
+	if err != nil {
+		h.error(w, http.StatusBadRequest, err)
+		return
+	}
+	var req assignRoleReq
+	if err := h.bindData(r, &req); err != nil || req.Role == "" {
+		h.error(w, http.StatusBadRequest, ErrBadReq)
+		return
+	}
+	h.roleResult(w, h.roleService.AssignRole(r.Context(), userID, req.Role))
+}
+
+func (h *Handler) UnassignRole(w http.ResponseWriter, r *http.Request) {
+	userID, err := userIDParam(r)
+	if err != nil {
+		h.error(w, http.StatusBadRequest, err)
+		return
+	}
+	h.roleResult(w, h.roleService.UnassignRole(r.Context(), userID, chi.URLParam(r, "role")))
+}
+
+// roleResult writes response of role assignment change
+func (h *Handler) roleResult(w http.ResponseWriter, err error) {
+	if err != nil {
+		h.log.Error("failed to change user roles: ", "error", err.Error())
+		if errors.Is(err, domain.ErrUserNotFound) || errors.Is(err, domain.ErrRoleNotFound) {
+			h.error(w, http.StatusNotFound, err)
+			return
+		}
+		h.error(w, http.StatusInternalServerError, internalSrvErrorMsg)
+		return
+	}
+	if _, err := w.Write([]byte("ok")); err != nil {
+		h.log.Error("failed to write response: ", "error", err.Error())
+	}
+}
+
+func userIDParam(r *http.Request) (uint, error) {
+	id, err := strconv.ParseUint(chi.URLParam(r, "id"), 10, 64)
+	if err != nil || id == 0 {
+		return 0, ErrInvalidUserID
+	}
+	return uint(id), nil
+}
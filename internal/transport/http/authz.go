@@ -0,0 +1,91 @@
+package http
+
+import (
+	"context"
+	"errors"
+	"github.com/go-chi/chi/v5"
+	"github.com/qPyth/mobydev-internship-auth/internal/domain"
+	"github.com/qPyth/mobydev-internship-auth/pkg/policy"
+	"net/http"
+)
+
+var ErrInvalidSubject = errors.New("exactly one of user_id and token is required, org_id is allowed only with user_id")
+
+type PolicyService interface {
+	Check(ctx context.Context, userID, orgID uint, action, resource string, explain bool) (policy.Decision, error)
+}
+
+// authzCheckReq identifies the subject either by user id with optional organization or by its access token
+type authzCheckReq struct {
+	UserID   uint   `json:"user_id"`
+	OrgID    uint   `json:"org_id"`
+	Token    string `json:"token"`
+	Action   string `json:"action" binding:"required"`
+	Resource string `json:"resource"`
+	Explain  bool   `json:"explain"`
+}
+
+func (h *Handler) InitAuthzRoutes(r chi.Router) {
+	r.Route("/authz", func(r chi.Router) {
+		r.Post("/check", h.AuthzCheck)
+	})
+}
+
+// AuthzCheck decides whether the subject may perform action on resource for authenticated clients
+func (h *Handler) AuthzCheck(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	if _, ok := h.authenticateClient(w, r); !ok {
+		return
+	}
+
+	var req authzCheckReq
+	if err := h.bindData(r, &req); err != nil {
+		h.log.Error("failed to bind authz check request: ", "error", err.Error())
+		h.error(w, http.StatusBadRequest, ErrBadReq)
+		return
+	}
+	if req.Action == "" {
+		h.error(w, http.StatusBadRequest, ErrBadReq)
+		return
+	}
+	if (req.UserID == 0) == (req.Token == "") || (req.Token != "" && req.OrgID != 0) {
+		h.error(w, http.StatusBadRequest, ErrInvalidSubject)
+		return
+	}
+
+	userID, orgID := req.UserID, req.OrgID
+	if req.Token != "" {
+		claims, err := h.userService.InspectAccessToken(ctx, req.Token)
+		if err != nil {
+			h.log.Error("failed to verify token: ", "error", err.Error())
+			if errors.Is(err, domain.ErrInvalidToken) {
+				h.error(w, http.StatusBadRequest, domain.ErrInvalidToken)
+				return
+			}
+			h.error(w, http.StatusInternalServerError, internalSrvErrorMsg)
+			return
+		}
+		if claims.IsClient() {
+			// the check is made for users, tokens of clients have no user
+			h.error(w, http.StatusBadRequest, domain.ErrInvalidToken)
+			return
+		}
+		if userID, err = claims.UserID(); err != nil {
+			h.error(w, http.StatusBadRequest, domain.ErrInvalidToken)
+			return
+		}
+		orgID = claims.OrgID
+	}
+
+	decision, err := h.policyService.Check(ctx, userID, orgID, req.Action, req.Resource, req.Explain)
+	if err != nil {
+		h.log.Error("failed to check policy: ", "error", err.Error())
+		if errors.Is(err, domain.ErrUserNotFound) || errors.Is(err, domain.ErrNotOrgMember) {
+			h.error(w, http.StatusNotFound, err)
+			return
+		}
+		h.error(w, http.StatusInternalServerError, internalSrvErrorMsg)
+		return
+	}
+	h.NewResponse(w, http.StatusOK, decision)
+}
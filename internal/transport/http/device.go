@@ -0,0 +1,88 @@
+package http
+
+import (
+	"errors"
+	"github.com/qPyth/mobydev-internship-auth/internal/domain"
+	"net/http"
+)
+
+type verifyDeviceReq struct {
+	UserCode string `json:"user_code"`
+	Approve  bool   `json:"approve"`
+}
+
+// DeviceAuthorization is the device authorization endpoint (RFC 8628 section 3.1). Clients authenticate like
+// at the token endpoint, public clients send only client_id
+func (h *Handler) DeviceAuthorization(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		h.log.Error("failed to parse device authorization request: ", "error", err.Error())
+		h.oauthError(w, http.StatusBadRequest, oauthErrInvalidRequest, "malformed request body")
+		return
+	}
+	client, ok := h.tokenClient(w, r, domain.GrantTypeDeviceCode)
+	if !ok {
+		return
+	}
+
+	authorization, err := h.oauthService.DeviceAuthorization(r.Context(), client, r.PostForm.Get("scope"))
+	if err != nil {
+		h.log.Error("failed to start device authorization: ", "client_id", client.ID, "error", err.Error())
+		switch {
+		case errors.Is(err, domain.ErrUnauthorizedClient):
+			h.oauthError(w, http.StatusBadRequest, oauthErrUnauthorizedClient, err.Error())
+		case errors.Is(err, domain.ErrScopeNotAllowed):
+			h.oauthError(w, http.StatusBadRequest, oauthErrInvalidScope, err.Error())
+		default:
+			h.oauthError(w, http.StatusInternalServerError, oauthErrServerError, "")
+		}
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	h.NewResponse(w, http.StatusOK, authorization)
+}
+
+// DeviceVerification returns the client and scopes of the device authorization by user_code query param,
+// so the verification page can show them to the signed in user
+func (h *Handler) DeviceVerification(w http.ResponseWriter, r *http.Request) {
+	verification, err := h.oauthService.DeviceVerification(r.Context(), r.URL.Query().Get("user_code"))
+	if err != nil {
+		h.log.Error("failed to get device verification: ", "error", err.Error())
+		h.deviceVerificationError(w, err)
+		return
+	}
+	h.NewResponse(w, http.StatusOK, verification)
+}
+
+// VerifyDevice approves or denies the device authorization for the signed in user
+func (h *Handler) VerifyDevice(w http.ResponseWriter, r *http.Request) {
+	var req verifyDeviceReq
+	if err := h.bindData(r, &req); err != nil {
+		h.log.Error("failed to bind verify device request: ", "error", err.Error())
+		h.error(w, http.StatusBadRequest, ErrBadReq)
+		return
+	}
+
+	if err := h.oauthService.VerifyDevice(r.Context(), req.UserCode, req.Approve); err != nil {
+		h.log.Error("failed to verify device: ", "error", err.Error())
+		h.deviceVerificationError(w, err)
+		return
+	}
+	_, err := w.Write([]byte("ok"))
+	if err != nil {
+		h.log.Error("failed to write response: ", "error", err.Error())
+	}
+}
+
+func (h *Handler) deviceVerificationError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, domain.ErrDeviceCodeNotFound):
+		h.error(w, http.StatusNotFound, err)
+	case errors.Is(err, domain.ErrTooManyRequests):
+		h.error(w, http.StatusTooManyRequests, err)
+	case errors.Is(err, domain.ErrSessionRequired):
+		h.error(w, http.StatusForbidden, err)
+	default:
+		h.error(w, http.StatusInternalServerError, internalSrvErrorMsg)
+	}
+}
@@ -0,0 +1,255 @@
+package http
+
+import (
+	"context"
+	"errors"
+	"github.com/go-chi/chi/v5"
+	"github.com/qPyth/mobydev-internship-auth/internal/domain"
+	"net/http"
+	"strconv"
+)
+
+const (
+	PermissionOrgGroupsRead  = "org:groups:read"
+	PermissionOrgGroupsWrite = "org:groups:write"
+)
+
+var (
+	ErrInvalidGroupID   = errors.New("invalid group id")
+	ErrInvalidGroupName = errors.New("invalid group name")
+)
+
+type GroupService interface {
+	CreateGroup(ctx context.Context, name string) (domain.Group, error)
+	ListGroups(ctx context.Context) ([]domain.Group, error)
+	GetGroup(ctx context.Context, id uint) (domain.Group, error)
+	DeleteGroup(ctx context.Context, id uint) error
+	ListGroupMembers(ctx context.Context, groupID uint, transitive bool) ([]domain.Membership, error)
+	AddGroupMember(ctx context.Context, groupID, userID uint) error
+	RemoveGroupMember(ctx context.Context, groupID, userID uint) error
+	AddSubgroup(ctx context.Context, parentID, childID uint) error
+	RemoveSubgroup(ctx context.Context, parentID, childID uint) error
+	AssignGroupRole(ctx context.Context, groupID uint, role string) error
+	UnassignGroupRole(ctx context.Context, groupID uint, role string) error
+}
+
+type createGroupReq struct {
+	Name string `json:"name"`
+}
+
+type addGroupMemberReq struct {
+	UserID uint `json:"user_id"`
+}
+
+type addSubgroupReq struct {
+	GroupID uint `json:"group_id"`
+}
+
+// InitGroupRoutes registers routes of groups of the active organization. Groups contain members of the organization
+// and other groups, roles assigned to a group are granted to all its direct and transitive members
+func (h *Handler) InitGroupRoutes(r chi.Router) {
+	r.Route("/org/groups", func(r chi.Router) {
+		r.Use(h.TokenAuthMiddleware)
+		r.Group(func(r chi.Router) {
+			r.Use(h.RequirePermission(PermissionOrgGroupsRead))
+			r.Get("/", h.ListGroups)
+			r.Get("/{id}", h.GetGroup)
+			r.Get("/{id}/members", h.ListGroupMembers)
+		})
+		r.Group(func(r chi.Router) {
+			r.Use(h.RequirePermission(PermissionOrgGroupsWrite))
+			r.Post("/", h.CreateGroup)
+			r.Delete("/{id}", h.DeleteGroup)
+			r.Post("/{id}/members", h.AddGroupMember)
+			r.Delete("/{id}/members/{user_id}", h.RemoveGroupMember)
+			r.Post("/{id}/groups", h.AddSubgroup)
+			r.Delete("/{id}/groups/{child_id}", h.RemoveSubgroup)
+			r.Post("/{id}/roles", h.AssignGroupRole)
+			r.Delete("/{id}/roles/{role}", h.UnassignGroupRole)
+		})
+	})
+}
+
+func (h *Handler) CreateGroup(w http.ResponseWriter, r *http.Request) {
+	var req createGroupReq
+	if err := h.bindData(r, &req); err != nil {
+		h.log.Error("failed to bind create group request: ", "error", err.Error())
+		h.error(w, http.StatusBadRequest, ErrBadReq)
+		return
+	}
+	if req.Name == "" || len(req.Name) > 128 {
+		h.error(w, http.StatusBadRequest, ErrInvalidGroupName)
+		return
+	}
+
+	group, err := h.groupService.CreateGroup(r.Context(), req.Name)
+	if err != nil {
+		h.log.Error("failed to create group: ", "error", err.Error())
+		h.groupError(w, err)
+		return
+	}
+	h.NewResponse(w, http.StatusCreated, group)
+}
+
+func (h *Handler) ListGroups(w http.ResponseWriter, r *http.Request) {
+	groups, err := h.groupService.ListGroups(r.Context())
+	if err != nil {
+		h.log.Error("failed to list groups: ", "error", err.Error())
+		h.groupError(w, err)
+		return
+	}
+	h.NewResponse(w, http.StatusOK, groups)
+}
+
+func (h *Handler) GetGroup(w http.ResponseWriter, r *http.Request) {
+	id, err := groupIDParam(r, "id")
+	if err != nil {
+		h.error(w, http.StatusBadRequest, err)
+		return
+	}
+	group, err := h.groupService.GetGroup(r.Context(), id)
+	if err != nil {
+		h.log.Error("failed to get group: ", "error", err.Error())
+		h.groupError(w, err)
+		return
+	}
+	h.NewResponse(w, http.StatusOK, group)
+}
+
+func (h *Handler) DeleteGroup(w http.ResponseWriter, r *http.Request) {
+	id, err := groupIDParam(r, "id")
+	if err != nil {
+		h.error(w, http.StatusBadRequest, err)
+		return
+	}
+	h.groupResult(w, h.groupService.DeleteGroup(r.Context(), id))
+}
+
+// ListGroupMembers returns direct members of the group, or also members of nested groups if transitive=true
+func (h *Handler) ListGroupMembers(w http.ResponseWriter, r *http.Request) {
+	id, err := groupIDParam(r, "id")
+	if err != nil {
+		h.error(w, http.StatusBadRequest, err)
+		return
+	}
+	transitive, _ := strconv.ParseBool(r.URL.Query().Get("transitive"))
+	members, err := h.groupService.ListGroupMembers(r.Context(), id, transitive)
+	if err != nil {
+		h.log.Error("failed to list group members: ", "error", err.Error())
+		h.groupError(w, err)
+		return
+	}
+	h.NewResponse(w, http.StatusOK, members)
+}
+
+func (h *Handler) AddGroupMember(w http.ResponseWriter, r *http.Request) {
+	id, err := groupIDParam(r, "id")
+	if err != nil {
+		h.error(w, http.StatusBadRequest, err)
+		return
+	}
+	var req addGroupMemberReq
+	if err := h.bindData(r, &req); err != nil || req.UserID == 0 {
+		h.error(w, http.StatusBadRequest, ErrBadReq)
+		return
+	}
+	h.groupResult(w, h.groupService.AddGroupMember(r.Context(), id, req.UserID))
+}
+
+func (h *Handler) RemoveGroupMember(w http.ResponseWriter, r *http.Request) {
+	id, err := groupIDParam(r, "id")
+	if err != nil {
+		h.error(w, http.StatusBadRequest, err)
+		return
+	}
+	userID, err := strconv.ParseUint(chi.URLParam(r, "user_id"), 10, 64)
+	if err != nil || userID == 0 {
+		h.error(w, http.StatusBadRequest, ErrInvalidUserID)
+		return
+	}
+	h.groupResult(w, h.groupService.RemoveGroupMember(r.Context(), id, uint(userID)))
+}
+
+func (h *Handler) AddSubgroup(w http.ResponseWriter, r *http.Request) {
+	id, err := groupIDParam(r, "id")
+	if err != nil {
+		h.error(w, http.StatusBadRequest, err)
+		return
+	}
+	var req addSubgroupReq
+	if err := h.bindData(r, &req); err != nil || req.GroupID == 0 {
+		h.error(w, http.StatusBadRequest, ErrBadReq)
+		return
+	}
+	h.groupResult(w, h.groupService.AddSubgroup(r.Context(), id, req.GroupID))
+}
+
+func (h *Handler) RemoveSubgroup(w http.ResponseWriter, r *http.Request) {
+	id, err := groupIDParam(r, "id")
+	if err != nil {
+		h.error(w, http.StatusBadRequest, err)
+		return
+	}
+	childID, err := groupIDParam(r, "child_id")
+	if err != nil {
+		h.error(w, http.StatusBadRequest, err)
+		return
+	}
+	h.groupResult(w, h.groupService.RemoveSubgroup(r.Context(), id, childID))
+}
+
+func (h *Handler) AssignGroupRole(w http.ResponseWriter, r *http.Request) {
+	id, err := groupIDParam(r, "id")
+	if err != nil {
+		h.error(w, http.StatusBadRequest, err)
+		return
+	}
+	var req assignRoleReq
+	if err := h.bindData(r, &req); err != nil || req.Role == "" {
+		h.error(w, http.StatusBadRequest, ErrBadReq)
+		return
+	}
+	h.groupResult(w, h.groupService.AssignGroupRole(r.Context(), id, req.Role))
+}
+
+func (h *Handler) UnassignGroupRole(w http.ResponseWriter, r *http.Request) {
+	id, err := groupIDParam(r, "id")
+	if err != nil {
+		h.error(w, http.StatusBadRequest, err)
+		return
+	}
+	h.groupResult(w, h.groupService.UnassignGroupRole(r.Context(), id, chi.URLParam(r, "role")))
+}
+
+// groupResult writes response of group change
+func (h *Handler) groupResult(w http.ResponseWriter, err error) {
+	if err != nil {
+		h.log.Error("failed to change group: ", "error", err.Error())
+		h.groupError(w, err)
+		return
+	}
+	if _, err := w.Write([]byte("ok")); err != nil {
+		h.log.Error("failed to write response: ", "error", err.Error())
+	}
+}
+
+func (h *Handler) groupError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, domain.ErrNoActiveOrg):
+		h.error(w, http.StatusForbidden, err)
+	case errors.Is(err, domain.ErrGroupExists), errors.Is(err, domain.ErrGroupCycle):
+		h.error(w, http.StatusConflict, err)
+	case errors.Is(err, domain.ErrGroupNotFound), errors.Is(err, domain.ErrNotOrgMember), errors.Is(err, domain.ErrRoleNotFound):
+		h.error(w, http.StatusNotFound, err)
+	default:
+		h.error(w, http.StatusInternalServerError, internalSrvErrorMsg)
+	}
+}
+
+func groupIDParam(r *http.Request, name string) (uint, error) {
+	id, err := strconv.ParseUint(chi.URLParam(r, name), 10, 64)
+	if err != nil || id == 0 {
+		return 0, ErrInvalidGroupID
+	}
+	return uint(id), nil
+}
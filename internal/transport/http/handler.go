@@ -6,14 +6,32 @@ import (
 	"fmt"
 	"github.com/go-chi/chi/v5"
 	"github.com/go-chi/chi/v5/middleware"
+	"github.com/qPyth/mobydev-internship-auth/pkg/auth"
 	"log/slog"
 	"net/http"
 )
 
 type Handler struct {
-	log         *slog.Logger
-	userService UserService
-	//TODO: tokenManager
+	log               *slog.Logger
+	userService       UserService
+	oauthService      OAuthService
+	roleService       RoleService
+	policyService     PolicyService
+	orgService        OrganizationService
+	groupService      GroupService
+	invitationService InvitationService
+	accountService    AccountService
+	tokenManager      TokenManager
+	dpopVerifier      DPoPVerifier
+	externalURL       string
+}
+
+type DPoPVerifier interface {
+	Verify(proof, method, requestURL, accessToken string) (jkt string, err error)
+}
+
+type TokenManager interface {
+	JWKS() auth.JWKS
 }
 
 type ErrorResponse struct {
@@ -23,8 +41,21 @@ type ErrorResponse struct {
 
 var internalSrvErrorMsg = errors.New("server error")
 
-func NewHandler(log *slog.Logger, userService UserService) *Handler {
-	return &Handler{log: log, userService: userService}
+func NewHandler(log *slog.Logger, userService UserService, oauthService OAuthService, roleService RoleService, policyService PolicyService, orgService OrganizationService, groupService GroupService, invitationService InvitationService, accountService AccountService, tokenManager TokenManager, dpopVerifier DPoPVerifier, externalURL string) *Handler {
+	return &Handler{
+		log:               log,
+		userService:       userService,
+		oauthService:      oauthService,
+		roleService:       roleService,
+		policyService:     policyService,
+		orgService:        orgService,
+		groupService:      groupService,
+		invitationService: invitationService,
+		accountService:    accountService,
+		tokenManager:      tokenManager,
+		dpopVerifier:      dpopVerifier,
+		externalURL:       externalURL,
+	}
 }
 
 func (h *Handler) Init() *chi.Mux {
@@ -32,6 +63,14 @@ func (h *Handler) Init() *chi.Mux {
 	//TODO: add mws
 	r.Use(middleware.Logger)
 	h.InitUserRoutes(r)
+	h.InitOAuthRoutes(r)
+	h.InitAdminRoutes(r)
+	h.InitAuthzRoutes(r)
+	h.InitOrganizationRoutes(r)
+	h.InitGroupRoutes(r)
+	h.InitInvitationRoutes(r)
+	h.InitAccountRoutes(r)
+	h.InitWellKnownRoutes(r)
 	return r
 }
 
@@ -0,0 +1,155 @@
+package http
+
+import (
+	"context"
+	"errors"
+	"github.com/go-chi/chi/v5"
+	"github.com/qPyth/mobydev-internship-auth/internal/domain"
+	"github.com/qPyth/mobydev-internship-auth/internal/validators"
+	"net/http"
+	"strconv"
+)
+
+var ErrInvalidInvitationID = errors.New("invalid invitation id")
+
+type InvitationService interface {
+	Invite(ctx context.Context, email string, roles []string) (domain.Invitation, error)
+	ListInvitations(ctx context.Context) ([]domain.Invitation, error)
+	Resend(ctx context.Context, id uint) error
+	Revoke(ctx context.Context, id uint) error
+	Accept(ctx context.Context, token, password string) (domain.Invitation, error)
+}
+
+type inviteReq struct {
+	Email string   `json:"email" binding:"required"`
+	Roles []string `json:"roles"`
+}
+
+// acceptInvitationReq password is required only if there is no user with the invitation email yet
+type acceptInvitationReq struct {
+	Token    string `json:"token" binding:"required"`
+	Password string `json:"password"`
+	PassConf string `json:"pass_conf"`
+}
+
+// InitInvitationRoutes registers invitation management routes of the active organization and the public accept route
+func (h *Handler) InitInvitationRoutes(r chi.Router) {
+	r.Route("/org/invitations", func(r chi.Router) {
+		r.Use(h.TokenAuthMiddleware, h.RequirePermission(PermissionOrgMembersWrite))
+		r.Post("/", h.Invite)
+		r.Get("/", h.ListInvitations)
+		r.Post("/{id}/resend", h.ResendInvitation)
+		r.Delete("/{id}", h.RevokeInvitation)
+	})
+	r.Post("/invitations/accept", h.AcceptInvitation)
+}
+
+func (h *Handler) Invite(w http.ResponseWriter, r *http.Request) {
+	var req inviteReq
+	if err := h.bindData(r, &req); err != nil {
+		h.log.Error("failed to bind invite request: ", "error", err.Error())
+		h.error(w, http.StatusBadRequest, ErrBadReq)
+		return
+	}
+	emailValid, err := validators.EmailIsValid(req.Email)
+	if err != nil || !emailValid {
+		h.error(w, http.StatusBadRequest, ErrInvalidEmail)
+		return
+	}
+
+	invitation, err := h.invitationService.Invite(r.Context(), req.Email, req.Roles)
+	if err != nil {
+		h.log.Error("failed to invite user: ", "error", err.Error())
+		if errors.Is(err, domain.ErrAlreadyMember) {
+			h.error(w, http.StatusConflict, err)
+			return
+		}
+		h.invitationError(w, err)
+		return
+	}
+	h.NewResponse(w, http.StatusCreated, invitation)
+}
+
+func (h *Handler) ListInvitations(w http.ResponseWriter, r *http.Request) {
+	invitations, err := h.invitationService.ListInvitations(r.Context())
+	if err != nil {
+		h.log.Error("failed to list invitations: ", "error", err.Error())
+		h.invitationError(w, err)
+		return
+	}
+	h.NewResponse(w, http.StatusOK, invitations)
+}
+
+func (h *Handler) ResendInvitation(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseUint(chi.URLParam(r, "id"), 10, 64)
+	if err != nil {
+		h.error(w, http.StatusBadRequest, ErrInvalidInvitationID)
+		return
+	}
+	if err := h.invitationService.Resend(r.Context(), uint(id)); err != nil {
+		h.log.Error("failed to resend invitation: ", "error", err.Error())
+		h.invitationError(w, err)
+		return
+	}
+	if _, err := w.Write([]byte("ok")); err != nil {
+		h.log.Error("failed to write response: ", "error", err.Error())
+	}
+}
+
+func (h *Handler) RevokeInvitation(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseUint(chi.URLParam(r, "id"), 10, 64)
+	if err != nil {
+		h.error(w, http.StatusBadRequest, ErrInvalidInvitationID)
+		return
+	}
+	if err := h.invitationService.Revoke(r.Context(), uint(id)); err != nil {
+		h.log.Error("failed to revoke invitation: ", "error", err.Error())
+		h.invitationError(w, err)
+		return
+	}
+	if _, err := w.Write([]byte("ok")); err != nil {
+		h.log.Error("failed to write response: ", "error", err.Error())
+	}
+}
+
+func (h *Handler) AcceptInvitation(w http.ResponseWriter, r *http.Request) {
+	var req acceptInvitationReq
+	if err := h.bindData(r, &req); err != nil || req.Token == "" {
+		h.error(w, http.StatusBadRequest, ErrBadReq)
+		return
+	}
+	if req.Password != "" {
+		if err := passwordValidation(req.Password, req.PassConf); err != nil {
+			h.log.Error("failed to validate accept invitation request: ", "error", err.Error())
+			if errors.Is(err, ErrInvalidPassword) || errors.Is(err, ErrPassConfirm) {
+				h.error(w, http.StatusBadRequest, err)
+				return
+			}
+			h.error(w, http.StatusInternalServerError, internalSrvErrorMsg)
+			return
+		}
+	}
+
+	invitation, err := h.invitationService.Accept(r.Context(), req.Token, req.Password)
+	if err != nil {
+		h.log.Error("failed to accept invitation: ", "error", err.Error())
+		if errors.Is(err, domain.ErrInvalidInvitation) || errors.Is(err, domain.ErrPasswordRequired) {
+			h.error(w, http.StatusBadRequest, err)
+			return
+		}
+		h.error(w, http.StatusInternalServerError, internalSrvErrorMsg)
+		return
+	}
+	h.NewResponse(w, http.StatusOK, invitation)
+}
+
+func (h *Handler) invitationError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, domain.ErrNoActiveOrg):
+		h.error(w, http.StatusForbidden, err)
+	case errors.Is(err, domain.ErrInvitationNotFound), errors.Is(err, domain.ErrRoleNotFound):
+		h.error(w, http.StatusNotFound, err)
+	default:
+		h.error(w, http.StatusInternalServerError, internalSrvErrorMsg)
+	}
+}
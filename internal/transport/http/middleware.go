@@ -1,43 +1,90 @@
 package http
 
 import (
-	"context"
+	"errors"
 	"fmt"
-	"github.com/golang-jwt/jwt/v5"
+	"github.com/qPyth/mobydev-internship-auth/internal/domain"
+	"github.com/qPyth/mobydev-internship-auth/pkg/auth"
 	"net/http"
-	"os"
+	"strings"
 )
 
-func (h *Handler) JWTAuthMiddleware(next http.Handler) http.Handler {
+// TokenAuthMiddleware authenticates user request by access token of the configured format (JWT or PASETO)
+// or by personal access token, tokens issued to clients themselves are rejected.
+// Tokens bound to a DPoP key must be sent with the DPoP scheme and a valid DPoP proof of the same key
+func (h *Handler) TokenAuthMiddleware(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		tokenString := r.Header.Get("Authorization")
-		if len(tokenString) < 7 || tokenString[:7] != "Bearer " {
+		scheme, tokenString, ok := strings.Cut(r.Header.Get("Authorization"), " ")
+		if !ok || tokenString == "" || (scheme != "Bearer" && scheme != "DPoP") {
 			h.error(w, http.StatusUnauthorized, fmt.Errorf("invalid token"))
 			return
 		}
-		tokenString = tokenString[7:]
 
-		jwtSecret := os.Getenv("JWT_SECRET")
-		token, err := jwt.Parse(tokenString, func(token *jwt.Token) (interface{}, error) {
-			if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
-				return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
+		claims, err := h.userService.VerifyAccessToken(r.Context(), tokenString)
+		if err != nil {
+			h.log.Error("failed to verify token: ", "error", err.Error())
+			if errors.Is(err, domain.ErrInvalidToken) {
+				h.error(w, http.StatusUnauthorized, fmt.Errorf("invalid token"))
+				return
 			}
-			return []byte(jwtSecret), nil
-		})
-
-		if err != nil || !token.Valid {
-			h.log.Error("failed to parse token: ", "error", err.Error())
-			h.error(w, http.StatusUnauthorized, fmt.Errorf("invalid token"))
+			h.error(w, http.StatusInternalServerError, internalSrvErrorMsg)
 			return
 		}
-
-		claim, ok := token.Claims.(jwt.MapClaims)
-		if !ok {
-			h.log.Error("failed to parse token claims")
+		if claims.IsClient() {
+			// routes act on behalf of a user, tokens of clients are meant for other services
 			h.error(w, http.StatusUnauthorized, fmt.Errorf("invalid token"))
 			return
 		}
-		ctx := context.WithValue(r.Context(), "userID", claim["sub"])
-		next.ServeHTTP(w, r.WithContext(ctx))
+
+		if jkt := claims.DPoPJKT(); jkt != "" || scheme == "DPoP" {
+			if jkt == "" || scheme != "DPoP" {
+				h.error(w, http.StatusUnauthorized, fmt.Errorf("invalid token"))
+				return
+			}
+			proofJKT, err := h.dpopVerifier.Verify(r.Header.Get("DPoP"), r.Method, h.requestURL(r), tokenString)
+			if err == nil && proofJKT != jkt {
+				err = fmt.Errorf("%w: key does not match token binding", auth.ErrInvalidDPoPProof)
+			}
+			if err != nil {
+				h.log.Error("failed to verify DPoP proof: ", "error", err.Error())
+				w.Header().Set("WWW-Authenticate", `DPoP error="invalid_dpop_proof"`)
+				h.error(w, http.StatusUnauthorized, domain.ErrInvalidDPoPProof)
+				return
+			}
+		}
+
+		next.ServeHTTP(w, r.WithContext(auth.WithClaims(r.Context(), claims)))
 	})
 }
+
+// requestURL returns absolute url of the request without query, used to check htu claim of DPoP proofs.
+// Forwarded headers are not trusted, the configured external url is used instead if set
+func (h *Handler) requestURL(r *http.Request) string {
+	if h.externalURL != "" {
+		return strings.TrimSuffix(h.externalURL, "/") + r.URL.Path
+	}
+	scheme := "http"
+	if r.TLS != nil {
+		scheme = "https"
+	}
+	return scheme + "://" + r.Host + r.URL.Path
+}
+
+// RequirePermission allows request only if access token from context grants permission in its scope.
+// Must be used after TokenAuthMiddleware
+func (h *Handler) RequirePermission(permission string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			claims, ok := auth.ClaimsFromContext(r.Context())
+			if !ok {
+				h.error(w, http.StatusUnauthorized, fmt.Errorf("invalid token"))
+				return
+			}
+			if !claims.HasScope(permission) {
+				h.error(w, http.StatusForbidden, ErrForbidden)
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
@@ -0,0 +1,43 @@
+package http
+
+import (
+	"github.com/qPyth/mobydev-internship-auth/pkg/auth"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestHandler_RequirePermission(t *testing.T) {
+	h := &Handler{log: slog.New(slog.NewTextHandler(io.Discard, nil))}
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	})
+
+	tests := []struct {
+		name       string
+		claims     *auth.Claims
+		wantStatus int
+	}{
+		{name: "no token claims", wantStatus: http.StatusUnauthorized},
+		{name: "empty scope", claims: &auth.Claims{}, wantStatus: http.StatusForbidden},
+		{name: "other permissions", claims: &auth.Claims{Scope: "users:write roles:read"}, wantStatus: http.StatusForbidden},
+		// permissions are compared whole, a prefix of the permission grants nothing
+		{name: "prefix of the permission", claims: &auth.Claims{Scope: "users users:rea"}, wantStatus: http.StatusForbidden},
+		{name: "permission in scope", claims: &auth.Claims{Scope: "roles:read users:read"}, wantStatus: http.StatusNoContent},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, "/admin/users/1/roles", nil)
+			if tt.claims != nil {
+				r = r.WithContext(auth.WithClaims(r.Context(), tt.claims))
+			}
+			w := httptest.NewRecorder()
+			h.RequirePermission(PermissionUsersRead)(next).ServeHTTP(w, r)
+			if w.Code != tt.wantStatus {
+				t.Fatalf("got status %d, want %d", w.Code, tt.wantStatus)
+			}
+		})
+	}
+}
@@ -0,0 +1,316 @@
+package http
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/go-chi/chi/v5"
+	"github.com/qPyth/mobydev-internship-auth/internal/domain"
+	"net/http"
+)
+
+type OAuthService interface {
+	AuthenticateClient(ctx context.Context, clientID, clientSecret string) (domain.Client, error)
+	PublicClient(ctx context.Context, clientID string) (domain.Client, error)
+	ClientCredentials(ctx context.Context, client domain.Client, scope string) (domain.TokenResponse, error)
+	StartAuthorization(ctx context.Context, req domain.AuthorizationRequest) (string, error)
+	Authorize(ctx context.Context, req domain.AuthorizationRequest, approve *bool) (domain.Authorization, error)
+	ExchangeAuthorizationCode(ctx context.Context, client domain.Client, code, redirectURI, codeVerifier string, meta domain.SessionMeta) (domain.TokenResponse, error)
+	RefreshToken(ctx context.Context, client domain.Client, refreshToken, dpopJKT string) (domain.TokenResponse, error)
+	DeviceAuthorization(ctx context.Context, client domain.Client, scope string) (domain.DeviceAuthorization, error)
+	DeviceVerification(ctx context.Context, userCode string) (domain.DeviceVerification, error)
+	VerifyDevice(ctx context.Context, userCode string, approve bool) error
+	ExchangeDeviceCode(ctx context.Context, client domain.Client, deviceCode string, meta domain.SessionMeta) (domain.TokenResponse, error)
+	ExchangeToken(ctx context.Context, client domain.Client, req domain.TokenExchangeRequest, dpopJKT string) (domain.TokenResponse, error)
+	Introspect(ctx context.Context, token, tokenTypeHint string) (domain.Introspection, error)
+	UserInfo(ctx context.Context) (domain.UserInfo, error)
+	Discovery() domain.OpenIDConfiguration
+}
+
+// OAuthErrorResponse is an error response of OAuth 2.0 endpoints (RFC 6749 section 5.2)
+type OAuthErrorResponse struct {
+	Error            string `json:"error"`
+	ErrorDescription string `json:"error_description,omitempty"`
+}
+
+const (
+	oauthErrInvalidRequest       = "invalid_request"
+	oauthErrInvalidClient        = "invalid_client"
+	oauthErrUnauthorizedClient   = "unauthorized_client"
+	oauthErrUnsupportedGrantType = "unsupported_grant_type"
+	oauthErrInvalidScope         = "invalid_scope"
+	oauthErrInvalidGrant         = "invalid_grant"
+	oauthErrInvalidDPoPProof     = "invalid_dpop_proof"
+	oauthErrAuthorizationPending = "authorization_pending"
+	oauthErrSlowDown             = "slow_down"
+	oauthErrAccessDenied         = "access_denied"
+	oauthErrExpiredToken         = "expired_token"
+	oauthErrInvalidTarget        = "invalid_target"
+	oauthErrServerError          = "server_error"
+)
+
+func (h *Handler) InitOAuthRoutes(r chi.Router) {
+	r.Route("/oauth", func(r chi.Router) {
+		r.Get("/authorize", h.StartAuthorization)
+		r.With(h.TokenAuthMiddleware).Post("/authorize", h.Authorize)
+		r.Post("/token", h.Token)
+		r.Post("/device_authorization", h.DeviceAuthorization)
+		r.With(h.TokenAuthMiddleware).Get("/device", h.DeviceVerification)
+		r.With(h.TokenAuthMiddleware).Post("/device", h.VerifyDevice)
+		r.Post("/introspect", h.Introspect)
+	})
+	userInfo := r.With(h.TokenAuthMiddleware, h.RequirePermission(domain.ScopeOpenID))
+	userInfo.Get("/userinfo", h.UserInfo)
+	userInfo.Post("/userinfo", h.UserInfo)
+}
+
+// authorizeReq is the authorization request approved by the signed in user on the consent page.
+// Approve is omitted to check for an earlier consent, true to approve and false to deny the request
+type authorizeReq struct {
+	domain.AuthorizationRequest
+	Approve *bool `json:"approve"`
+}
+
+// StartAuthorization is the authorization endpoint (RFC 6749 section 3.1), it redirects the browser to the consent page
+func (h *Handler) StartAuthorization(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	uri, err := h.oauthService.StartAuthorization(r.Context(), domain.AuthorizationRequest{
+		ResponseType:        query.Get("response_type"),
+		ClientID:            query.Get("client_id"),
+		RedirectURI:         query.Get("redirect_uri"),
+		Scope:               query.Get("scope"),
+		State:               query.Get("state"),
+		CodeChallenge:       query.Get("code_challenge"),
+		CodeChallengeMethod: query.Get("code_challenge_method"),
+		Nonce:               query.Get("nonce"),
+	})
+	if err != nil {
+		h.log.Error("failed to start authorization: ", "error", err.Error())
+		h.authorizationError(w, err)
+		return
+	}
+	http.Redirect(w, r, uri, http.StatusFound)
+}
+
+// Authorize issues authorization code for the signed in user and returns the client redirect uri with it
+func (h *Handler) Authorize(w http.ResponseWriter, r *http.Request) {
+	var req authorizeReq
+	if err := h.bindData(r, &req); err != nil {
+		h.log.Error("failed to bind authorize request: ", "error", err.Error())
+		h.error(w, http.StatusBadRequest, ErrBadReq)
+		return
+	}
+
+	authorization, err := h.oauthService.Authorize(r.Context(), req.AuthorizationRequest, req.Approve)
+	if err != nil {
+		h.log.Error("failed to authorize: ", "error", err.Error())
+		h.authorizationError(w, err)
+		return
+	}
+	w.Header().Set("Cache-Control", "no-store")
+	h.NewResponse(w, http.StatusOK, authorization)
+}
+
+func (h *Handler) authorizationError(w http.ResponseWriter, err error) {
+	if errors.Is(err, domain.ErrInvalidClient) || errors.Is(err, domain.ErrInvalidRedirectURI) {
+		h.oauthError(w, http.StatusBadRequest, oauthErrInvalidRequest, err.Error())
+		return
+	}
+	if errors.Is(err, domain.ErrSessionRequired) {
+		h.oauthError(w, http.StatusForbidden, oauthErrAccessDenied, err.Error())
+		return
+	}
+	h.oauthError(w, http.StatusInternalServerError, oauthErrServerError, "")
+}
+
+// Token is the token endpoint (RFC 6749 section 3.2). Confidential clients must authenticate, public clients
+// send only client_id and can use the authorization code and refresh token grants
+func (h *Handler) Token(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	if err := r.ParseForm(); err != nil {
+		h.log.Error("failed to parse token request: ", "error", err.Error())
+		h.oauthError(w, http.StatusBadRequest, oauthErrInvalidRequest, "malformed request body")
+		return
+	}
+	grantType := r.PostForm.Get("grant_type")
+	if grantType == "" {
+		h.oauthError(w, http.StatusBadRequest, oauthErrInvalidRequest, "grant_type is required")
+		return
+	}
+
+	client, ok := h.tokenClient(w, r, grantType)
+	if !ok {
+		return
+	}
+
+	var resp domain.TokenResponse
+	var err error
+	switch grantType {
+	case domain.GrantTypeClientCredentials:
+		resp, err = h.oauthService.ClientCredentials(ctx, client, r.PostForm.Get("scope"))
+	case domain.GrantTypeAuthorizationCode, domain.GrantTypeRefreshToken, domain.GrantTypeDeviceCode:
+		dpopJKT, ok := h.verifyDPoPProof(w, r)
+		if !ok {
+			return
+		}
+		meta := domain.SessionMeta{UserAgent: r.UserAgent(), IP: clientIP(r), DPoPJKT: dpopJKT}
+		switch grantType {
+		case domain.GrantTypeRefreshToken:
+			resp, err = h.oauthService.RefreshToken(ctx, client, r.PostForm.Get("refresh_token"), dpopJKT)
+		case domain.GrantTypeDeviceCode:
+			resp, err = h.oauthService.ExchangeDeviceCode(ctx, client, r.PostForm.Get("device_code"), meta)
+		default:
+			resp, err = h.oauthService.ExchangeAuthorizationCode(ctx, client, r.PostForm.Get("code"), r.PostForm.Get("redirect_uri"),
+				r.PostForm.Get("code_verifier"), meta)
+		}
+	case domain.GrantTypeTokenExchange:
+		dpopJKT, ok := h.verifyDPoPProof(w, r)
+		if !ok {
+			return
+		}
+		resp, err = h.oauthService.ExchangeToken(ctx, client, domain.TokenExchangeRequest{
+			SubjectToken:       r.PostForm.Get("subject_token"),
+			SubjectTokenType:   r.PostForm.Get("subject_token_type"),
+			RequestedTokenType: r.PostForm.Get("requested_token_type"),
+			Audience:           r.PostForm.Get("audience"),
+			Scope:              r.PostForm.Get("scope"),
+		}, dpopJKT)
+	default:
+		h.oauthError(w, http.StatusBadRequest, oauthErrUnsupportedGrantType, "")
+		return
+	}
+	if err != nil {
+		h.log.Error("failed to issue token: ", "client_id", client.ID, "grant_type", grantType, "error", err.Error())
+		switch {
+		case errors.Is(err, domain.ErrUnauthorizedClient):
+			h.oauthError(w, http.StatusBadRequest, oauthErrUnauthorizedClient, err.Error())
+		case errors.Is(err, domain.ErrScopeNotAllowed):
+			h.oauthError(w, http.StatusBadRequest, oauthErrInvalidScope, err.Error())
+		case errors.Is(err, domain.ErrInvalidGrant):
+			h.oauthError(w, http.StatusBadRequest, oauthErrInvalidGrant, domain.ErrInvalidGrant.Error())
+		case errors.Is(err, domain.ErrInvalidDPoPProof):
+			h.oauthError(w, http.StatusBadRequest, oauthErrInvalidDPoPProof, err.Error())
+		case errors.Is(err, domain.ErrAuthPending):
+			h.oauthError(w, http.StatusBadRequest, oauthErrAuthorizationPending, "")
+		case errors.Is(err, domain.ErrSlowDown):
+			h.oauthError(w, http.StatusBadRequest, oauthErrSlowDown, "")
+		case errors.Is(err, domain.ErrAccessDenied):
+			h.oauthError(w, http.StatusBadRequest, oauthErrAccessDenied, err.Error())
+		case errors.Is(err, domain.ErrExpiredToken):
+			h.oauthError(w, http.StatusBadRequest, oauthErrExpiredToken, err.Error())
+		case errors.Is(err, domain.ErrInvalidExchange):
+			h.oauthError(w, http.StatusBadRequest, oauthErrInvalidRequest, err.Error())
+		case errors.Is(err, domain.ErrInvalidTarget):
+			h.oauthError(w, http.StatusBadRequest, oauthErrInvalidTarget, err.Error())
+		default:
+			h.oauthError(w, http.StatusInternalServerError, oauthErrServerError, "")
+		}
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	h.NewResponse(w, http.StatusOK, resp)
+}
+
+// tokenClient authenticates confidential client or, for grants allowed to public clients, returns public client
+// by client_id if no secret was sent. Error response is written if client is not valid
+func (h *Handler) tokenClient(w http.ResponseWriter, r *http.Request, grantType string) (domain.Client, bool) {
+	_, _, basic := r.BasicAuth()
+	clientID := r.PostForm.Get("client_id")
+	if basic || r.PostForm.Get("client_secret") != "" || clientID == "" || grantType == domain.GrantTypeClientCredentials ||
+		grantType == domain.GrantTypeTokenExchange {
+		return h.authenticateClient(w, r)
+	}
+
+	client, err := h.oauthService.PublicClient(r.Context(), clientID)
+	if err != nil {
+		h.log.Error("failed to get public client: ", "client_id", clientID, "error", err.Error())
+		if errors.Is(err, domain.ErrInvalidClient) {
+			h.oauthError(w, http.StatusUnauthorized, oauthErrInvalidClient, "client authentication failed")
+			return domain.Client{}, false
+		}
+		h.oauthError(w, http.StatusInternalServerError, oauthErrServerError, "")
+		return domain.Client{}, false
+	}
+	return client, true
+}
+
+// Introspect returns state of the token for authenticated clients (RFC 7662)
+func (h *Handler) Introspect(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	if err := r.ParseForm(); err != nil {
+		h.log.Error("failed to parse introspection request: ", "error", err.Error())
+		h.oauthError(w, http.StatusBadRequest, oauthErrInvalidRequest, "malformed request body")
+		return
+	}
+
+	if _, ok := h.authenticateClient(w, r); !ok {
+		return
+	}
+
+	token := r.PostForm.Get("token")
+	if token == "" {
+		h.oauthError(w, http.StatusBadRequest, oauthErrInvalidRequest, "token is required")
+		return
+	}
+
+	introspection, err := h.oauthService.Introspect(ctx, token, r.PostForm.Get("token_type_hint"))
+	if err != nil {
+		h.log.Error("failed to introspect token: ", "error", err.Error())
+		h.oauthError(w, http.StatusInternalServerError, oauthErrServerError, "")
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	h.NewResponse(w, http.StatusOK, introspection)
+}
+
+// UserInfo returns OpenID Connect claims of the user allowed by scopes of the access token
+func (h *Handler) UserInfo(w http.ResponseWriter, r *http.Request) {
+	info, err := h.oauthService.UserInfo(r.Context())
+	if err != nil {
+		h.log.Error("failed to get user info: ", "error", err.Error())
+		if errors.Is(err, domain.ErrUserNotFound) {
+			h.error(w, http.StatusUnauthorized, fmt.Errorf("invalid token"))
+			return
+		}
+		h.error(w, http.StatusInternalServerError, internalSrvErrorMsg)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	h.NewResponse(w, http.StatusOK, info)
+}
+
+// authenticateClient authenticates client by HTTP Basic credentials or client_id and client_secret form params,
+// error response is written if authentication fails. Form must be parsed before
+func (h *Handler) authenticateClient(w http.ResponseWriter, r *http.Request) (domain.Client, bool) {
+	clientID, clientSecret, ok := r.BasicAuth()
+	if !ok {
+		clientID, clientSecret = r.PostForm.Get("client_id"), r.PostForm.Get("client_secret")
+	}
+	if clientID == "" {
+		w.Header().Set("WWW-Authenticate", `Basic realm="oauth"`)
+		h.oauthError(w, http.StatusUnauthorized, oauthErrInvalidClient, "client authentication required")
+		return domain.Client{}, false
+	}
+
+	client, err := h.oauthService.AuthenticateClient(r.Context(), clientID, clientSecret)
+	if err != nil {
+		h.log.Error("failed to authenticate client: ", "client_id", clientID, "error", err.Error())
+		if errors.Is(err, domain.ErrInvalidClient) {
+			w.Header().Set("WWW-Authenticate", `Basic realm="oauth"`)
+			h.oauthError(w, http.StatusUnauthorized, oauthErrInvalidClient, "client authentication failed")
+			return domain.Client{}, false
+		}
+		h.oauthError(w, http.StatusInternalServerError, oauthErrServerError, "")
+		return domain.Client{}, false
+	}
+	return client, true
+}
+
+func (h *Handler) oauthError(w http.ResponseWriter, status int, code, description string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	h.NewResponse(w, status, OAuthErrorResponse{Error: code, ErrorDescription: description})
+}
@@ -0,0 +1,185 @@
+package http
+
+import (
+	"context"
+	"errors"
+	"github.com/go-chi/chi/v5"
+	"github.com/qPyth/mobydev-internship-auth/internal/domain"
+	"github.com/qPyth/mobydev-internship-auth/internal/validators"
+	"net/http"
+)
+
+const (
+	PermissionOrgMembersRead  = "org:members:read"
+	PermissionOrgMembersWrite = "org:members:write"
+)
+
+var (
+	ErrInvalidOrgName = errors.New("invalid organization name")
+	ErrInvalidOrgSlug = errors.New("invalid organization slug, use 2-64 lowercase letters, digits and hyphens")
+)
+
+type OrganizationService interface {
+	CreateOrganization(ctx context.Context, name, slug string) (domain.Organization, error)
+	ListOrganizations(ctx context.Context) ([]domain.Organization, error)
+	ListMembers(ctx context.Context) ([]domain.Membership, error)
+	AssignMemberRole(ctx context.Context, userID uint, role string) error
+	UnassignMemberRole(ctx context.Context, userID uint, role string) error
+	RemoveMember(ctx context.Context, userID uint) error
+}
+
+type createOrgReq struct {
+	Name string `json:"name" binding:"required,max=128"`
+	Slug string `json:"slug" binding:"required"`
+}
+
+type switchOrgReq struct {
+	// OrgID is the organization to switch to, 0 leaves the active organization
+	OrgID uint `json:"org_id"`
+}
+
+// InitOrganizationRoutes registers routes of user organizations and of members of the active organization.
+// Members routes always work with the active organization of the token
+func (h *Handler) InitOrganizationRoutes(r chi.Router) {
+	r.Route("/orgs", func(r chi.Router) {
+		r.Use(h.TokenAuthMiddleware)
+		r.Post("/", h.CreateOrganization)
+		r.Get("/", h.ListOrganizations)
+		r.Post("/switch", h.SwitchOrganization)
+	})
+	r.Route("/org", func(r chi.Router) {
+		r.Use(h.TokenAuthMiddleware)
+		r.With(h.RequirePermission(PermissionOrgMembersRead)).Get("/members", h.ListMembers)
+		r.With(h.RequirePermission(PermissionOrgMembersWrite)).Delete("/members/{id}", h.RemoveMember)
+		r.With(h.RequirePermission(PermissionOrgMembersWrite)).Post("/members/{id}/roles", h.AssignMemberRole)
+		r.With(h.RequirePermission(PermissionOrgMembersWrite)).Delete("/members/{id}/roles/{role}", h.UnassignMemberRole)
+	})
+}
+
+func (h *Handler) CreateOrganization(w http.ResponseWriter, r *http.Request) {
+	var req createOrgReq
+	if err := h.bindData(r, &req); err != nil {
+		h.log.Error("failed to bind create organization request: ", "error", err.Error())
+		h.error(w, http.StatusBadRequest, ErrBadReq)
+		return
+	}
+	if !validators.OrgNameIsValid(req.Name) {
+		h.error(w, http.StatusBadRequest, ErrInvalidOrgName)
+		return
+	}
+	slugValid, err := validators.SlugIsValid(req.Slug)
+	if err != nil || !slugValid {
+		h.error(w, http.StatusBadRequest, ErrInvalidOrgSlug)
+		return
+	}
+
+	org, err := h.orgService.CreateOrganization(r.Context(), req.Name, req.Slug)
+	if err != nil {
+		h.log.Error("failed to create organization: ", "error", err.Error())
+		if errors.Is(err, domain.ErrOrgExists) {
+			h.error(w, http.StatusConflict, err)
+			return
+		}
+		h.error(w, http.StatusInternalServerError, internalSrvErrorMsg)
+		return
+	}
+	h.NewResponse(w, http.StatusCreated, org)
+}
+
+func (h *Handler) ListOrganizations(w http.ResponseWriter, r *http.Request) {
+	orgs, err := h.orgService.ListOrganizations(r.Context())
+	if err != nil {
+		h.log.Error("failed to list organizations: ", "error", err.Error())
+		h.error(w, http.StatusInternalServerError, internalSrvErrorMsg)
+		return
+	}
+	h.NewResponse(w, http.StatusOK, orgs)
+}
+
+func (h *Handler) SwitchOrganization(w http.ResponseWriter, r *http.Request) {
+	var req switchOrgReq
+	if err := h.bindData(r, &req); err != nil {
+		h.log.Error("failed to bind switch organization request: ", "error", err.Error())
+		h.error(w, http.StatusBadRequest, ErrBadReq)
+		return
+	}
+
+	tokens, err := h.userService.SwitchOrganization(r.Context(), req.OrgID)
+	if err != nil {
+		h.log.Error("failed to switch organization: ", "error", err.Error())
+		if errors.Is(err, domain.ErrNotOrgMember) || errors.Is(err, domain.ErrSessionRequired) {
+			h.error(w, http.StatusForbidden, err)
+			return
+		}
+		h.error(w, http.StatusInternalServerError, internalSrvErrorMsg)
+		return
+	}
+	h.NewResponse(w, http.StatusOK, SignInResp{AccessToken: tokens.AccessToken, RefreshToken: tokens.RefreshToken})
+}
+
+func (h *Handler) ListMembers(w http.ResponseWriter, r *http.Request) {
+	members, err := h.orgService.ListMembers(r.Context())
+	if err != nil {
+		h.log.Error("failed to list organization members: ", "error", err.Error())
+		h.memberError(w, err)
+		return
+	}
+	h.NewResponse(w, http.StatusOK, members)
+}
+
+func (h *Handler) RemoveMember(w http.ResponseWriter, r *http.Request) {
+	userID, err := userIDParam(r)
+	if err != nil {
+		h.error(w, http.StatusBadRequest, err)
+		return
+	}
+	h.memberResult(w, h.orgService.RemoveMember(r.Context(), userID))
+}
+
+func (h *Handler) AssignMemberRole(w http.ResponseWriter, r *http.Request) {
+	userID, err := userIDParam(r)
+	if err != nil {
+		h.error(w, http.StatusBadRequest, err)
+		return
+	}
+	var req assignRoleReq
+	if err := h.bindData(r, &req); err != nil || req.Role == "" {
+		h.error(w, http.StatusBadRequest, ErrBadReq)
+		return
+	}
+	h.memberResult(w, h.orgService.AssignMemberRole(r.Context(), userID, req.Role))
+}
+
+func (h *Handler) UnassignMemberRole(w http.ResponseWriter, r *http.Request) {
+	userID, err := userIDParam(r)
+	if err != nil {
+		h.error(w, http.StatusBadRequest, err)
+		return
+	}
+	h.memberResult(w, h.orgService.UnassignMemberRole(r.Context(), userID, chi.URLParam(r, "role")))
+}
+
+// memberResult writes response of organization member change
+func (h *Handler) memberResult(w http.ResponseWriter, err error) {
+	if err != nil {
+		h.log.Error("failed to change organization member: ", "error", err.Error())
+		h.memberError(w, err)
+		return
+	}
+	if _, err := w.Write([]byte("ok")); err != nil {
+		h.log.Error("failed to write response: ", "error", err.Error())
+	}
+}
+
+func (h *Handler) memberError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, domain.ErrNoActiveOrg):
+		h.error(w, http.StatusForbidden, err)
+	case errors.Is(err, domain.ErrNotOrgMember), errors.Is(err, domain.ErrRoleNotFound):
+		h.error(w, http.StatusNotFound, err)
+	case errors.Is(err, domain.ErrLastOrgAdmin):
+		h.error(w, http.StatusConflict, err)
+	default:
+		h.error(w, http.StatusInternalServerError, internalSrvErrorMsg)
+	}
+}
@@ -0,0 +1,93 @@
+package http
+
+import (
+	"errors"
+	"github.com/go-chi/chi/v5"
+	"github.com/qPyth/mobydev-internship-auth/internal/domain"
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+var (
+	ErrInvalidTokenName = errors.New("invalid token name")
+	ErrInvalidTokenID   = errors.New("invalid token id")
+)
+
+type createPersonalTokenReq struct {
+	Name   string   `json:"name"`
+	Scopes []string `json:"scopes"`
+	// ExpiresIn is lifetime of the token in seconds, 0 uses the maximum lifetime
+	ExpiresIn int64 `json:"expires_in"`
+}
+
+type createPersonalTokenResp struct {
+	domain.PersonalToken
+	// Token is shown only once, it can not be read again
+	Token string `json:"token"`
+}
+
+func (h *Handler) CreatePersonalToken(w http.ResponseWriter, r *http.Request) {
+	var req createPersonalTokenReq
+	if err := h.bindData(r, &req); err != nil {
+		h.log.Error("failed to bind create personal token request: ", "error", err.Error())
+		h.error(w, http.StatusBadRequest, ErrBadReq)
+		return
+	}
+	if req.Name == "" || len(req.Name) > 64 {
+		h.error(w, http.StatusBadRequest, ErrInvalidTokenName)
+		return
+	}
+
+	// bounded before conversion, a larger value overflows time.Duration
+	if req.ExpiresIn < 0 || req.ExpiresIn > math.MaxInt64/int64(time.Second) {
+		h.error(w, http.StatusBadRequest, domain.ErrInvalidExpiration)
+		return
+	}
+
+	personalToken, token, err := h.userService.CreatePersonalToken(r.Context(), req.Name, req.Scopes, time.Duration(req.ExpiresIn)*time.Second)
+	if err != nil {
+		h.log.Error("failed to create personal token: ", "error", err.Error())
+		switch {
+		case errors.Is(err, domain.ErrInvalidScope), errors.Is(err, domain.ErrInvalidExpiration):
+			h.error(w, http.StatusBadRequest, err)
+		case errors.Is(err, domain.ErrSessionRequired):
+			h.error(w, http.StatusForbidden, err)
+		default:
+			h.error(w, http.StatusInternalServerError, internalSrvErrorMsg)
+		}
+		return
+	}
+	h.NewResponse(w, http.StatusCreated, createPersonalTokenResp{PersonalToken: personalToken, Token: token})
+}
+
+func (h *Handler) ListPersonalTokens(w http.ResponseWriter, r *http.Request) {
+	tokens, err := h.userService.ListPersonalTokens(r.Context())
+	if err != nil {
+		h.log.Error("failed to list personal tokens: ", "error", err.Error())
+		h.error(w, http.StatusInternalServerError, internalSrvErrorMsg)
+		return
+	}
+	h.NewResponse(w, http.StatusOK, tokens)
+}
+
+func (h *Handler) RevokePersonalToken(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseUint(chi.URLParam(r, "id"), 10, 64)
+	if err != nil || id == 0 {
+		h.error(w, http.StatusBadRequest, ErrInvalidTokenID)
+		return
+	}
+	if err := h.userService.RevokePersonalToken(r.Context(), uint(id)); err != nil {
+		h.log.Error("failed to revoke personal token: ", "error", err.Error())
+		if errors.Is(err, domain.ErrTokenNotFound) {
+			h.error(w, http.StatusNotFound, err)
+			return
+		}
+		h.error(w, http.StatusInternalServerError, internalSrvErrorMsg)
+		return
+	}
+	if _, err := w.Write([]byte("ok")); err != nil {
+		h.log.Error("failed to write response: ", "error", err.Error())
+	}
+}
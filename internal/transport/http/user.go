@@ -6,14 +6,26 @@ import (
 	"github.com/go-chi/chi/v5"
 	"github.com/qPyth/mobydev-internship-auth/internal/domain"
 	"github.com/qPyth/mobydev-internship-auth/internal/validators"
+	"github.com/qPyth/mobydev-internship-auth/pkg/auth"
+	"net"
 	"net/http"
+	"time"
 )
 
 func (h *Handler) InitUserRoutes(r chi.Router) {
 	r.Route("/user", func(r chi.Router) {
 		r.Post("/signup", h.SignUp)
 		r.Post("/signin", h.SignIn)
-		r.With(h.JWTAuthMiddleware).Post("/profile/update", h.UserProfileUpdate)
+		r.Post("/token/refresh", h.RefreshTokens)
+		r.With(h.TokenAuthMiddleware).Post("/profile/update", h.UserProfileUpdate)
+		r.With(h.TokenAuthMiddleware).Post("/password/change", h.ChangePassword)
+		r.With(h.TokenAuthMiddleware).Post("/signout", h.SignOut)
+		r.With(h.TokenAuthMiddleware).Post("/signout/all", h.SignOutAll)
+		r.With(h.TokenAuthMiddleware).Get("/sessions", h.ListSessions)
+		r.With(h.TokenAuthMiddleware).Delete("/sessions/{id}", h.RevokeSession)
+		r.With(h.TokenAuthMiddleware).Post("/tokens", h.CreatePersonalToken)
+		r.With(h.TokenAuthMiddleware).Get("/tokens", h.ListPersonalTokens)
+		r.With(h.TokenAuthMiddleware).Delete("/tokens/{id}", h.RevokePersonalToken)
 	})
 }
 
@@ -26,10 +38,24 @@ type userSignUpReq struct {
 type userSignInReq struct {
 	Email    string `json:"email" binding:"required, max=64"`
 	Password string `json:"password" binding:"required, min=8,max=64"`
+	Device   string `json:"device" binding:"max=64"`
 }
 
 type SignInResp struct {
-	Token string `json:"token"`
+	AccessToken  string `json:"access_token"`
+	RefreshToken string `json:"refresh_token"`
+}
+
+type changePasswordReq struct {
+	CurrentPassword string `json:"current_password"`
+	Password        string `json:"password"`
+	PassConf        string `json:"pass_conf"`
+	// SignOutOthers revokes every other session of the user
+	SignOutOthers bool `json:"sign_out_others"`
+}
+
+type refreshTokensReq struct {
+	RefreshToken string `json:"refresh_token" binding:"required"`
 }
 
 var (
@@ -40,12 +66,25 @@ var (
 	ErrInvalidBDay     = errors.New("invalid birthdate or date format not in RFC3339")
 	ErrInvalidPhone    = errors.New("invalid phone number")
 	ErrBadReq          = errors.New("bad request")
+	ErrInvalidDevice   = errors.New("invalid device name")
 )
 
 type UserService interface {
 	SignUp(ctx context.Context, email, password string) error
-	SignIn(ctx context.Context, email, password string) (token string, err error)
+	SignIn(ctx context.Context, email, password string, meta domain.SessionMeta) (domain.Tokens, error)
+	RefreshTokens(ctx context.Context, refreshToken, dpopJKT string) (domain.Tokens, error)
+	SignOut(ctx context.Context) error
+	SignOutAll(ctx context.Context) error
+	VerifyAccessToken(ctx context.Context, token string) (*auth.Claims, error)
+	InspectAccessToken(ctx context.Context, token string) (*auth.Claims, error)
+	ListSessions(ctx context.Context) ([]domain.Session, error)
+	RevokeSession(ctx context.Context, sessionID string) error
+	SwitchOrganization(ctx context.Context, orgID uint) (domain.Tokens, error)
+	CreatePersonalToken(ctx context.Context, name string, scopes []string, ttl time.Duration) (domain.PersonalToken, string, error)
+	ListPersonalTokens(ctx context.Context) ([]domain.PersonalToken, error)
+	RevokePersonalToken(ctx context.Context, id uint) error
 	UpdateUserProfile(ctx context.Context, req domain.UserProfileUpdateReq) error
+	ChangePassword(ctx context.Context, currentPassword, newPassword string, signOutOthers bool) error
 }
 
 func (h *Handler) SignUp(w http.ResponseWriter, r *http.Request) {
@@ -71,9 +110,17 @@ func (h *Handler) SignUp(w http.ResponseWriter, r *http.Request) {
 			h.error(w, http.StatusBadRequest, err)
 			return
 		}
+		if errors.Is(err, domain.ErrSignUpDisabled) {
+			h.error(w, http.StatusForbidden, err)
+			return
+		}
 		h.error(w, http.StatusInternalServerError, internalSrvErrorMsg)
 		return
 	}
+	if err := h.accountService.SendVerification(ctx, req.Email); err != nil {
+		// the user can request the link again
+		h.log.Error("failed to send email verification: ", "error", err.Error())
+	}
 	_, err := w.Write([]byte("ok"))
 	if err != nil {
 		h.error(w, http.StatusInternalServerError, internalSrvErrorMsg)
@@ -89,16 +136,123 @@ func (h *Handler) SignIn(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	token, err := h.userService.SignIn(ctx, req.Email, req.Password)
+	if len(req.Device) > 64 {
+		h.error(w, http.StatusBadRequest, ErrInvalidDevice)
+		return
+	}
+	dpopJKT, ok := h.verifyDPoPProof(w, r)
+	if !ok {
+		return
+	}
+
+	tokens, err := h.userService.SignIn(ctx, req.Email, req.Password, domain.SessionMeta{
+		Device:    req.Device,
+		UserAgent: r.UserAgent(),
+		IP:        clientIP(r),
+		DPoPJKT:   dpopJKT,
+	})
 	if err != nil {
 		if errors.Is(err, domain.ErrInvalidCredentials) {
 			h.error(w, http.StatusBadRequest, err)
 			return
 		}
+		if errors.Is(err, domain.ErrEmailNotVerified) {
+			h.error(w, http.StatusForbidden, err)
+			return
+		}
 		h.error(w, http.StatusInternalServerError, err)
 		return
 	}
-	h.NewResponse(w, http.StatusOK, SignInResp{Token: token})
+	h.NewResponse(w, http.StatusOK, SignInResp{AccessToken: tokens.AccessToken, RefreshToken: tokens.RefreshToken})
+}
+
+func (h *Handler) RefreshTokens(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	var req refreshTokensReq
+	if err := h.bindData(r, &req); err != nil {
+		h.log.Error("failed to bind refresh tokens request: ", "error", err.Error())
+		h.error(w, http.StatusBadRequest, ErrBadReq)
+		return
+	}
+	if req.RefreshToken == "" {
+		h.error(w, http.StatusBadRequest, ErrBadReq)
+		return
+	}
+	dpopJKT, ok := h.verifyDPoPProof(w, r)
+	if !ok {
+		return
+	}
+
+	tokens, err := h.userService.RefreshTokens(ctx, req.RefreshToken, dpopJKT)
+	if err != nil {
+		h.log.Error("failed to refresh tokens: ", "error", err.Error())
+		if errors.Is(err, domain.ErrInvalidRefreshToken) || errors.Is(err, domain.ErrRefreshTokenReused) {
+			h.error(w, http.StatusUnauthorized, domain.ErrInvalidRefreshToken)
+			return
+		}
+		if errors.Is(err, domain.ErrInvalidDPoPProof) {
+			h.error(w, http.StatusBadRequest, err)
+			return
+		}
+		h.error(w, http.StatusInternalServerError, internalSrvErrorMsg)
+		return
+	}
+	h.NewResponse(w, http.StatusOK, SignInResp{AccessToken: tokens.AccessToken, RefreshToken: tokens.RefreshToken})
+}
+
+func (h *Handler) SignOut(w http.ResponseWriter, r *http.Request) {
+	if err := h.userService.SignOut(r.Context()); err != nil {
+		h.log.Error("failed to sign out user: ", "error", err.Error())
+		if errors.Is(err, domain.ErrSessionRequired) {
+			h.error(w, http.StatusForbidden, err)
+			return
+		}
+		h.error(w, http.StatusInternalServerError, internalSrvErrorMsg)
+		return
+	}
+	_, err := w.Write([]byte("ok"))
+	if err != nil {
+		h.log.Error("failed to write response: ", "error", err.Error())
+	}
+}
+
+func (h *Handler) SignOutAll(w http.ResponseWriter, r *http.Request) {
+	if err := h.userService.SignOutAll(r.Context()); err != nil {
+		h.log.Error("failed to sign out user from all devices: ", "error", err.Error())
+		h.error(w, http.StatusInternalServerError, internalSrvErrorMsg)
+		return
+	}
+	_, err := w.Write([]byte("ok"))
+	if err != nil {
+		h.log.Error("failed to write response: ", "error", err.Error())
+	}
+}
+
+func (h *Handler) ListSessions(w http.ResponseWriter, r *http.Request) {
+	sessions, err := h.userService.ListSessions(r.Context())
+	if err != nil {
+		h.log.Error("failed to list user sessions: ", "error", err.Error())
+		h.error(w, http.StatusInternalServerError, internalSrvErrorMsg)
+		return
+	}
+	h.NewResponse(w, http.StatusOK, sessions)
+}
+
+func (h *Handler) RevokeSession(w http.ResponseWriter, r *http.Request) {
+	err := h.userService.RevokeSession(r.Context(), chi.URLParam(r, "id"))
+	if err != nil {
+		h.log.Error("failed to revoke user session: ", "error", err.Error())
+		if errors.Is(err, domain.ErrSessionNotFound) {
+			h.error(w, http.StatusNotFound, err)
+			return
+		}
+		h.error(w, http.StatusInternalServerError, internalSrvErrorMsg)
+		return
+	}
+	_, err = w.Write([]byte("ok"))
+	if err != nil {
+		h.log.Error("failed to write response: ", "error", err.Error())
+	}
 }
 
 func (h *Handler) UserProfileUpdate(w http.ResponseWriter, r *http.Request) {
@@ -122,7 +276,7 @@ func (h *Handler) UserProfileUpdate(w http.ResponseWriter, r *http.Request) {
 	err = h.userService.UpdateUserProfile(ctx, req)
 	if err != nil {
 		h.log.Error("failed to update user profile: ", "error", err.Error())
-		if errors.Is(err, domain.ErrUserNotFound) {
+		if errors.Is(err, domain.ErrUserNotFound) || errors.Is(err, domain.ErrEmailUpdate) {
 			h.error(w, http.StatusBadRequest, err)
 			return
 		}
@@ -135,23 +289,65 @@ func (h *Handler) UserProfileUpdate(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
+// ChangePassword sets a new password of the user, the current password is required
+func (h *Handler) ChangePassword(w http.ResponseWriter, r *http.Request) {
+	var req changePasswordReq
+	if err := h.bindData(r, &req); err != nil {
+		h.log.Error("failed to bind change password request: ", "error", err.Error())
+		h.error(w, http.StatusBadRequest, ErrBadReq)
+		return
+	}
+	if err := passwordValidation(req.Password, req.PassConf); err != nil {
+		h.log.Error("failed to validate change password request: ", "error", err.Error())
+		if errors.Is(err, ErrInvalidPassword) || errors.Is(err, ErrPassConfirm) {
+			h.error(w, http.StatusBadRequest, err)
+			return
+		}
+		h.error(w, http.StatusInternalServerError, internalSrvErrorMsg)
+		return
+	}
+
+	if err := h.userService.ChangePassword(r.Context(), req.CurrentPassword, req.Password, req.SignOutOthers); err != nil {
+		h.log.Error("failed to change password: ", "error", err.Error())
+		if errors.Is(err, domain.ErrInvalidCredentials) {
+			h.error(w, http.StatusBadRequest, err)
+			return
+		}
+		if errors.Is(err, domain.ErrSessionRequired) {
+			h.error(w, http.StatusForbidden, err)
+			return
+		}
+		h.error(w, http.StatusInternalServerError, internalSrvErrorMsg)
+		return
+	}
+	_, err := w.Write([]byte("ok"))
+	if err != nil {
+		h.log.Error("failed to write response: ", "error", err.Error())
+	}
+}
+
 func userSignUpReqValidation(req userSignUpReq) error {
 	emailValid, err := validators.EmailIsValid(req.Email)
 	if err != nil {
 		return err
 	}
+	if !emailValid {
+		return ErrInvalidEmail
+	}
+
+	return passwordValidation(req.Password, req.PassConf)
+}
 
-	passValid, err := validators.PasswordIsValid(req.Password)
+func passwordValidation(password, passConf string) error {
+	passValid, err := validators.PasswordIsValid(password)
 	if err != nil {
 		return err
 	}
 
 	switch {
-	case !emailValid:
-		return ErrInvalidEmail
 	case !passValid:
 		return ErrInvalidPassword
-	case !validators.PasswordsMatch(req.Password, req.PassConf):
+	case !validators.PasswordsMatch(password, passConf):
 		return ErrPassConfirm
 	}
 
@@ -192,3 +388,28 @@ func updateProfileValidation(req domain.UserProfileUpdateReq) error {
 	}
 	return nil
 }
+
+// verifyDPoPProof verifies optional DPoP proof of the request and returns thumbprint of its key,
+// empty thumbprint is returned if request has no proof. Error response is written if proof is invalid
+func (h *Handler) verifyDPoPProof(w http.ResponseWriter, r *http.Request) (string, bool) {
+	proof := r.Header.Get("DPoP")
+	if proof == "" {
+		return "", true
+	}
+	jkt, err := h.dpopVerifier.Verify(proof, r.Method, h.requestURL(r), "")
+	if err != nil {
+		h.log.Error("failed to verify DPoP proof: ", "error", err.Error())
+		h.error(w, http.StatusBadRequest, domain.ErrInvalidDPoPProof)
+		return "", false
+	}
+	return jkt, true
+}
+
+// clientIP returns the host part of the request remote address
+func clientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
@@ -0,0 +1,27 @@
+package http
+
+import (
+	"github.com/go-chi/chi/v5"
+	"net/http"
+)
+
+func (h *Handler) InitWellKnownRoutes(r chi.Router) {
+	r.Route("/.well-known", func(r chi.Router) {
+		r.Get("/jwks.json", h.JWKS)
+		r.Get("/openid-configuration", h.OpenIDConfiguration)
+	})
+}
+
+// JWKS serves public keys for token verification by other services
+func (h *Handler) JWKS(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "public, max-age=300")
+	h.NewResponse(w, http.StatusOK, h.tokenManager.JWKS())
+}
+
+// OpenIDConfiguration serves OpenID Provider metadata so clients can discover endpoints and capabilities
+func (h *Handler) OpenIDConfiguration(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "public, max-age=300")
+	h.NewResponse(w, http.StatusOK, h.oauthService.Discovery())
+}
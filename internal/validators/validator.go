@@ -3,6 +3,8 @@ package validators
 import (
 	"regexp"
 	"time"
+	"unicode"
+	"unicode/utf8"
 )
 
 const (
@@ -46,3 +48,25 @@ func PhoneE164Validation(phone string) (bool, error) {
 	match, _ := regexp.MatchString(`^\+\d{1,15}$`, phone)
 	return match, nil
 }
+
+func SlugIsValid(slug string) (bool, error) {
+	if len(slug) < 2 || len(slug) > 64 {
+		return false, nil
+	}
+
+	return regexp.MatchString(`^[a-z0-9]+(-[a-z0-9]+)*$`, slug)
+}
+
+// OrgNameIsValid checks that the name is not empty, at most 128 bytes and has no control characters,
+// organization names are used in email headers
+func OrgNameIsValid(name string) bool {
+	if name == "" || len(name) > 128 || !utf8.ValidString(name) {
+		return false
+	}
+	for _, r := range name {
+		if unicode.IsControl(r) {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,5 @@
+-- DROP COLUMN requires SQLite 3.35.0, sqlite.New refuses older versions
+ALTER TABLE sessions DROP COLUMN scopes;
+ALTER TABLE sessions DROP COLUMN client_id;
+DROP TABLE IF EXISTS oauth_consents;
+DROP TABLE IF EXISTS oauth_codes;
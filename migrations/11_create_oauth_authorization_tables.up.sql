@@ -0,0 +1,24 @@
+CREATE TABLE IF NOT EXISTS oauth_codes (
+                                     code_hash      TEXT PRIMARY KEY,
+                                     client_id      TEXT NOT NULL,
+                                     user_id        INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+                                     org_id         INTEGER,
+                                     redirect_uri   TEXT NOT NULL,
+                                     scopes         TEXT NOT NULL,
+                                     code_challenge TEXT NOT NULL,
+                                     created_at     DATETIME NOT NULL,
+                                     expires_at     DATETIME NOT NULL,
+                                     used_at        DATETIME
+);
+
+CREATE TABLE IF NOT EXISTS oauth_consents (
+                                     user_id    INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+                                     client_id  TEXT NOT NULL,
+                                     scopes     TEXT NOT NULL,
+                                     created_at DATETIME NOT NULL,
+                                     updated_at DATETIME NOT NULL,
+                                     PRIMARY KEY (user_id, client_id)
+);
+
+ALTER TABLE sessions ADD COLUMN client_id TEXT;
+ALTER TABLE sessions ADD COLUMN scopes TEXT;
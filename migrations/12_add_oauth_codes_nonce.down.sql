@@ -0,0 +1,2 @@
+-- DROP COLUMN requires SQLite 3.35.0, sqlite.New refuses older versions
+ALTER TABLE oauth_codes DROP COLUMN nonce;
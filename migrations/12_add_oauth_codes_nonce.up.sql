@@ -0,0 +1 @@
+ALTER TABLE oauth_codes ADD COLUMN nonce TEXT NOT NULL DEFAULT '';
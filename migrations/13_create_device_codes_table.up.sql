@@ -0,0 +1,14 @@
+CREATE TABLE IF NOT EXISTS oauth_device_codes (
+                                     device_code_hash TEXT PRIMARY KEY,
+                                     user_code        TEXT NOT NULL UNIQUE,
+                                     client_id        TEXT NOT NULL,
+                                     scopes           TEXT NOT NULL,
+                                     status           TEXT NOT NULL,
+                                     user_id          INTEGER REFERENCES users(id) ON DELETE CASCADE,
+                                     org_id           INTEGER,
+                                     poll_interval    INTEGER NOT NULL,
+                                     last_polled_at   DATETIME,
+                                     created_at       DATETIME NOT NULL,
+                                     expires_at       DATETIME NOT NULL,
+                                     used_at          DATETIME
+);
@@ -0,0 +1,3 @@
+-- DROP COLUMN requires SQLite 3.35.0, sqlite.New refuses older versions
+DROP TABLE IF EXISTS account_tokens;
+ALTER TABLE users DROP COLUMN email_verified;
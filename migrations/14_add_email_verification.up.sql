@@ -0,0 +1,14 @@
+ALTER TABLE users ADD COLUMN email_verified INTEGER NOT NULL DEFAULT 0;
+
+CREATE TABLE IF NOT EXISTS account_tokens (
+                                     id         INTEGER PRIMARY KEY AUTOINCREMENT,
+                                     user_id    INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+                                     purpose    TEXT NOT NULL,
+                                     email      TEXT NOT NULL,
+                                     token_hash TEXT NOT NULL UNIQUE,
+                                     created_at DATETIME NOT NULL,
+                                     expires_at DATETIME NOT NULL,
+                                     used_at    DATETIME
+);
+
+CREATE INDEX IF NOT EXISTS account_tokens_user_purpose_idx ON account_tokens(user_id, purpose);
@@ -0,0 +1,2 @@
+-- DROP COLUMN requires SQLite 3.35.0, sqlite.New refuses older versions
+ALTER TABLE account_tokens DROP COLUMN session_id;
@@ -0,0 +1 @@
+ALTER TABLE account_tokens ADD COLUMN session_id TEXT;
@@ -0,0 +1,4 @@
+ALTER TABLE invitations ADD COLUMN sent_at DATETIME;
+
+-- invitations created before were sent together with storing them
+UPDATE invitations SET sent_at = created_at;
@@ -0,0 +1,12 @@
+CREATE TABLE IF NOT EXISTS refresh_tokens (
+                                     id          INTEGER PRIMARY KEY AUTOINCREMENT,
+                                     user_id     INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+                                     family_id   TEXT NOT NULL,
+                                     token_hash  TEXT NOT NULL UNIQUE,
+                                     expires_at  DATETIME NOT NULL,
+                                     used_at     DATETIME,
+                                     revoked_at  DATETIME,
+                                     created_at  DATETIME NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS idx_refresh_tokens_family_id ON refresh_tokens(family_id);
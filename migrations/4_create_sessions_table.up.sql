@@ -0,0 +1,13 @@
+CREATE TABLE IF NOT EXISTS sessions (
+                                     id           TEXT PRIMARY KEY,
+                                     user_id      INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+                                     device       TEXT,
+                                     user_agent   TEXT,
+                                     ip           TEXT,
+                                     created_at   DATETIME NOT NULL,
+                                     last_seen_at DATETIME NOT NULL,
+                                     expires_at   DATETIME NOT NULL,
+                                     revoked_at   DATETIME
+);
+
+CREATE INDEX IF NOT EXISTS idx_sessions_user_id ON sessions(user_id);
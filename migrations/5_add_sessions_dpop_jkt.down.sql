@@ -0,0 +1 @@
+-- DROP COLUMN requires SQLite 3.35.0, sqlite.New refuses older versions
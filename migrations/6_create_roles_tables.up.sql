@@ -0,0 +1,29 @@
+CREATE TABLE IF NOT EXISTS roles (
+                                     id          INTEGER PRIMARY KEY AUTOINCREMENT,
+                                     name        TEXT NOT NULL UNIQUE,
+                                     description TEXT
+);
+
+CREATE TABLE IF NOT EXISTS permissions (
+                                     id          INTEGER PRIMARY KEY AUTOINCREMENT,
+                                     name        TEXT NOT NULL UNIQUE
+);
+
+CREATE TABLE IF NOT EXISTS role_permissions (
+                                     role_id       INTEGER NOT NULL REFERENCES roles(id) ON DELETE CASCADE,
+                                     permission_id INTEGER NOT NULL REFERENCES permissions(id) ON DELETE CASCADE,
+                                     PRIMARY KEY (role_id, permission_id)
+);
+
+CREATE TABLE IF NOT EXISTS user_roles (
+                                     user_id     INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+                                     role_id     INTEGER NOT NULL REFERENCES roles(id) ON DELETE CASCADE,
+                                     PRIMARY KEY (user_id, role_id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_user_roles_role_id ON user_roles(role_id);
+
+INSERT INTO roles(name, description) VALUES ('admin', 'Manages users and their roles');
+INSERT INTO permissions(name) VALUES ('users:read'), ('users:write'), ('roles:read'), ('roles:write');
+INSERT INTO role_permissions(role_id, permission_id)
+SELECT r.id, p.id FROM roles r, permissions p WHERE r.name = 'admin';
@@ -0,0 +1,8 @@
+-- DROP COLUMN requires SQLite 3.35.0, sqlite.New refuses older versions
+DELETE FROM roles WHERE scope = 'org';
+DELETE FROM permissions WHERE name IN ('org:members:read', 'org:members:write');
+ALTER TABLE sessions DROP COLUMN org_id;
+ALTER TABLE roles DROP COLUMN scope;
+DROP TABLE IF EXISTS membership_roles;
+DROP TABLE IF EXISTS memberships;
+DROP TABLE IF EXISTS organizations;
@@ -0,0 +1,37 @@
+CREATE TABLE IF NOT EXISTS organizations (
+                                     id          INTEGER PRIMARY KEY AUTOINCREMENT,
+                                     name        TEXT NOT NULL,
+                                     slug        TEXT NOT NULL UNIQUE,
+                                     created_at  DATETIME NOT NULL
+);
+
+CREATE TABLE IF NOT EXISTS memberships (
+                                     org_id      INTEGER NOT NULL REFERENCES organizations(id) ON DELETE CASCADE,
+                                     user_id     INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+                                     created_at  DATETIME NOT NULL,
+                                     PRIMARY KEY (org_id, user_id)
+);
+
+CREATE TABLE IF NOT EXISTS membership_roles (
+                                     org_id      INTEGER NOT NULL,
+                                     user_id     INTEGER NOT NULL,
+                                     role_id     INTEGER NOT NULL REFERENCES roles(id) ON DELETE CASCADE,
+                                     PRIMARY KEY (org_id, user_id, role_id),
+                                     FOREIGN KEY (org_id, user_id) REFERENCES memberships(org_id, user_id) ON DELETE CASCADE
+);
+
+CREATE INDEX IF NOT EXISTS idx_memberships_user_id ON memberships(user_id);
+
+-- global roles are assigned to users platform wide, org roles only within organizations
+ALTER TABLE roles ADD COLUMN scope TEXT NOT NULL DEFAULT 'global';
+
+ALTER TABLE sessions ADD COLUMN org_id INTEGER;
+
+INSERT INTO roles(name, description, scope) VALUES
+    ('org_admin', 'Manages members of the organization', 'org'),
+    ('org_member', 'Member of the organization', 'org');
+INSERT INTO permissions(name) VALUES ('org:members:read'), ('org:members:write');
+INSERT INTO role_permissions(role_id, permission_id)
+SELECT r.id, p.id FROM roles r, permissions p
+WHERE (r.name = 'org_admin' AND p.name IN ('org:members:read', 'org:members:write'))
+   OR (r.name = 'org_member' AND p.name = 'org:members:read');
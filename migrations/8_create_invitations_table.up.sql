@@ -0,0 +1,14 @@
+CREATE TABLE IF NOT EXISTS invitations (
+                                     id          INTEGER PRIMARY KEY AUTOINCREMENT,
+                                     org_id      INTEGER NOT NULL REFERENCES organizations(id) ON DELETE CASCADE,
+                                     email       TEXT NOT NULL,
+                                     roles       TEXT NOT NULL,
+                                     token_hash  TEXT NOT NULL UNIQUE,
+                                     invited_by  INTEGER NOT NULL,
+                                     created_at  DATETIME NOT NULL,
+                                     expires_at  DATETIME NOT NULL,
+                                     accepted_at DATETIME,
+                                     revoked_at  DATETIME
+);
+
+CREATE INDEX IF NOT EXISTS idx_invitations_org_id_email ON invitations(org_id, email);
@@ -0,0 +1,5 @@
+DELETE FROM permissions WHERE name IN ('org:groups:read', 'org:groups:write');
+DROP TABLE IF EXISTS group_roles;
+DROP TABLE IF EXISTS group_subgroups;
+DROP TABLE IF EXISTS group_members;
+DROP TABLE IF EXISTS groups;
@@ -0,0 +1,35 @@
+CREATE TABLE IF NOT EXISTS groups (
+                                     id          INTEGER PRIMARY KEY AUTOINCREMENT,
+                                     org_id      INTEGER NOT NULL REFERENCES organizations(id) ON DELETE CASCADE,
+                                     name        TEXT NOT NULL,
+                                     created_at  DATETIME NOT NULL,
+                                     UNIQUE (org_id, name)
+);
+
+CREATE TABLE IF NOT EXISTS group_members (
+                                     group_id    INTEGER NOT NULL REFERENCES groups(id) ON DELETE CASCADE,
+                                     user_id     INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+                                     PRIMARY KEY (group_id, user_id)
+);
+
+-- child groups are members of parent groups, members of a child group are transitively members of its parents
+CREATE TABLE IF NOT EXISTS group_subgroups (
+                                     parent_id   INTEGER NOT NULL REFERENCES groups(id) ON DELETE CASCADE,
+                                     child_id    INTEGER NOT NULL REFERENCES groups(id) ON DELETE CASCADE,
+                                     PRIMARY KEY (parent_id, child_id)
+);
+
+CREATE TABLE IF NOT EXISTS group_roles (
+                                     group_id    INTEGER NOT NULL REFERENCES groups(id) ON DELETE CASCADE,
+                                     role_id     INTEGER NOT NULL REFERENCES roles(id) ON DELETE CASCADE,
+                                     PRIMARY KEY (group_id, role_id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_group_members_user_id ON group_members(user_id);
+CREATE INDEX IF NOT EXISTS idx_group_subgroups_child_id ON group_subgroups(child_id);
+
+INSERT INTO permissions(name) VALUES ('org:groups:read'), ('org:groups:write');
+INSERT INTO role_permissions(role_id, permission_id)
+SELECT r.id, p.id FROM roles r, permissions p
+WHERE (r.name = 'org_admin' AND p.name IN ('org:groups:read', 'org:groups:write'))
+   OR (r.name = 'org_member' AND p.name = 'org:groups:read');
@@ -0,0 +1,163 @@
+package auth
+
+import (
+	"context"
+	"fmt"
+	"github.com/golang-jwt/jwt/v5"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ClientSubjectPrefix starts sub of tokens issued to clients themselves, user subjects are numeric ids
+const ClientSubjectPrefix = "client:"
+
+// Claims are claims of access tokens issued by Manager
+type Claims struct {
+	jwt.RegisteredClaims
+	SessionID string `json:"sid,omitempty"`
+	// OrgID is the active organization of the session, 0 if none
+	OrgID uint     `json:"org_id,omitempty"`
+	Roles []string `json:"roles,omitempty"`
+	// Groups are names of the groups of the user in the active organization, if enabled
+	Groups []string `json:"groups,omitempty"`
+	// Scope is a space separated list of permissions granted to the token
+	Scope        string        `json:"scope,omitempty"`
+	Confirmation *Confirmation `json:"cnf,omitempty"`
+	// ClientID is the OAuth client the token was issued to, for tokens of the client itself sub is ClientSubjectPrefix + ClientID
+	ClientID string `json:"client_id,omitempty"`
+	// Actor identifies the service acting on behalf of the subject in tokens issued by token exchange
+	Actor *Actor `json:"act,omitempty"`
+}
+
+// Actor is the act claim (RFC 8693 section 4.1), Actor of the actor is the previous party in the delegation chain
+type Actor struct {
+	Subject string `json:"sub"`
+	Actor   *Actor `json:"act,omitempty"`
+}
+
+// TokenParams describe the subject of a new access token
+type TokenParams struct {
+	UserID uint
+	// ClientID is put to the client_id claim, if UserID is 0 the token is issued to the client itself
+	ClientID  string
+	SessionID string
+	OrgID     uint
+	Roles     []string
+	Groups    []string
+	// Permissions are put to the scope claim
+	Permissions []string
+	// DPoPJKT binds the token to the DPoP key with this thumbprint, empty for bearer tokens
+	DPoPJKT string
+	// Audience replaces the configured audience if set
+	Audience []string
+	// Actor is put to the act claim
+	Actor *Actor
+	// TTL replaces the configured lifetime of the token if set
+	TTL time.Duration
+}
+
+func (p TokenParams) confirmation() *Confirmation {
+	if p.DPoPJKT == "" {
+		return nil
+	}
+	return &Confirmation{JKT: p.DPoPJKT}
+}
+
+func (p TokenParams) subject() string {
+	if p.UserID == 0 && p.ClientID != "" {
+		return ClientSubjectPrefix + p.ClientID
+	}
+	return strconv.FormatUint(uint64(p.UserID), 10)
+}
+
+func (p TokenParams) audience(configured []string) []string {
+	if len(p.Audience) > 0 {
+		return p.Audience
+	}
+	return configured
+}
+
+func (p TokenParams) ttl(configured time.Duration) time.Duration {
+	if p.TTL > 0 {
+		return p.TTL
+	}
+	return configured
+}
+
+func (p TokenParams) scope() string {
+	return strings.Join(p.Permissions, " ")
+}
+
+// HasScope reports whether permission is listed in the scope claim
+func (c *Claims) HasScope(permission string) bool {
+	for _, p := range strings.Fields(c.Scope) {
+		if p == permission {
+			return true
+		}
+	}
+	return false
+}
+
+// DPoPJKT returns thumbprint of the DPoP key the token is bound to, empty for bearer tokens
+func (c *Claims) DPoPJKT() string {
+	if c.Confirmation == nil {
+		return ""
+	}
+	return c.Confirmation.JKT
+}
+
+// IsClient reports whether the token was issued to the client itself rather than to a user
+func (c *Claims) IsClient() bool {
+	return c.ClientID != "" && c.Subject == ClientSubjectPrefix+c.ClientID
+}
+
+// validateSubject checks that user tokens have a numeric sub and a sid claim, tokens of clients have no session
+func (c *Claims) validateSubject() error {
+	if c.IsClient() {
+		return nil
+	}
+	if c.SessionID == "" {
+		return fmt.Errorf("missing sid claim")
+	}
+	_, err := c.UserID()
+	return err
+}
+
+// UserID returns id of the user from the sub claim, tokens of clients have no user
+func (c *Claims) UserID() (uint, error) {
+	if c.IsClient() {
+		return 0, fmt.Errorf("token of client %s has no user", c.ClientID)
+	}
+	id, err := strconv.ParseUint(c.Subject, 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid subject %q: %w", c.Subject, err)
+	}
+	return uint(id), nil
+}
+
+type claimsCtxKey struct{}
+
+// WithClaims returns a copy of ctx which carries token claims
+func WithClaims(ctx context.Context, claims *Claims) context.Context {
+	return context.WithValue(ctx, claimsCtxKey{}, claims)
+}
+
+// ClaimsFromContext returns token claims stored in ctx by WithClaims
+func ClaimsFromContext(ctx context.Context) (*Claims, bool) {
+	claims, ok := ctx.Value(claimsCtxKey{}).(*Claims)
+	return claims, ok
+}
+
+// UserIDFromContext returns id of the authenticated user stored in ctx by WithClaims
+func UserIDFromContext(ctx context.Context) (uint, bool) {
+	claims, ok := ClaimsFromContext(ctx)
+	if !ok {
+		return 0, false
+	}
+	id, err := claims.UserID()
+	if err != nil {
+		return 0, false
+	}
+	return id, true
+}
@@ -0,0 +1,52 @@
+package auth
+
+import (
+	"github.com/golang-jwt/jwt/v5"
+	"testing"
+	"time"
+)
+
+func TestClaims_IsClient(t *testing.T) {
+	key, err := GenerateSigningKey(jwt.SigningMethodES256)
+	if err != nil {
+		t.Fatalf("GenerateSigningKey: %v", err)
+	}
+	manager := NewManager(NewKeyring(key, time.Hour), ManagerConfig{TokenTTL: time.Minute, Issuer: "https://auth"})
+
+	tests := []struct {
+		name       string
+		params     TokenParams
+		wantClient bool
+		wantUserID uint
+	}{
+		{name: "token of the client", params: TokenParams{ClientID: "42"}, wantClient: true},
+		// client id equal to the user id must not make the user token a token of the client
+		{name: "user token of a client with numeric id", params: TokenParams{UserID: 42, ClientID: "42", SessionID: "s"}, wantUserID: 42},
+		{name: "user token", params: TokenParams{UserID: 7, SessionID: "s"}, wantUserID: 7},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			token, err := manager.NewAccessToken(tt.params)
+			if err != nil {
+				t.Fatalf("NewAccessToken: %v", err)
+			}
+			claims, err := manager.Parse(token)
+			if err != nil {
+				t.Fatalf("Parse: %v", err)
+			}
+			if claims.IsClient() != tt.wantClient {
+				t.Fatalf("got IsClient %v, want %v", claims.IsClient(), tt.wantClient)
+			}
+			userID, err := claims.UserID()
+			if tt.wantClient {
+				if err == nil {
+					t.Fatalf("token of the client has user %d", userID)
+				}
+				return
+			}
+			if err != nil || userID != tt.wantUserID {
+				t.Fatalf("got user %d, error %v, want user %d", userID, err, tt.wantUserID)
+			}
+		})
+	}
+}
@@ -0,0 +1,163 @@
+package auth
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/golang-jwt/jwt/v5"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+var ErrInvalidDPoPProof = errors.New("invalid DPoP proof")
+
+// dpopAlgorithms are asymmetric algorithms accepted for DPoP proofs
+var dpopAlgorithms = []string{
+	jwt.SigningMethodRS256.Alg(),
+	jwt.SigningMethodES256.Alg(),
+	jwt.SigningMethodES384.Alg(),
+	jwt.SigningMethodES512.Alg(),
+	jwt.SigningMethodEdDSA.Alg(),
+}
+
+// Confirmation is the cnf claim binding token to the DPoP key by its RFC 7638 thumbprint
+type Confirmation struct {
+	JKT string `json:"jkt"`
+}
+
+type dpopClaims struct {
+	jwt.RegisteredClaims
+	HTM string `json:"htm"`
+	HTU string `json:"htu"`
+	ATH string `json:"ath,omitempty"`
+}
+
+// DPoPVerifier verifies DPoP proofs (RFC 9449) and rejects replayed ones
+type DPoPVerifier struct {
+	maxAge time.Duration
+	leeway time.Duration
+	replay *ReplayCache
+}
+
+// NewDPoPVerifier creates verifier accepting proofs issued not earlier than maxAge ago
+func NewDPoPVerifier(maxAge, leeway time.Duration) *DPoPVerifier {
+	return &DPoPVerifier{maxAge: maxAge, leeway: leeway, replay: NewReplayCache()}
+}
+
+// Verify verifies DPoP proof for the request method and url and returns thumbprint of the proof key.
+// If accessToken is not empty, the proof must contain its hash in the ath claim
+func (v *DPoPVerifier) Verify(proof, method, requestURL, accessToken string) (string, error) {
+	var jkt string
+	var claims dpopClaims
+	token, err := jwt.ParseWithClaims(proof, &claims, func(token *jwt.Token) (interface{}, error) {
+		if typ, _ := token.Header["typ"].(string); typ != "dpop+jwt" {
+			return nil, fmt.Errorf("unexpected typ %q", typ)
+		}
+		jwk, err := headerJWK(token.Header["jwk"])
+		if err != nil {
+			return nil, err
+		}
+		if jkt, err = jwk.Thumbprint(); err != nil {
+			return nil, err
+		}
+		return jwk.PublicKey()
+	}, jwt.WithValidMethods(dpopAlgorithms), jwt.WithIssuedAt(), jwt.WithLeeway(v.leeway))
+	if err != nil || !token.Valid {
+		return "", fmt.Errorf("%w: %w", ErrInvalidDPoPProof, err)
+	}
+
+	now := time.Now()
+	switch {
+	case claims.ID == "":
+		return "", fmt.Errorf("%w: missing jti", ErrInvalidDPoPProof)
+	case claims.IssuedAt == nil || now.Sub(claims.IssuedAt.Time) > v.maxAge:
+		return "", fmt.Errorf("%w: iat is missing or too old", ErrInvalidDPoPProof)
+	case !strings.EqualFold(claims.HTM, method):
+		return "", fmt.Errorf("%w: htm %q does not match %s", ErrInvalidDPoPProof, claims.HTM, method)
+	case !sameURL(claims.HTU, requestURL):
+		return "", fmt.Errorf("%w: htu %q does not match %s", ErrInvalidDPoPProof, claims.HTU, requestURL)
+	}
+	if accessToken != "" {
+		sum := sha256.Sum256([]byte(accessToken))
+		if claims.ATH != base64.RawURLEncoding.EncodeToString(sum[:]) {
+			return "", fmt.Errorf("%w: ath does not match access token", ErrInvalidDPoPProof)
+		}
+	}
+
+	if v.replay.Seen(jkt+":"+claims.ID, claims.IssuedAt.Add(v.maxAge+v.leeway)) {
+		return "", fmt.Errorf("%w: proof replayed", ErrInvalidDPoPProof)
+	}
+	return jkt, nil
+}
+
+// headerJWK returns public JWK from the proof header, keys with private members are rejected
+func headerJWK(raw interface{}) (JWK, error) {
+	members, ok := raw.(map[string]interface{})
+	if !ok {
+		return JWK{}, errors.New("missing jwk header")
+	}
+	for _, private := range []string{"d", "p", "q", "dp", "dq", "qi", "k"} {
+		if _, ok := members[private]; ok {
+			return JWK{}, errors.New("jwk header contains private key")
+		}
+	}
+	data, err := json.Marshal(members)
+	if err != nil {
+		return JWK{}, err
+	}
+	var jwk JWK
+	if err := json.Unmarshal(data, &jwk); err != nil {
+		return JWK{}, err
+	}
+	return jwk, nil
+}
+
+// sameURL compares urls without query and fragment as required for htu
+func sameURL(htu, requestURL string) bool {
+	a, err := url.Parse(htu)
+	if err != nil {
+		return false
+	}
+	b, err := url.Parse(requestURL)
+	if err != nil {
+		return false
+	}
+	return strings.EqualFold(a.Scheme, b.Scheme) && strings.EqualFold(a.Host, b.Host) && a.Path == b.Path
+}
+
+// ReplayCache remembers keys until they expire, it is used to reject reused one-time values
+type ReplayCache struct {
+	mu      sync.Mutex
+	seen    map[string]time.Time
+	inserts int
+}
+
+func NewReplayCache() *ReplayCache {
+	return &ReplayCache{seen: make(map[string]time.Time)}
+}
+
+// Seen reports whether key was already seen and not expired, otherwise remembers it until expiresAt
+func (c *ReplayCache) Seen(key string, expiresAt time.Time) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	now := time.Now()
+	if exp, ok := c.seen[key]; ok && now.Before(exp) {
+		return true
+	}
+	c.seen[key] = expiresAt
+
+	c.inserts++
+	if c.inserts%1000 == 0 {
+		for k, exp := range c.seen {
+			if !now.Before(exp) {
+				delete(c.seen, k)
+			}
+		}
+	}
+	return false
+}
@@ -0,0 +1,164 @@
+package auth
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"github.com/golang-jwt/jwt/v5"
+	"testing"
+	"time"
+)
+
+const (
+	dpopTestMethod = "POST"
+	dpopTestURL    = "https://auth.example.com/user/token/refresh"
+)
+
+// newDPoPProof returns a proof for dpopTestMethod and dpopTestURL signed by key, edit changes claims and header
+func newDPoPProof(t *testing.T, key *SigningKey, edit func(claims jwt.MapClaims, header map[string]interface{})) string {
+	t.Helper()
+	jwk, ok := key.JWK()
+	if !ok {
+		t.Fatal("key has no public JWK")
+	}
+	jti, err := RandomString(16)
+	if err != nil {
+		t.Fatalf("RandomString: %v", err)
+	}
+	claims := jwt.MapClaims{"jti": jti, "htm": dpopTestMethod, "htu": dpopTestURL, "iat": time.Now().Unix()}
+	token := jwt.NewWithClaims(key.Method, claims)
+	token.Header["typ"] = "dpop+jwt"
+	token.Header["jwk"] = jwk
+	if edit != nil {
+		edit(claims, token.Header)
+	}
+	proof, err := token.SignedString(key.private)
+	if err != nil {
+		t.Fatalf("SignedString: %v", err)
+	}
+	return proof
+}
+
+func accessTokenHash(accessToken string) string {
+	sum := sha256.Sum256([]byte(accessToken))
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
+
+func TestDPoPVerifier_Verify(t *testing.T) {
+	key, err := GenerateSigningKey(jwt.SigningMethodES256)
+	if err != nil {
+		t.Fatalf("GenerateSigningKey: %v", err)
+	}
+	jwk, _ := key.JWK()
+	thumbprint, err := jwk.Thumbprint()
+	if err != nil {
+		t.Fatalf("Thumbprint: %v", err)
+	}
+
+	tests := []struct {
+		name        string
+		edit        func(claims jwt.MapClaims, header map[string]interface{})
+		method      string
+		url         string
+		accessToken string
+		wantErr     bool
+	}{
+		{name: "valid proof"},
+		{name: "method is case insensitive", method: "post"},
+		{name: "htu ignores query and fragment", url: dpopTestURL + "?a=b#c"},
+		{name: "another method", method: "GET", wantErr: true},
+		{name: "another path", url: "https://auth.example.com/oauth/token", wantErr: true},
+		{name: "another host", url: "https://evil.example.com/user/token/refresh", wantErr: true},
+		{name: "another scheme", url: "http://auth.example.com/user/token/refresh", wantErr: true},
+		{name: "iat too old", edit: func(claims jwt.MapClaims, _ map[string]interface{}) {
+			claims["iat"] = time.Now().Add(-10 * time.Minute).Unix()
+		}, wantErr: true},
+		{name: "iat in the future", edit: func(claims jwt.MapClaims, _ map[string]interface{}) {
+			claims["iat"] = time.Now().Add(10 * time.Minute).Unix()
+		}, wantErr: true},
+		{name: "missing iat", edit: func(claims jwt.MapClaims, _ map[string]interface{}) {
+			delete(claims, "iat")
+		}, wantErr: true},
+		{name: "missing jti", edit: func(claims jwt.MapClaims, _ map[string]interface{}) {
+			delete(claims, "jti")
+		}, wantErr: true},
+		{name: "ath of the access token", edit: func(claims jwt.MapClaims, _ map[string]interface{}) {
+			claims["ath"] = accessTokenHash("access-token")
+		}, accessToken: "access-token"},
+		{name: "ath of another access token", edit: func(claims jwt.MapClaims, _ map[string]interface{}) {
+			claims["ath"] = accessTokenHash("another-token")
+		}, accessToken: "access-token", wantErr: true},
+		{name: "missing ath", accessToken: "access-token", wantErr: true},
+		{name: "wrong typ", edit: func(_ jwt.MapClaims, header map[string]interface{}) {
+			header["typ"] = "JWT"
+		}, wantErr: true},
+		{name: "missing jwk", edit: func(_ jwt.MapClaims, header map[string]interface{}) {
+			delete(header, "jwk")
+		}, wantErr: true},
+		{name: "jwk with private key", edit: func(_ jwt.MapClaims, header map[string]interface{}) {
+			header["jwk"] = map[string]interface{}{"kty": jwk.Kty, "crv": jwk.Crv, "x": jwk.X, "y": jwk.Y, "d": "secret"}
+		}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			verifier := NewDPoPVerifier(5*time.Minute, 30*time.Second)
+			method, url := tt.method, tt.url
+			if method == "" {
+				method = dpopTestMethod
+			}
+			if url == "" {
+				url = dpopTestURL
+			}
+
+			jkt, err := verifier.Verify(newDPoPProof(t, key, tt.edit), method, url, tt.accessToken)
+			if tt.wantErr {
+				if !errors.Is(err, ErrInvalidDPoPProof) {
+					t.Fatalf("got error %v, want ErrInvalidDPoPProof", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Verify: %v", err)
+			}
+			if jkt != thumbprint {
+				t.Fatalf("got thumbprint %s, want %s", jkt, thumbprint)
+			}
+		})
+	}
+}
+
+func TestDPoPVerifier_RejectsReplay(t *testing.T) {
+	key, err := GenerateSigningKey(jwt.SigningMethodES256)
+	if err != nil {
+		t.Fatalf("GenerateSigningKey: %v", err)
+	}
+	verifier := NewDPoPVerifier(5*time.Minute, 30*time.Second)
+	proof := newDPoPProof(t, key, nil)
+
+	if _, err := verifier.Verify(proof, dpopTestMethod, dpopTestURL, ""); err != nil {
+		t.Fatalf("first use: %v", err)
+	}
+	if _, err := verifier.Verify(proof, dpopTestMethod, dpopTestURL, ""); !errors.Is(err, ErrInvalidDPoPProof) {
+		t.Fatalf("replay: got error %v, want ErrInvalidDPoPProof", err)
+	}
+	if _, err := verifier.Verify(newDPoPProof(t, key, nil), dpopTestMethod, dpopTestURL, ""); err != nil {
+		t.Fatalf("new proof of the same key: %v", err)
+	}
+}
+
+func TestDPoPVerifier_RejectsSymmetricProof(t *testing.T) {
+	key := NewHMACKey("hmac", []byte("secret"))
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
+		"jti": "id", "htm": dpopTestMethod, "htu": dpopTestURL, "iat": time.Now().Unix(),
+	})
+	token.Header["typ"] = "dpop+jwt"
+	token.Header["jwk"] = map[string]interface{}{"kty": "oct", "k": "c2VjcmV0"}
+	proof, err := token.SignedString(key.private)
+	if err != nil {
+		t.Fatalf("SignedString: %v", err)
+	}
+	if _, err := NewDPoPVerifier(time.Minute, 0).Verify(proof, dpopTestMethod, dpopTestURL, ""); !errors.Is(err, ErrInvalidDPoPProof) {
+		t.Fatalf("got error %v, want ErrInvalidDPoPProof", err)
+	}
+}
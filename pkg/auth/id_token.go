@@ -0,0 +1,72 @@
+package auth
+
+import (
+	"fmt"
+	"github.com/golang-jwt/jwt/v5"
+	"strconv"
+	"time"
+)
+
+// IDTokenClaims are claims of OpenID Connect ID tokens issued by Manager
+type IDTokenClaims struct {
+	jwt.RegisteredClaims
+	Nonce string `json:"nonce,omitempty"`
+	// AuthorizedParty is the client the token was issued to
+	AuthorizedParty string `json:"azp,omitempty"`
+	Name            string `json:"name,omitempty"`
+	Email           string `json:"email,omitempty"`
+	EmailVerified   *bool  `json:"email_verified,omitempty"`
+	PhoneNumber     string `json:"phone_number,omitempty"`
+	Birthdate       string `json:"birthdate,omitempty"`
+}
+
+// IDTokenParams describe the user and the client of a new ID token, empty profile claims are omitted
+type IDTokenParams struct {
+	UserID uint
+	// ClientID is put to the aud and azp claims
+	ClientID      string
+	Nonce         string
+	Name          string
+	Email         string
+	EmailVerified *bool
+	PhoneNumber   string
+	Birthdate     string
+}
+
+// NewIDToken returns OpenID Connect ID token signed by the active key of the keyring. ID tokens are always JWT,
+// clients verify them with keys published in JWKS, so symmetric keys are refused with ErrUnsupportedKey
+func (m *Manager) NewIDToken(params IDTokenParams) (string, error) {
+	now := time.Now()
+	key := m.keyring.Active()
+	if key.Symmetric() {
+		return "", fmt.Errorf("%w: ID tokens can not be signed with symmetric key %q", ErrUnsupportedKey, key.ID)
+	}
+	token := jwt.NewWithClaims(key.Method, IDTokenClaims{
+		RegisteredClaims: jwt.RegisteredClaims{
+			Issuer:    m.cfg.Issuer,
+			Subject:   strconv.FormatUint(uint64(params.UserID), 10),
+			Audience:  jwt.ClaimStrings{params.ClientID},
+			IssuedAt:  jwt.NewNumericDate(now),
+			ExpiresAt: jwt.NewNumericDate(now.Add(m.cfg.TokenTTL)),
+		},
+		Nonce:           params.Nonce,
+		AuthorizedParty: params.ClientID,
+		Name:            params.Name,
+		Email:           params.Email,
+		EmailVerified:   params.EmailVerified,
+		PhoneNumber:     params.PhoneNumber,
+		Birthdate:       params.Birthdate,
+	})
+	token.Header["kid"] = key.ID
+
+	return token.SignedString(key.private)
+}
+
+// IDTokenSigningAlgorithms returns alg of the active key which signs ID tokens, none if the key is symmetric
+func (m *Manager) IDTokenSigningAlgorithms() []string {
+	key := m.keyring.Active()
+	if key.Symmetric() {
+		return nil
+	}
+	return []string{key.Method.Alg()}
+}
@@ -0,0 +1,40 @@
+package auth
+
+import (
+	"errors"
+	"github.com/golang-jwt/jwt/v5"
+	"testing"
+	"time"
+)
+
+func TestManager_NewIDTokenRequiresAsymmetricKey(t *testing.T) {
+	hmac := NewManager(NewKeyring(NewHMACKey("hmac", []byte("secret")), time.Hour), ManagerConfig{TokenTTL: time.Minute, Issuer: "https://auth"})
+	if _, err := hmac.NewIDToken(IDTokenParams{UserID: 1, ClientID: "app"}); !errors.Is(err, ErrUnsupportedKey) {
+		t.Fatalf("HS256: got error %v, want ErrUnsupportedKey", err)
+	}
+	if algorithms := hmac.IDTokenSigningAlgorithms(); len(algorithms) != 0 {
+		t.Fatalf("HS256: got algorithms %v, want none", algorithms)
+	}
+
+	key, err := GenerateSigningKey(jwt.SigningMethodES256)
+	if err != nil {
+		t.Fatalf("GenerateSigningKey: %v", err)
+	}
+	ec := NewManager(NewKeyring(key, time.Hour), ManagerConfig{TokenTTL: time.Minute, Issuer: "https://auth"})
+	token, err := ec.NewIDToken(IDTokenParams{UserID: 1, ClientID: "app", Nonce: "n"})
+	if err != nil {
+		t.Fatalf("NewIDToken: %v", err)
+	}
+	var claims IDTokenClaims
+	_, err = jwt.ParseWithClaims(token, &claims, func(*jwt.Token) (interface{}, error) { return key.public, nil },
+		jwt.WithValidMethods([]string{"ES256"}), jwt.WithAudience("app"), jwt.WithIssuer("https://auth"))
+	if err != nil {
+		t.Fatalf("ParseWithClaims: %v", err)
+	}
+	if claims.Subject != "1" || claims.Nonce != "n" || claims.AuthorizedParty != "app" {
+		t.Fatalf("got claims %+v", claims)
+	}
+	if algorithms := ec.IDTokenSigningAlgorithms(); len(algorithms) != 1 || algorithms[0] != "ES256" {
+		t.Fatalf("ES256: got algorithms %v", algorithms)
+	}
+}
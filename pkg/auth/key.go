@@ -0,0 +1,177 @@
+package auth
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"github.com/golang-jwt/jwt/v5"
+	"os"
+)
+
+var ErrUnsupportedKey = errors.New("unsupported key type")
+
+// SigningKey is a key used to sign and verify tokens. For asymmetric keys only the public part is used for verification
+type SigningKey struct {
+	ID     string
+	Method jwt.SigningMethod
+	// private is []byte secret for HMAC or crypto.Signer for asymmetric keys
+	private interface{}
+	// public is []byte secret for HMAC or crypto.PublicKey for asymmetric keys
+	public interface{}
+}
+
+// NewHMACKey returns HS256 key from shared secret
+func NewHMACKey(id string, secret []byte) *SigningKey {
+	return &SigningKey{ID: id, Method: jwt.SigningMethodHS256, private: secret, public: secret}
+}
+
+// NewSigningKey returns key for RSA (RS256), ECDSA (ES256, ES384, ES512 depending on curve) or Ed25519 (EdDSA) private key.
+// If id is empty, RFC 7638 thumbprint of the public key is used as key id
+func NewSigningKey(id string, private crypto.Signer) (*SigningKey, error) {
+	key, err := NewVerificationKey(id, private.Public())
+	if err != nil {
+		return nil, err
+	}
+	key.private = private
+	return key, nil
+}
+
+// NewVerificationKey returns key which can only verify tokens signed by the matching private key.
+// If id is empty, RFC 7638 thumbprint of the public key is used as key id
+func NewVerificationKey(id string, public crypto.PublicKey) (*SigningKey, error) {
+	var method jwt.SigningMethod
+	switch k := public.(type) {
+	case *rsa.PublicKey:
+		method = jwt.SigningMethodRS256
+	case *ecdsa.PublicKey:
+		switch k.Curve {
+		case elliptic.P256():
+			method = jwt.SigningMethodES256
+		case elliptic.P384():
+			method = jwt.SigningMethodES384
+		case elliptic.P521():
+			method = jwt.SigningMethodES512
+		default:
+			return nil, fmt.Errorf("%w: ecdsa curve %s", ErrUnsupportedKey, k.Curve.Params().Name)
+		}
+	case ed25519.PublicKey:
+		method = jwt.SigningMethodEdDSA
+	default:
+		return nil, fmt.Errorf("%w: %T", ErrUnsupportedKey, public)
+	}
+
+	key := &SigningKey{ID: id, Method: method, public: public}
+	if key.ID == "" {
+		jwk, _ := key.JWK()
+		thumbprint, err := jwk.Thumbprint()
+		if err != nil {
+			return nil, err
+		}
+		key.ID = thumbprint
+	}
+	return key, nil
+}
+
+// ParsePrivateKeyPEM parses PKCS#8, PKCS#1 (RSA) or SEC 1 (EC) PEM encoded private key
+func ParsePrivateKeyPEM(id string, data []byte) (*SigningKey, error) {
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, errors.New("failed to decode PEM block")
+	}
+
+	var private interface{}
+	var err error
+	switch block.Type {
+	case "RSA PRIVATE KEY":
+		private, err = x509.ParsePKCS1PrivateKey(block.Bytes)
+	case "EC PRIVATE KEY":
+		private, err = x509.ParseECPrivateKey(block.Bytes)
+	case "PRIVATE KEY":
+		private, err = x509.ParsePKCS8PrivateKey(block.Bytes)
+	default:
+		return nil, fmt.Errorf("%w: PEM block %q", ErrUnsupportedKey, block.Type)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("x509.Parse: %w", err)
+	}
+
+	signer, ok := private.(crypto.Signer)
+	if !ok {
+		return nil, fmt.Errorf("%w: %T", ErrUnsupportedKey, private)
+	}
+	return NewSigningKey(id, signer)
+}
+
+// LoadPrivateKeyFile reads PEM encoded private key from file
+func LoadPrivateKeyFile(id, path string) (*SigningKey, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("os.ReadFile: %w", err)
+	}
+	return ParsePrivateKeyPEM(id, data)
+}
+
+// ParsePublicKeyPEM parses PKIX or PKCS#1 (RSA) PEM encoded public key into verification only key
+func ParsePublicKeyPEM(id string, data []byte) (*SigningKey, error) {
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, errors.New("failed to decode PEM block")
+	}
+
+	var public interface{}
+	var err error
+	switch block.Type {
+	case "RSA PUBLIC KEY":
+		public, err = x509.ParsePKCS1PublicKey(block.Bytes)
+	case "PUBLIC KEY":
+		public, err = x509.ParsePKIXPublicKey(block.Bytes)
+	default:
+		return nil, fmt.Errorf("%w: PEM block %q", ErrUnsupportedKey, block.Type)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("x509.Parse: %w", err)
+	}
+	return NewVerificationKey(id, public)
+}
+
+// LoadPublicKeyFile reads PEM encoded public key from file
+func LoadPublicKeyFile(id, path string) (*SigningKey, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("os.ReadFile: %w", err)
+	}
+	return ParsePublicKeyPEM(id, data)
+}
+
+// CanSign reports whether key has a private part and can be used to sign tokens
+func (k *SigningKey) CanSign() bool {
+	return k.private != nil
+}
+
+// Symmetric reports whether key is a shared secret which must not be published
+func (k *SigningKey) Symmetric() bool {
+	_, ok := k.public.([]byte)
+	return ok
+}
+
+// JWK returns public part of the key in JWK format, false is returned for symmetric keys
+func (k *SigningKey) JWK() (JWK, bool) {
+	jwk := JWK{Kid: k.ID, Use: "sig", Alg: k.Method.Alg()}
+	switch pub := k.public.(type) {
+	case *rsa.PublicKey:
+		jwk.setRSA(pub)
+	case *ecdsa.PublicKey:
+		jwk.setECDSA(pub)
+	case ed25519.PublicKey:
+		jwk.setEd25519(pub)
+	default:
+		return JWK{}, false
+	}
+	return jwk, true
+}
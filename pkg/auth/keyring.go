@@ -0,0 +1,157 @@
+package auth
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"errors"
+	"fmt"
+	"github.com/golang-jwt/jwt/v5"
+	"sync"
+	"time"
+)
+
+// Keyring holds the active signing key and previous keys which are still accepted for verification
+// until they retire, so tokens signed before rotation stay valid during the overlap window
+type Keyring struct {
+	mu               sync.RWMutex
+	active           *SigningKey
+	previous         []retiringKey
+	retirementPeriod time.Duration
+}
+
+type retiringKey struct {
+	key       *SigningKey
+	retiresAt time.Time
+}
+
+// NewKeyring creates keyring with the active key. After rotation the replaced key is accepted
+// for verification during retirementPeriod, it should be not less than the access token ttl
+func NewKeyring(active *SigningKey, retirementPeriod time.Duration) *Keyring {
+	return &Keyring{active: active, retirementPeriod: retirementPeriod}
+}
+
+// AddVerificationKey adds verification only key which is accepted until retiresAt
+func (k *Keyring) AddVerificationKey(key *SigningKey, retiresAt time.Time) error {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	if k.hasKeyID(key.ID) {
+		return fmt.Errorf("duplicate key id %q", key.ID)
+	}
+	k.previous = append(k.previous, retiringKey{key: key, retiresAt: retiresAt})
+	return nil
+}
+
+// Rotate makes next the active key, the replaced one is kept for verification during retirement period
+func (k *Keyring) Rotate(next *SigningKey) error {
+	if !next.CanSign() {
+		return errors.New("active key must have a private part")
+	}
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	if k.hasKeyID(next.ID) {
+		return fmt.Errorf("duplicate key id %q", next.ID)
+	}
+
+	now := time.Now()
+	k.previous = append(k.previous, retiringKey{key: k.active, retiresAt: now.Add(k.retirementPeriod)})
+	k.active = next
+	k.pruneLocked(now)
+	return nil
+}
+
+// Active returns key used to sign new tokens
+func (k *Keyring) Active() *SigningKey {
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+	return k.active
+}
+
+// Key returns active or not retired previous key by its id
+func (k *Keyring) Key(kid string) (*SigningKey, bool) {
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+	if k.active.ID == kid {
+		return k.active, true
+	}
+	now := time.Now()
+	for _, p := range k.previous {
+		if p.key.ID == kid && now.Before(p.retiresAt) {
+			return p.key, true
+		}
+	}
+	return nil, false
+}
+
+// Keys returns active and not retired previous keys, the active key goes first
+func (k *Keyring) Keys() []*SigningKey {
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+	now := time.Now()
+	keys := []*SigningKey{k.active}
+	for _, p := range k.previous {
+		if now.Before(p.retiresAt) {
+			keys = append(keys, p.key)
+		}
+	}
+	return keys
+}
+
+func (k *Keyring) hasKeyID(kid string) bool {
+	if k.active.ID == kid {
+		return true
+	}
+	for _, p := range k.previous {
+		if p.key.ID == kid {
+			return true
+		}
+	}
+	return false
+}
+
+func (k *Keyring) pruneLocked(now time.Time) {
+	previous := k.previous[:0]
+	for _, p := range k.previous {
+		if now.Before(p.retiresAt) {
+			previous = append(previous, p)
+		}
+	}
+	k.previous = previous
+}
+
+// GenerateSigningKey generates a new random key for the signing method: HS256, RS256, ES256, ES384, ES512 or EdDSA
+func GenerateSigningKey(method jwt.SigningMethod) (*SigningKey, error) {
+	var private crypto.Signer
+	var err error
+	switch method.Alg() {
+	case jwt.SigningMethodHS256.Alg():
+		id, err := RandomString(16)
+		if err != nil {
+			return nil, err
+		}
+		secret := make([]byte, 32)
+		if _, err := rand.Read(secret); err != nil {
+			return nil, fmt.Errorf("rand.Read: %w", err)
+		}
+		return NewHMACKey(id, secret), nil
+	case jwt.SigningMethodRS256.Alg():
+		private, err = rsa.GenerateKey(rand.Reader, 2048)
+	case jwt.SigningMethodES256.Alg():
+		private, err = ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	case jwt.SigningMethodES384.Alg():
+		private, err = ecdsa.GenerateKey(elliptic.P384(), rand.Reader)
+	case jwt.SigningMethodES512.Alg():
+		private, err = ecdsa.GenerateKey(elliptic.P521(), rand.Reader)
+	case jwt.SigningMethodEdDSA.Alg():
+		_, private, err = ed25519.GenerateKey(rand.Reader)
+	default:
+		return nil, fmt.Errorf("%w: signing method %s", ErrUnsupportedKey, method.Alg())
+	}
+	if err != nil {
+		return nil, fmt.Errorf("generate key: %w", err)
+	}
+	return NewSigningKey("", private)
+}
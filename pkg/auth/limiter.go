@@ -0,0 +1,63 @@
+package auth
+
+import (
+	"sync"
+	"time"
+)
+
+// AttemptLimiter counts failed attempts per key in fixed windows, it is used to slow down guessing of short codes
+type AttemptLimiter struct {
+	mu       sync.Mutex
+	max      int
+	window   time.Duration
+	attempts map[string]attemptWindow
+	inserts  int
+}
+
+type attemptWindow struct {
+	start    time.Time
+	failures int
+}
+
+// NewAttemptLimiter creates limiter allowing max failed attempts per window, max 0 disables the limit
+func NewAttemptLimiter(max int, window time.Duration) *AttemptLimiter {
+	return &AttemptLimiter{max: max, window: window, attempts: make(map[string]attemptWindow)}
+}
+
+// Allow reports whether key has failed less than max times in the current window
+func (l *AttemptLimiter) Allow(key string) bool {
+	if l.max <= 0 {
+		return true
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	a, ok := l.attempts[key]
+	return !ok || time.Since(a.start) >= l.window || a.failures < l.max
+}
+
+// Fail counts a failed attempt of key
+func (l *AttemptLimiter) Fail(key string) {
+	if l.max <= 0 {
+		return
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := time.Now()
+	a, ok := l.attempts[key]
+	if !ok || now.Sub(a.start) >= l.window {
+		a = attemptWindow{start: now}
+		l.inserts++
+	}
+	a.failures++
+	l.attempts[key] = a
+
+	if l.inserts%1000 == 0 {
+		for k, a := range l.attempts {
+			if now.Sub(a.start) >= l.window {
+				delete(l.attempts, k)
+			}
+		}
+	}
+}
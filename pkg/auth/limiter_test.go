@@ -0,0 +1,32 @@
+package auth
+
+import (
+	"testing"
+	"time"
+)
+
+func TestAttemptLimiter(t *testing.T) {
+	limiter := NewAttemptLimiter(2, 50*time.Millisecond)
+	for i := 0; i < 2; i++ {
+		if !limiter.Allow("user") {
+			t.Fatalf("attempt %d was not allowed", i+1)
+		}
+		limiter.Fail("user")
+	}
+	if limiter.Allow("user") {
+		t.Fatal("attempt after max failures was allowed")
+	}
+	if !limiter.Allow("other") {
+		t.Fatal("failures of another key are counted")
+	}
+	time.Sleep(60 * time.Millisecond)
+	if !limiter.Allow("user") {
+		t.Fatal("attempt in the next window was not allowed")
+	}
+
+	disabled := NewAttemptLimiter(0, time.Minute)
+	disabled.Fail("user")
+	if !disabled.Allow("user") {
+		t.Fatal("disabled limiter denied attempt")
+	}
+}
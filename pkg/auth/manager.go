@@ -1,28 +1,162 @@
 package auth
 
 import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
 	"github.com/golang-jwt/jwt/v5"
 	"time"
 )
 
+var ErrInvalidToken = errors.New("invalid token")
+
+// TokenManager issues and parses access tokens, implemented by Manager for JWT and PasetoManager for PASETO
 type TokenManager interface {
-	NewJWT(userID uint) (string, error)
+	NewAccessToken(params TokenParams) (string, error)
+	NewRefreshToken() (string, error)
+	Parse(token string) (*Claims, error)
 }
 
 type Manager struct {
-	secretKey string
-	tokenTTL  time.Duration
+	keyring *Keyring
+	cfg     ManagerConfig
+}
+
+type ManagerConfig struct {
+	TokenTTL time.Duration
+	// Issuer is put to the iss claim, tokens of other issuers are rejected
+	Issuer string
+	// Audience is put to the aud claim, tokens for none of these audiences are rejected.
+	// If empty, only tokens without aud claim are accepted
+	Audience []string
+	// Leeway is the allowed clock skew for exp, nbf and iat validation
+	Leeway time.Duration
 }
 
-func NewManager(secretKey string, tokenTTL time.Duration) *Manager {
-	return &Manager{secretKey: secretKey, tokenTTL: tokenTTL}
+func NewManager(keyring *Keyring, cfg ManagerConfig) *Manager {
+	return &Manager{keyring: keyring, cfg: cfg}
 }
 
-func (m *Manager) NewJWT(userID uint) (string, error) {
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
-		"sub": userID,
-		"exp": time.Now().Add(m.tokenTTL).Unix(),
+// NewAccessToken returns JWT signed by the active key of the keyring
+func (m *Manager) NewAccessToken(params TokenParams) (string, error) {
+	jti, err := RandomString(16)
+	if err != nil {
+		return "", err
+	}
+	now := time.Now()
+	key := m.keyring.Active()
+	token := jwt.NewWithClaims(key.Method, Claims{
+		RegisteredClaims: jwt.RegisteredClaims{
+			Issuer:    m.cfg.Issuer,
+			Subject:   params.subject(),
+			Audience:  params.audience(m.cfg.Audience),
+			ID:        jti,
+			IssuedAt:  jwt.NewNumericDate(now),
+			NotBefore: jwt.NewNumericDate(now),
+			ExpiresAt: jwt.NewNumericDate(now.Add(params.ttl(m.cfg.TokenTTL))),
+		},
+		SessionID:    params.SessionID,
+		OrgID:        params.OrgID,
+		Roles:        params.Roles,
+		Groups:       params.Groups,
+		Scope:        params.scope(),
+		Confirmation: params.confirmation(),
+		ClientID:     params.ClientID,
+		Actor:        params.Actor,
 	})
+	token.Header["kid"] = key.ID
+
+	return token.SignedString(key.private)
+}
+
+// Parse verifies token signature, exp, nbf, iat, issuer and audience and returns its claims.
+// Tokens without exp, iat or jti claims and user tokens without sid claim are rejected
+func (m *Manager) Parse(token string) (*Claims, error) {
+	opts := []jwt.ParserOption{jwt.WithExpirationRequired(), jwt.WithIssuedAt(), jwt.WithLeeway(m.cfg.Leeway)}
+
+	var claims Claims
+	_, err := jwt.ParseWithClaims(token, &claims, m.Keyfunc, opts...)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrInvalidToken, err)
+	}
+	if claims.IssuedAt == nil || claims.ID == "" {
+		return nil, fmt.Errorf("%w: missing iat or jti claim", ErrInvalidToken)
+	}
+	if claims.Issuer != m.cfg.Issuer {
+		return nil, fmt.Errorf("%w: %w", ErrInvalidToken, jwt.ErrTokenInvalidIssuer)
+	}
+	if !audienceAllowed(m.cfg.Audience, claims.Audience) {
+		return nil, fmt.Errorf("%w: audience %v is not accepted", ErrInvalidToken, claims.Audience)
+	}
+	if err := claims.validateSubject(); err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrInvalidToken, err)
+	}
+	return &claims, nil
+}
+
+// audienceAllowed reports whether token audience contains any of accepted audiences. If none configured, only tokens
+// without audience are accepted, so tokens issued by token exchange for other services are never accepted here
+func audienceAllowed(accepted []string, audience jwt.ClaimStrings) bool {
+	if len(accepted) == 0 {
+		return len(audience) == 0
+	}
+	for _, aud := range audience {
+		for _, allowed := range accepted {
+			if aud == allowed {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// Keyfunc returns verification key for the token by its kid header, it can be passed to jwt.Parse.
+// Tokens without kid are verified with the active key. Tokens signed by unknown or retired key,
+// or with algorithm not matching the key are rejected
+func (m *Manager) Keyfunc(token *jwt.Token) (interface{}, error) {
+	key := m.keyring.Active()
+	if kid, ok := token.Header["kid"]; ok {
+		kidStr, _ := kid.(string)
+		if key, ok = m.keyring.Key(kidStr); !ok {
+			return nil, fmt.Errorf("unknown key id: %v", kid)
+		}
+	}
+	if token.Method.Alg() != key.Method.Alg() {
+		return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
+	}
+	return key.public, nil
+}
+
+// JWKS returns public keys which can be used to verify tokens. Symmetric keys are never published
+func (m *Manager) JWKS() JWKS {
+	jwks := JWKS{Keys: []JWK{}}
+	for _, key := range m.keyring.Keys() {
+		if jwk, ok := key.JWK(); ok {
+			jwks.Keys = append(jwks.Keys, jwk)
+		}
+	}
+	return jwks
+}
+
+// NewRefreshToken returns a new opaque random refresh token
+func (m *Manager) NewRefreshToken() (string, error) {
+	return RandomString(32)
+}
+
+// RandomString returns url-safe base64 encoded string built from n random bytes
+func RandomString(n int) (string, error) {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("rand.Read: %w", err)
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
 
-	return token.SignedString([]byte(m.secretKey))
+// HashToken returns hex encoded sha256 hash of the token, used to store opaque tokens
+func HashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
 }
@@ -0,0 +1,52 @@
+package auth
+
+import (
+	"errors"
+	"github.com/golang-jwt/jwt/v5"
+	"testing"
+	"time"
+)
+
+func TestManager_ParseIssuerAndAudience(t *testing.T) {
+	key, err := GenerateSigningKey(jwt.SigningMethodES256)
+	if err != nil {
+		t.Fatalf("GenerateSigningKey: %v", err)
+	}
+	keyring := NewKeyring(key, time.Hour)
+	newManager := func(issuer string, audience ...string) *Manager {
+		return NewManager(keyring, ManagerConfig{TokenTTL: time.Minute, Issuer: issuer, Audience: audience})
+	}
+	user := TokenParams{UserID: 1, SessionID: "session"}
+	exchanged := TokenParams{UserID: 1, SessionID: "session", Audience: []string{"orders-service"}}
+
+	tests := []struct {
+		name    string
+		issuer  *Manager
+		params  TokenParams
+		parser  *Manager
+		wantErr bool
+	}{
+		{name: "same issuer and audience", issuer: newManager("https://auth", "api"), params: user, parser: newManager("https://auth", "api")},
+		{name: "another issuer", issuer: newManager("https://other", "api"), params: user, parser: newManager("https://auth", "api"), wantErr: true},
+		{name: "no issuer is not a wildcard", issuer: newManager("https://other"), params: user, parser: newManager(""), wantErr: true},
+		{name: "another audience", issuer: newManager("https://auth", "api"), params: exchanged, parser: newManager("https://auth", "api"), wantErr: true},
+		{name: "no audience configured accepts tokens without aud", issuer: newManager("https://auth"), params: user, parser: newManager("https://auth")},
+		{name: "no audience configured rejects exchanged tokens", issuer: newManager("https://auth"), params: exchanged, parser: newManager("https://auth"), wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			token, err := tt.issuer.NewAccessToken(tt.params)
+			if err != nil {
+				t.Fatalf("NewAccessToken: %v", err)
+			}
+			_, err = tt.parser.Parse(token)
+			if tt.wantErr != (err != nil) {
+				t.Fatalf("got error %v, want error %v", err, tt.wantErr)
+			}
+			if err != nil && !errors.Is(err, ErrInvalidToken) {
+				t.Fatalf("got error %v, want ErrInvalidToken", err)
+			}
+		})
+	}
+}
@@ -0,0 +1,408 @@
+package auth
+
+import (
+	"crypto/ed25519"
+	"crypto/hmac"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/golang-jwt/jwt/v5"
+	"golang.org/x/crypto/blake2b"
+	"golang.org/x/crypto/chacha20"
+	"strings"
+	"time"
+)
+
+const (
+	PasetoV4Public = "v4.public"
+	PasetoV4Local  = "v4.local"
+
+	pasetoLocalKeySize = 32
+)
+
+// PasetoManager issues and verifies PASETO v4 tokens. v4.public tokens are signed with the active Ed25519 key
+// of the keyring and verified by the kid in the footer, v4.local tokens are encrypted with a shared 32 bytes key
+type PasetoManager struct {
+	purpose  string
+	keyring  *Keyring
+	localKey []byte
+	cfg      ManagerConfig
+}
+
+// NewPasetoPublicManager creates manager for v4.public tokens, all keys of the keyring must be Ed25519 keys
+func NewPasetoPublicManager(keyring *Keyring, cfg ManagerConfig) (*PasetoManager, error) {
+	for _, key := range keyring.Keys() {
+		if _, ok := key.public.(ed25519.PublicKey); !ok {
+			return nil, fmt.Errorf("%w: %s requires Ed25519 keys, key %q is %s", ErrUnsupportedKey, PasetoV4Public, key.ID, key.Method.Alg())
+		}
+	}
+	return &PasetoManager{purpose: PasetoV4Public, keyring: keyring, cfg: cfg}, nil
+}
+
+// NewPasetoLocalManager creates manager for v4.local tokens encrypted with 32 bytes key
+func NewPasetoLocalManager(key []byte, cfg ManagerConfig) (*PasetoManager, error) {
+	if len(key) != pasetoLocalKeySize {
+		return nil, fmt.Errorf("%w: %s key must be %d bytes", ErrUnsupportedKey, PasetoV4Local, pasetoLocalKeySize)
+	}
+	return &PasetoManager{purpose: PasetoV4Local, localKey: key, cfg: cfg}, nil
+}
+
+// pasetoClaims are claims in PASETO payload, time claims are RFC 3339 strings
+type pasetoClaims struct {
+	Iss      string        `json:"iss,omitempty"`
+	Sub      string        `json:"sub"`
+	Aud      interface{}   `json:"aud,omitempty"`
+	Exp      string        `json:"exp"`
+	Nbf      string        `json:"nbf"`
+	Iat      string        `json:"iat"`
+	Jti      string        `json:"jti"`
+	Sid      string        `json:"sid,omitempty"`
+	OrgID    uint          `json:"org_id,omitempty"`
+	Roles    []string      `json:"roles,omitempty"`
+	Groups   []string      `json:"groups,omitempty"`
+	Scope    string        `json:"scope,omitempty"`
+	Cnf      *Confirmation `json:"cnf,omitempty"`
+	ClientID string        `json:"client_id,omitempty"`
+	Act      *Actor        `json:"act,omitempty"`
+}
+
+type pasetoFooter struct {
+	Kid string `json:"kid,omitempty"`
+}
+
+func (m *PasetoManager) NewAccessToken(params TokenParams) (string, error) {
+	jti, err := RandomString(16)
+	if err != nil {
+		return "", err
+	}
+	now := time.Now().UTC().Truncate(time.Second)
+	claims := pasetoClaims{
+		Iss:      m.cfg.Issuer,
+		Sub:      params.subject(),
+		Exp:      now.Add(params.ttl(m.cfg.TokenTTL)).Format(time.RFC3339),
+		Nbf:      now.Format(time.RFC3339),
+		Iat:      now.Format(time.RFC3339),
+		Jti:      jti,
+		Sid:      params.SessionID,
+		OrgID:    params.OrgID,
+		Roles:    params.Roles,
+		Groups:   params.Groups,
+		Scope:    params.scope(),
+		Cnf:      params.confirmation(),
+		ClientID: params.ClientID,
+		Act:      params.Actor,
+	}
+	switch audience := params.audience(m.cfg.Audience); len(audience) {
+	case 0:
+	case 1:
+		claims.Aud = audience[0]
+	default:
+		claims.Aud = audience
+	}
+	payload, err := json.Marshal(claims)
+	if err != nil {
+		return "", fmt.Errorf("json.Marshal: %w", err)
+	}
+
+	if m.purpose == PasetoV4Local {
+		return pasetoV4Encrypt(m.localKey, payload, nil, nil)
+	}
+
+	key := m.keyring.Active()
+	footer, err := json.Marshal(pasetoFooter{Kid: key.ID})
+	if err != nil {
+		return "", fmt.Errorf("json.Marshal: %w", err)
+	}
+	return pasetoV4Sign(key.private.(ed25519.PrivateKey), payload, footer, nil), nil
+}
+
+func (m *PasetoManager) NewRefreshToken() (string, error) {
+	return RandomString(32)
+}
+
+// Parse verifies or decrypts token and validates exp, nbf, iat, issuer and audience claims
+func (m *PasetoManager) Parse(token string) (*Claims, error) {
+	var payload []byte
+	var err error
+	if m.purpose == PasetoV4Local {
+		payload, err = pasetoV4Decrypt(m.localKey, token, nil)
+	} else {
+		payload, err = m.verifyPublic(token)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrInvalidToken, err)
+	}
+
+	var raw pasetoClaims
+	if err := json.Unmarshal(payload, &raw); err != nil {
+		return nil, fmt.Errorf("%w: json.Unmarshal: %w", ErrInvalidToken, err)
+	}
+	claims, err := raw.toClaims()
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrInvalidToken, err)
+	}
+	if err := m.validate(claims, time.Now()); err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrInvalidToken, err)
+	}
+	return claims, nil
+}
+
+// JWKS returns public keys of v4.public tokens, nothing is published for v4.local
+func (m *PasetoManager) JWKS() JWKS {
+	jwks := JWKS{Keys: []JWK{}}
+	if m.keyring == nil {
+		return jwks
+	}
+	for _, key := range m.keyring.Keys() {
+		if jwk, ok := key.JWK(); ok {
+			jwks.Keys = append(jwks.Keys, jwk)
+		}
+	}
+	return jwks
+}
+
+func (m *PasetoManager) verifyPublic(token string) ([]byte, error) {
+	footer, err := pasetoFooterOf(token)
+	if err != nil {
+		return nil, err
+	}
+	var f pasetoFooter
+	if err := json.Unmarshal(footer, &f); err != nil {
+		return nil, fmt.Errorf("invalid footer: %w", err)
+	}
+	key, ok := m.keyring.Key(f.Kid)
+	if !ok {
+		return nil, fmt.Errorf("unknown key id: %q", f.Kid)
+	}
+	public, ok := key.public.(ed25519.PublicKey)
+	if !ok {
+		return nil, fmt.Errorf("key %q is not Ed25519 key", f.Kid)
+	}
+	return pasetoV4Verify(public, token, nil)
+}
+
+func (m *PasetoManager) validate(claims *Claims, now time.Time) error {
+	leeway := m.cfg.Leeway
+	switch {
+	case claims.ExpiresAt == nil || claims.IssuedAt == nil || claims.NotBefore == nil:
+		return errors.New("missing exp, iat or nbf claim")
+	case now.After(claims.ExpiresAt.Add(leeway)):
+		return jwt.ErrTokenExpired
+	case now.Before(claims.NotBefore.Add(-leeway)):
+		return jwt.ErrTokenNotValidYet
+	case now.Before(claims.IssuedAt.Add(-leeway)):
+		return jwt.ErrTokenUsedBeforeIssued
+	case claims.Issuer != m.cfg.Issuer:
+		return jwt.ErrTokenInvalidIssuer
+	case claims.ID == "":
+		return errors.New("missing jti claim")
+	}
+	if !audienceAllowed(m.cfg.Audience, claims.Audience) {
+		return jwt.ErrTokenInvalidAudience
+	}
+	return claims.validateSubject()
+}
+
+func (c pasetoClaims) toClaims() (*Claims, error) {
+	claims := &Claims{
+		RegisteredClaims: jwt.RegisteredClaims{Issuer: c.Iss, Subject: c.Sub, ID: c.Jti},
+		SessionID:        c.Sid,
+		OrgID:            c.OrgID,
+		Roles:            c.Roles,
+		Groups:           c.Groups,
+		Scope:            c.Scope,
+		Confirmation:     c.Cnf,
+		ClientID:         c.ClientID,
+		Actor:            c.Act,
+	}
+	switch aud := c.Aud.(type) {
+	case nil:
+	case string:
+		claims.Audience = jwt.ClaimStrings{aud}
+	case []interface{}:
+		for _, a := range aud {
+			s, ok := a.(string)
+			if !ok {
+				return nil, errors.New("invalid aud claim")
+			}
+			claims.Audience = append(claims.Audience, s)
+		}
+	default:
+		return nil, errors.New("invalid aud claim")
+	}
+
+	for _, t := range []struct {
+		value string
+		dest  **jwt.NumericDate
+	}{{c.Exp, &claims.ExpiresAt}, {c.Nbf, &claims.NotBefore}, {c.Iat, &claims.IssuedAt}} {
+		if t.value == "" {
+			continue
+		}
+		parsed, err := time.Parse(time.RFC3339, t.value)
+		if err != nil {
+			return nil, fmt.Errorf("invalid time claim: %w", err)
+		}
+		*t.dest = jwt.NewNumericDate(parsed)
+	}
+	return claims, nil
+}
+
+// pasetoV4Sign returns v4.public token (https://github.com/paseto-standard/paseto-spec/blob/master/docs/01-Protocol-Versions/Version4.md).
+// implicit is the implicit assertion, it is authenticated but not put to the token
+func pasetoV4Sign(key ed25519.PrivateKey, message, footer, implicit []byte) string {
+	header := []byte(PasetoV4Public + ".")
+	signature := ed25519.Sign(key, pae(header, message, footer, implicit))
+	return pasetoEncode(header, append(message, signature...), footer)
+}
+
+func pasetoV4Verify(key ed25519.PublicKey, token string, implicit []byte) ([]byte, error) {
+	header := []byte(PasetoV4Public + ".")
+	body, footer, err := pasetoDecode(header, token)
+	if err != nil {
+		return nil, err
+	}
+	if len(body) < ed25519.SignatureSize {
+		return nil, errors.New("token is too short")
+	}
+	message, signature := body[:len(body)-ed25519.SignatureSize], body[len(body)-ed25519.SignatureSize:]
+	if !ed25519.Verify(key, pae(header, message, footer, implicit), signature) {
+		return nil, errors.New("invalid token signature")
+	}
+	return message, nil
+}
+
+// pasetoV4Encrypt returns v4.local token encrypted with a random nonce
+func pasetoV4Encrypt(key, message, footer, implicit []byte) (string, error) {
+	nonce := make([]byte, 32)
+	if _, err := rand.Read(nonce); err != nil {
+		return "", fmt.Errorf("rand.Read: %w", err)
+	}
+	return pasetoV4EncryptWithNonce(key, nonce, message, footer, implicit)
+}
+
+func pasetoV4EncryptWithNonce(key, nonce, message, footer, implicit []byte) (string, error) {
+	header := []byte(PasetoV4Local + ".")
+	encKey, nonce2, authKey := pasetoV4SplitKey(key, nonce)
+	cipher, err := chacha20.NewUnauthenticatedCipher(encKey, nonce2)
+	if err != nil {
+		return "", fmt.Errorf("chacha20.NewUnauthenticatedCipher: %w", err)
+	}
+	ciphertext := make([]byte, len(message))
+	cipher.XORKeyStream(ciphertext, message)
+
+	tag := blake2bMAC(authKey, pae(header, nonce, ciphertext, footer, implicit))
+	body := append(append(append([]byte{}, nonce...), ciphertext...), tag...)
+	return pasetoEncode(header, body, footer), nil
+}
+
+func pasetoV4Decrypt(key []byte, token string, implicit []byte) ([]byte, error) {
+	header := []byte(PasetoV4Local + ".")
+	body, footer, err := pasetoDecode(header, token)
+	if err != nil {
+		return nil, err
+	}
+	if len(body) < 64 {
+		return nil, errors.New("token is too short")
+	}
+	nonce, ciphertext, tag := body[:32], body[32:len(body)-32], body[len(body)-32:]
+
+	encKey, nonce2, authKey := pasetoV4SplitKey(key, nonce)
+	if !hmac.Equal(tag, blake2bMAC(authKey, pae(header, nonce, ciphertext, footer, implicit))) {
+		return nil, errors.New("invalid token tag")
+	}
+	cipher, err := chacha20.NewUnauthenticatedCipher(encKey, nonce2)
+	if err != nil {
+		return nil, fmt.Errorf("chacha20.NewUnauthenticatedCipher: %w", err)
+	}
+	message := make([]byte, len(ciphertext))
+	cipher.XORKeyStream(message, ciphertext)
+	return message, nil
+}
+
+// pasetoV4SplitKey derives encryption key, XChaCha20 nonce and authentication key from the key and token nonce
+func pasetoV4SplitKey(key, nonce []byte) (encKey, nonce2, authKey []byte) {
+	tmp := blake2bHash(56, key, append([]byte("paseto-encryption-key"), nonce...))
+	return tmp[:32], tmp[32:], blake2bMAC(key, append([]byte("paseto-auth-key-for-aead"), nonce...))
+}
+
+func blake2bMAC(key, message []byte) []byte {
+	return blake2bHash(32, key, message)
+}
+
+func blake2bHash(size int, key, message []byte) []byte {
+	h, err := blake2b.New(size, key)
+	if err != nil {
+		// size and key length are constant and valid
+		panic(err)
+	}
+	h.Write(message)
+	return h.Sum(nil)
+}
+
+// pae is PASETO pre-authentication encoding
+func pae(pieces ...[]byte) []byte {
+	le64 := func(n int) []byte {
+		b := make([]byte, 8)
+		binary.LittleEndian.PutUint64(b, uint64(n)&(1<<63-1))
+		return b
+	}
+	out := le64(len(pieces))
+	for _, piece := range pieces {
+		out = append(out, le64(len(piece))...)
+		out = append(out, piece...)
+	}
+	return out
+}
+
+func pasetoEncode(header, body, footer []byte) string {
+	token := string(header) + base64.RawURLEncoding.EncodeToString(body)
+	if len(footer) > 0 {
+		token += "." + base64.RawURLEncoding.EncodeToString(footer)
+	}
+	return token
+}
+
+func pasetoDecode(header []byte, token string) (body, footer []byte, err error) {
+	if !strings.HasPrefix(token, string(header)) {
+		return nil, nil, errors.New("unexpected token header")
+	}
+	parts := strings.Split(strings.TrimPrefix(token, string(header)), ".")
+	if len(parts) > 2 {
+		return nil, nil, errors.New("malformed token")
+	}
+	body, err = pasetoDecodeBase64(parts[0])
+	if err != nil {
+		return nil, nil, fmt.Errorf("invalid token body: %w", err)
+	}
+	if len(parts) == 2 {
+		footer, err = pasetoDecodeBase64(parts[1])
+		if err != nil {
+			return nil, nil, fmt.Errorf("invalid token footer: %w", err)
+		}
+	}
+	return body, footer, nil
+}
+
+func pasetoFooterOf(token string) ([]byte, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 4 {
+		return nil, errors.New("token has no footer")
+	}
+	footer, err := pasetoDecodeBase64(parts[3])
+	if err != nil {
+		return nil, fmt.Errorf("invalid token footer: %w", err)
+	}
+	return footer, nil
+}
+
+// pasetoDecodeBase64 decodes only canonical unpadded base64url, so a token has exactly one valid encoding
+func pasetoDecodeBase64(s string) ([]byte, error) {
+	// Strict still skips new lines
+	if strings.ContainsAny(s, "\r\n") {
+		return nil, errors.New("illegal new line in base64 data")
+	}
+	return base64.RawURLEncoding.Strict().DecodeString(s)
+}
@@ -0,0 +1,168 @@
+package auth
+
+import (
+	"crypto/ed25519"
+	"encoding/hex"
+	"encoding/json"
+	"os"
+	"strings"
+	"testing"
+)
+
+// pasetoVector is a test vector of https://github.com/paseto-standard/test-vectors,
+// testdata/paseto_v4.json is their v4.json
+type pasetoVector struct {
+	Name       string  `json:"name"`
+	ExpectFail bool    `json:"expect-fail"`
+	Key        string  `json:"key"`
+	Nonce      string  `json:"nonce"`
+	PublicKey  string  `json:"public-key"`
+	SecretKey  string  `json:"secret-key"`
+	Token      string  `json:"token"`
+	Payload    *string `json:"payload"`
+	Footer     string  `json:"footer"`
+	Implicit   string  `json:"implicit-assertion"`
+}
+
+func TestPasetoV4Vectors(t *testing.T) {
+	data, err := os.ReadFile("testdata/paseto_v4.json")
+	if err != nil {
+		t.Fatalf("os.ReadFile: %v", err)
+	}
+	var vectors struct {
+		Tests []pasetoVector `json:"tests"`
+	}
+	if err := json.Unmarshal(data, &vectors); err != nil {
+		t.Fatalf("json.Unmarshal: %v", err)
+	}
+	if len(vectors.Tests) == 0 {
+		t.Fatal("no test vectors")
+	}
+
+	for _, v := range vectors.Tests {
+		t.Run(v.Name, func(t *testing.T) {
+			footer, implicit := []byte(v.Footer), []byte(v.Implicit)
+
+			var payload []byte
+			var err error
+			if v.Key != "" {
+				payload, err = pasetoV4Decrypt(mustHex(t, v.Key), v.Token, implicit)
+			} else {
+				payload, err = pasetoV4Verify(ed25519.PublicKey(mustHex(t, v.PublicKey)), v.Token, implicit)
+			}
+			if err == nil && string(tokenFooter(t, v.Token)) != v.Footer {
+				err = errFooterMismatch
+			}
+
+			if v.ExpectFail {
+				if err == nil {
+					t.Fatalf("token was accepted, payload %s", payload)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("token was rejected: %v", err)
+			}
+			if string(payload) != *v.Payload {
+				t.Fatalf("got payload %s, want %s", payload, *v.Payload)
+			}
+
+			// encryption with the vector nonce and signing are deterministic
+			var token string
+			if v.Key != "" {
+				token, err = pasetoV4EncryptWithNonce(mustHex(t, v.Key), mustHex(t, v.Nonce), []byte(*v.Payload), footer, implicit)
+				if err != nil {
+					t.Fatalf("pasetoV4EncryptWithNonce: %v", err)
+				}
+			} else {
+				token = pasetoV4Sign(ed25519.PrivateKey(mustHex(t, v.SecretKey)), []byte(*v.Payload), footer, implicit)
+			}
+			if token != v.Token {
+				t.Fatalf("got token %s, want %s", token, v.Token)
+			}
+		})
+	}
+}
+
+func TestPasetoV4RejectsTampering(t *testing.T) {
+	key := make([]byte, pasetoLocalKeySize)
+	token, err := pasetoV4Encrypt(key, []byte(`{"sub":"1"}`), []byte("footer"), []byte("implicit"))
+	if err != nil {
+		t.Fatalf("pasetoV4Encrypt: %v", err)
+	}
+	public, private, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		t.Fatalf("ed25519.GenerateKey: %v", err)
+	}
+	signed := pasetoV4Sign(private, []byte(`{"sub":"1"}`), []byte("footer"), []byte("implicit"))
+
+	tests := []struct {
+		name  string
+		parse func() error
+	}{
+		{name: "local wrong implicit assertion", parse: func() error {
+			_, err := pasetoV4Decrypt(key, token, []byte("other"))
+			return err
+		}},
+		{name: "local replaced footer", parse: func() error {
+			_, err := pasetoV4Decrypt(key, replaceFooter(token, "other"), []byte("implicit"))
+			return err
+		}},
+		{name: "local wrong key", parse: func() error {
+			_, err := pasetoV4Decrypt(append(key[:len(key)-1:len(key)-1], 1), token, []byte("implicit"))
+			return err
+		}},
+		{name: "public wrong implicit assertion", parse: func() error {
+			_, err := pasetoV4Verify(public, signed, []byte("other"))
+			return err
+		}},
+		{name: "public replaced footer", parse: func() error {
+			_, err := pasetoV4Verify(public, replaceFooter(signed, "other"), []byte("implicit"))
+			return err
+		}},
+		{name: "public token as local", parse: func() error {
+			_, err := pasetoV4Decrypt(key, signed, []byte("implicit"))
+			return err
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.parse(); err == nil {
+				t.Fatal("token was accepted")
+			}
+		})
+	}
+}
+
+type pasetoTestError string
+
+func (e pasetoTestError) Error() string { return string(e) }
+
+const errFooterMismatch = pasetoTestError("footer does not match")
+
+func mustHex(t *testing.T, s string) []byte {
+	t.Helper()
+	b, err := hex.DecodeString(s)
+	if err != nil {
+		t.Fatalf("hex.DecodeString: %v", err)
+	}
+	return b
+}
+
+func tokenFooter(t *testing.T, token string) []byte {
+	t.Helper()
+	parts := strings.Split(token, ".")
+	if len(parts) < 4 {
+		return nil
+	}
+	footer, err := pasetoFooterOf(token)
+	if err != nil {
+		t.Fatalf("pasetoFooterOf: %v", err)
+	}
+	return footer
+}
+
+func replaceFooter(token, footer string) string {
+	parts := strings.Split(token, ".")
+	return strings.Join(parts[:3], ".") + "." + pasetoEncode(nil, []byte(footer), nil)
+}
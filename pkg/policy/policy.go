@@ -0,0 +1,247 @@
+package policy
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+type Effect string
+
+const (
+	Allow Effect = "allow"
+	Deny  Effect = "deny"
+)
+
+var ErrInvalidPolicy = errors.New("invalid policy")
+
+// Policy is a set of rules deciding whether subject may perform action on resource.
+// Deny rules override allow rules, requests matched by no rule are denied
+type Policy struct {
+	Rules []Rule `yaml:"rules"`
+}
+
+// Rule applies its effect to requests which action and resource match one of its patterns and which subject
+// satisfies all conditions. Patterns may contain * wildcards, empty resources match every resource
+type Rule struct {
+	ID          string     `yaml:"id"`
+	Description string     `yaml:"description"`
+	Effect      Effect     `yaml:"effect"`
+	Actions     []string   `yaml:"actions"`
+	Resources   []string   `yaml:"resources"`
+	When        Conditions `yaml:"when"`
+}
+
+// Conditions on subject attributes, empty conditions are satisfied by every subject
+type Conditions struct {
+	// Roles are satisfied if subject has any of the roles
+	Roles []string `yaml:"roles"`
+	// Groups are satisfied if subject is a direct or transitive member of any of the groups
+	Groups []string `yaml:"groups"`
+	// Orgs are satisfied if subject acts in any of the organizations
+	Orgs []string `yaml:"orgs"`
+	// EmailDomains are satisfied if subject email belongs to any of the domains
+	EmailDomains  []string `yaml:"email_domains"`
+	EmailVerified *bool    `yaml:"email_verified"`
+}
+
+// Subject is the user attributes rules are evaluated over
+type Subject struct {
+	ID            string   `json:"id"`
+	Email         string   `json:"email"`
+	Roles         []string `json:"roles"`
+	Groups        []string `json:"groups,omitempty"`
+	Org           string   `json:"org,omitempty"`
+	EmailVerified bool     `json:"email_verified"`
+}
+
+type Request struct {
+	Subject  Subject
+	Action   string
+	Resource string
+}
+
+// Decision is the result of policy evaluation. Rule is id of the rule which decided it, empty if no rule matched
+type Decision struct {
+	Allowed bool   `json:"allowed"`
+	Rule    string `json:"rule,omitempty"`
+	Reason  string `json:"reason"`
+	// Trace explains evaluation of every rule, it is filled only by Explain
+	Trace []RuleResult `json:"trace,omitempty"`
+}
+
+type RuleResult struct {
+	Rule    string `json:"rule"`
+	Effect  Effect `json:"effect"`
+	Matched bool   `json:"matched"`
+	Reason  string `json:"reason"`
+}
+
+// Load reads policy from the YAML file
+func Load(path string) (*Policy, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return Parse(data)
+}
+
+// Parse parses and validates YAML policy
+func Parse(data []byte) (*Policy, error) {
+	var p Policy
+	if err := yaml.Unmarshal(data, &p); err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrInvalidPolicy, err)
+	}
+	if err := p.Validate(); err != nil {
+		return nil, err
+	}
+	return &p, nil
+}
+
+// Validate checks that rules have unique ids, known effects and actions
+func (p *Policy) Validate() error {
+	ids := make(map[string]bool, len(p.Rules))
+	for i, rule := range p.Rules {
+		switch {
+		case rule.ID == "":
+			return fmt.Errorf("%w: rule %d has no id", ErrInvalidPolicy, i)
+		case ids[rule.ID]:
+			return fmt.Errorf("%w: duplicate rule id %q", ErrInvalidPolicy, rule.ID)
+		case rule.Effect != Allow && rule.Effect != Deny:
+			return fmt.Errorf("%w: rule %q has unknown effect %q", ErrInvalidPolicy, rule.ID, rule.Effect)
+		case len(rule.Actions) == 0:
+			return fmt.Errorf("%w: rule %q has no actions", ErrInvalidPolicy, rule.ID)
+		}
+		ids[rule.ID] = true
+	}
+	return nil
+}
+
+// Evaluate decides the request
+func (p *Policy) Evaluate(req Request) Decision {
+	return p.evaluate(req, false)
+}
+
+// Explain decides the request like Evaluate and reports how every rule was evaluated
+func (p *Policy) Explain(req Request) Decision {
+	return p.evaluate(req, true)
+}
+
+func (p *Policy) evaluate(req Request, explain bool) Decision {
+	var allowedBy, deniedBy *Rule
+	var trace []RuleResult
+	for i := range p.Rules {
+		rule := &p.Rules[i]
+		matched, reason := rule.match(req)
+		if explain {
+			trace = append(trace, RuleResult{Rule: rule.ID, Effect: rule.Effect, Matched: matched, Reason: reason})
+		}
+		if !matched {
+			continue
+		}
+		if rule.Effect == Deny && deniedBy == nil {
+			deniedBy = rule
+			if !explain {
+				break
+			}
+		}
+		if rule.Effect == Allow && allowedBy == nil {
+			allowedBy = rule
+		}
+	}
+
+	decision := Decision{Reason: "no rule matched", Trace: trace}
+	switch {
+	case deniedBy != nil:
+		decision.Rule, decision.Reason = deniedBy.ID, "denied by rule"
+	case allowedBy != nil:
+		decision.Allowed, decision.Rule, decision.Reason = true, allowedBy.ID, "allowed by rule"
+	}
+	return decision
+}
+
+// match reports whether rule applies to the request and why
+func (r *Rule) match(req Request) (bool, string) {
+	if !matchAny(r.Actions, req.Action) {
+		return false, "action does not match"
+	}
+	if len(r.Resources) > 0 && !matchAny(r.Resources, req.Resource) {
+		return false, "resource does not match"
+	}
+
+	subject := req.Subject
+	if len(r.When.Roles) > 0 && !intersects(r.When.Roles, subject.Roles) {
+		return false, "subject has none of the roles"
+	}
+	if len(r.When.Groups) > 0 && !intersects(r.When.Groups, subject.Groups) {
+		return false, "subject is in none of the groups"
+	}
+	if len(r.When.Orgs) > 0 && !contains(r.When.Orgs, subject.Org) {
+		return false, "subject is not in the organizations"
+	}
+	if len(r.When.EmailDomains) > 0 && !contains(r.When.EmailDomains, emailDomain(subject.Email)) {
+		return false, "email domain does not match"
+	}
+	if r.When.EmailVerified != nil && *r.When.EmailVerified != subject.EmailVerified {
+		return false, "email verification does not match"
+	}
+	return true, "all conditions matched"
+}
+
+func matchAny(patterns []string, value string) bool {
+	for _, pattern := range patterns {
+		if wildcardMatch(pattern, value) {
+			return true
+		}
+	}
+	return false
+}
+
+// wildcardMatch matches value against pattern where * stands for any, possibly empty, sequence of characters
+func wildcardMatch(pattern, value string) bool {
+	parts := strings.Split(pattern, "*")
+	if len(parts) == 1 {
+		return pattern == value
+	}
+	if !strings.HasPrefix(value, parts[0]) {
+		return false
+	}
+	value = value[len(parts[0]):]
+	for _, part := range parts[1 : len(parts)-1] {
+		i := strings.Index(value, part)
+		if i < 0 {
+			return false
+		}
+		value = value[i+len(part):]
+	}
+	return strings.HasSuffix(value, parts[len(parts)-1])
+}
+
+func intersects(a, b []string) bool {
+	for _, v := range b {
+		if contains(a, v) {
+			return true
+		}
+	}
+	return false
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+func emailDomain(email string) string {
+	i := strings.LastIndex(email, "@")
+	if i < 0 {
+		return ""
+	}
+	return strings.ToLower(email[i+1:])
+}
@@ -0,0 +1,181 @@
+package policy
+
+import (
+	"errors"
+	"testing"
+)
+
+const testPolicy = `
+rules:
+  - id: admins
+    effect: allow
+    actions: ["*"]
+    when:
+      roles: [admin]
+  - id: read-own-org
+    effect: allow
+    actions: ["users:read", "groups:read"]
+    resources: ["org/*/users/*", "org/*/groups/*"]
+    when:
+      orgs: [acme]
+  - id: staff-reports
+    effect: allow
+    actions: ["reports:*"]
+    when:
+      groups: [staff]
+      email_domains: [acme.com]
+      email_verified: true
+  - id: no-unverified-delete
+    effect: deny
+    actions: ["*:delete"]
+    when:
+      email_verified: false
+`
+
+func TestPolicy_Evaluate(t *testing.T) {
+	p, err := Parse([]byte(testPolicy))
+	if err != nil {
+		t.Fatalf("Parse: %v", err)
+	}
+	admin := Subject{ID: "1", Email: "admin@acme.com", Roles: []string{"admin"}, EmailVerified: true}
+	member := Subject{ID: "2", Email: "member@Acme.com", Roles: []string{"user"}, Groups: []string{"staff"}, Org: "acme", EmailVerified: true}
+
+	tests := []struct {
+		name        string
+		req         Request
+		wantAllowed bool
+		wantRule    string
+	}{
+		{name: "allowed by role", req: Request{Subject: admin, Action: "users:delete"}, wantAllowed: true, wantRule: "admins"},
+		{
+			name:     "deny overrides allow",
+			req:      Request{Subject: Subject{Roles: []string{"admin"}}, Action: "users:delete"},
+			wantRule: "no-unverified-delete",
+		},
+		{name: "default deny", req: Request{Subject: Subject{Roles: []string{"user"}, EmailVerified: true}, Action: "users:read"}},
+		{
+			name:        "allowed by org and resource",
+			req:         Request{Subject: member, Action: "users:read", Resource: "org/1/users/2"},
+			wantAllowed: true,
+			wantRule:    "read-own-org",
+		},
+		{name: "resource does not match", req: Request{Subject: member, Action: "users:read", Resource: "org/1/roles/2"}},
+		{
+			name: "org does not match",
+			req:  Request{Subject: Subject{Org: "other", EmailVerified: true}, Action: "users:read", Resource: "org/1/users/2"},
+		},
+		{
+			name:        "allowed by group, email domain and verification",
+			req:         Request{Subject: member, Action: "reports:export"},
+			wantAllowed: true,
+			wantRule:    "staff-reports",
+		},
+		{
+			name: "email domain does not match",
+			req:  Request{Subject: Subject{Email: "member@other.com", Groups: []string{"staff"}, EmailVerified: true}, Action: "reports:export"},
+		},
+		{
+			name: "email is not verified",
+			req:  Request{Subject: Subject{Email: "member@acme.com", Groups: []string{"staff"}}, Action: "reports:export"},
+		},
+		{
+			name: "subject is not in the group",
+			req:  Request{Subject: Subject{Email: "member@acme.com", EmailVerified: true}, Action: "reports:export"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			decision := p.Evaluate(tt.req)
+			if decision.Allowed != tt.wantAllowed || decision.Rule != tt.wantRule {
+				t.Fatalf("got allowed %v by rule %q, want %v by rule %q", decision.Allowed, decision.Rule, tt.wantAllowed, tt.wantRule)
+			}
+			if decision.Trace != nil {
+				t.Fatalf("Evaluate filled trace: %v", decision.Trace)
+			}
+		})
+	}
+}
+
+func TestPolicy_Explain(t *testing.T) {
+	p, err := Parse([]byte(testPolicy))
+	if err != nil {
+		t.Fatalf("Parse: %v", err)
+	}
+	decision := p.Explain(Request{Subject: Subject{Roles: []string{"admin"}}, Action: "users:delete"})
+	if decision.Allowed || decision.Rule != "no-unverified-delete" || decision.Reason != "denied by rule" {
+		t.Fatalf("got decision %+v, want denied by no-unverified-delete", decision)
+	}
+
+	// every rule is reported, even after the deciding deny rule
+	want := []RuleResult{
+		{Rule: "admins", Effect: Allow, Matched: true, Reason: "all conditions matched"},
+		{Rule: "read-own-org", Effect: Allow, Matched: false, Reason: "action does not match"},
+		{Rule: "staff-reports", Effect: Allow, Matched: false, Reason: "action does not match"},
+		{Rule: "no-unverified-delete", Effect: Deny, Matched: true, Reason: "all conditions matched"},
+	}
+	if len(decision.Trace) != len(want) {
+		t.Fatalf("got %d trace entries, want %d: %+v", len(decision.Trace), len(want), decision.Trace)
+	}
+	for i := range want {
+		if decision.Trace[i] != want[i] {
+			t.Fatalf("trace entry %d: got %+v, want %+v", i, decision.Trace[i], want[i])
+		}
+	}
+
+	decision = p.Explain(Request{Subject: Subject{EmailVerified: true}, Action: "users:read", Resource: "org/1/users/2"})
+	if decision.Allowed || decision.Rule != "" || decision.Reason != "no rule matched" {
+		t.Fatalf("got decision %+v, want denied by default", decision)
+	}
+	if got := decision.Trace[1]; got.Matched || got.Reason != "subject is not in the organizations" {
+		t.Fatalf("got trace entry %+v, want not matched organization", got)
+	}
+}
+
+func TestWildcardMatch(t *testing.T) {
+	tests := []struct {
+		pattern string
+		value   string
+		want    bool
+	}{
+		{pattern: "users:read", value: "users:read", want: true},
+		{pattern: "users:read", value: "users:write"},
+		{pattern: "*", value: "", want: true},
+		{pattern: "*", value: "anything", want: true},
+		{pattern: "users:*", value: "users:", want: true},
+		{pattern: "users:*", value: "users:read", want: true},
+		{pattern: "users:*", value: "roles:read"},
+		{pattern: "*:delete", value: "users:delete", want: true},
+		{pattern: "*:delete", value: "users:delete:all"},
+		{pattern: "org/*/users/*", value: "org/1/users/2", want: true},
+		{pattern: "org/*/users/*", value: "org/1/groups/2"},
+		{pattern: "a*a", value: "a"},
+		{pattern: "a*a", value: "aa", want: true},
+		{pattern: "a*b*c", value: "abbc", want: true},
+		{pattern: "a*b*c", value: "acb"},
+	}
+	for _, tt := range tests {
+		if got := wildcardMatch(tt.pattern, tt.value); got != tt.want {
+			t.Errorf("wildcardMatch(%q, %q) = %v, want %v", tt.pattern, tt.value, got, tt.want)
+		}
+	}
+}
+
+func TestParse_Validates(t *testing.T) {
+	tests := []struct {
+		name   string
+		policy string
+	}{
+		{name: "rule without id", policy: "rules: [{effect: allow, actions: [a]}]"},
+		{name: "duplicate id", policy: "rules: [{id: r, effect: allow, actions: [a]}, {id: r, effect: deny, actions: [b]}]"},
+		{name: "unknown effect", policy: "rules: [{id: r, effect: permit, actions: [a]}]"},
+		{name: "rule without actions", policy: "rules: [{id: r, effect: allow}]"},
+		{name: "not yaml", policy: "rules: {"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := Parse([]byte(tt.policy)); !errors.Is(err, ErrInvalidPolicy) {
+				t.Fatalf("got error %v, want ErrInvalidPolicy", err)
+			}
+		})
+	}
+}